@@ -0,0 +1,37 @@
+package mongodbstore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// recordAccess writes the access time of the loaded document in the
+// background unless it was recorded less than AccessInterval ago. In
+// write-behind mode the write is queued with the buffered refreshes.
+func (m *MongoDBStore) recordAccess(s *Session, name string, now time.Time) {
+	if m.AccessInterval <= 0 || now.Sub(s.LastAccessed) < m.AccessInterval {
+		return
+	}
+	m.cache.accessed(s.ID, now)
+
+	if wb := m.writeBehind; wb != nil && wb.touch(s.ID, touch{lastAccessed: now}) {
+		return
+	}
+
+	go func() {
+		filter := m.liveFilter(s.ID)
+		update := bson.D{{Key: "$max", Value: bson.D{{Key: "lastAccessed", Value: now}}}}
+		ctx := m.profilerContext(context.Background(), name)
+		err := m.observe(ctx, "updateOne", filter, func(ctx context.Context) (string, error) {
+			res, err := m.collection.UpdateOne(ctx, filter, update)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("matched=%d modified=%d", res.MatchedCount, res.ModifiedCount), nil
+		})
+		m.reportError(ctx, "record access", err)
+	}()
+}
@@ -0,0 +1,66 @@
+package mongodbstore
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// GetString returns the string stored in the session under key, or def if
+// the key is missing or holds another type.
+func GetString(session *sessions.Session, key interface{}, def string) string {
+	if s, ok := session.Values[key].(string); ok {
+		return s
+	}
+	return def
+}
+
+// GetInt returns the integer stored in the session under key, or def if the
+// key is missing or doesn't hold an integer. Any integer type is accepted.
+func GetInt(session *sessions.Session, key interface{}, def int) int {
+	v := reflect.ValueOf(session.Values[key])
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(v.Uint())
+	}
+	return def
+}
+
+// GetBool returns the bool stored in the session under key, or def if the
+// key is missing or holds another type.
+func GetBool(session *sessions.Session, key interface{}, def bool) bool {
+	if b, ok := session.Values[key].(bool); ok {
+		return b
+	}
+	return def
+}
+
+// GetTime returns the time stored in the session under key, or def if the
+// key is missing or holds another type.
+func GetTime(session *sessions.Session, key interface{}, def time.Time) time.Time {
+	if t, ok := session.Values[key].(time.Time); ok {
+		return t
+	}
+	return def
+}
+
+// GetAs returns the value held in the session under key as a T and reports
+// whether it is one. The zero T is returned if the key is missing or holds
+// another type. A *T value is dereferenced.
+//
+//	cart, ok := mongodbstore.GetAs[Cart](session, "cart")
+func GetAs[T any](session *sessions.Session, key interface{}) (T, bool) {
+	switch v := session.Values[key].(type) {
+	case T:
+		return v, true
+	case *T:
+		if v != nil {
+			return *v, true
+		}
+	}
+	var zero T
+	return zero, false
+}
@@ -0,0 +1,44 @@
+package mongodbstore
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+func TestAccessors(t *testing.T) {
+	session := sessions.NewSession(nil, "session-key")
+	now := time.Now()
+	session.Values["name"] = "john"
+	session.Values["visits"] = int64(7)
+	session.Values["at"] = now
+	session.Values["flash"] = &FlashMessage{42, "foo"}
+
+	if s := GetString(session, "name", "anonymous"); s != "john" {
+		t.Errorf("Expected john; Got %q", s)
+	}
+	if s := GetString(session, "visits", "none"); s != "none" {
+		t.Errorf("Expected default for wrong type; Got %q", s)
+	}
+	if n := GetInt(session, "visits", 0); n != 7 {
+		t.Errorf("Expected 7 visits; Got %v", n)
+	}
+	if n := GetInt(session, "missing", -1); n != -1 {
+		t.Errorf("Expected default for missing key; Got %v", n)
+	}
+	if at := GetTime(session, "at", time.Time{}); !at.Equal(now) {
+		t.Errorf("Expected %v; Got %v", now, at)
+	}
+
+	if flash, ok := GetAs[FlashMessage](session, "flash"); !ok || flash.Type != 42 {
+		t.Errorf("Expected flash message; Got %v", flash)
+	}
+	if _, ok := GetAs[int](session, "name"); ok {
+		t.Errorf("Expected string not to be returned as int")
+	}
+	if s, ok := GetAs[fmt.Stringer](session, "at"); !ok || s == nil {
+		t.Errorf("Expected the time as a fmt.Stringer")
+	}
+}
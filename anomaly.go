@@ -0,0 +1,223 @@
+package mongodbstore
+
+import (
+	"encoding/gob"
+	"math"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// activityKey is the session value holding the activity the AnomalyDetector
+// compares requests with.
+const activityKey = "mongodbstore.activity"
+
+func init() {
+	gob.Register(activity{})
+}
+
+// Location is where an address is located, as far as a GeoResolver knows.
+// Zero fields are unknown.
+type Location struct {
+	Country   string
+	ASN       uint32
+	Latitude  float64
+	Longitude float64
+}
+
+// GeoResolver locates client addresses, typically with a GeoIP database.
+type GeoResolver interface {
+	Resolve(ip net.IP) (Location, error)
+}
+
+// AnomalyKind is the kind of suspicious activity detected on a session.
+type AnomalyKind int
+
+// Kinds of anomalies.
+const (
+	// AnomalyNewCountry is a request from another country than the
+	// previous one.
+	AnomalyNewCountry AnomalyKind = iota + 1
+	// AnomalyNewASN is a request from another network than the previous
+	// one.
+	AnomalyNewASN
+	// AnomalyImpossibleTravel is a request from a location too far from the
+	// previous one to be reached in the elapsed time.
+	AnomalyImpossibleTravel
+	// AnomalyTooManyIPs is a request from one address too many within the
+	// window.
+	AnomalyTooManyIPs
+)
+
+func (k AnomalyKind) String() string {
+	switch k {
+	case AnomalyNewCountry:
+		return "new country"
+	case AnomalyNewASN:
+		return "new ASN"
+	case AnomalyImpossibleTravel:
+		return "impossible travel"
+	case AnomalyTooManyIPs:
+		return "too many IPs"
+	}
+	return "unknown"
+}
+
+// Anomaly describes suspicious activity detected on a session.
+type Anomaly struct {
+	Kind AnomalyKind
+	// IP is the address of the request.
+	IP net.IP
+	// Previous and Current are the locations of the previous address and of
+	// IP, if a GeoResolver is set.
+	Previous, Current Location
+	// Elapsed is the time since the session was last seen at Previous.
+	Elapsed time.Duration
+	// IPs is the number of distinct addresses seen within the window.
+	IPs int
+}
+
+// AnomalyDetector detects suspicious use of sessions from the addresses of
+// the requests loading them, so that applications can force
+// re-authentication or raise an alert.
+type AnomalyDetector struct {
+	// Resolver, if set, locates addresses for the country, ASN and travel
+	// checks. It is only asked about addresses new to a session.
+	Resolver GeoResolver
+	// MaxSpeed is the fastest plausible travel in km/h, 1000 by default.
+	MaxSpeed float64
+	// MaxIPs, if positive, is the number of distinct addresses a session may
+	// be used from within Window, an hour by default.
+	MaxIPs int
+	Window time.Duration
+	// OnAnomaly is called with the anomalies detected on a request, before
+	// New returns the session.
+	OnAnomaly func(r *http.Request, session *sessions.Session, anomalies []Anomaly)
+}
+
+// activity is what the AnomalyDetector remembers of a session: where and when
+// it was last seen, and when it was last used from each address. Addresses
+// are keyed by their HMAC with IPHashKey so the session data holds no
+// addresses.
+type activity struct {
+	Location Location
+	Seen     time.Time
+	IPs      map[string]time.Time
+}
+
+// activityRefresh is how often the time a session was last seen at its
+// location is updated, bounding the saves it causes.
+const activityRefresh = 10 * time.Minute
+
+// detectAnomalies compares the request with the recorded activity of a loaded
+// session, updates the activity and calls OnAnomaly with the anomalies found.
+func (m *MongoDBStore) detectAnomalies(r *http.Request, session *sessions.Session) {
+	d := m.Anomalies
+	if d == nil || session.IsNew {
+		return
+	}
+	ip := clientIP(r)
+	if ip == nil {
+		return
+	}
+
+	now := time.Now()
+	window := d.Window
+	if window <= 0 {
+		window = time.Hour
+	}
+
+	prev, _ := session.Values[activityKey].(activity)
+	act := activity{Location: prev.Location, Seen: prev.Seen, IPs: make(map[string]time.Time)}
+	changed := false
+	for k, t := range prev.IPs {
+		if now.Sub(t) < window {
+			act.IPs[k] = t
+		} else {
+			changed = true
+		}
+	}
+	key := m.ipHash(ip)
+	last, known := act.IPs[key]
+	if !known || now.Sub(last) >= activityRefresh {
+		act.IPs[key] = now
+		changed = true
+	}
+
+	var anomalies []Anomaly
+	if !known && d.MaxIPs > 0 && len(act.IPs) > d.MaxIPs {
+		anomalies = append(anomalies, Anomaly{Kind: AnomalyTooManyIPs, IP: ip, IPs: len(act.IPs)})
+	}
+
+	if !known && d.Resolver != nil {
+		loc, err := d.Resolver.Resolve(ip)
+		if err != nil {
+			m.reportError(r.Context(), "resolve", m.sessionError("resolve address of", session.Name(), err))
+		} else {
+			if !prev.Seen.IsZero() {
+				anomalies = append(anomalies, d.travelAnomalies(ip, prev.Location, loc, now.Sub(prev.Seen))...)
+			}
+			act.Location = loc
+			act.Seen = now
+		}
+	}
+	if now.Sub(act.Seen) >= activityRefresh {
+		act.Seen = now
+	}
+
+	// The activity is only replaced when it changed, so that loads don't
+	// make unchanged sessions dirty.
+	if changed || !act.Seen.Equal(prev.Seen) {
+		session.Values[activityKey] = act
+	}
+	if len(anomalies) > 0 && d.OnAnomaly != nil {
+		d.OnAnomaly(r, session, anomalies)
+	}
+}
+
+// travelAnomalies compares the location of the previous address with the
+// current one.
+func (d *AnomalyDetector) travelAnomalies(ip net.IP, prev, cur Location, elapsed time.Duration) []Anomaly {
+	var anomalies []Anomaly
+	anomaly := func(kind AnomalyKind) {
+		anomalies = append(anomalies, Anomaly{Kind: kind, IP: ip, Previous: prev, Current: cur, Elapsed: elapsed})
+	}
+	if prev.Country != "" && cur.Country != "" && prev.Country != cur.Country {
+		anomaly(AnomalyNewCountry)
+	}
+	if prev.ASN != 0 && cur.ASN != 0 && prev.ASN != cur.ASN {
+		anomaly(AnomalyNewASN)
+	}
+	if located(prev) && located(cur) {
+		maxSpeed := d.MaxSpeed
+		if maxSpeed <= 0 {
+			maxSpeed = 1000
+		}
+		if distance(prev, cur) > geoAccuracy+maxSpeed*elapsed.Hours() {
+			anomaly(AnomalyImpossibleTravel)
+		}
+	}
+	return anomalies
+}
+
+// geoAccuracy is the distance in km below which two locations may be the
+// same place, given the accuracy of GeoIP databases.
+const geoAccuracy = 100
+
+// located reports whether the coordinates of the location are known.
+func located(l Location) bool {
+	return l.Latitude != 0 || l.Longitude != 0
+}
+
+// distance returns the great-circle distance between two locations in km.
+func distance(a, b Location) float64 {
+	const earthRadius = 6371
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := rad(b.Latitude - a.Latitude)
+	dLon := rad(b.Longitude - a.Longitude)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(rad(a.Latitude))*math.Cos(rad(b.Latitude))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
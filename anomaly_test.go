@@ -0,0 +1,89 @@
+package mongodbstore
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+type fakeResolver map[string]Location
+
+func (f fakeResolver) Resolve(ip net.IP) (Location, error) {
+	return f[ip.String()], nil
+}
+
+func TestAnomalyDetector(t *testing.T) {
+	store := newOfflineStore(t)
+
+	var got []AnomalyKind
+	store.Anomalies = &AnomalyDetector{
+		Resolver: fakeResolver{
+			"192.0.2.1": {Country: "FR", ASN: 1, Latitude: 48.85, Longitude: 2.35},
+			"192.0.2.2": {Country: "FR", ASN: 1, Latitude: 48.86, Longitude: 2.34},
+			"192.0.2.3": {Country: "JP", ASN: 2, Latitude: 35.68, Longitude: 139.69},
+		},
+		MaxIPs: 2,
+		OnAnomaly: func(r *http.Request, session *sessions.Session, anomalies []Anomaly) {
+			for _, a := range anomalies {
+				got = append(got, a.Kind)
+			}
+		},
+	}
+
+	session := sessions.NewSession(store, "session-key")
+	session.IsNew = false
+	for _, tt := range []struct {
+		addr string
+		want []AnomalyKind
+	}{
+		{"192.0.2.1:1234", nil},
+		{"192.0.2.1:1234", nil},
+		{"192.0.2.2:1234", nil},
+		{"192.0.2.3:1234", []AnomalyKind{AnomalyTooManyIPs, AnomalyNewCountry, AnomalyNewASN, AnomalyImpossibleTravel}},
+	} {
+		got = nil
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.addr
+		store.detectAnomalies(r, session)
+		if len(got) != len(tt.want) {
+			t.Fatalf("%s: Expected anomalies %v; Got %v", tt.addr, tt.want, got)
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: Expected anomalies %v; Got %v", tt.addr, tt.want, got)
+			}
+		}
+	}
+
+	act := session.Values[activityKey].(activity)
+	if len(act.IPs) != 3 || act.Location.Country != "JP" {
+		t.Errorf("Expected 3 addresses and location JP; Got %d and %q", len(act.IPs), act.Location.Country)
+	}
+
+	// Addresses leave the window.
+	for k := range act.IPs {
+		act.IPs[k] = time.Now().Add(-2 * time.Hour)
+	}
+	got = nil
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "192.0.2.3:1234"
+	store.detectAnomalies(r, session)
+	if len(got) != 0 {
+		t.Errorf("Expected no anomalies; Got %v", got)
+	}
+	if act := session.Values[activityKey].(activity); len(act.IPs) != 1 {
+		t.Errorf("Expected 1 address in the window; Got %d", len(act.IPs))
+	}
+}
+
+func TestDistance(t *testing.T) {
+	paris := Location{Latitude: 48.8566, Longitude: 2.3522}
+	london := Location{Latitude: 51.5074, Longitude: -0.1278}
+	if d := distance(paris, london); d < 330 || d > 360 {
+		t.Errorf("Expected about 344 km; Got %.0f", d)
+	}
+}
@@ -0,0 +1,174 @@
+package mongodbstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gorilla/sessions"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// atomicValuesKey holds the atomic values of a loaded session.
+const atomicValuesKey transientKey = "atomicValues"
+
+// ErrInvalidKey is returned for atomic value keys that are empty, contain a
+// dot or start with a dollar sign, which MongoDB does not allow as field
+// names.
+var ErrInvalidKey = errors.New("mongodbstore: invalid atomic value key")
+
+// AtomicValue returns the atomic value as of the session load or the last
+// change made through this session.
+//
+// Atomic values are stored as plain BSON in the values subdocument of the
+// session document, next to the encoded session data. Unlike session values
+// they are not signed or encrypted, they are changed directly on the server
+// without saving the session, and concurrent changes don't overwrite each
+// other. Saves never touch them. They suit counters and idempotency tokens.
+func AtomicValue(session *sessions.Session, key string) (interface{}, bool) {
+	values, _ := session.Values[atomicValuesKey].(bson.M)
+	value, ok := values[key]
+	return value, ok
+}
+
+// setAtomicValue updates the atomic value seen through the session.
+func setAtomicValue(session *sessions.Session, key string, value interface{}) {
+	values, _ := session.Values[atomicValuesKey].(bson.M)
+	if values == nil {
+		values = bson.M{}
+		session.Values[atomicValuesKey] = values
+	}
+	values[key] = value
+}
+
+// atomicField returns the document field of the atomic value.
+func atomicField(key string) (string, error) {
+	if key == "" || strings.Contains(key, ".") || strings.HasPrefix(key, "$") {
+		return "", ErrInvalidKey
+	}
+	return "values." + key, nil
+}
+
+// CompareAndSetValue sets the atomic value to newValue if its stored value
+// equals old, in a single server-side update. A nil old matches a missing
+// value. It reports whether the value was set. The session must have been
+// saved.
+func (m *MongoDBStore) CompareAndSetValue(ctx context.Context, session *sessions.Session, key string,
+	old, newValue interface{}) (bool, error) {
+	field, err := atomicField(key)
+	if err != nil {
+		return false, m.sessionError("set value of", session.Name(), err)
+	}
+	sessionID, err := primitive.ObjectIDFromHex(session.ID)
+	if err != nil {
+		return false, m.sessionError("set value of", session.Name(), ErrInvalidID)
+	}
+
+	filter := m.liveFilter(sessionID)
+	if old == nil {
+		filter = append(filter, bson.E{Key: field, Value: bson.D{{Key: "$exists", Value: false}}})
+	} else {
+		filter = append(filter, bson.E{Key: field, Value: old})
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: field, Value: newValue}}}}
+
+	var matched int64
+	err = m.observe(m.profilerContext(ctx, session.Name()), "updateOne", filter, func(ctx context.Context) (string, error) {
+		res, err := m.collection.UpdateOne(ctx, filter, update)
+		if err != nil {
+			return "", err
+		}
+		matched = res.MatchedCount
+		return fmt.Sprintf("matched=%d modified=%d", res.MatchedCount, res.ModifiedCount), nil
+	})
+	if err != nil {
+		return false, m.sessionError("set value of", session.Name(), err)
+	}
+	if matched == 0 {
+		return false, nil
+	}
+
+	m.uncache(sessionID)
+	setAtomicValue(session, key, newValue)
+	return true, nil
+}
+
+// IncrementValue adds delta to the atomic value, treating a missing value as
+// 0, and returns the new value. Concurrent increments are never lost.
+func (m *MongoDBStore) IncrementValue(ctx context.Context, session *sessions.Session, key string, delta int64) (int64, error) {
+	value, err := m.updateAtomic(ctx, session, key, "$inc", delta)
+	if err != nil {
+		return 0, err
+	}
+	switch n := value.(type) {
+	case int32:
+		return int64(n), nil
+	case float64:
+		return int64(n), nil
+	default:
+		n64, _ := value.(int64)
+		return n64, nil
+	}
+}
+
+// PushValue appends item to the atomic array value, creating it if missing,
+// and returns the new array.
+func (m *MongoDBStore) PushValue(ctx context.Context, session *sessions.Session, key string, item interface{}) (bson.A, error) {
+	value, err := m.updateAtomic(ctx, session, key, "$push", item)
+	if err != nil {
+		return nil, err
+	}
+	a, _ := value.(bson.A)
+	return a, nil
+}
+
+// AddToSetValue adds item to the atomic array value unless it already
+// contains it, creating the array if missing, and returns the new array.
+func (m *MongoDBStore) AddToSetValue(ctx context.Context, session *sessions.Session, key string, item interface{}) (bson.A, error) {
+	value, err := m.updateAtomic(ctx, session, key, "$addToSet", item)
+	if err != nil {
+		return nil, err
+	}
+	a, _ := value.(bson.A)
+	return a, nil
+}
+
+// updateAtomic applies the update operator to the atomic value and returns
+// its new value.
+func (m *MongoDBStore) updateAtomic(ctx context.Context, session *sessions.Session, key, op string,
+	operand interface{}) (interface{}, error) {
+	field, err := atomicField(key)
+	if err != nil {
+		return nil, m.sessionError("update value of", session.Name(), err)
+	}
+	sessionID, err := primitive.ObjectIDFromHex(session.ID)
+	if err != nil {
+		return nil, m.sessionError("update value of", session.Name(), ErrInvalidID)
+	}
+
+	filter := m.liveFilter(sessionID)
+	update := bson.D{{Key: op, Value: bson.D{{Key: field, Value: operand}}}}
+	var doc struct {
+		Values bson.M `bson:"values"`
+	}
+	err = m.observe(m.profilerContext(ctx, session.Name()), "findOneAndUpdate", filter, func(ctx context.Context) (string, error) {
+		return "", m.collection.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().
+			SetReturnDocument(options.After).
+			SetProjection(bson.D{{Key: field, Value: 1}})).Decode(&doc)
+	})
+	if err == mongo.ErrNoDocuments {
+		err = ErrNotFound
+	}
+	if err != nil {
+		return nil, m.sessionError("update value of", session.Name(), err)
+	}
+
+	m.uncache(sessionID)
+	value := doc.Values[key]
+	setAtomicValue(session, key, value)
+	return value, nil
+}
@@ -0,0 +1,149 @@
+package mongodbstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAtomicValues(t *testing.T) {
+	store := newOfflineStore(t)
+	session := sessions.NewSession(store, "session-key")
+	session.ID = "5cc8b3a2a4d5b6c7d8e9f0a1"
+
+	for _, key := range []string{"", "a.b", "$inc"} {
+		if _, err := store.CompareAndSetValue(context.Background(), session, key, nil, 1); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Expected ErrInvalidKey for %q; Got %v", key, err)
+		}
+	}
+
+	if _, ok := AtomicValue(session, "views"); ok {
+		t.Errorf("Expected no atomic value")
+	}
+	setAtomicValue(session, "views", int64(3))
+	if v, ok := AtomicValue(session, "views"); !ok || v != int64(3) {
+		t.Errorf("Expected atomic value 3; Got %v", v)
+	}
+	if _, ok := persistentValues(session)[atomicValuesKey]; ok {
+		t.Errorf("Expected atomic values not to be persisted with the session data")
+	}
+}
+
+func TestUpdateAtomicInvalidKey(t *testing.T) {
+	store := newOfflineStore(t)
+	session := sessions.NewSession(store, "session-key")
+	session.ID = "5cc8b3a2a4d5b6c7d8e9f0a1"
+
+	if _, err := store.IncrementValue(context.Background(), session, "a.b", 1); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Expected ErrInvalidKey; Got %v", err)
+	}
+	if _, err := store.PushValue(context.Background(), session, "$x", 1); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Expected ErrInvalidKey; Got %v", err)
+	}
+}
+
+func TestMongoStoreCompareAndSetValue(t *testing.T) {
+	store := newLiveStore(t)
+	session := savedSession(t, store)
+	ctx := context.Background()
+
+	tests := []struct {
+		old, value interface{}
+		set        bool
+	}{
+		{nil, "a", true},
+		{nil, "b", false},
+		{"b", "c", false},
+		{"a", "c", true},
+	}
+	for _, tt := range tests {
+		set, err := store.CompareAndSetValue(ctx, session, "state", tt.old, tt.value)
+		if err != nil || set != tt.set {
+			t.Errorf("%v to %v: Expected %t; Got %t, %v", tt.old, tt.value, tt.set, set, err)
+		}
+	}
+	if v, _ := AtomicValue(session, "state"); v != "c" {
+		t.Errorf("Expected the session to see the value set; Got %v", v)
+	}
+
+	loaded := reloadSession(t, store, session)
+	if v, _ := AtomicValue(loaded, "state"); v != "c" {
+		t.Errorf("Expected the stored value; Got %v", v)
+	}
+}
+
+func TestMongoStoreCompareAndSetValueTombstone(t *testing.T) {
+	store := newLiveStore(t)
+	store.TombstoneTTL = time.Hour
+	session := savedSession(t, store)
+	ctx := context.Background()
+	if err := store.deleteContext(ctx, session); err != nil {
+		t.Fatalf("Error deleting session: %v", err)
+	}
+
+	if set, err := store.CompareAndSetValue(ctx, session, "state", nil, "a"); set || err != nil {
+		t.Errorf("Expected a revoked session not to be written; Got %t, %v", set, err)
+	}
+	id, _ := primitive.ObjectIDFromHex(session.ID)
+	var doc bson.M
+	if err := store.collection.FindOne(ctx, bson.D{{Key: "_id", Value: id}}).Decode(&doc); err != nil {
+		t.Fatalf("Error loading the tombstone: %v", err)
+	}
+	if _, ok := doc["values"]; ok {
+		t.Errorf("Expected the tombstone to hold no values; Got %v", doc)
+	}
+}
+
+func TestMongoStoreUpdateValue(t *testing.T) {
+	store := newLiveStore(t)
+	session := savedSession(t, store)
+	ctx := context.Background()
+
+	for i, want := range []int64{2, 5} {
+		if n, err := store.IncrementValue(ctx, session, "views", int64(2+i)); err != nil || n != want {
+			t.Errorf("Expected %d; Got %d, %v", want, n, err)
+		}
+	}
+	if _, err := store.PushValue(ctx, session, "events", "login"); err != nil {
+		t.Fatalf("Error pushing value: %v", err)
+	}
+	if a, err := store.PushValue(ctx, session, "events", "login"); err != nil || len(a) != 2 {
+		t.Errorf("Expected both items to be appended; Got %v, %v", a, err)
+	}
+	if _, err := store.AddToSetValue(ctx, session, "roles", "admin"); err != nil {
+		t.Fatalf("Error adding value: %v", err)
+	}
+	if a, err := store.AddToSetValue(ctx, session, "roles", "admin"); err != nil || len(a) != 1 {
+		t.Errorf("Expected the item to be added once; Got %v, %v", a, err)
+	}
+
+	loaded := reloadSession(t, store, session)
+	if v, _ := AtomicValue(loaded, "views"); v != int64(5) {
+		t.Errorf("Expected the stored counter; Got %v (%T)", v, v)
+	}
+	if v, _ := AtomicValue(loaded, "events"); len(v.(bson.A)) != 2 {
+		t.Errorf("Expected the stored array; Got %v", v)
+	}
+}
+
+func TestMongoStoreUpdateValueTombstone(t *testing.T) {
+	store := newLiveStore(t)
+	store.TombstoneTTL = time.Hour
+	session := savedSession(t, store)
+	ctx := context.Background()
+	if err := store.deleteContext(ctx, session); err != nil {
+		t.Fatalf("Error deleting session: %v", err)
+	}
+
+	if _, err := store.IncrementValue(ctx, session, "views", 1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a revoked session; Got %v", err)
+	}
+	if _, err := store.PushValue(ctx, session, "events", "login"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a revoked session; Got %v", err)
+	}
+}
@@ -0,0 +1,144 @@
+package mongodbstore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BackgroundError is returned by Run with the errors the background
+// components ended with and the errors of the shutdown.
+type BackgroundError struct {
+	Errors []error
+}
+
+func (e *BackgroundError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return "mongodbstore: background components failed: " + strings.Join(msgs, "; ")
+}
+
+// background tracks the goroutines of the background components: write-behind
+// flushes, mirror replication, publishers, the janitor and change stream
+// tailers. They share a context canceled on shutdown.
+type background struct {
+	mu     sync.Mutex
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	errs   []error
+}
+
+// goBackground runs fn in a background goroutine tracked by the store. The
+// context passed to fn is canceled when the store shuts down. An error
+// returned by fn, other than the cancellation, is returned by Run.
+func (m *MongoDBStore) goBackground(name string, fn func(ctx context.Context) error) {
+	b := &m.background
+	b.mu.Lock()
+	if b.ctx == nil {
+		b.ctx, b.cancel = context.WithCancel(context.Background())
+	}
+	ctx := b.ctx
+	b.wg.Add(1)
+	b.mu.Unlock()
+
+	go func() {
+		defer b.wg.Done()
+		if err := fn(ctx); err != nil && err != context.Canceled {
+			b.mu.Lock()
+			b.errs = append(b.errs, fmt.Errorf("%s: %w", name, err))
+			b.mu.Unlock()
+		}
+	}()
+}
+
+// maxFailures is the number of consecutive failures after which a periodic
+// background task, such as a janitor run or a write-behind flush, is
+// considered failed.
+const maxFailures = 3
+
+// failures counts the consecutive failures of a periodic background task.
+type failures struct {
+	n   int
+	err error
+}
+
+// record records the result of a run of the task.
+func (f *failures) record(err error) {
+	if err == nil {
+		f.n, f.err = 0, nil
+		return
+	}
+	f.n++
+	f.err = err
+}
+
+// result returns the error the task ends with: its last error if its last
+// maxFailures runs or more failed, or nil.
+func (f *failures) result() error {
+	if f.n < maxFailures {
+		return nil
+	}
+	return fmt.Errorf("failed %d times in a row: %w", f.n, f.err)
+}
+
+// stopBackground cancels the context of the background goroutines and waits
+// for them to return.
+func (m *MongoDBStore) stopBackground(ctx context.Context) error {
+	b := &m.background
+	b.mu.Lock()
+	if b.cancel != nil {
+		b.cancel()
+	}
+	b.mu.Unlock()
+
+	stopped := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Run owns the background components of the store, such as the janitor, the
+// write-behind flusher, the mirror, the publishers and the change stream
+// tailers of WatchSessions: it blocks until ctx is done, then shuts them all
+// down as Close does, waiting up to ShutdownTimeout, 30 seconds by default.
+// It returns a *BackgroundError with the errors the components ended with
+// and those of the shutdown, or nil. The janitor and the write-behind flusher
+// end with an error when their last runs all failed, at least maxFailures of
+// them; single failures are only reported to the error handler. Components enabled before or while Run
+// runs are owned alike; Run is typically started last, in its own goroutine
+// or as a member of the application's errgroup.
+func (m *MongoDBStore) Run(ctx context.Context) error {
+	<-ctx.Done()
+
+	timeout := m.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	shutdown, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var errs []error
+	if err := m.Close(shutdown); err != nil {
+		errs = append(errs, err)
+	}
+	m.background.mu.Lock()
+	errs = append(errs, m.background.errs...)
+	m.background.errs = nil
+	m.background.mu.Unlock()
+	if len(errs) > 0 {
+		return &BackgroundError{Errors: errs}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package mongodbstore
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	store := newOfflineStore(t)
+	store.EnableJanitor(Janitor{Interval: time.Hour})
+	store.EnablePublisher(PublisherFunc(func(context.Context, Event) error { return nil }), 1)
+
+	failed := errors.New("failed")
+	stopped := make(chan struct{})
+	store.goBackground("failing", func(context.Context) error { return failed })
+	store.goBackground("blocking", func(ctx context.Context) error {
+		<-ctx.Done()
+		close(stopped)
+		return ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := store.Run(ctx)
+	var berr *BackgroundError
+	if !errors.As(err, &berr) || len(berr.Errors) != 1 || !errors.Is(berr.Errors[0], failed) {
+		t.Fatalf("Expected the error of the failing component; Got %v", err)
+	}
+	select {
+	case <-stopped:
+	default:
+		t.Error("Expected the blocking component to be stopped")
+	}
+
+	if err := store.Run(ctx); err != nil {
+		t.Errorf("Expected no errors running again; Got %v", err)
+	}
+}
+
+func TestRunComponentFailures(t *testing.T) {
+	store := newOfflineStore(t)
+	failed := make(chan struct{}, 100)
+	store.WithErrorHandler(func(ctx context.Context, op string, err error) {
+		if op == "janitor" {
+			select {
+			case failed <- struct{}{}:
+			default:
+			}
+		}
+	})
+	// Without a server, every janitor run fails.
+	store.EnableJanitor(Janitor{Interval: time.Millisecond})
+	store.EnableWriteBehind(time.Hour, 0)
+	for i := 0; i < maxFailures; i++ {
+		<-failed
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := store.Run(ctx)
+	var berr *BackgroundError
+	if !errors.As(err, &berr) || len(berr.Errors) != 1 || !strings.HasPrefix(berr.Errors[0].Error(), "janitor: failed") {
+		t.Fatalf("Expected the error of the failing janitor; Got %v", err)
+	}
+}
+
+func TestFailures(t *testing.T) {
+	var f failures
+	failed := errors.New("failed")
+	for i := 0; i < maxFailures-1; i++ {
+		f.record(failed)
+	}
+	if err := f.result(); err != nil {
+		t.Errorf("Expected single failures to be tolerated; Got %v", err)
+	}
+	f.record(failed)
+	if err := f.result(); !errors.Is(err, failed) {
+		t.Errorf("Expected the last error; Got %v", err)
+	}
+	f.record(nil)
+	if err := f.result(); err != nil {
+		t.Errorf("Expected a success to clear the failures; Got %v", err)
+	}
+}
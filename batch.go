@@ -0,0 +1,227 @@
+package mongodbstore
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SaveAll saves all sessions obtained from the store during the current
+// request that were changed since they were loaded. New sessions and sessions
+// marked for deletion with MaxAge < 0 are always saved. All documents are
+// written to MongoDB with a single BulkWrite. Sessions the PersistPolicy
+// refuses to store are written to their cookies instead.
+//
+// Once the mirror is promoted or the Legacy store is authoritative, the
+// sessions of the request registry are saved with sessions.Save instead.
+//
+// Sessions are tracked in the gorilla context of the request, like the
+// sessions registry, so handlers must be wrapped with context.ClearHandler
+// unless gorilla/mux clears the context for them. Sessions obtained with New
+// on a request without gorilla context are not tracked; obtain them with Get.
+func (m *MongoDBStore) SaveAll(r *http.Request, w http.ResponseWriter) error {
+	if m.delegateStore() != nil {
+		return sessions.Save(r, w)
+	}
+	// The SafeValues guards are locked in name order, so that concurrent
+	// calls can't deadlock.
+	names := make([]string, 0, len(m.tracked(r)))
+	for name := range m.tracked(r) {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		defer lockValues(r, m.tracked(r)[name].session)()
+	}
+
+	var models []mongo.WriteModel
+	var saved, cookieOnly, refreshed []*sessions.Session
+	// inserts and created map the indexes of the insert models to their
+	// documents and sessions.
+	inserts := make(map[int]*Session)
+	created := make(map[int]*sessions.Session)
+	// docs are the documents the saved sessions are written as, nil for
+	// deletions.
+	docs := make(map[*sessions.Session]*Session)
+	for _, t := range m.tracked(r) {
+		session := t.session
+		if session.Options.MaxAge < 0 {
+			if session.ID != "" {
+				sessionID, err := primitive.ObjectIDFromHex(session.ID)
+				if err != nil {
+					return m.sessionError("delete", session.Name(), ErrInvalidID)
+				}
+				if m.TombstoneTTL > 0 {
+					models = append(models, mongo.NewUpdateOneModel().
+						SetFilter(bson.D{{Key: "_id", Value: sessionID}}).
+						SetUpdate(m.tombstoneUpdate(time.Now())).
+						SetUpsert(true))
+				} else {
+					models = append(models, mongo.NewDeleteOneModel().
+						SetFilter(bson.D{{Key: "_id", Value: sessionID}}))
+				}
+				m.counters.add(&m.counters.deletes, 1)
+				m.uncache(sessionID)
+			}
+			saved = append(saved, session)
+			continue
+		}
+
+		if IsStale(session) {
+			return m.sessionError("save", session.Name(), ErrSessionStale)
+		}
+
+		if !m.persist(r, session) {
+			cookieOnly = append(cookieOnly, session)
+			continue
+		}
+
+		if sessionCookieMode(session) == modeCookieOnly {
+			if session.ID == "" {
+				return m.sessionError("save", session.Name(), ErrInvalidID)
+			}
+			refreshed = append(refreshed, session)
+			continue
+		}
+
+		if !m.dirty(t) {
+			continue
+		}
+
+		if !m.allowWrite(r.Context(), r, session) {
+			return m.sessionError("save", session.Name(), ErrRateLimited)
+		}
+
+		if err := m.checkQuota(r.Context(), session); err != nil {
+			return m.sessionError("save", session.Name(), err)
+		}
+
+		if session.ID == "" {
+			session.ID = primitive.NewObjectID().Hex()
+		}
+		m.enrich(r, session)
+
+		s, err := m.document(session)
+		if err != nil {
+			return m.sessionError("save", session.Name(), err)
+		}
+
+		docs[session] = s
+		if session.IsNew && t.data == "" {
+			inserts[len(models)] = s
+			created[len(models)] = session
+			models = append(models, mongo.NewInsertOneModel().SetDocument(s))
+		} else {
+			models = append(models, m.upsertModel(s))
+		}
+		m.counters.add(&m.counters.saves, 1)
+		m.uncache(s.ID)
+		saved = append(saved, session)
+	}
+
+	if len(models) > 0 {
+		write := func(ctx context.Context) (string, error) {
+			return bulkResult(m.collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)))
+		}
+		err := m.observe(context.Background(), "bulkWrite", nil, write)
+		if isDuplicateKey(err) {
+			// Inserts of sessions saved concurrently, and upserts racing
+			// with concurrent ones, are retried as updates of the documents
+			// inserted meanwhile. The other writes are idempotent. Only
+			// the sessions inserted by the first write were created here.
+			rejected := duplicateKeyWrites(err)
+			for i, s := range inserts {
+				models[i] = m.upsertModel(s)
+				if rejected[i] {
+					delete(inserts, i)
+					delete(created, i)
+				}
+			}
+			err = m.observe(context.Background(), "bulkWrite", nil, write)
+		}
+		if err != nil {
+			return m.opError("save all sessions", m.revokedError(err))
+		}
+		m.counters.add(&m.counters.creates, int64(len(inserts)))
+		for _, s := range inserts {
+			m.quotaCreated(s)
+		}
+		for _, session := range created {
+			m.notify(Event{Type: EventCreated, Name: session.Name(), ID: session.ID, Principal: GetPrincipal(session)})
+		}
+	}
+	for _, session := range saved {
+		m.stored(r, session, docs[session])
+		m.negativeRemove(session.ID)
+		m.mirrorSave(session)
+		if session.Options.MaxAge < 0 && session.ID != "" {
+			m.notify(Event{Type: EventDestroyed, Name: session.Name(), ID: session.ID, Principal: GetPrincipal(session)})
+		}
+	}
+
+	for _, session := range saved {
+		m.writeLegacy(r, w, session)
+		if sessionCookieMode(session) == modeSkipCookie {
+			continue
+		}
+		if session.Options.MaxAge < 0 {
+			m.setToken(w, session, "")
+			continue
+		}
+
+		if err := m.setCookie(w, session); err != nil {
+			return err
+		}
+		m.markRecentWrite(w, session)
+	}
+
+	for _, session := range refreshed {
+		if err := m.setCookie(w, session); err != nil {
+			return err
+		}
+	}
+
+	for _, session := range cookieOnly {
+		if err := m.saveCookieOnly(w, session); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// upsertModel returns the bulk write model updating or inserting the
+// document.
+func (m *MongoDBStore) upsertModel(s *Session) mongo.WriteModel {
+	return mongo.NewUpdateOneModel().
+		SetFilter(m.liveFilter(s.ID)).
+		SetUpdate(s.update()).
+		SetUpsert(true)
+}
+
+// dirty reports whether the session values differ from the data the session
+// was loaded from or last saved with.
+func (m *MongoDBStore) dirty(t *tracked) bool {
+	if t.data == "" {
+		return true
+	}
+
+	decoders, err := m.sessionDecoders(t.session)
+	if err != nil {
+		return true
+	}
+	values := make(map[interface{}]interface{})
+	if err := m.decodeMulti(t.session.Name(), t.data, &values, t.session.ID, decoders...); err != nil {
+		return true
+	}
+
+	return !reflect.DeepEqual(values, persistentValues(t.session))
+}
@@ -0,0 +1,144 @@
+package mongodbstore
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/context"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// newOfflineStore returns a store whose collection is never connected, for
+// tests that don't talk to MongoDB.
+func newOfflineStore(t *testing.T) *MongoDBStore {
+	client, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	if err != nil {
+		t.Fatalf("Error creating client: %v", err)
+	}
+
+	return NewMongoDBStore(client.Database("test").Collection("test_session"), 3600, false,
+		[]byte("secret-key"))
+}
+
+func TestDirty(t *testing.T) {
+	store := newOfflineStore(t)
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, err := store.Get(req, "session-key")
+	if err != nil {
+		t.Fatalf("Error creating session: %v", err)
+	}
+	if !store.dirty(store.tracked(req)["session-key"]) {
+		t.Errorf("Expected new session to be dirty")
+	}
+
+	session.Values["foo"] = "bar"
+	session.IsNew = false
+	session.ID = "5cc8b3a2a4d5b6c7d8e9f0a1"
+	data, err := store.document(session)
+	if err != nil {
+		t.Fatalf("Error encoding session: %v", err)
+	}
+	store.track(req, session, data)
+
+	if store.dirty(store.tracked(req)["session-key"]) {
+		t.Errorf("Expected unchanged session to be clean")
+	}
+
+	session.Values["foo"] = "baz"
+	if !store.dirty(store.tracked(req)["session-key"]) {
+		t.Errorf("Expected changed session to be dirty")
+	}
+}
+
+func TestTrackedAfterSave(t *testing.T) {
+	store := newOfflineStore(t)
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, err := store.Get(req, "session-key")
+	if err != nil {
+		t.Fatalf("Error creating session: %v", err)
+	}
+	defer context.Clear(req)
+	session.ID = "5cc8b3a2a4d5b6c7d8e9f0a1"
+	session.Values["foo"] = "bar"
+	doc, err := store.document(session)
+	if err != nil {
+		t.Fatalf("Error encoding session: %v", err)
+	}
+
+	// A new session saved during the request is only written again when
+	// it changes.
+	store.stored(req, session, doc)
+	if store.dirty(store.tracked(req)["session-key"]) {
+		t.Errorf("Expected saved session to be clean")
+	}
+	session.Values["foo"] = "baz"
+	if !store.dirty(store.tracked(req)["session-key"]) {
+		t.Errorf("Expected session changed after its save to be dirty")
+	}
+	store.stored(req, session, nil)
+	if tr := store.tracked(req)["session-key"]; tr.data != "" || !store.dirty(tr) {
+		t.Errorf("Expected deleted session to be dirty")
+	}
+}
+
+func TestTrackNeedsContext(t *testing.T) {
+	store := newOfflineStore(t)
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	if _, err := store.New(req, "session-key"); err != nil {
+		t.Fatalf("Error creating session: %v", err)
+	}
+	if context.GetAll(req) != nil {
+		t.Errorf("Expected New alone to leave no gorilla context behind")
+	}
+
+	if _, err := store.Get(req, "session-key"); err != nil {
+		t.Fatalf("Error creating session: %v", err)
+	}
+	defer context.Clear(req)
+	if store.tracked(req)["session-key"] == nil {
+		t.Errorf("Expected the session of the registry to be tracked")
+	}
+}
+
+func TestSkipTouch(t *testing.T) {
+	store := newOfflineStore(t)
+	store.TouchInterval = time.Minute
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, err := store.Get(req, "session-key")
+	if err != nil {
+		t.Fatalf("Error creating session: %v", err)
+	}
+	session.Values["foo"] = "bar"
+	session.IsNew = false
+	session.ID = "5cc8b3a2a4d5b6c7d8e9f0a1"
+	doc, err := store.document(session)
+	if err != nil {
+		t.Fatalf("Error encoding session: %v", err)
+	}
+	store.track(req, session, doc)
+
+	rsp := httptest.NewRecorder()
+	if err := store.Save(req, rsp, session); err != nil {
+		t.Fatalf("Expected write to be skipped; Got %v", err)
+	}
+	if len(rsp.Result().Cookies()) != 1 {
+		t.Errorf("Expected cookie to be refreshed")
+	}
+
+	doc.Modified = doc.Modified.Add(-2 * time.Minute)
+	store.track(req, session, doc)
+	if store.skipTouch(req, session) {
+		t.Errorf("Expected refresh after TouchInterval")
+	}
+	session.Values["foo"] = "baz"
+	if store.skipTouch(req, session) {
+		t.Errorf("Expected changed session to be written")
+	}
+}
@@ -0,0 +1,165 @@
+package mongodbstore
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// defaultCacheSize is the number of documents kept by the cache when
+// CacheSize is not set.
+const defaultCacheSize = 10000
+
+// docCache keeps recently read session documents in memory.
+type docCache struct {
+	mu      sync.Mutex
+	entries map[primitive.ObjectID]cacheEntry
+}
+
+type cacheEntry struct {
+	expires time.Time
+	doc     *Session
+}
+
+func (c *docCache) get(id primitive.ObjectID, now time.Time) (*Session, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[id]
+	if !ok {
+		return nil, false
+	}
+	if !now.Before(e.expires) {
+		delete(c.entries, id)
+		return nil, false
+	}
+	return e.doc, true
+}
+
+// put caches the document until ttl elapses. When the cache is full, expired
+// entries are dropped first, then arbitrary ones.
+func (c *docCache) put(doc *Session, ttl time.Duration, size int, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[primitive.ObjectID]cacheEntry)
+	}
+	if len(c.entries) >= size {
+		for id, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, id)
+			}
+		}
+		for id := range c.entries {
+			if len(c.entries) < size {
+				break
+			}
+			delete(c.entries, id)
+		}
+	}
+	c.entries[doc.ID] = cacheEntry{expires: now.Add(ttl), doc: doc}
+}
+
+// accessed updates the access time of the cached document, so that loads
+// served from the cache don't record the access again.
+func (c *docCache) accessed(id primitive.ObjectID, t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[id]; ok {
+		doc := *e.doc
+		doc.LastAccessed = t
+		e.doc = &doc
+		c.entries[id] = e
+	}
+}
+
+func (c *docCache) remove(id primitive.ObjectID) {
+	c.mu.Lock()
+	delete(c.entries, id)
+	c.mu.Unlock()
+}
+
+func (c *docCache) clear() {
+	c.mu.Lock()
+	c.entries = nil
+	c.mu.Unlock()
+}
+
+// cached returns the cached document with the id.
+func (m *MongoDBStore) cached(id primitive.ObjectID) (*Session, bool) {
+	if m.CacheTTL <= 0 {
+		return nil, false
+	}
+	doc, ok := m.cache.get(id, time.Now())
+	if ok {
+		m.counters.add(&m.counters.cacheHits, 1)
+	} else {
+		m.counters.add(&m.counters.cacheMisses, 1)
+	}
+	return doc, ok
+}
+
+// cacheDoc adds the document to the cache.
+func (m *MongoDBStore) cacheDoc(doc *Session) {
+	if m.CacheTTL <= 0 {
+		return
+	}
+	size := m.CacheSize
+	if size <= 0 {
+		size = defaultCacheSize
+	}
+	m.cache.put(doc, m.CacheTTL, size, time.Now())
+}
+
+// uncache removes the document with the id from the cache.
+func (m *MongoDBStore) uncache(id primitive.ObjectID) {
+	if m.CacheTTL <= 0 {
+		return
+	}
+	m.cache.remove(id)
+}
+
+// Preload reads the sessions with the given ids into the cache in a single
+// query, for example from a websocket gateway that knows its connected
+// clients, so that their next loads don't wait for MongoDB. It does nothing
+// unless CacheTTL is set. Invalid ids are skipped.
+func (m *MongoDBStore) Preload(ctx context.Context, ids []string) error {
+	if m.CacheTTL <= 0 || len(ids) == 0 {
+		return nil
+	}
+
+	objectIDs := make([]primitive.ObjectID, 0, len(ids))
+	for _, id := range ids {
+		if oid, err := primitive.ObjectIDFromHex(id); err == nil {
+			objectIDs = append(objectIDs, oid)
+		}
+	}
+
+	filter := bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: objectIDs}}}}
+	var cur *mongo.Cursor
+	err := m.observe(ctx, "find", filter, func(ctx context.Context) (string, error) {
+		var err error
+		cur, err = m.collection.Find(ctx, filter, options.Find().SetProjection(loadProjection()))
+		return "", err
+	})
+	if err != nil {
+		return m.opError("preload sessions", err)
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		doc := &Session{}
+		if err := cur.Decode(doc); err != nil {
+			return m.opError("preload sessions", err)
+		}
+		m.cacheDoc(doc)
+	}
+	return m.opError("preload sessions", cur.Err())
+}
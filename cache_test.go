@@ -0,0 +1,138 @@
+package mongodbstore
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDocCache(t *testing.T) {
+	var c docCache
+	now := time.Now()
+	a := &Session{ID: primitive.NewObjectID()}
+	b := &Session{ID: primitive.NewObjectID()}
+
+	c.put(a, time.Minute, 1, now)
+	if doc, ok := c.get(a.ID, now); !ok || doc != a {
+		t.Errorf("Expected cached document; Got %v, %v", doc, ok)
+	}
+	c.put(b, time.Minute, 1, now)
+	if len(c.entries) != 1 {
+		t.Errorf("Expected cache to stay within its size; Got %d entries", len(c.entries))
+	}
+	if _, ok := c.get(b.ID, now.Add(time.Minute)); ok {
+		t.Errorf("Expected expired entry to be gone")
+	}
+}
+
+func TestCachedLoad(t *testing.T) {
+	store := newOfflineStore(t)
+	store.CacheTTL = time.Minute
+
+	id := primitive.NewObjectID()
+	data, err := securecookie.EncodeMulti("session-key", map[interface{}]interface{}{"foo": "bar"}, store.Codecs...)
+	if err != nil {
+		t.Fatalf("Error encoding data: %v", err)
+	}
+	store.cacheDoc(&Session{ID: id, Data: data, IdleExpires: time.Now().Add(time.Hour)})
+
+	cookie, err := securecookie.EncodeMulti("session-key", id.Hex(), store.Codecs...)
+	if err != nil {
+		t.Fatalf("Error encoding cookie: %v", err)
+	}
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	req.AddCookie(&http.Cookie{Name: "session-key", Value: cookie})
+	session, err := store.New(req, "session-key")
+	if err != nil {
+		t.Fatalf("Error loading cached session: %v", err)
+	}
+	if session.IsNew || session.Values["foo"] != "bar" {
+		t.Errorf("Expected cached values; Got %v", session.Values)
+	}
+	if hits := store.counters.snapshot()["cache_hits"]; hits != 1 {
+		t.Errorf("Expected one cache hit; Got %d", hits)
+	}
+
+	store.uncache(id)
+	if _, ok := store.cached(id); ok {
+		t.Errorf("Expected document to be removed from the cache")
+	}
+}
+
+func TestCachedAccess(t *testing.T) {
+	store := newOfflineStore(t)
+	store.CacheTTL = time.Minute
+	store.AccessInterval = time.Minute
+
+	id := primitive.NewObjectID()
+	data, err := securecookie.EncodeMulti("session-key", map[interface{}]interface{}{}, store.Codecs...)
+	if err != nil {
+		t.Fatalf("Error encoding data: %v", err)
+	}
+	store.cacheDoc(&Session{ID: id, Data: data})
+	token, err := securecookie.EncodeMulti("session-key", id.Hex(), store.Codecs...)
+	if err != nil {
+		t.Fatalf("Error encoding token: %v", err)
+	}
+
+	if _, err := store.Validate(context.Background(), "session-key", token); err != nil {
+		t.Fatalf("Error loading session: %v", err)
+	}
+	doc, _ := store.cached(id)
+	if time.Since(doc.LastAccessed) > time.Minute {
+		t.Errorf("Expected access time to be recorded; Got %v", doc.LastAccessed)
+	}
+}
+
+// gateSink is a MetricsSink holding the operations reporting their timing
+// until the gate opens.
+type gateSink struct {
+	gate chan struct{}
+}
+
+func (s gateSink) Timing(name string, d time.Duration, tags ...string) { <-s.gate }
+func (s gateSink) Count(name string, n int64, tags ...string)          {}
+
+func TestCoalesceLoads(t *testing.T) {
+	for _, coalesce := range []bool{false, true} {
+		store := newOfflineStore(t)
+		store.CoalesceLoads = coalesce
+		sink := gateSink{gate: make(chan struct{})}
+		store.Metrics = sink
+		id := primitive.NewObjectID()
+
+		// The offline store fails the queries, which wait for the gate to
+		// report their timing, so that the fetches overlap.
+		var wg sync.WaitGroup
+		var failed int32
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := store.fetch(context.Background(), id, false); err != nil {
+					atomic.AddInt32(&failed, 1)
+				}
+			}()
+		}
+		time.Sleep(20 * time.Millisecond)
+		close(sink.gate)
+		wg.Wait()
+
+		want := int64(5)
+		if coalesce {
+			want = 1
+		}
+		if loads := atomic.LoadInt64(&store.counters.loads); loads != want {
+			t.Errorf("coalesce=%t: Expected %d queries; Got %d", coalesce, want, loads)
+		}
+		if failed != 5 {
+			t.Errorf("coalesce=%t: Expected every fetch to get the error; Got %d", coalesce, failed)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package mongodbstore
+
+import (
+	"net/http"
+
+	"github.com/gorilla/sessions"
+)
+
+// carryOver copies the CarryOver values found in from into to. It reports
+// whether any value was copied.
+func (m *MongoDBStore) carryOver(from, to map[interface{}]interface{}) bool {
+	copied := false
+	for _, key := range m.CarryOver {
+		if v, ok := from[key]; ok {
+			to[key] = v
+			copied = true
+		}
+	}
+	return copied
+}
+
+// carryOverExpired copies the CarryOver values of the expired document into
+// the session replacing it. Documents that can't be decoded carry nothing
+// over.
+func (m *MongoDBStore) carryOverExpired(session *sessions.Session, s *Session) {
+	if len(m.CarryOver) == 0 || s.corrupted() {
+		return
+	}
+	decoders, err := m.sessionDecoders(session)
+	if err != nil {
+		return
+	}
+	values := make(map[interface{}]interface{})
+	if m.decodeMulti(session.Name(), s.Data, &values, session.ID, decoders...) != nil {
+		return
+	}
+	m.carryOver(values, session.Values)
+}
+
+// carryOverDestroyed saves a new session holding the CarryOver values of a
+// destroyed session. The new session is loaded by the next request.
+func (m *MongoDBStore) carryOverDestroyed(r *http.Request, w http.ResponseWriter, name string, values map[interface{}]interface{}) error {
+	if len(m.CarryOver) == 0 {
+		return nil
+	}
+	session := m.newSession(name)
+	if tenant, ok := values[tenantKey]; ok {
+		session.Values[tenantKey] = tenant
+	}
+	if !m.carryOver(values, session.Values) {
+		return nil
+	}
+	return m.Save(r, w, session)
+}
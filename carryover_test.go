@@ -0,0 +1,56 @@
+package mongodbstore
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCarryOverExpired(t *testing.T) {
+	store := newOfflineStore(t)
+	store.CacheTTL = time.Minute
+	store.CarryOver = []string{"draft", "cart"}
+
+	values := map[interface{}]interface{}{"draft": "text", "user": "alice"}
+	data, err := securecookie.EncodeMulti("session-key", values, store.Codecs...)
+	if err != nil {
+		t.Fatalf("Error encoding data: %v", err)
+	}
+	id := primitive.NewObjectID()
+	store.cacheDoc(&Session{ID: id, Data: data, Checksum: checksum(data), IdleExpires: time.Now().Add(-time.Hour)})
+	token, _ := securecookie.EncodeMulti("session-key", id.Hex(), store.Codecs...)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Cookie", "session-key="+token)
+	session, err := store.New(req, "session-key")
+	if err != nil {
+		t.Fatalf("Error loading session: %v", err)
+	}
+	if !session.IsNew {
+		t.Fatal("Expected a new session in place of the expired one")
+	}
+	if session.Values["draft"] != "text" {
+		t.Errorf("Expected the draft carried over; Got %v", session.Values)
+	}
+	if _, ok := session.Values["user"]; ok {
+		t.Errorf("Expected only the CarryOver values; Got %v", session.Values)
+	}
+}
+
+func TestCarryOverDestroyedWithoutValues(t *testing.T) {
+	store := newOfflineStore(t)
+	store.CarryOver = []string{"draft"}
+
+	// Nothing to carry over: no session is saved.
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	if err := store.carryOverDestroyed(req, w, "session-key", map[interface{}]interface{}{"user": "alice"}); err != nil {
+		t.Fatalf("Error carrying over: %v", err)
+	}
+	if cookies := w.Result().Cookies(); len(cookies) != 0 {
+		t.Errorf("Expected no cookie; Got %v", cookies)
+	}
+}
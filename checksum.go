@@ -0,0 +1,25 @@
+package mongodbstore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+)
+
+// ErrCorruptedSession is returned when the data of a stored session doesn't
+// match the checksum saved with it. Data that matches its checksum but can't
+// be decoded points at the codecs, for example a key removed too early,
+// rather than at the stored document.
+var ErrCorruptedSession = errors.New("mongodbstore: session data corrupted")
+
+// checksum returns the checksum of encoded session data.
+func checksum(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:16])
+}
+
+// corrupted reports whether the data of the document doesn't match its
+// checksum. Documents saved before checksums were stored are not checked.
+func (s *Session) corrupted() bool {
+	return s.Checksum != "" && s.Checksum != checksum(s.Data)
+}
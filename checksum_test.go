@@ -0,0 +1,48 @@
+package mongodbstore
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCorruptedSession(t *testing.T) {
+	store := newOfflineStore(t)
+	store.CacheTTL = time.Minute
+
+	data, err := securecookie.EncodeMulti("session-key", map[interface{}]interface{}{"foo": "bar"}, store.Codecs...)
+	if err != nil {
+		t.Fatalf("Error encoding data: %v", err)
+	}
+	intact := primitive.NewObjectID()
+	store.cacheDoc(&Session{ID: intact, Data: data, Checksum: checksum(data)})
+	corrupted := primitive.NewObjectID()
+	store.cacheDoc(&Session{ID: corrupted, Data: data[:len(data)-2] + "xx", Checksum: checksum(data)})
+
+	for _, tt := range []struct {
+		id   primitive.ObjectID
+		want error
+	}{
+		{intact, nil},
+		{corrupted, ErrCorruptedSession},
+	} {
+		token, _ := securecookie.EncodeMulti("session-key", tt.id.Hex(), store.Codecs...)
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Cookie", "session-key="+token)
+		session, err := store.New(req, "session-key")
+		if err != nil {
+			t.Fatalf("Error loading session: %v", err)
+		}
+		if got := LoadError(session); !errors.Is(got, tt.want) {
+			t.Errorf("Expected load error %v; Got %v", tt.want, got)
+		}
+	}
+
+	if got := store.counters.snapshot()["corrupted"]; got != 1 {
+		t.Errorf("Expected 1 corrupted load; Got %d", got)
+	}
+}
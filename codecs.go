@@ -0,0 +1,48 @@
+package mongodbstore
+
+import (
+	"crypto/cipher"
+	"hash"
+
+	"github.com/gorilla/securecookie"
+)
+
+// CodecOptions select the algorithms of the codecs made by NewCodecs, so that
+// deployments can meet crypto policies without replacing the codecs. The
+// zero value selects the defaults of NewMongoDBStore.
+type CodecOptions struct {
+	// Hash is the hash function of the HMAC signing values, sha256.New by
+	// default. With sha512.New hash keys should be 64 bytes long.
+	Hash func() hash.Hash
+	// Cipher makes the block cipher encrypting values from the block keys,
+	// aes.NewCipher by default. Strict only accepts block keys of AES sizes.
+	Cipher func(key []byte) (cipher.Block, error)
+	// Serializer encodes values before they are encrypted and signed,
+	// securecookie.GobEncoder by default. securecookie.JSONEncoder can encode
+	// session ids but not session data, whose keys are interfaces, so codecs
+	// using it must be Codecs or NameCodecs along with gob DataCodecs.
+	Serializer securecookie.Serializer
+}
+
+// NewCodecs returns codecs made from hash and block key pairs like
+// securecookie.CodecsFromPairs, using the algorithms of the options. Keys
+// invalid for the cipher make the codecs fail, which SelfCheck reports.
+func NewCodecs(opts CodecOptions, keyPairs ...[]byte) []securecookie.Codec {
+	var serializer securecookie.Serializer = securecookie.GobEncoder{}
+	if opts.Serializer != nil {
+		serializer = opts.Serializer
+	}
+
+	codecs := securecookie.CodecsFromPairs(keyPairs...)
+	for i, codec := range codecs {
+		sc := codec.(*securecookie.SecureCookie)
+		sc.SetSerializer(serializer)
+		if opts.Hash != nil {
+			sc.HashFunc(opts.Hash)
+		}
+		if blockKey := 2*i + 1; opts.Cipher != nil && blockKey < len(keyPairs) && keyPairs[blockKey] != nil {
+			sc.BlockFunc(opts.Cipher)
+		}
+	}
+	return codecs
+}
@@ -0,0 +1,45 @@
+package mongodbstore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha512"
+	"testing"
+
+	"github.com/gorilla/securecookie"
+)
+
+func TestNewCodecs(t *testing.T) {
+	hashKey := []byte("0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")
+	blockKey := []byte("0123456789abcdef")
+
+	ciphers := 0
+	codecs := NewCodecs(CodecOptions{
+		Hash: sha512.New,
+		Cipher: func(key []byte) (cipher.Block, error) {
+			ciphers++
+			return aes.NewCipher(key)
+		},
+		Serializer: securecookie.JSONEncoder{},
+	}, hashKey, blockKey)
+	if ciphers != 1 {
+		t.Errorf("Expected the cipher to be made once; Got %d", ciphers)
+	}
+
+	encoded, err := securecookie.EncodeMulti("session-key", "5cc8b3a2a4d5b6c7d8e9f0a1", codecs...)
+	if err != nil {
+		t.Fatalf("Error encoding: %v", err)
+	}
+	var id string
+	if err := securecookie.DecodeMulti("session-key", encoded, &id, codecs...); err != nil || id != "5cc8b3a2a4d5b6c7d8e9f0a1" {
+		t.Errorf("Expected the id back; Got %q, %v", id, err)
+	}
+	if err := securecookie.DecodeMulti("session-key", encoded, &id, NewCodecs(CodecOptions{}, hashKey, blockKey)...); err == nil {
+		t.Error("Expected SHA-256 codecs to reject SHA-512 signatures")
+	}
+
+	bad := NewCodecs(CodecOptions{Cipher: aes.NewCipher}, hashKey, []byte("short"))
+	if _, err := securecookie.EncodeMulti("session-key", "id", bad...); err == nil {
+		t.Error("Expected an invalid block key to fail")
+	}
+}
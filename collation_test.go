@@ -0,0 +1,19 @@
+package mongodbstore
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestFindOptionsCollation(t *testing.T) {
+	store := newOfflineStore(t)
+	if store.findOptions().Collation != nil {
+		t.Errorf("Expected no collation by default")
+	}
+
+	store.Collation = &options.Collation{Locale: "en", Strength: 2}
+	if c := store.findOptions().Collation; c == nil || c.Locale != "en" || c.Strength != 2 {
+		t.Errorf("Expected configured collation; Got %+v", c)
+	}
+}
@@ -0,0 +1,275 @@
+package mongodbstore
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Compatibility selects the MongoDB-compatible service the store runs
+// against, to avoid the features it lacks.
+type Compatibility int
+
+const (
+	// CompatMongoDB uses every feature of MongoDB.
+	CompatMongoDB Compatibility = iota
+	// CompatDocumentDB avoids collations and change streams, which Amazon
+	// DocumentDB doesn't support or has disabled by default.
+	CompatDocumentDB
+	// CompatCosmosDB avoids collations, change streams and TTL indexes on
+	// fields other than _ts, which the Azure Cosmos DB API for MongoDB
+	// doesn't support. Expired sessions are not loaded but stay stored
+	// until PurgeExpired removes them.
+	CompatCosmosDB
+	// CompatFerretDB avoids collations, change streams, sparse indexes and
+	// transactions, which FerretDB doesn't support. DetectFeatures
+	// recognizes FerretDB by itself.
+	CompatFerretDB
+)
+
+// Capabilities are the optional server features the store uses.
+type Capabilities struct {
+	// Backend is the service the store runs against, as set by the
+	// Compatibility or found by DetectFeatures.
+	Backend Compatibility
+
+	// Collation enables the Collation.
+	Collation bool
+	// ChangeStreams are needed to watch sessions.
+	ChangeStreams bool
+	// FieldTTL allows TTL indexes on fields other than _ts.
+	FieldTTL bool
+	// SparseIndexes allows sparse indexes, including sparse TTL indexes.
+	SparseIndexes bool
+	// Transactions are supported by replica sets and sharded clusters;
+	// they are only known after DetectFeatures.
+	Transactions bool
+}
+
+// detectedFeatures holds the results of DetectFeatures.
+type detectedFeatures struct {
+	mu        sync.Mutex
+	probed    bool
+	backend   Compatibility
+	available Capabilities
+}
+
+// Capabilities returns the features the store uses, according to the
+// Compatibility and to DetectFeatures, so that applications can adapt too.
+func (m *MongoDBStore) Capabilities() Capabilities {
+	m.detected.mu.Lock()
+	defer m.detected.mu.Unlock()
+
+	backend := m.Compatibility
+	if backend == CompatMongoDB && m.detected.probed {
+		backend = m.detected.backend
+	}
+	c := Capabilities{Backend: backend, Collation: true, ChangeStreams: true, FieldTTL: true, SparseIndexes: true}
+	switch backend {
+	case CompatDocumentDB:
+		c.Collation, c.ChangeStreams = false, false
+	case CompatCosmosDB:
+		c.Collation, c.ChangeStreams, c.FieldTTL, c.SparseIndexes = false, false, false, false
+	case CompatFerretDB:
+		c.Collation, c.ChangeStreams, c.SparseIndexes = false, false, false
+	}
+
+	if m.detected.probed {
+		c.Collation = c.Collation && m.detected.available.Collation
+		c.ChangeStreams = c.ChangeStreams && m.detected.available.ChangeStreams
+		c.Transactions = backend != CompatFerretDB && m.detected.available.Transactions
+	}
+	return c
+}
+
+// String returns the name of the service.
+func (c Compatibility) String() string {
+	switch c {
+	case CompatMongoDB:
+		return "MongoDB"
+	case CompatDocumentDB:
+		return "DocumentDB"
+	case CompatCosmosDB:
+		return "CosmosDB"
+	case CompatFerretDB:
+		return "FerretDB"
+	}
+	return fmt.Sprintf("Compatibility(%d)", int(c))
+}
+
+// DetectFeatures probes the server for the optional features the store uses
+// and stops using those the server lacks. It recognizes FerretDB by its build
+// info, tries a query with a collation and a change stream, and tells
+// whether the deployment supports transactions. Call it at startup; it
+// doesn't create or modify documents.
+func (m *MongoDBStore) DetectFeatures(ctx context.Context) error {
+	var available Capabilities
+	backend := CompatMongoDB
+	db := m.collection.Database()
+
+	err := m.observe(ctx, "buildInfo", nil, func(ctx context.Context) (string, error) {
+		info, err := db.RunCommand(ctx, bson.D{{Key: "buildInfo", Value: 1}}).DecodeBytes()
+		if err != nil {
+			return "", err
+		}
+		if _, err := info.LookupErr("ferretdb"); err == nil {
+			backend = CompatFerretDB
+		}
+		return backend.String(), nil
+	})
+	if err != nil {
+		return m.opError("detect features", err)
+	}
+
+	err = m.observe(ctx, "isMaster", nil, func(ctx context.Context) (string, error) {
+		var hello struct {
+			SetName        string `bson:"setName"`
+			Msg            string `bson:"msg"`
+			MaxWireVersion int32  `bson:"maxWireVersion"`
+		}
+		if err := db.RunCommand(ctx, bson.D{{Key: "isMaster", Value: 1}}).Decode(&hello); err != nil {
+			return "", err
+		}
+		// Transactions need MongoDB 4.0 on replica sets and 4.2 on sharded
+		// clusters.
+		available.Transactions = hello.SetName != "" && hello.MaxWireVersion >= 7 ||
+			hello.Msg == "isdbgrid" && hello.MaxWireVersion >= 8
+		return fmt.Sprintf("transactions=%t", available.Transactions), nil
+	})
+	if err != nil {
+		return m.opError("detect features", err)
+	}
+
+	err = m.observe(ctx, "find", nil, func(ctx context.Context) (string, error) {
+		opts := options.Find().SetLimit(1).SetCollation(&options.Collation{Locale: "simple"})
+		cur, err := m.collection.Find(ctx, bson.D{}, opts)
+		if err == nil {
+			available.Collation = true
+			cur.Close(ctx)
+		}
+		return fmt.Sprintf("collation=%t", available.Collation), ignoreCommandError(err)
+	})
+	if err != nil {
+		return m.opError("detect features", err)
+	}
+
+	err = m.observe(ctx, "watch", nil, func(ctx context.Context) (string, error) {
+		stream, err := m.collection.Watch(ctx, mongo.Pipeline{})
+		if err == nil {
+			available.ChangeStreams = true
+			stream.Close(ctx)
+		}
+		return fmt.Sprintf("changeStreams=%t", available.ChangeStreams), ignoreCommandError(err)
+	})
+	if err != nil {
+		return m.opError("detect features", err)
+	}
+
+	m.detected.mu.Lock()
+	m.detected.probed = true
+	m.detected.backend = backend
+	m.detected.available = available
+	m.detected.mu.Unlock()
+	return nil
+}
+
+// ignoreCommandError returns nil for errors returned by the server, which
+// mean a probed feature is unsupported, and err for other errors, such as
+// network failures.
+func ignoreCommandError(err error) error {
+	if _, ok := err.(mongo.CommandError); ok {
+		return nil
+	}
+	return err
+}
+
+// collation returns the Collation unless the server doesn't support
+// collations.
+func (m *MongoDBStore) collation() *options.Collation {
+	if m.Collation == nil || !m.Capabilities().Collation {
+		return nil
+	}
+	return m.Collation
+}
+
+// EnsureIndexes creates the indexes NewMongoDBStore creates with ensureTTL,
+// and those of the Snapshots and LoginThrottle collections, without the TTL
+// and sparse options the Capabilities rule out. Use it instead of ensureTTL when the Compatibility is set.
+func (m *MongoDBStore) EnsureIndexes(ctx context.Context) error {
+	c := m.Capabilities()
+	for _, index := range indexes(m.indexMaxAge) {
+		if !c.FieldTTL {
+			index.Options.ExpireAfterSeconds = nil
+		}
+		if !c.SparseIndexes {
+			index.Options.Sparse = nil
+		}
+		err := m.observe(ctx, "createIndex", nil, func(ctx context.Context) (string, error) {
+			return m.collection.Indexes().CreateOne(ctx, index)
+		})
+		if err != nil {
+			return m.opError("create index", err)
+		}
+	}
+	if m.Snapshots != nil {
+		if err := m.ensureTTLIndexes(ctx, m.Snapshots, snapshotIndexes()); err != nil {
+			return m.opError("create snapshot index", err)
+		}
+	}
+	if m.LoginThrottle != nil {
+		if err := m.ensureTTLIndexes(ctx, m.LoginThrottle.Collection, loginThrottleIndexes()); err != nil {
+			return m.opError("create login throttle index", err)
+		}
+	}
+	return nil
+}
+
+// ensureTTLIndexes creates the indexes of an auxiliary collection, without
+// TTL if the Capabilities rule it out.
+func (m *MongoDBStore) ensureTTLIndexes(ctx context.Context, c *mongo.Collection, indexes []mongo.IndexModel) error {
+	for _, index := range indexes {
+		if !m.Capabilities().FieldTTL {
+			index.Options.ExpireAfterSeconds = nil
+		}
+		err := m.observe(ctx, "createIndex", nil, func(ctx context.Context) (string, error) {
+			return c.Indexes().CreateOne(ctx, index)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PurgeExpired deletes the documents the TTL indexes would have removed, for
+// services without TTL indexes on fields such as Cosmos DB, and returns their
+// number. Call it periodically.
+func (m *MongoDBStore) PurgeExpired(ctx context.Context) (int64, error) {
+	now := time.Now()
+	expired := bson.A{
+		bson.M{"idleExpires": bson.M{"$lte": now}},
+		bson.M{"absoluteExpires": bson.M{"$lte": now}},
+		bson.M{"expires": bson.M{"$lte": now}},
+	}
+	if m.indexMaxAge > 0 {
+		expired = append(expired, bson.M{"modified": bson.M{"$lte": now.Add(-time.Duration(m.indexMaxAge) * time.Second)}})
+	}
+	filter := bson.M{"$or": expired}
+
+	var deleted int64
+	err := m.observe(ctx, "deleteMany", filter, func(ctx context.Context) (string, error) {
+		res, err := m.collection.DeleteMany(ctx, filter)
+		if err != nil {
+			return "", err
+		}
+		deleted = res.DeletedCount
+		return fmt.Sprintf("deleted=%d", deleted), nil
+	})
+	// Expired documents are not loaded, so the cache stays valid.
+	return deleted, m.opError("purge expired sessions", err)
+}
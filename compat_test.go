@@ -0,0 +1,62 @@
+package mongodbstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestCompatibility(t *testing.T) {
+	store := newOfflineStore(t)
+	store.Collation = &options.Collation{Locale: "en", Strength: 2}
+
+	all := Capabilities{Collation: true, ChangeStreams: true, FieldTTL: true, SparseIndexes: true}
+	tests := []struct {
+		compat Compatibility
+		want   Capabilities
+	}{
+		{CompatMongoDB, all},
+		{CompatDocumentDB, Capabilities{Backend: CompatDocumentDB, FieldTTL: true, SparseIndexes: true}},
+		{CompatCosmosDB, Capabilities{Backend: CompatCosmosDB}},
+		{CompatFerretDB, Capabilities{Backend: CompatFerretDB, FieldTTL: true}},
+	}
+	for _, tt := range tests {
+		store.Compatibility = tt.compat
+		if got := store.Capabilities(); got != tt.want {
+			t.Errorf("%v: Expected capabilities %+v; Got %+v", tt.compat, tt.want, got)
+		}
+		if got := store.collation() != nil; got != tt.want.Collation {
+			t.Errorf("%v: Expected collation %t; Got %t", tt.compat, tt.want.Collation, got)
+		}
+	}
+}
+
+func TestDetectedFeatures(t *testing.T) {
+	store := newOfflineStore(t)
+	store.detected.probed = true
+	store.detected.available = Capabilities{Collation: true, Transactions: true}
+	want := Capabilities{Collation: true, FieldTTL: true, SparseIndexes: true, Transactions: true}
+	if got := store.Capabilities(); got != want {
+		t.Errorf("Expected %+v; Got %+v", want, got)
+	}
+
+	store.detected.backend = CompatFerretDB
+	want = Capabilities{Backend: CompatFerretDB, FieldTTL: true}
+	if got := store.Capabilities(); got != want {
+		t.Errorf("Expected detected FerretDB to be handled; Got %+v", got)
+	}
+
+	// Failures to reach the server are not taken for missing features.
+	if err := store.DetectFeatures(context.Background()); err == nil {
+		t.Error("Expected the offline store to fail to probe")
+	}
+	if err := ignoreCommandError(mongo.CommandError{Code: 115}); err != nil {
+		t.Errorf("Expected command errors to be ignored; Got %v", err)
+	}
+	if err := ignoreCommandError(errors.New("network")); err == nil {
+		t.Error("Expected other errors to be kept")
+	}
+}
@@ -0,0 +1,295 @@
+package mongodbstore
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Config holds the settings of a store connecting to MongoDB by itself, as
+// used by NewFromConfig and NewFromEnv.
+type Config struct {
+	// URI is the MongoDB connection string.
+	URI string
+	// Database and Collection name the collection sessions are stored in.
+	// Collection defaults to "sessions".
+	Database   string
+	Collection string
+
+	// KeyPairs are the hash and block keys of the Codecs, as passed to
+	// NewMongoDBStore.
+	KeyPairs [][]byte
+	// Strict refuses weak keys like NewMongoDBStoreStrict.
+	Strict bool
+	// Codec selects the algorithms of the Codecs made from KeyPairs.
+	Codec CodecOptions
+
+	// MaxAge and EnsureTTL are the arguments of NewMongoDBStore.
+	MaxAge    int
+	EnsureTTL bool
+
+	// TLS connects with TLS, verifying the server against the system roots
+	// or, if set, the PEM certificates of TLSCAFile. TLSCertFile and
+	// TLSKeyFile hold the PEM client certificate and key presented to the
+	// server, as required by X.509 authentication. Setting any of the files
+	// implies TLS.
+	TLS         bool
+	TLSCAFile   string
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// AuthMechanism, such as "SCRAM-SHA-256" or "MONGODB-X509", AuthSource,
+	// Username and Password set the credentials, overriding those of the
+	// URI. With MONGODB-X509 the user is taken from the client certificate.
+	AuthMechanism string
+	AuthSource    string
+	Username      string
+	Password      string
+
+	// Secure sets the Secure attribute of the session cookies.
+	Secure bool
+
+	// StorageTTL, IdleTimeout and CacheTTL set the fields of the same name
+	// of the store.
+	StorageTTL  time.Duration
+	IdleTimeout time.Duration
+	CacheTTL    time.Duration
+
+	// DevFallback makes OpenStore return a MemoryStore when MongoDB can't
+	// be reached, for local development. Never set it in production, where
+	// it would silently keep sessions in the memory of each process.
+	DevFallback bool
+}
+
+// NewFromConfig connects to MongoDB and returns a store of the configured
+// collection, with the features of the server detected by DetectFeatures.
+// The client is owned by the store; disconnect it with
+// store.Collection().Database().Client().Disconnect when done.
+func NewFromConfig(ctx context.Context, cfg Config) (*MongoDBStore, error) {
+	if cfg.URI == "" || cfg.Database == "" {
+		return nil, errors.New("mongodbstore: config needs a URI and a database")
+	}
+	if cfg.Strict {
+		if err := checkKeyPairs(cfg.KeyPairs); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Collection == "" {
+		cfg.Collection = "sessions"
+	}
+
+	opts, err := cfg.clientOptions()
+	if err != nil {
+		return nil, err
+	}
+	client, err := mongo.Connect(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("mongodbstore: connect: %w", err)
+	}
+
+	store := NewMongoDBStore(client.Database(cfg.Database).Collection(cfg.Collection), cfg.MaxAge, false,
+		cfg.KeyPairs...)
+	store.Codecs = NewCodecs(cfg.Codec, cfg.KeyPairs...)
+	store.CookieMaxAge(cfg.MaxAge)
+	// The indexes depend on the capabilities of the server.
+	err = store.DetectFeatures(ctx)
+	if err == nil && cfg.EnsureTTL {
+		err = store.EnsureIndexes(ctx)
+	}
+	if err != nil {
+		client.Disconnect(ctx)
+		return nil, err
+	}
+	store.Options.Secure = cfg.Secure
+	store.StorageTTL = cfg.StorageTTL
+	store.IdleTimeout = cfg.IdleTimeout
+	store.CacheTTL = cfg.CacheTTL
+	return store, nil
+}
+
+// OpenStore is NewFromConfig returning the Store interface. With DevFallback
+// it returns a MemoryStore with the same keys and cookie options when the
+// MongoDB store can't be created.
+func OpenStore(ctx context.Context, cfg Config) (Store, error) {
+	store, err := NewFromConfig(ctx, cfg)
+	if err == nil {
+		return store, nil
+	}
+	if !cfg.DevFallback || errors.Is(err, ErrWeakKeys) {
+		return nil, err
+	}
+	mem := NewMemoryStore(cfg.MaxAge, cfg.KeyPairs...)
+	mem.Options.Secure = cfg.Secure
+	return mem, nil
+}
+
+// clientOptions returns the options of the MongoDB client.
+func (cfg Config) clientOptions() (*options.ClientOptions, error) {
+	opts := options.Client().ApplyURI(cfg.URI)
+
+	if cfg.TLS || cfg.TLSCAFile != "" || cfg.TLSCertFile != "" {
+		tlsConfig := &tls.Config{}
+		if cfg.TLSCAFile != "" {
+			pem, err := ioutil.ReadFile(cfg.TLSCAFile)
+			if err != nil {
+				return nil, fmt.Errorf("mongodbstore: reading CA file: %w", err)
+			}
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("mongodbstore: no certificates in CA file %s", cfg.TLSCAFile)
+			}
+		}
+		if cfg.TLSCertFile != "" {
+			keyFile := cfg.TLSKeyFile
+			if keyFile == "" {
+				// The key is often bundled with the certificate.
+				keyFile = cfg.TLSCertFile
+			}
+			cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, keyFile)
+			if err != nil {
+				return nil, fmt.Errorf("mongodbstore: loading client certificate: %w", err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
+
+	if cfg.AuthMechanism != "" || cfg.Username != "" {
+		if cfg.AuthMechanism == "MONGODB-X509" && cfg.TLSCertFile == "" {
+			return nil, errors.New("mongodbstore: MONGODB-X509 authentication needs a client certificate")
+		}
+		opts.SetAuth(options.Credential{
+			AuthMechanism: cfg.AuthMechanism,
+			AuthSource:    cfg.AuthSource,
+			Username:      cfg.Username,
+			Password:      cfg.Password,
+		})
+	}
+	return opts, nil
+}
+
+// NewFromEnv is NewFromConfig with the configuration read from environment
+// variables:
+//
+//	MONGODBSTORE_URI             connection string (required)
+//	MONGODBSTORE_DATABASE        database (required)
+//	MONGODBSTORE_COLLECTION      collection, "sessions" by default
+//	MONGODBSTORE_KEYS            comma-separated base64 keys, in hash/block
+//	                             pairs; an empty block key disables
+//	                             encryption
+//	MONGODBSTORE_STRICT          refuse weak keys, true by default
+//	MONGODBSTORE_MAX_AGE         cookie and TTL index max age in seconds,
+//	                             2592000 (30 days) by default
+//	MONGODBSTORE_ENSURE_TTL      create the indexes, true by default
+//	MONGODBSTORE_TLS             connect with TLS
+//	MONGODBSTORE_TLS_CA_FILE     PEM file of the CA certificates
+//	MONGODBSTORE_TLS_CERT_FILE   PEM file of the client certificate
+//	MONGODBSTORE_TLS_KEY_FILE    PEM file of the client key, if not bundled
+//	                             with the certificate
+//	MONGODBSTORE_AUTH_MECHANISM  authentication mechanism, such as
+//	                             "SCRAM-SHA-256" or "MONGODB-X509"
+//	MONGODBSTORE_AUTH_SOURCE     authentication database
+//	MONGODBSTORE_USERNAME        user name
+//	MONGODBSTORE_PASSWORD        password
+//	MONGODBSTORE_SECURE          set the Secure attribute of cookies
+//	MONGODBSTORE_STORAGE_TTL     StorageTTL, as a duration such as "24h"
+//	MONGODBSTORE_IDLE_TIMEOUT    IdleTimeout, as a duration
+//	MONGODBSTORE_CACHE_TTL       CacheTTL, as a duration
+//	MONGODBSTORE_DEV_FALLBACK    fall back to a MemoryStore in OpenStore
+//
+// Booleans are parsed by strconv.ParseBool.
+func NewFromEnv(ctx context.Context) (*MongoDBStore, error) {
+	cfg, err := configFromEnv(os.Getenv)
+	if err != nil {
+		return nil, err
+	}
+	return NewFromConfig(ctx, cfg)
+}
+
+// configFromEnv reads the configuration documented by NewFromEnv with getenv.
+func configFromEnv(getenv func(string) string) (Config, error) {
+	cfg := Config{
+		URI:        getenv("MONGODBSTORE_URI"),
+		Database:   getenv("MONGODBSTORE_DATABASE"),
+		Collection: getenv("MONGODBSTORE_COLLECTION"),
+
+		TLSCAFile:     getenv("MONGODBSTORE_TLS_CA_FILE"),
+		TLSCertFile:   getenv("MONGODBSTORE_TLS_CERT_FILE"),
+		TLSKeyFile:    getenv("MONGODBSTORE_TLS_KEY_FILE"),
+		AuthMechanism: getenv("MONGODBSTORE_AUTH_MECHANISM"),
+		AuthSource:    getenv("MONGODBSTORE_AUTH_SOURCE"),
+		Username:      getenv("MONGODBSTORE_USERNAME"),
+		Password:      getenv("MONGODBSTORE_PASSWORD"),
+
+		MaxAge:    30 * 24 * 3600,
+		EnsureTTL: true,
+		Strict:    true,
+	}
+
+	var errs []string
+	fail := func(name string, err error) {
+		errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+	}
+	boolean := func(name string, dst *bool) {
+		if v := getenv(name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				fail(name, err)
+			}
+			*dst = b
+		}
+	}
+	duration := func(name string, dst *time.Duration) {
+		if v := getenv(name); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				fail(name, err)
+			}
+			*dst = d
+		}
+	}
+
+	if v := getenv("MONGODBSTORE_KEYS"); v != "" {
+		for _, s := range strings.Split(v, ",") {
+			var key []byte
+			if s = strings.TrimSpace(s); s != "" {
+				var err error
+				if key, err = base64.StdEncoding.DecodeString(s); err != nil {
+					fail("MONGODBSTORE_KEYS", err)
+				}
+			}
+			cfg.KeyPairs = append(cfg.KeyPairs, key)
+		}
+	}
+	if v := getenv("MONGODBSTORE_MAX_AGE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			fail("MONGODBSTORE_MAX_AGE", err)
+		}
+		cfg.MaxAge = n
+	}
+	boolean("MONGODBSTORE_STRICT", &cfg.Strict)
+	boolean("MONGODBSTORE_ENSURE_TTL", &cfg.EnsureTTL)
+	boolean("MONGODBSTORE_TLS", &cfg.TLS)
+	boolean("MONGODBSTORE_SECURE", &cfg.Secure)
+	duration("MONGODBSTORE_STORAGE_TTL", &cfg.StorageTTL)
+	duration("MONGODBSTORE_IDLE_TIMEOUT", &cfg.IdleTimeout)
+	duration("MONGODBSTORE_CACHE_TTL", &cfg.CacheTTL)
+	boolean("MONGODBSTORE_DEV_FALLBACK", &cfg.DevFallback)
+
+	if len(errs) > 0 {
+		return cfg, fmt.Errorf("mongodbstore: invalid environment: %s", strings.Join(errs, "; "))
+	}
+	return cfg, nil
+}
@@ -0,0 +1,75 @@
+package mongodbstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	hashKey := bytes.Repeat([]byte("h"), 32)
+	env := map[string]string{
+		"MONGODBSTORE_URI":          "mongodb://localhost:27017",
+		"MONGODBSTORE_DATABASE":     "app",
+		"MONGODBSTORE_KEYS":         base64.StdEncoding.EncodeToString(hashKey) + ",",
+		"MONGODBSTORE_MAX_AGE":      "0",
+		"MONGODBSTORE_SECURE":       "true",
+		"MONGODBSTORE_STORAGE_TTL":  "24h",
+		"MONGODBSTORE_IDLE_TIMEOUT": "30m",
+	}
+	cfg, err := configFromEnv(func(name string) string { return env[name] })
+	if err != nil {
+		t.Fatalf("Error reading config: %v", err)
+	}
+	if cfg.URI != env["MONGODBSTORE_URI"] || cfg.Database != "app" || cfg.MaxAge != 0 || !cfg.Secure ||
+		!cfg.EnsureTTL || !cfg.Strict || cfg.StorageTTL != 24*time.Hour || cfg.IdleTimeout != 30*time.Minute {
+		t.Errorf("Unexpected config %+v", cfg)
+	}
+	if len(cfg.KeyPairs) != 2 || !bytes.Equal(cfg.KeyPairs[0], hashKey) || cfg.KeyPairs[1] != nil {
+		t.Errorf("Unexpected keys %q", cfg.KeyPairs)
+	}
+
+	env["MONGODBSTORE_TLS"] = "maybe"
+	env["MONGODBSTORE_CACHE_TTL"] = "soon"
+	if _, err := configFromEnv(func(name string) string { return env[name] }); err == nil {
+		t.Error("Expected invalid values to be reported")
+	}
+}
+
+func TestNewFromConfigStrict(t *testing.T) {
+	_, err := NewFromConfig(context.Background(), Config{
+		URI:      "mongodb://localhost:27017",
+		Database: "app",
+		KeyPairs: [][]byte{[]byte("secret-key")},
+		Strict:   true,
+	})
+	if !errors.Is(err, ErrWeakKeys) {
+		t.Errorf("Expected ErrWeakKeys; Got %v", err)
+	}
+}
+
+func TestConfigClientOptions(t *testing.T) {
+	cfg := Config{URI: "mongodb://localhost:27017", Username: "app", Password: "secret", AuthSource: "admin",
+		AuthMechanism: "SCRAM-SHA-256", TLS: true}
+	opts, err := cfg.clientOptions()
+	if err != nil {
+		t.Fatalf("Error building client options: %v", err)
+	}
+	if opts.TLSConfig == nil || opts.Auth == nil || opts.Auth.Username != "app" ||
+		opts.Auth.AuthMechanism != "SCRAM-SHA-256" {
+		t.Errorf("Unexpected client options %+v", opts)
+	}
+
+	cfg = Config{URI: "mongodb://localhost:27017", AuthMechanism: "MONGODB-X509"}
+	if _, err := cfg.clientOptions(); err == nil {
+		t.Error("Expected X.509 authentication without a certificate to fail")
+	}
+
+	cfg = Config{URI: "mongodb://localhost:27017", TLSCAFile: "testdata/missing.pem"}
+	if _, err := cfg.clientOptions(); err == nil {
+		t.Error("Expected a missing CA file to fail")
+	}
+}
@@ -0,0 +1,55 @@
+package mongodbstore
+
+import (
+	"net/http"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+// PersistPolicy decides per request whether a session may be stored in
+// MongoDB, for example only once the user consented to cookies or only for
+// clients of some regions. Sessions that may not be stored are kept in the
+// cookie itself, encoded with the Codecs like a sessions.CookieStore, and are
+// carried over to MongoDB by the first save the policy allows.
+type PersistPolicy func(r *http.Request, session *sessions.Session) bool
+
+// persist reports whether the session may be stored in MongoDB.
+func (m *MongoDBStore) persist(r *http.Request, session *sessions.Session) bool {
+	return m.PersistPolicy == nil || m.PersistPolicy(r, session)
+}
+
+// decodeCookieOnly decodes the values of a session kept in the cookie into the
+// session. It reports whether the cookie held such a session.
+func (m *MongoDBStore) decodeCookieOnly(session *sessions.Session, cookie string) bool {
+	if m.PersistPolicy == nil {
+		return false
+	}
+	values := make(map[interface{}]interface{})
+	if securecookie.DecodeMulti(session.Name(), cookie, &values, m.CookieCodecs(session.Name())...) != nil {
+		return false
+	}
+	for k, v := range values {
+		session.Values[k] = v
+	}
+	return true
+}
+
+// saveCookieOnly writes the session values to the cookie. A stored document
+// of the session, saved before the policy started refusing storage, is
+// deleted.
+func (m *MongoDBStore) saveCookieOnly(w http.ResponseWriter, session *sessions.Session) error {
+	if session.ID != "" && !session.IsNew {
+		if err := m.delete(session); err != nil {
+			return m.sessionError("delete", session.Name(), err)
+		}
+	}
+	session.ID = ""
+
+	encoded, err := securecookie.EncodeMulti(session.Name(), persistentValues(session), m.CookieCodecs(session.Name())...)
+	if err != nil {
+		return m.sessionError("encode cookie of", session.Name(), err)
+	}
+	m.setToken(w, session, encoded)
+	return nil
+}
@@ -0,0 +1,113 @@
+package mongodbstore
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+func TestPersistPolicyCookieOnly(t *testing.T) {
+	store := newOfflineStore(t)
+	consent := false
+	store.PersistPolicy = func(r *http.Request, _ *sessions.Session) bool {
+		return consent
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	session, err := store.New(r, "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.Values["cart"] = "42"
+	w := httptest.NewRecorder()
+	if err := store.Save(r, w, session); err != nil {
+		t.Fatal(err)
+	}
+	if session.ID != "" {
+		t.Fatalf("session stored without consent: id %q", session.ID)
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	for _, c := range w.Result().Cookies() {
+		r.AddCookie(c)
+	}
+	session, err = store.New(r, "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !session.IsNew || session.Values["cart"] != "42" {
+		t.Fatalf("cookie-only session not restored: new=%v values=%v", session.IsNew, session.Values)
+	}
+
+	// Once the policy allows storage the cookie-only values are carried over
+	// to the stored session.
+	consent = true
+	if !store.persist(r, session) {
+		t.Fatal("persist refused after consent")
+	}
+	session.ID = "5d1f2d6e1c9d440000a1b2c3"
+	s, err := store.document(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[interface{}]interface{})
+	if err := store.decodeMulti("session", s.Data, &values, "", store.dataDecoders("session")...); err != nil {
+		t.Fatal(err)
+	}
+	if values["cart"] != "42" {
+		t.Errorf("stored values = %v", values)
+	}
+}
+
+func TestPersistPolicyIgnoresIDCookies(t *testing.T) {
+	store := newOfflineStore(t)
+	store.PersistPolicy = func(*http.Request, *sessions.Session) bool { return true }
+
+	encoded, err := securecookie.EncodeMulti("session", "5d1f2d6e1c9d440000a1b2c3", store.Codecs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := sessions.NewSession(store, "session")
+	if store.decodeCookieOnly(session, encoded) {
+		t.Error("id cookie decoded as cookie-only session")
+	}
+}
+
+func TestPersistPolicyLogout(t *testing.T) {
+	store := newOfflineStore(t)
+	store.PersistPolicy = func(r *http.Request, _ *sessions.Session) bool {
+		return false
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	session, err := store.New(r, "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.Values["cart"] = "42"
+	w := httptest.NewRecorder()
+	if err := store.Save(r, w, session); err != nil {
+		t.Fatal(err)
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	for _, c := range w.Result().Cookies() {
+		r.AddCookie(c)
+	}
+	session, err = store.New(r, "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.Options.MaxAge = -1
+	w = httptest.NewRecorder()
+	if err := store.Save(r, w, session); err != nil {
+		t.Fatalf("logout of a cookie-only session failed: %v", err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "session" || cookies[0].MaxAge >= 0 {
+		t.Fatalf("cookie not expired: %v", cookies)
+	}
+}
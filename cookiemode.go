@@ -0,0 +1,72 @@
+package mongodbstore
+
+import (
+	"net/http"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+// cookieModeKey holds how saving the session treats its cookie.
+const cookieModeKey transientKey = "cookieMode"
+
+type cookieMode int
+
+const (
+	modeSkipCookie cookieMode = iota + 1
+	modeCookieOnly
+)
+
+// SkipCookie makes saving the session during the current request write it to
+// MongoDB without setting its cookie, so that the response stays cacheable,
+// for example by a CDN. The client keeps the cookie it has, so the session
+// must already have one, or be found otherwise, to be loaded again. It
+// doesn't apply to sessions the PersistPolicy keeps in their cookie.
+func SkipCookie(session *sessions.Session) {
+	session.Values[cookieModeKey] = modeSkipCookie
+}
+
+// CookieOnly makes saving the session during the current request set its
+// cookie again, for example to extend its MaxAge, without writing it to
+// MongoDB: changed values are not saved. The session must have been saved
+// before.
+func CookieOnly(session *sessions.Session) {
+	session.Values[cookieModeKey] = modeCookieOnly
+}
+
+// sessionCookieMode returns the cookie mode of the session, 0 by default.
+func sessionCookieMode(session *sessions.Session) cookieMode {
+	mode, _ := session.Values[cookieModeKey].(cookieMode)
+	return mode
+}
+
+// setCookie sets the token holding the encoded session ID, unless the
+// session skips its cookie.
+func (m *MongoDBStore) setCookie(w http.ResponseWriter, session *sessions.Session) error {
+	if sessionCookieMode(session) == modeSkipCookie {
+		return nil
+	}
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, m.CookieCodecs(session.Name())...)
+	if err != nil {
+		return m.sessionError("encode cookie of", session.Name(), err)
+	}
+	m.setToken(w, session, encoded)
+	return nil
+}
+
+// setToken hands the token of the session to the Token transport, or keeps it
+// for Persist. A CookieToken only expires the chunk cookies the client of the
+// session holds, when known.
+func (m *MongoDBStore) setToken(w http.ResponseWriter, session *sessions.Session, token string) {
+	if tw, ok := w.(*tokenWriter); ok {
+		tw.token = token
+		return
+	}
+	c, ok := m.Token.(*CookieToken)
+	chunks, known := session.Values[tokenChunksKey].(int)
+	if !ok || !known {
+		m.Token.SetToken(w, m.tokenName(session.Name()), token, session.Options)
+		return
+	}
+	session.Values[tokenChunksKey] = c.setToken(w, m.tokenName(session.Name()), token, session.Options, chunks)
+}
@@ -0,0 +1,51 @@
+package mongodbstore
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCookieOnly(t *testing.T) {
+	store := newOfflineStore(t)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	session, _ := store.New(r, "session-key")
+	CookieOnly(session)
+	if err := store.Save(r, httptest.NewRecorder(), session); !errors.Is(err, ErrInvalidID) {
+		t.Errorf("Expected ErrInvalidID for an unsaved session; Got %v", err)
+	}
+
+	// The offline store fails any write.
+	session.ID = primitive.NewObjectID().Hex()
+	session.Values["user"] = "alice"
+	w := httptest.NewRecorder()
+	if err := store.Save(r, w, session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("Expected the cookie of the session; Got %v", cookies)
+	}
+	if id, err := store.parseToken("session-key", cookies[0].Value); err != nil || id != session.ID {
+		t.Errorf("Expected the cookie of the session; Got %v", cookies)
+	}
+}
+
+func TestSkipCookie(t *testing.T) {
+	store := newOfflineStore(t)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	session, _ := store.New(r, "session-key")
+	SkipCookie(session)
+	session.Options.MaxAge = -1
+	w := httptest.NewRecorder()
+	if err := store.SaveAll(r, w); err != nil {
+		t.Fatalf("Error saving sessions: %v", err)
+	}
+	if cookie := w.Header().Get("Set-Cookie"); cookie != "" {
+		t.Errorf("Expected no cookie; Got %q", cookie)
+	}
+}
@@ -0,0 +1,80 @@
+package mongodbstore
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/sessions"
+)
+
+// ErrCSRF is returned by VerifyCSRF when a request doesn't carry the
+// double-submit token of its session.
+var ErrCSRF = errors.New("mongodbstore: CSRF token missing or invalid")
+
+// CSRFHeader is the header in which VerifyCSRF expects the double-submit
+// token.
+const CSRFHeader = "X-CSRF-Token"
+
+// csrfSuffix is appended to the token name of a session to form the name of
+// its CSRF cookie.
+const csrfSuffix = ".csrf"
+
+// CSRFToken returns the double-submit token of the session: the HMAC-SHA256
+// of its name and ID keyed with CSRFKey. The session must be saved first so
+// that it has an ID.
+func (m *MongoDBStore) CSRFToken(session *sessions.Session) (string, error) {
+	if session.ID == "" {
+		return "", m.sessionError("make CSRF token of", session.Name(), ErrInvalidID)
+	}
+	if len(m.CSRFKey) == 0 {
+		return "", m.sessionError("make CSRF token of", session.Name(), errors.New("no CSRFKey"))
+	}
+	mac := hmac.New(sha256.New, m.CSRFKey)
+	mac.Write([]byte(session.Name()))
+	mac.Write([]byte{0})
+	mac.Write([]byte(session.ID))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// SetCSRFCookie sets the companion cookie of the session holding its
+// double-submit token. The cookie has the options of the session but is not
+// HttpOnly, so that scripts of the site can copy it into the CSRFHeader of
+// their requests. It is meant for deployments carrying the session token in
+// a header, where the token itself cannot be read from a cookie.
+func (m *MongoDBStore) SetCSRFCookie(w http.ResponseWriter, session *sessions.Session) error {
+	token, err := m.CSRFToken(session)
+	if err != nil {
+		return err
+	}
+	opts := *session.Options
+	opts.HttpOnly = false
+	http.SetCookie(w, sessions.NewCookie(m.tokenName(session.Name())+csrfSuffix, token, &opts))
+	return nil
+}
+
+// VerifyCSRF checks the double-submit token of a request made with the
+// session: the CSRFHeader and the CSRF cookie must both hold the token of
+// the session. Requests with safe methods are not checked. It returns
+// ErrCSRF, wrapped, when the check fails.
+func (m *MongoDBStore) VerifyCSRF(r *http.Request, session *sessions.Session) error {
+	switch r.Method {
+	case "GET", "HEAD", "OPTIONS", "TRACE":
+		return nil
+	}
+	want, err := m.CSRFToken(session)
+	if err != nil {
+		return err
+	}
+	cookie, err := r.Cookie(m.tokenName(session.Name()) + csrfSuffix)
+	if err != nil {
+		return m.sessionError("verify CSRF token of", session.Name(), ErrCSRF)
+	}
+	header := r.Header.Get(CSRFHeader)
+	if !hmac.Equal([]byte(cookie.Value), []byte(want)) || !hmac.Equal([]byte(header), []byte(want)) {
+		return m.sessionError("verify CSRF token of", session.Name(), ErrCSRF)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package mongodbstore
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/sessions"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCSRF(t *testing.T) {
+	store := newOfflineStore(t)
+	store.CSRFKey = []byte("csrf-key")
+
+	session := sessions.NewSession(store, "session-key")
+	session.Options = &sessions.Options{Path: "/", HttpOnly: true}
+	if err := store.SetCSRFCookie(httptest.NewRecorder(), session); !errors.Is(err, ErrInvalidID) {
+		t.Fatalf("Expected ErrInvalidID for an unsaved session; Got %v", err)
+	}
+	session.ID = primitive.NewObjectID().Hex()
+
+	w := httptest.NewRecorder()
+	if err := store.SetCSRFCookie(w, session); err != nil {
+		t.Fatalf("Error setting CSRF cookie: %v", err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "session-key.csrf" || cookies[0].HttpOnly {
+		t.Fatalf("Expected a readable session-key.csrf cookie; Got %v", cookies)
+	}
+	token := cookies[0].Value
+
+	for _, tt := range []struct {
+		method, cookie, header string
+		ok                     bool
+	}{
+		{"GET", "", "", true},
+		{"POST", token, token, true},
+		{"POST", token, "", false},
+		{"POST", "", token, false},
+		{"POST", "forged", "forged", false},
+	} {
+		r := httptest.NewRequest(tt.method, "/", nil)
+		if tt.cookie != "" {
+			r.Header.Set("Cookie", "session-key.csrf="+tt.cookie)
+		}
+		if tt.header != "" {
+			r.Header.Set(CSRFHeader, tt.header)
+		}
+		err := store.VerifyCSRF(r, session)
+		if tt.ok && err != nil || !tt.ok && !errors.Is(err, ErrCSRF) {
+			t.Errorf("%s %q %q: Expected ok %v; Got %v", tt.method, tt.cookie, tt.header, tt.ok, err)
+		}
+	}
+
+	// The token is bound to the session ID.
+	other := *session
+	other.ID = primitive.NewObjectID().Hex()
+	r := httptest.NewRequest("POST", "/", nil)
+	r.Header.Set("Cookie", "session-key.csrf="+token)
+	r.Header.Set(CSRFHeader, token)
+	if err := store.VerifyCSRF(r, &other); !errors.Is(err, ErrCSRF) {
+		t.Errorf("Expected ErrCSRF for another session; Got %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package mongodbstore
+
+import (
+	"testing"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+func TestDataCodecs(t *testing.T) {
+	store := newOfflineStore(t)
+	session := sessions.NewSession(store, "session-key")
+	session.ID = "5cc8b3a2a4d5b6c7d8e9f0a1"
+	session.Values["foo"] = "bar"
+
+	legacy, err := store.document(session)
+	if err != nil {
+		t.Fatalf("Error encoding session: %v", err)
+	}
+
+	store.DataCodecs = securecookie.CodecsFromPairs([]byte("data-key"))
+	doc, err := store.document(session)
+	if err != nil {
+		t.Fatalf("Error encoding session: %v", err)
+	}
+	values := make(map[interface{}]interface{})
+	if err := securecookie.DecodeMulti("session-key", doc.Data, &values, store.Codecs...); err == nil {
+		t.Errorf("Expected data not to be decodable with the cookie codecs")
+	}
+
+	for _, data := range []string{doc.Data, legacy.Data} {
+		values := make(map[interface{}]interface{})
+		if err := store.decodeMulti("session-key", data, &values, "", store.dataDecoders("session-key")...); err != nil ||
+			values["foo"] != "bar" {
+			t.Errorf("Expected data to decode; Got %v, %v", values, err)
+		}
+	}
+}
+
+func TestDataIgnoresCookieMaxAge(t *testing.T) {
+	store := newOfflineStore(t)
+	session := sessions.NewSession(store, "session-key")
+	session.ID = "5cc8b3a2a4d5b6c7d8e9f0a1"
+	session.Values["foo"] = "bar"
+
+	doc, err := store.document(session)
+	if err != nil {
+		t.Fatalf("Error encoding session: %v", err)
+	}
+
+	// A negative MaxAge makes every timestamp too old, like a data payload
+	// saved long before the cookie MaxAge was shortened.
+	store.Codecs[0].(*securecookie.SecureCookie).MaxAge(-10)
+	values := make(map[interface{}]interface{})
+	if err := securecookie.DecodeMulti("session-key", doc.Data, &values, store.Codecs...); err == nil {
+		t.Fatal("Expected the cookie codecs to reject the timestamp")
+	}
+	if err := store.decodeMulti("session-key", doc.Data, &values, "", store.dataDecoders("session-key")...); err != nil ||
+		values["foo"] != "bar" {
+		t.Errorf("Expected data to decode regardless of MaxAge; Got %v, %v", values, err)
+	}
+}
+
+func TestNameCodecs(t *testing.T) {
+	store := newOfflineStore(t)
+	store.NameCodecs = map[string][]securecookie.Codec{
+		"auth": securecookie.CodecsFromPairs([]byte("auth-key")),
+	}
+	id := "5cc8b3a2a4d5b6c7d8e9f0a1"
+
+	auth, err := securecookie.EncodeMulti("auth", id, store.CookieCodecs("auth")...)
+	if err != nil {
+		t.Fatalf("Error encoding cookie: %v", err)
+	}
+	if got, err := store.parseToken("auth", auth); err != nil || got != id {
+		t.Errorf("Expected the auth cookie to decode; Got %q, %v", got, err)
+	}
+	forged, _ := securecookie.EncodeMulti("auth", id, store.Codecs...)
+	if _, err := store.parseToken("auth", forged); err == nil {
+		t.Error("Expected an auth cookie signed with Codecs to be rejected")
+	}
+
+	prefs, _ := securecookie.EncodeMulti("prefs", id, store.Codecs...)
+	if got, err := store.parseToken("prefs", prefs); err != nil || got != id {
+		t.Errorf("Expected the prefs cookie to decode with Codecs; Got %q, %v", got, err)
+	}
+
+	session := sessions.NewSession(store, "auth")
+	session.ID = id
+	session.Values["foo"] = "bar"
+	doc, err := store.document(session)
+	if err != nil {
+		t.Fatalf("Error encoding session: %v", err)
+	}
+	values := make(map[interface{}]interface{})
+	if err := securecookie.DecodeMulti("auth", doc.Data, &values, store.Codecs...); err == nil {
+		t.Error("Expected auth data not to be decodable with Codecs")
+	}
+}
@@ -0,0 +1,197 @@
+package mongodbstore
+
+import (
+	"container/list"
+	"reflect"
+	"sync"
+
+	"github.com/gorilla/securecookie"
+)
+
+// decodeMulti decodes value like securecookie.DecodeMulti. When the data of a
+// session was last decoded by a codec other than the first one, the index of
+// that codec is remembered under hint and tried first next time. With
+// DecodeConcurrency above 1 the codecs are tried concurrently.
+func (m *MongoDBStore) decodeMulti(name, value string, dst interface{}, hint string,
+	codecs ...securecookie.Codec) error {
+	if len(codecs) == 0 {
+		return securecookie.DecodeMulti(name, value, dst, codecs...)
+	}
+
+	if hint != "" {
+		if i, ok := m.keyHints.get(hint); ok && i < len(codecs) {
+			if err := codecs[i].Decode(name, value, dst); err == nil {
+				return nil
+			}
+		}
+	}
+
+	var i int
+	var err error
+	if m.DecodeConcurrency > 1 && len(codecs) > 1 {
+		i, err = decodeConcurrent(name, value, dst, m.DecodeConcurrency, codecs)
+	} else {
+		i, err = decodeSerial(name, value, dst, codecs)
+	}
+	if err != nil {
+		return err
+	}
+
+	if hint != "" {
+		if i > 0 {
+			m.keyHints.put(hint, i)
+		} else {
+			m.keyHints.remove(hint)
+		}
+	}
+	return nil
+}
+
+func decodeSerial(name, value string, dst interface{}, codecs []securecookie.Codec) (int, error) {
+	var errors securecookie.MultiError
+	for i, codec := range codecs {
+		err := codec.Decode(name, value, dst)
+		if err == nil {
+			return i, nil
+		}
+		errors = append(errors, err)
+	}
+	return -1, errors
+}
+
+// decodeConcurrent tries at most limit codecs at a time, each decoding into
+// its own copy of dst, and stores the result of the lowest successful codec
+// into dst. A map result is merged into the map dst points to, like a codec
+// decoding into dst directly would, so that values already set are kept.
+func decodeConcurrent(name, value string, dst interface{}, limit int,
+	codecs []securecookie.Codec) (int, error) {
+	typ := reflect.TypeOf(dst)
+	if typ.Kind() != reflect.Ptr {
+		return decodeSerial(name, value, dst, codecs)
+	}
+
+	results := make([]reflect.Value, len(codecs))
+	errors := make(securecookie.MultiError, len(codecs))
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i, codec := range codecs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, codec securecookie.Codec) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			v := reflect.New(typ.Elem())
+			if err := codec.Decode(name, value, v.Interface()); err != nil {
+				errors[i] = err
+				return
+			}
+			results[i] = v
+		}(i, codec)
+	}
+	wg.Wait()
+
+	for i, v := range results {
+		if v.IsValid() {
+			merge(reflect.ValueOf(dst).Elem(), v.Elem())
+			return i, nil
+		}
+	}
+	return -1, errors
+}
+
+// merge stores the decoded value into dst, adding the entries of a map to the
+// map dst already holds, if any.
+func merge(dst, decoded reflect.Value) {
+	if dst.Kind() != reflect.Map || dst.IsNil() {
+		dst.Set(decoded)
+		return
+	}
+	iter := decoded.MapRange()
+	for iter.Next() {
+		dst.SetMapIndex(iter.Key(), iter.Value())
+	}
+}
+
+// keyHintsSize is the number of sessions whose codec index is remembered.
+const keyHintsSize = 10000
+
+// keyHints remembers the index of the codec that last decoded the data of a
+// session, for the keyHintsSize sessions that used one most recently.
+type keyHints struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     list.List
+}
+
+type keyHint struct {
+	key   string
+	index int
+}
+
+func (h *keyHints) get(key string) (int, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	e, ok := h.entries[key]
+	if !ok {
+		return 0, false
+	}
+	h.lru.MoveToFront(e)
+	return e.Value.(*keyHint).index, true
+}
+
+func (h *keyHints) put(key string, index int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if e, ok := h.entries[key]; ok {
+		e.Value.(*keyHint).index = index
+		h.lru.MoveToFront(e)
+		return
+	}
+	if h.entries == nil {
+		h.entries = make(map[string]*list.Element)
+	}
+	if h.lru.Len() >= keyHintsSize {
+		oldest := h.lru.Back()
+		h.lru.Remove(oldest)
+		delete(h.entries, oldest.Value.(*keyHint).key)
+	}
+	h.entries[key] = h.lru.PushFront(&keyHint{key: key, index: index})
+}
+
+func (h *keyHints) remove(key string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if e, ok := h.entries[key]; ok {
+		h.lru.Remove(e)
+		delete(h.entries, key)
+	}
+}
+
+// reset forgets all hints.
+func (h *keyHints) reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.entries = nil
+	h.lru.Init()
+}
+
+// withoutMaxAge returns the codecs with copies of the securecookie codecs that
+// don't check the timestamp of the values they decode.
+func withoutMaxAge(codecs []securecookie.Codec) []securecookie.Codec {
+	out := codecs[:0:0]
+	for _, codec := range codecs {
+		if sc, ok := codec.(*securecookie.SecureCookie); ok {
+			c := *sc
+			c.MaxAge(0)
+			codec = &c
+		}
+		out = append(out, codec)
+	}
+	return out
+}
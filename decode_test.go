@@ -0,0 +1,74 @@
+package mongodbstore
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gorilla/securecookie"
+)
+
+func TestDecodeMulti(t *testing.T) {
+	codecs := securecookie.CodecsFromPairs([]byte("key-1"), nil, []byte("key-2"), nil, []byte("key-3"), nil)
+	encoded, err := codecs[2].Encode("session-key", "5cc8b3a2a4d5b6c7d8e9f0a1")
+	if err != nil {
+		t.Fatalf("Error encoding: %v", err)
+	}
+
+	for _, concurrency := range []int{0, 2, 8} {
+		store := newOfflineStore(t)
+		store.DecodeConcurrency = concurrency
+
+		var id string
+		if err := store.decodeMulti("session-key", encoded, &id, "hint", codecs...); err != nil {
+			t.Fatalf("Error decoding with concurrency %d: %v", concurrency, err)
+		}
+		if id != "5cc8b3a2a4d5b6c7d8e9f0a1" {
+			t.Errorf("Expected decoded id; Got %q", id)
+		}
+		if i, ok := store.keyHints.get("hint"); !ok || i != 2 {
+			t.Errorf("Expected key hint 2; Got %v", i)
+		}
+
+		if err := store.decodeMulti("session-key", "garbage", &id, "", codecs...); err == nil {
+			t.Errorf("Expected error decoding garbage with concurrency %d", concurrency)
+		} else if multi, ok := err.(securecookie.MultiError); !ok || len(multi) != 3 {
+			t.Errorf("Expected MultiError with 3 errors; Got %#v", err)
+		}
+	}
+}
+
+func TestDecodeConcurrentKeepsValues(t *testing.T) {
+	codecs := securecookie.CodecsFromPairs([]byte("key-1"), nil, []byte("key-2"), nil)
+	encoded, err := codecs[1].Encode("session-key", map[interface{}]interface{}{"foo": "bar"})
+	if err != nil {
+		t.Fatalf("Error encoding: %v", err)
+	}
+
+	store := newOfflineStore(t)
+	store.DecodeConcurrency = 2
+	values := map[interface{}]interface{}{tenantKey: "acme"}
+	if err := store.decodeMulti("session-key", encoded, &values, "", codecs...); err != nil {
+		t.Fatalf("Error decoding: %v", err)
+	}
+	if values["foo"] != "bar" || values[tenantKey] != "acme" {
+		t.Errorf("Expected decoded and preset values; Got %v", values)
+	}
+}
+
+func TestKeyHintsBounded(t *testing.T) {
+	var hints keyHints
+	for i := 0; i <= keyHintsSize; i++ {
+		hints.put(fmt.Sprint(i), 1)
+	}
+	hints.get("1")
+	hints.put("new", 1)
+	if len(hints.entries) != keyHintsSize || hints.lru.Len() != keyHintsSize {
+		t.Errorf("Expected %d hints; Got %d", keyHintsSize, len(hints.entries))
+	}
+	if _, ok := hints.get("0"); ok {
+		t.Errorf("Expected the least recently used hint to be dropped")
+	}
+	if _, ok := hints.get("1"); !ok {
+		t.Errorf("Expected a recently used hint to be kept")
+	}
+}
@@ -0,0 +1,164 @@
+package mongodbstore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/gorilla/securecookie"
+)
+
+// SortedGobSerializer is a securecookie.Serializer encoding session values
+// with gob in the order of their keys, so that equal values always encode to
+// the same bytes. Maps nested in values are still encoded in random order.
+type SortedGobSerializer struct{}
+
+// sortedEntry is a session value encoded by SortedGobSerializer.
+type sortedEntry struct {
+	Key   interface{}
+	Value interface{}
+}
+
+// Serialize encodes a value using gob, sorting the entries of session values.
+func (SortedGobSerializer) Serialize(src interface{}) ([]byte, error) {
+	var values map[interface{}]interface{}
+	switch v := src.(type) {
+	case map[interface{}]interface{}:
+		values = v
+	case *map[interface{}]interface{}:
+		values = *v
+	default:
+		return securecookie.GobEncoder{}.Serialize(src)
+	}
+
+	entries := make([]sortedEntry, 0, len(values))
+	keys := make([]string, 0, len(values))
+	for k, v := range values {
+		entries = append(entries, sortedEntry{Key: k, Value: v})
+		keys = append(keys, fmt.Sprintf("%T:%v", k, k))
+	}
+	sort.Sort(byKey{entries, keys})
+	return securecookie.GobEncoder{}.Serialize(entries)
+}
+
+// Deserialize decodes a value encoded by Serialize.
+func (SortedGobSerializer) Deserialize(src []byte, dst interface{}) error {
+	values, ok := dst.(*map[interface{}]interface{})
+	if !ok {
+		return securecookie.GobEncoder{}.Deserialize(src, dst)
+	}
+
+	var entries []sortedEntry
+	if err := (securecookie.GobEncoder{}).Deserialize(src, &entries); err != nil {
+		return err
+	}
+	if *values == nil {
+		*values = make(map[interface{}]interface{}, len(entries))
+	}
+	for _, e := range entries {
+		(*values)[e.Key] = e.Value
+	}
+	return nil
+}
+
+// byKey sorts entries by the string form of their keys.
+type byKey struct {
+	entries []sortedEntry
+	keys    []string
+}
+
+func (b byKey) Len() int           { return len(b.entries) }
+func (b byKey) Less(i, j int) bool { return b.keys[i] < b.keys[j] }
+func (b byKey) Swap(i, j int) {
+	b.entries[i], b.entries[j] = b.entries[j], b.entries[i]
+	b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
+}
+
+// errDeterministicMAC is returned when a value decoded by a
+// DeterministicCodec fails authentication.
+var errDeterministicMAC = errors.New("mongodbstore: deterministic codec: invalid value")
+
+// DeterministicCodec is a securecookie.Codec whose output only depends on its
+// input and on its nonce source, for golden-file tests of cookies and stored
+// documents. It signs values with HMAC-SHA256 and, with a block key,
+// encrypts them with AES-CTR using nonces read from the nonce source. Unlike
+// securecookie it doesn't timestamp values. Don't use it in production: a
+// fixed nonce source makes the encryption insecure.
+type DeterministicCodec struct {
+	hashKey []byte
+	block   cipher.Block
+	nonce   io.Reader
+}
+
+// NewDeterministicCodec returns a DeterministicCodec. blockKey may be nil to
+// only sign values. nonce may be nil to use zero nonces.
+func NewDeterministicCodec(hashKey, blockKey []byte, nonce io.Reader) (*DeterministicCodec, error) {
+	if len(hashKey) == 0 {
+		return nil, errors.New("mongodbstore: deterministic codec needs a hash key")
+	}
+	c := &DeterministicCodec{hashKey: hashKey, nonce: nonce}
+	if blockKey != nil {
+		block, err := aes.NewCipher(blockKey)
+		if err != nil {
+			return nil, err
+		}
+		c.block = block
+	}
+	return c, nil
+}
+
+// Encode serializes, encrypts and signs the value.
+func (c *DeterministicCodec) Encode(name string, value interface{}) (string, error) {
+	b, err := SortedGobSerializer{}.Serialize(value)
+	if err != nil {
+		return "", err
+	}
+	if c.block != nil {
+		iv := make([]byte, c.block.BlockSize())
+		if c.nonce != nil {
+			if _, err := io.ReadFull(c.nonce, iv); err != nil {
+				return "", err
+			}
+		}
+		cipher.NewCTR(c.block, iv).XORKeyStream(b, b)
+		b = append(iv, b...)
+	}
+	b = append(b, c.mac(name, b)...)
+	return base64.URLEncoding.EncodeToString(b), nil
+}
+
+// Decode verifies, decrypts and deserializes the value.
+func (c *DeterministicCodec) Decode(name, value string, dst interface{}) error {
+	b, err := base64.URLEncoding.DecodeString(value)
+	if err != nil || len(b) < sha256.Size {
+		return errDeterministicMAC
+	}
+	b, mac := b[:len(b)-sha256.Size], b[len(b)-sha256.Size:]
+	if !hmac.Equal(mac, c.mac(name, b)) {
+		return errDeterministicMAC
+	}
+	if c.block != nil {
+		size := c.block.BlockSize()
+		if len(b) < size {
+			return errDeterministicMAC
+		}
+		iv, payload := b[:size], append([]byte(nil), b[size:]...)
+		cipher.NewCTR(c.block, iv).XORKeyStream(payload, payload)
+		b = payload
+	}
+	return SortedGobSerializer{}.Deserialize(b, dst)
+}
+
+func (c *DeterministicCodec) mac(name string, b []byte) []byte {
+	h := hmac.New(sha256.New, c.hashKey)
+	h.Write([]byte(name))
+	h.Write([]byte{'|'})
+	h.Write(b)
+	return h.Sum(nil)
+}
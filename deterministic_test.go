@@ -0,0 +1,64 @@
+package mongodbstore
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+func TestDeterministicCodec(t *testing.T) {
+	nonce := func() *bytes.Reader { return bytes.NewReader(bytes.Repeat([]byte{7}, 64)) }
+	newCodec := func() *DeterministicCodec {
+		codec, err := NewDeterministicCodec([]byte("hash-key"), bytes.Repeat([]byte("b"), 16), nonce())
+		if err != nil {
+			t.Fatalf("Error creating codec: %v", err)
+		}
+		return codec
+	}
+
+	values := map[interface{}]interface{}{}
+	for _, k := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		values[k] = k + "-value"
+	}
+	first, err := newCodec().Encode("session-key", values)
+	if err != nil {
+		t.Fatalf("Error encoding: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		if again, _ := newCodec().Encode("session-key", values); again != first {
+			t.Fatalf("Expected stable encoding; Got %s and %s", first, again)
+		}
+	}
+
+	decoded := make(map[interface{}]interface{})
+	if err := newCodec().Decode("session-key", first, &decoded); err != nil || decoded["c"] != "c-value" {
+		t.Errorf("Expected values to decode; Got %v, %v", decoded, err)
+	}
+	if err := newCodec().Decode("other-name", first, &decoded); err == nil {
+		t.Error("Expected a value of another name to be rejected")
+	}
+}
+
+func TestDeterministicStoreData(t *testing.T) {
+	store := newOfflineStore(t)
+	codec, err := NewDeterministicCodec([]byte("hash-key"), nil, nil)
+	if err != nil {
+		t.Fatalf("Error creating codec: %v", err)
+	}
+	store.Codecs = []securecookie.Codec{codec}
+
+	session := sessions.NewSession(store, "session-key")
+	session.ID = "5cc8b3a2a4d5b6c7d8e9f0a1"
+	session.Values["user"] = "alice"
+	session.Values["role"] = "admin"
+	first, err := store.document(session)
+	if err != nil {
+		t.Fatalf("Error encoding session: %v", err)
+	}
+	second, _ := store.document(session)
+	if first.Data != second.Data || first.Checksum != second.Checksum {
+		t.Error("Expected stored data to be stable")
+	}
+}
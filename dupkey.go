@@ -0,0 +1,42 @@
+package mongodbstore
+
+import "go.mongodb.org/mongo-driver/mongo"
+
+// duplicateKeyCode is the MongoDB error code of duplicate key errors.
+const duplicateKeyCode = 11000
+
+// isDuplicateKey reports whether err is, or for bulk writes contains, a
+// duplicate key error.
+func isDuplicateKey(err error) bool {
+	switch e := err.(type) {
+	case mongo.WriteException:
+		for _, we := range e.WriteErrors {
+			if we.Code == duplicateKeyCode {
+				return true
+			}
+		}
+	case mongo.BulkWriteException:
+		for _, we := range e.WriteErrors {
+			if we.Code == duplicateKeyCode {
+				return true
+			}
+		}
+	case mongo.CommandError:
+		return e.Code == duplicateKeyCode
+	}
+	return false
+}
+
+// duplicateKeyWrites returns the indexes of the writes of a bulk write that
+// failed with a duplicate key error.
+func duplicateKeyWrites(err error) map[int]bool {
+	indexes := make(map[int]bool)
+	if e, ok := err.(mongo.BulkWriteException); ok {
+		for _, we := range e.WriteErrors {
+			if we.Code == duplicateKeyCode {
+				indexes[we.Index] = true
+			}
+		}
+	}
+	return indexes
+}
@@ -0,0 +1,39 @@
+package mongodbstore
+
+import (
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestIsDuplicateKey(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("boom"), false},
+		{mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000}}}, true},
+		{mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 121}}}, false},
+		{mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{{WriteError: mongo.WriteError{Code: 11000}}}}, true},
+		{mongo.CommandError{Code: 11000}, true},
+	} {
+		if got := isDuplicateKey(tc.err); got != tc.want {
+			t.Errorf("isDuplicateKey(%v) = %v; want %v", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestDuplicateKeyWrites(t *testing.T) {
+	err := mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{
+		{WriteError: mongo.WriteError{Index: 1, Code: 11000}},
+		{WriteError: mongo.WriteError{Index: 2, Code: 121}},
+	}}
+	if got := duplicateKeyWrites(err); len(got) != 1 || !got[1] {
+		t.Errorf("Expected only write 1; Got %v", got)
+	}
+	if got := duplicateKeyWrites(errors.New("boom")); len(got) != 0 {
+		t.Errorf("Expected no writes; Got %v", got)
+	}
+}
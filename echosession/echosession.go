@@ -0,0 +1,75 @@
+// Package echosession provides an Echo middleware that loads the session of
+// a mongodbstore.MongoDBStore before the handler and saves the sessions of the
+// request before the response is written, so that Echo applications share
+// the sessions of gorilla/sessions and Fiber based ones.
+//
+// Echo handlers get an echo.Context rather than an *http.Request, and Echo
+// commits the response headers as soon as the handler writes the body, so the
+// sessions are saved in a Before hook of the response:
+//
+//	e.Use(echosession.Middleware(&mongodbstore.Middleware{Store: store, Name: "session"}))
+//
+//	e.GET("/", func(c echo.Context) error {
+//		session, err := echosession.Get(c, "session")
+//		...
+//	})
+package echosession
+
+import (
+	"net/http"
+
+	"github.com/ashulepov/mongodbstore"
+	gcontext "github.com/gorilla/context"
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo/v4"
+)
+
+// storeKey is the key of the store in the Echo context.
+const storeKey = "mongodbstore.echosession"
+
+// Middleware returns an Echo middleware loading the session named mw.Name
+// through mw, which handles the requests whose session can't be loaded.
+// Every session of the request is saved with SaveAll before the response is
+// committed, or after the handler if it wrote nothing. A save failure after
+// the handler wrote the body can only be logged, with the logger of Echo.
+//
+// The gorilla context of the request is cleared after the handler.
+func Middleware(mw *mongodbstore.Middleware) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			r := c.Request()
+			defer gcontext.Clear(r)
+
+			var err error
+			mw.ServeHTTP(c.Response(), r, func(w http.ResponseWriter, r *http.Request) {
+				c.Set(storeKey, mw.Store)
+				saved := false
+				save := func() error {
+					saved = true
+					return mw.Store.SaveAll(r, c.Response())
+				}
+				c.Response().Before(func() {
+					if err := save(); err != nil {
+						c.Logger().Error(err)
+					}
+				})
+
+				err = next(c)
+				if err == nil && !saved && !c.Response().Committed {
+					err = save()
+				}
+			})
+			return err
+		}
+	}
+}
+
+// Get returns the session named name of the request, loaded by the
+// middleware or on first use.
+func Get(c echo.Context, name string) (*sessions.Session, error) {
+	store, ok := c.Get(storeKey).(*mongodbstore.MongoDBStore)
+	if !ok {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "echosession: middleware not installed")
+	}
+	return store.Get(c.Request(), name)
+}
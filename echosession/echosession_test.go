@@ -0,0 +1,80 @@
+package echosession
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ashulepov/mongodbstore"
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func newStore(t *testing.T) *mongodbstore.MongoDBStore {
+	client, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	if err != nil {
+		t.Fatalf("Error creating client: %v", err)
+	}
+	store := mongodbstore.NewMongoDBStore(client.Database("test").Collection("test_session"), 3600, false,
+		[]byte("secret-key"))
+	// Sessions kept in their cookies are saved without MongoDB.
+	store.PersistPolicy = func(*http.Request, *sessions.Session) bool { return false }
+	return store
+}
+
+func TestMiddleware(t *testing.T) {
+	store := newStore(t)
+	e := echo.New()
+	e.Use(Middleware(&mongodbstore.Middleware{Store: store, Name: "session"}))
+	e.GET("/write", func(c echo.Context) error {
+		session, err := Get(c, "session")
+		if err != nil {
+			return err
+		}
+		n, _ := session.Values["visits"].(int)
+		session.Values["visits"] = n + 1
+		return c.String(http.StatusOK, "ok")
+	})
+	e.GET("/empty", func(c echo.Context) error {
+		session, err := Get(c, "session")
+		if err != nil {
+			return err
+		}
+		session.Values["empty"] = true
+		return nil
+	})
+
+	var cookie string
+	for i, path := range []string{"/write", "/write", "/empty"} {
+		req := httptest.NewRequest("GET", path, nil)
+		if cookie != "" {
+			req.Header.Set("Cookie", cookie)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200 for %s; Got %d %s", path, rec.Code, rec.Body)
+		}
+		cookies := rec.Result().Cookies()
+		if len(cookies) != 1 {
+			t.Fatalf("Expected the session cookie for request %d; Got %v", i, cookies)
+		}
+		cookie = (&http.Cookie{Name: cookies[0].Name, Value: cookies[0].Value}).String()
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Cookie", cookie)
+	session, err := store.New(req, "session")
+	if err != nil || session.Values["visits"] != 2 || session.Values["empty"] != true {
+		t.Errorf("Expected the values saved by the handlers; Got %v, %v", session.Values, err)
+	}
+}
+
+func TestGetWithoutMiddleware(t *testing.T) {
+	c := echo.New().NewContext(httptest.NewRequest("GET", "/", nil), httptest.NewRecorder())
+	if _, err := Get(c, "session"); err == nil {
+		t.Errorf("Expected an error without the middleware")
+	}
+}
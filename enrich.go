@@ -0,0 +1,48 @@
+package mongodbstore
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/gorilla/sessions"
+)
+
+// Enrichment is what an Enricher knows about the client that created a
+// session. It is stored with the Metadata of the session document.
+type Enrichment struct {
+	Country     string `bson:"country,omitempty"`
+	ASN         uint32 `bson:"asn,omitempty"`
+	DeviceClass string `bson:"deviceClass,omitempty"`
+}
+
+// Enricher derives information about a client from its address and user
+// agent, typically with GeoIP databases and a user agent parser, for device
+// management and analytics.
+type Enricher interface {
+	Enrich(ip net.IP, userAgent string) (Enrichment, error)
+}
+
+// NopEnricher is the default Enricher. It knows nothing.
+type NopEnricher struct{}
+
+// Enrich returns an empty Enrichment.
+func (NopEnricher) Enrich(net.IP, string) (Enrichment, error) {
+	return Enrichment{}, nil
+}
+
+// enrich enriches the metadata captured for a new session before it is first
+// saved. The address passed to the Enricher is the one of the request, before
+// the IPPolicy applies; only the Enrichment is stored.
+func (m *MongoDBStore) enrich(r *http.Request, session *sessions.Session) {
+	meta := storedMetadata(session.IsNew, session.Values)
+	if meta == nil || meta.enriched || m.Enricher == nil {
+		return
+	}
+	meta.enriched = true
+	e, err := m.Enricher.Enrich(clientIP(r), r.UserAgent())
+	if err != nil {
+		m.reportError(r.Context(), "enrich", m.sessionError("enrich metadata of", session.Name(), err))
+		return
+	}
+	meta.Enrichment = e
+}
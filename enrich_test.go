@@ -0,0 +1,110 @@
+package mongodbstore
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"testing"
+)
+
+type fakeEnricher struct{ calls int }
+
+func (f *fakeEnricher) Enrich(ip net.IP, userAgent string) (Enrichment, error) {
+	f.calls++
+	if ip.String() != "192.0.2.17" || userAgent != "test-agent" {
+		return Enrichment{}, errors.New("unexpected client")
+	}
+	return Enrichment{Country: "FR", ASN: 64496, DeviceClass: "desktop"}, nil
+}
+
+func TestMetadataEnriched(t *testing.T) {
+	store := newOfflineStore(t)
+	store.CaptureMetadata = true
+	store.IPPolicy = IPNone
+	enricher := &fakeEnricher{}
+	store.Enricher = enricher
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "192.0.2.17:1234"
+	r.Header.Set("User-Agent", "test-agent")
+	session, err := store.New(r, "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.ID = "5d1f2d6e1c9d440000a1b2c3"
+
+	store.enrich(r, session)
+	store.enrich(r, session)
+	if enricher.calls != 1 {
+		t.Errorf("enricher called %d times, want 1", enricher.calls)
+	}
+
+	s, err := store.document(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Enrichment{Country: "FR", ASN: 64496, DeviceClass: "desktop"}
+	if s.Metadata == nil || s.Metadata.Enrichment != want || s.Metadata.IP != "" {
+		t.Fatalf("metadata = %+v", s.Metadata)
+	}
+}
+
+func TestEnrichError(t *testing.T) {
+	store := newOfflineStore(t)
+	store.CaptureMetadata = true
+	enricher := &fakeEnricher{}
+	store.Enricher = enricher
+	var reported []error
+	store.WithErrorHandler(func(ctx context.Context, op string, err error) {
+		if op == "enrich" {
+			reported = append(reported, err)
+		}
+	})
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "198.51.100.1:1234"
+	session, err := store.New(r, "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.ID = "5d1f2d6e1c9d440000a1b2c3"
+
+	store.enrich(r, session)
+	store.enrich(r, session)
+	if enricher.calls != 1 || len(reported) != 1 {
+		t.Errorf("Expected one failed call reported; Got %d calls, %v", enricher.calls, reported)
+	}
+	s, err := store.document(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Metadata == nil || s.Metadata.Enrichment != (Enrichment{}) {
+		t.Errorf("Expected the metadata without enrichment; Got %+v", s.Metadata)
+	}
+}
+
+func TestEnrichSkipsExisting(t *testing.T) {
+	store := newOfflineStore(t)
+	store.CaptureMetadata = true
+	enricher := &fakeEnricher{}
+	store.Enricher = enricher
+
+	r := httptest.NewRequest("GET", "/", nil)
+	session, err := store.New(r, "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.IsNew = false
+	store.enrich(r, session)
+	if enricher.calls != 0 {
+		t.Errorf("Expected sessions already saved not to be enriched; Got %d calls", enricher.calls)
+	}
+
+	store.Enricher = nil
+	session.IsNew = true
+	store.enrich(r, session)
+	if meta := storedMetadata(true, session.Values); meta == nil || meta.enriched {
+		t.Errorf("Expected no enrichment without an Enricher; Got %+v", meta)
+	}
+}
@@ -0,0 +1,80 @@
+package mongodbstore
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// errorHandler receives errors the store cannot return to a caller.
+type errorHandler struct {
+	mu      sync.Mutex
+	handler func(ctx context.Context, op string, err error)
+	pending []pendingError
+}
+
+type pendingError struct {
+	op  string
+	err error
+}
+
+// WithErrorHandler sets the function called with errors that the store
+// cannot return to a caller, such as failures to create indexes, to flush
+// buffered writes in the background or to load a session that is then
+// replaced by a new one. Errors that occurred before the handler was set,
+// in NewMongoDBStore, are passed to it right away. It returns the store to
+// allow chaining with the constructor.
+func (m *MongoDBStore) WithErrorHandler(h func(ctx context.Context, op string, err error)) *MongoDBStore {
+	m.errHandler.mu.Lock()
+	m.errHandler.handler = h
+	pending := m.errHandler.pending
+	m.errHandler.pending = nil
+	m.errHandler.mu.Unlock()
+
+	if h != nil {
+		for _, p := range pending {
+			h(context.Background(), p.op, p.err)
+		}
+	}
+	return m
+}
+
+// reportError passes err to the error handler. Until a handler is set, errors
+// are kept so the handler receives them once set.
+func (m *MongoDBStore) reportError(ctx context.Context, op string, err error) {
+	if err == nil {
+		return
+	}
+
+	m.errHandler.mu.Lock()
+	h := m.errHandler.handler
+	if h == nil && len(m.errHandler.pending) < maxPendingErrors {
+		m.errHandler.pending = append(m.errHandler.pending, pendingError{op: op, err: err})
+	}
+	m.errHandler.mu.Unlock()
+
+	if h != nil {
+		h(ctx, op, err)
+	}
+}
+
+// maxPendingErrors bounds the errors kept while no handler is set.
+const maxPendingErrors = 16
+
+// sessionError wraps err with the operation, the session name and the
+// collection name. The original error stays available to errors.Is and
+// errors.As.
+func (m *MongoDBStore) sessionError(op, name string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("mongodbstore: %s session %q in collection %s: %w", op, name, m.collection.Name(), err)
+}
+
+// opError wraps err with the operation and the collection name.
+func (m *MongoDBStore) opError(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("mongodbstore: %s in collection %s: %w", op, m.collection.Name(), err)
+}
@@ -0,0 +1,43 @@
+package mongodbstore
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestErrorWrapping(t *testing.T) {
+	store := newOfflineStore(t)
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, _ := store.New(req, "session-key")
+	session.ID = "not-an-object-id"
+	session.Options.MaxAge = -1
+
+	err := store.Save(req, httptest.NewRecorder(), session)
+	if !errors.Is(err, ErrInvalidID) {
+		t.Errorf("Expected ErrInvalidID; Got %v", err)
+	}
+	for _, part := range []string{"delete", "session-key", "test_session"} {
+		if !strings.Contains(err.Error(), part) {
+			t.Errorf("Expected %q in error %q", part, err)
+		}
+	}
+}
+
+func TestErrorHandler(t *testing.T) {
+	store := newOfflineStore(t)
+	store.reportError(context.Background(), "create index", errors.New("early"))
+
+	var ops []string
+	store.WithErrorHandler(func(ctx context.Context, op string, err error) {
+		ops = append(ops, op+": "+err.Error())
+	})
+	store.reportError(context.Background(), "flush", errors.New("late"))
+
+	if len(ops) != 2 || ops[0] != "create index: early" || ops[1] != "flush: late" {
+		t.Errorf("Expected early and late errors; Got %v", ops)
+	}
+}
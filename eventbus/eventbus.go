@@ -0,0 +1,72 @@
+// Package eventbus publishes the session lifecycle events of a
+// mongodbstore.MongoDBStore to NATS or Kafka, for real-time analytics and
+// fraud detection.
+//
+// Like fiberstorage, the package doesn't import the clients: NATS takes the
+// Publish method of a *nats.Conn, and Kafka takes a function writing a
+// message with the producer of choice:
+//
+//	store.EnablePublisher(&eventbus.NATS{Conn: nc, Subject: "sessions"}, 1000)
+//
+//	store.EnablePublisher(&eventbus.Kafka{
+//		Topic: "sessions",
+//		Write: func(ctx context.Context, topic string, key, value []byte) error {
+//			return w.WriteMessages(ctx, kafka.Message{Topic: topic, Key: key, Value: value})
+//		},
+//	}, 1000)
+//
+// Events are encoded as JSON.
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/ashulepov/mongodbstore"
+)
+
+// NATSConn is the part of *nats.Conn used to publish events.
+type NATSConn interface {
+	Publish(subject string, data []byte) error
+}
+
+// NATS publishes events to NATS subjects named after the Subject and the
+// event type, such as sessions.session.created.
+type NATS struct {
+	Conn    NATSConn
+	Subject string
+}
+
+// Publish publishes the event.
+func (p *NATS) Publish(ctx context.Context, e mongodbstore.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	subject := string(e.Type)
+	if p.Subject != "" {
+		subject = p.Subject + "." + subject
+	}
+	return p.Conn.Publish(subject, data)
+}
+
+// Kafka publishes events to a Kafka topic. Messages are keyed by the session
+// id, or by the principal for revocations, so that the events of a session
+// stay in order within their partition.
+type Kafka struct {
+	Topic string
+	Write func(ctx context.Context, topic string, key, value []byte) error
+}
+
+// Publish publishes the event.
+func (p *Kafka) Publish(ctx context.Context, e mongodbstore.Event) error {
+	value, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	key := e.ID
+	if key == "" {
+		key = e.Principal
+	}
+	return p.Write(ctx, p.Topic, []byte(key), value)
+}
@@ -0,0 +1,63 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/ashulepov/mongodbstore"
+)
+
+type fakeConn map[string][]byte
+
+func (c fakeConn) Publish(subject string, data []byte) error {
+	c[subject] = data
+	return nil
+}
+
+var (
+	_ mongodbstore.Publisher = (*NATS)(nil)
+	_ mongodbstore.Publisher = (*Kafka)(nil)
+)
+
+func TestNATS(t *testing.T) {
+	conn := fakeConn{}
+	p := &NATS{Conn: conn, Subject: "sessions"}
+	e := mongodbstore.Event{Type: mongodbstore.EventCreated, ID: "5d1f2d6e1c9d440000a1b2c3"}
+	if err := p.Publish(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+
+	var got mongodbstore.Event
+	if err := json.Unmarshal(conn["sessions.session.created"], &got); err != nil {
+		t.Fatalf("Error decoding event: %v", err)
+	}
+	if got.ID != e.ID {
+		t.Errorf("Expected id %s; Got %s", e.ID, got.ID)
+	}
+}
+
+func TestKafka(t *testing.T) {
+	var keys []string
+	p := &Kafka{
+		Topic: "sessions",
+		Write: func(ctx context.Context, topic string, key, value []byte) error {
+			if topic != "sessions" {
+				t.Errorf("Expected topic sessions; Got %s", topic)
+			}
+			keys = append(keys, string(key))
+			return nil
+		},
+	}
+	for _, e := range []mongodbstore.Event{
+		{Type: mongodbstore.EventDestroyed, ID: "5d1f2d6e1c9d440000a1b2c3"},
+		{Type: mongodbstore.EventRevoked, Principal: "alice", Count: 2},
+	} {
+		if err := p.Publish(context.Background(), e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(keys) != 2 || keys[0] != "5d1f2d6e1c9d440000a1b2c3" || keys[1] != "alice" {
+		t.Errorf("Unexpected keys %q", keys)
+	}
+}
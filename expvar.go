@@ -0,0 +1,74 @@
+package mongodbstore
+
+import (
+	"expvar"
+	"sync/atomic"
+)
+
+// counters are the operation counters of a store.
+type counters struct {
+	loads   int64
+	saves   int64
+	deletes int64
+	errors  int64
+
+	// creates counts new sessions inserted, resurrections saves of sessions
+	// deleted since they were loaded.
+	creates       int64
+	resurrections int64
+	// migrations counts sessions read through from the Legacy store.
+	migrations int64
+
+	// savedBytes is the total encoded size of the saved sessions.
+	savedBytes int64
+
+	// corrupted counts loads of documents whose data doesn't match its
+	// checksum.
+	corrupted int64
+	// quarantined counts documents moved to the Quarantine collection.
+	quarantined int64
+	// quotaRejections counts saves refused by TenantQuotas.
+	quotaRejections int64
+	// shed counts sessions evicted by the janitor's ShedPolicy.
+	shed int64
+
+	cacheHits    int64
+	cacheMisses  int64
+	negativeHits int64
+}
+
+func (c *counters) add(counter *int64, n int64) {
+	atomic.AddInt64(counter, n)
+}
+
+// snapshot returns the current values of the counters.
+func (c *counters) snapshot() map[string]int64 {
+	return map[string]int64{
+		"loads":   atomic.LoadInt64(&c.loads),
+		"saves":   atomic.LoadInt64(&c.saves),
+		"deletes": atomic.LoadInt64(&c.deletes),
+		"errors":  atomic.LoadInt64(&c.errors),
+
+		"creates":          atomic.LoadInt64(&c.creates),
+		"resurrections":    atomic.LoadInt64(&c.resurrections),
+		"migrations":       atomic.LoadInt64(&c.migrations),
+		"saved_bytes":      atomic.LoadInt64(&c.savedBytes),
+		"corrupted":        atomic.LoadInt64(&c.corrupted),
+		"quarantined":      atomic.LoadInt64(&c.quarantined),
+		"quota_rejections": atomic.LoadInt64(&c.quotaRejections),
+		"shed":             atomic.LoadInt64(&c.shed),
+
+		"cache_hits":          atomic.LoadInt64(&c.cacheHits),
+		"cache_misses":        atomic.LoadInt64(&c.cacheMisses),
+		"negative_cache_hits": atomic.LoadInt64(&c.negativeHits),
+	}
+}
+
+// PublishExpvar publishes the store counters (loads, saves, deletes, errors,
+// saved bytes and cache hits) as an expvar map named prefix, visible at
+// /debug/vars. Like expvar.Publish it panics if the name is already in use.
+func (m *MongoDBStore) PublishExpvar(prefix string) {
+	expvar.Publish(prefix, expvar.Func(func() interface{} {
+		return m.counters.snapshot()
+	}))
+}
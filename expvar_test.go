@@ -0,0 +1,26 @@
+package mongodbstore
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"strings"
+	"testing"
+)
+
+func TestPublishExpvar(t *testing.T) {
+	store := newOfflineStore(t)
+	store.PublishExpvar("mongodbstore_test")
+
+	_ = store.observe(context.Background(), "findOne", nil, func(ctx context.Context) (string, error) {
+		return "", errors.New("boom")
+	})
+	store.counters.add(&store.counters.loads, 2)
+
+	v := expvar.Get("mongodbstore_test").String()
+	for _, part := range []string{`"loads":2`, `"errors":1`, `"saves":0`} {
+		if !strings.Contains(v, part) {
+			t.Errorf("Expected %s in %s", part, v)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// Package fiberstorage exposes the collection of a mongodbstore.MongoDBStore
+// as a storage for Fiber's session middleware, so that Fiber applications
+// share the sessions collection, its TTL indexes and its bulk deletions with
+// gorilla/sessions based ones.
+//
+// Storage implements the fiber.Storage interface without importing Fiber:
+//
+//	store := session.New(session.Config{Storage: fiberstorage.New(mongoStore)})
+//
+// Payloads are revoked with the other sessions: a payload turned into a
+// tombstone by InvalidateAll or DeleteWhere reads as missing, and its key
+// can't be reused until the tombstone expires.
+//
+// Echo applications use the echosession package instead.
+package fiberstorage
+
+import (
+	"context"
+	"time"
+
+	"github.com/ashulepov/mongodbstore"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Storage stores Fiber session payloads as documents keyed by the Fiber
+// session id. The documents carry the modified and idleExpires fields of the
+// store's documents, so they are expired by the same TTL indexes.
+type Storage struct {
+	collection *mongo.Collection
+}
+
+// New returns a Storage using the collection of the store.
+func New(store *mongodbstore.MongoDBStore) *Storage {
+	return &Storage{collection: store.Collection()}
+}
+
+type document struct {
+	ID          string     `bson:"_id"`
+	Fiber       []byte     `bson:"fiber"`
+	Modified    time.Time  `bson:"modified"`
+	IdleExpires *time.Time `bson:"idleExpires,omitempty"`
+}
+
+// liveFilter returns the filter matching the payload stored under key unless
+// it was revoked.
+func liveFilter(key string) bson.D {
+	return bson.D{
+		{Key: "_id", Value: key},
+		{Key: "revoked", Value: bson.D{{Key: "$ne", Value: true}}},
+	}
+}
+
+// Get returns the payload stored under key, or nil if there is none.
+func (s *Storage) Get(key string) ([]byte, error) {
+	var doc document
+	err := s.collection.FindOne(context.Background(), liveFilter(key)).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if doc.IdleExpires != nil && !time.Now().Before(*doc.IdleExpires) {
+		return nil, nil
+	}
+	return doc.Fiber, nil
+}
+
+// Set stores the payload under key. A positive exp expires it after that
+// long. Setting a revoked key fails with a duplicate key error.
+func (s *Storage) Set(key string, val []byte, exp time.Duration) error {
+	now := time.Now()
+	doc := document{ID: key, Fiber: val, Modified: now}
+	if exp > 0 {
+		expires := now.Add(exp)
+		doc.IdleExpires = &expires
+	}
+
+	_, err := s.collection.ReplaceOne(context.Background(), liveFilter(key), doc,
+		options.Replace().SetUpsert(true))
+	return err
+}
+
+// Delete removes the payload stored under key.
+func (s *Storage) Delete(key string) error {
+	_, err := s.collection.DeleteOne(context.Background(), bson.D{{Key: "_id", Value: key}})
+	return err
+}
+
+// Reset removes all Fiber payloads, leaving the other sessions alone.
+func (s *Storage) Reset() error {
+	_, err := s.collection.DeleteMany(context.Background(),
+		bson.D{{Key: "fiber", Value: bson.D{{Key: "$exists", Value: true}}}})
+	return err
+}
+
+// Close does nothing; the client is owned by the application.
+func (s *Storage) Close() error {
+	return nil
+}
@@ -0,0 +1,68 @@
+package fiberstorage
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ashulepov/mongodbstore"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestMongoStoreStorage(t *testing.T) {
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:27017"))
+	if err != nil {
+		t.Fatalf("Error connecting: %v", err)
+	}
+	defer client.Disconnect(context.Background())
+
+	store := mongodbstore.NewMongoDBStore(client.Database("test").Collection("test_session"), 3600, false,
+		[]byte("secret-key"))
+	store.TombstoneTTL = time.Hour
+	storage := New(store)
+	// Tombstones left by a previous run would keep the keys revoked.
+	store.Collection().DeleteMany(context.Background(),
+		bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: bson.A{"fiber-key", "expired-key"}}}}})
+
+	if err := storage.Set("fiber-key", []byte("payload"), time.Hour); err != nil {
+		t.Fatalf("Error setting payload: %v", err)
+	}
+	if got, err := storage.Get("fiber-key"); err != nil || !bytes.Equal(got, []byte("payload")) {
+		t.Fatalf("Expected the payload; Got %q, %v", got, err)
+	}
+
+	if _, err := store.InvalidateAll(context.Background(), mongodbstore.ConfirmInvalidateAll); err != nil {
+		t.Fatalf("Error invalidating sessions: %v", err)
+	}
+	if got, err := storage.Get("fiber-key"); err != nil || got != nil {
+		t.Errorf("Expected the revoked payload to read as missing; Got %q, %v", got, err)
+	}
+	if err := storage.Set("fiber-key", []byte("payload"), time.Hour); err == nil {
+		t.Errorf("Expected the revoked key not to be reused")
+	}
+
+	if err := storage.Set("expired-key", []byte("payload"), time.Nanosecond); err != nil {
+		t.Fatalf("Error setting payload: %v", err)
+	}
+	time.Sleep(time.Millisecond)
+	if got, err := storage.Get("expired-key"); err != nil || got != nil {
+		t.Errorf("Expected the expired payload to read as missing; Got %q, %v", got, err)
+	}
+	if err := storage.Reset(); err != nil {
+		t.Errorf("Error resetting: %v", err)
+	}
+}
+
+func TestLiveFilter(t *testing.T) {
+	want := bson.D{
+		{Key: "_id", Value: "fiber-key"},
+		{Key: "revoked", Value: bson.D{{Key: "$ne", Value: true}}},
+	}
+	if got := liveFilter("fiber-key"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v; Got %v", want, got)
+	}
+}
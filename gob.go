@@ -0,0 +1,48 @@
+package mongodbstore
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+)
+
+// EncodeError reports a session value that could not be encoded, usually
+// because its type was not registered with RegisterSessionType.
+type EncodeError struct {
+	Key  interface{}
+	Type string
+	Err  error
+}
+
+func (e *EncodeError) Error() string {
+	return fmt.Sprintf("mongodbstore: cannot encode session value %v of type %s: %v", e.Key, e.Type, e.Err)
+}
+
+// RegisterSessionType registers the type of v so that values of that type,
+// and pointers to them, can be stored in sessions. It wraps gob.Register but
+// returns an error instead of panicking when the type or its name is already
+// registered differently.
+func RegisterSessionType(v interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("mongodbstore: cannot register %T: %v", v, r)
+		}
+	}()
+
+	gob.Register(v)
+	return nil
+}
+
+// encodeError returns an *EncodeError for the first value that cannot be
+// encoded on its own, or err if every value encodes fine.
+func encodeError(values map[interface{}]interface{}, err error) error {
+	var buf bytes.Buffer
+	for k, v := range values {
+		buf.Reset()
+		single := map[interface{}]interface{}{k: v}
+		if encErr := gob.NewEncoder(&buf).Encode(single); encErr != nil {
+			return &EncodeError{Key: k, Type: fmt.Sprintf("%T", v), Err: encErr}
+		}
+	}
+	return err
+}
@@ -0,0 +1,39 @@
+package mongodbstore
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+type unregistered struct {
+	Name string
+}
+
+func TestEncodeError(t *testing.T) {
+	store := newOfflineStore(t)
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, _ := store.New(req, "session-key")
+	session.ID = "5cc8b3a2a4d5b6c7d8e9f0a1"
+	session.Values["ok"] = "fine"
+	session.Values["user"] = unregistered{"john"}
+
+	_, err := store.document(session)
+	var encErr *EncodeError
+	if !errors.As(err, &encErr) {
+		t.Fatalf("Expected *EncodeError; Got %#v", err)
+	}
+	if encErr.Key != "user" || encErr.Type != "mongodbstore.unregistered" {
+		t.Errorf("Expected error for key user of type unregistered; Got %v", encErr)
+	}
+
+	if err := RegisterSessionType(unregistered{}); err != nil {
+		t.Fatalf("Error registering type: %v", err)
+	}
+	if _, err := store.document(session); err != nil {
+		t.Errorf("Expected registered type to encode; Got %v", err)
+	}
+	if err := RegisterSessionType(unregistered{}); err != nil {
+		t.Errorf("Expected registering twice to succeed; Got %v", err)
+	}
+}
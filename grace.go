@@ -0,0 +1,63 @@
+package mongodbstore
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// staleKey holds the time a stale session expired.
+const staleKey transientKey = "stale"
+
+// ErrSessionStale is returned by Save for sessions loaded within the
+// ExpiryGrace window, which are read-only until revived.
+var ErrSessionStale = errors.New("mongodbstore: session expired, re-authentication required")
+
+// IsStale reports whether the session expired less than ExpiryGrace ago. Its
+// values can be read, for example to finish a form submitted just after the
+// expiry, but it can't be saved: the client should be asked to
+// re-authenticate, after which Revive makes it a live session again.
+func IsStale(session *sessions.Session) bool {
+	_, ok := session.Values[staleKey].(time.Time)
+	return ok
+}
+
+// Revive turns a stale session into a new session holding its values, after
+// the client re-authenticated. The session gets a new id when saved; the
+// expired document is left to the TTL indexes.
+func Revive(session *sessions.Session) {
+	if !IsStale(session) {
+		return
+	}
+	delete(session.Values, staleKey)
+	session.ID = ""
+	session.IsNew = true
+}
+
+// expiry returns the earliest deadline of the document, including the
+// MaxLifetime of the store, or the zero time if it has none.
+func (m *MongoDBStore) expiry(s *Session) time.Time {
+	var earliest time.Time
+	for _, t := range []time.Time{s.IdleExpires, s.AbsoluteExpires, s.Expires} {
+		if !t.IsZero() && (earliest.IsZero() || t.Before(earliest)) {
+			earliest = t
+		}
+	}
+	if m.MaxLifetime > 0 && !s.Created.IsZero() {
+		if t := s.Created.Add(m.MaxLifetime); earliest.IsZero() || t.Before(earliest) {
+			earliest = t
+		}
+	}
+	return earliest
+}
+
+// withinGrace reports whether the document expired less than ExpiryGrace
+// ago.
+func (m *MongoDBStore) withinGrace(s *Session, now time.Time) bool {
+	if m.ExpiryGrace <= 0 {
+		return false
+	}
+	expiry := m.expiry(s)
+	return !expiry.IsZero() && now.Sub(expiry) < m.ExpiryGrace
+}
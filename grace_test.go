@@ -0,0 +1,54 @@
+package mongodbstore
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestExpiryGrace(t *testing.T) {
+	store := newOfflineStore(t)
+	store.CacheTTL = time.Minute
+
+	data, err := securecookie.EncodeMulti("session-key", map[interface{}]interface{}{"draft": "text"}, store.Codecs...)
+	if err != nil {
+		t.Fatalf("Error encoding data: %v", err)
+	}
+	id := primitive.NewObjectID()
+	store.cacheDoc(&Session{ID: id, Data: data, Checksum: checksum(data), IdleExpires: time.Now().Add(-10 * time.Second)})
+	token, _ := securecookie.EncodeMulti("session-key", id.Hex(), store.Codecs...)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Cookie", "session-key="+token)
+	session, err := store.New(req, "session-key")
+	if err != nil {
+		t.Fatalf("Error loading session: %v", err)
+	}
+	if !session.IsNew || IsStale(session) {
+		t.Fatalf("Expected a new session without ExpiryGrace")
+	}
+	if session.ID != "" {
+		t.Fatalf("Expected the new session not to reuse the expired id %q", session.ID)
+	}
+
+	store.ExpiryGrace = time.Minute
+	session, err = store.New(req, "session-key")
+	if err != nil {
+		t.Fatalf("Error loading session: %v", err)
+	}
+	if session.IsNew || !IsStale(session) || session.Values["draft"] != "text" {
+		t.Fatalf("Expected a stale session with its values; Got new=%t, %v", session.IsNew, session.Values)
+	}
+	if err := store.Save(req, httptest.NewRecorder(), session); !errors.Is(err, ErrSessionStale) {
+		t.Errorf("Expected ErrSessionStale; Got %v", err)
+	}
+
+	Revive(session)
+	if IsStale(session) || !session.IsNew || session.ID != "" || session.Values["draft"] != "text" {
+		t.Errorf("Expected a new session with the values; Got id %q, new=%t, %v", session.ID, session.IsNew, session.Values)
+	}
+}
@@ -0,0 +1,148 @@
+// Package grpcsession provides gRPC server interceptors that load the session
+// named in the request metadata from a mongodbstore.MongoDBStore, make it
+// available to the handler through the context and persist it afterwards.
+//
+// The client sends the session token in the metadata key, and receives a new
+// or refreshed token in the header under the same key.
+package grpcsession
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ashulepov/mongodbstore"
+	"github.com/gorilla/sessions"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type contextKey struct{}
+
+// FromContext returns the session injected by the interceptors, or nil.
+func FromContext(ctx context.Context) *sessions.Session {
+	session, _ := ctx.Value(contextKey{}).(*sessions.Session)
+	return session
+}
+
+// Interceptor loads and saves sessions around gRPC handlers.
+type Interceptor struct {
+	// Store is the session store.
+	Store *mongodbstore.MongoDBStore
+	// Name is the session name the tokens are encoded with.
+	Name string
+	// MetadataKey is the metadata key carrying the token. It defaults to Name.
+	// gRPC lowercases metadata keys.
+	MetadataKey string
+}
+
+func (i *Interceptor) key() string {
+	if i.MetadataKey != "" {
+		return i.MetadataKey
+	}
+	return i.Name
+}
+
+// load returns the session for the token in the incoming metadata, or a new
+// session when there is no token or it refers to a missing or expired
+// session.
+func (i *Interceptor) load(ctx context.Context) (*sessions.Session, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if tokens := md.Get(i.key()); len(tokens) > 0 {
+		session, err := i.Store.Validate(ctx, i.Name, tokens[0])
+		if err == nil {
+			return session, nil
+		}
+		if !errors.Is(err, mongodbstore.ErrNotFound) && !errors.Is(err, mongodbstore.ErrSessionExpired) {
+			return nil, status.Errorf(codes.Unauthenticated, "invalid session: %v", err)
+		}
+	}
+
+	return i.Store.NewSession(ctx, i.Name), nil
+}
+
+// skipSave reports whether the session is left unsaved: a new session
+// without values, or a stale session, which is read-only until the handler
+// revives it with mongodbstore.Revive.
+func skipSave(session *sessions.Session) bool {
+	return session.IsNew && mongodbstore.IsEmpty(session) || mongodbstore.IsStale(session)
+}
+
+// save persists the session and sends its token in the response header.
+func (i *Interceptor) save(ctx context.Context, session *sessions.Session) error {
+	if skipSave(session) {
+		return nil
+	}
+
+	token, err := i.Store.Persist(ctx, session)
+	if err != nil {
+		return status.Errorf(codes.Unavailable, "save session: %v", err)
+	}
+	return grpc.SetHeader(ctx, metadata.Pairs(i.key(), token))
+}
+
+// Unary returns a unary server interceptor.
+func (i *Interceptor) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		session, err := i.load(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		ctx = context.WithValue(ctx, contextKey{}, session)
+		resp, err := handler(ctx, req)
+		if err != nil {
+			return resp, err
+		}
+		if err := i.save(ctx, session); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+}
+
+// Stream returns a stream server interceptor. The session is saved when the
+// handler returns; the token goes in the header if the handler has not sent
+// it yet, and in the trailer otherwise.
+func (i *Interceptor) Stream() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) error {
+		session, err := i.load(ss.Context())
+		if err != nil {
+			return err
+		}
+
+		ctx := context.WithValue(ss.Context(), contextKey{}, session)
+		if err := handler(srv, &serverStream{ServerStream: ss, ctx: ctx}); err != nil {
+			return err
+		}
+		return i.saveStream(ss, session)
+	}
+}
+
+func (i *Interceptor) saveStream(ss grpc.ServerStream, session *sessions.Session) error {
+	if skipSave(session) {
+		return nil
+	}
+
+	token, err := i.Store.Persist(ss.Context(), session)
+	if err != nil {
+		return status.Errorf(codes.Unavailable, "save session: %v", err)
+	}
+	if err := ss.SetHeader(metadata.Pairs(i.key(), token)); err != nil {
+		ss.SetTrailer(metadata.Pairs(i.key(), token))
+	}
+	return nil
+}
+
+// serverStream overrides the context of a server stream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
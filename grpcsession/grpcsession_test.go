@@ -0,0 +1,77 @@
+package grpcsession
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/ashulepov/mongodbstore"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func newInterceptor(t *testing.T) *Interceptor {
+	client, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	if err != nil {
+		t.Fatalf("Error creating client: %v", err)
+	}
+	store := mongodbstore.NewMongoDBStore(client.Database("test").Collection("test_session"), 3600, false,
+		[]byte("secret-key"))
+	return &Interceptor{Store: store, Name: "session"}
+}
+
+func TestUnary(t *testing.T) {
+	i := newInterceptor(t)
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"}
+
+	called := false
+	_, err := i.Unary()(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		called = true
+		if session := FromContext(ctx); session == nil || !session.IsNew {
+			t.Errorf("Expected new session in context; Got %v", session)
+		}
+		return nil, nil
+	})
+	if err != nil || !called {
+		t.Errorf("Expected handler to run; Got %v, %v", called, err)
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("session", "junk"))
+	_, err = i.Unary()(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		t.Errorf("Expected handler not to run for junk token")
+		return nil, nil
+	})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected Unauthenticated; Got %v", err)
+	}
+}
+
+type tenantKey struct{}
+
+func TestUnaryNewSession(t *testing.T) {
+	i := newInterceptor(t)
+	i.Store.Tenant = func(r *http.Request) string {
+		tenant, _ := r.Context().Value(tenantKey{}).(string)
+		return tenant
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"}
+
+	ctx := context.WithValue(context.Background(), tenantKey{}, "acme")
+	_, err := i.Unary()(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		session := FromContext(ctx)
+		if mongodbstore.SessionTenant(session) != "acme" || session.Options == i.Store.Options {
+			t.Errorf("Expected a new session of the tenant with its own options; Got %+v", session)
+		}
+		if !mongodbstore.IsEmpty(session) {
+			t.Errorf("Expected the tenant not to count as a value")
+		}
+		return nil, nil
+	})
+	if err != nil {
+		t.Errorf("Expected the empty session not to be saved; Got %v", err)
+	}
+}
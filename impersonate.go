@@ -0,0 +1,170 @@
+package mongodbstore
+
+import (
+	"context"
+	"encoding/gob"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// impersonatorKey is the session value linking an impersonation session to
+// the session of the impersonating user.
+const impersonatorKey = "mongodbstore.impersonator"
+
+// Impersonator describes who is acting through an impersonation session. It
+// is stored in the impersonatedBy field of the session document.
+type Impersonator struct {
+	SessionID string    `bson:"session"`
+	Principal string    `bson:"principal"`
+	Started   time.Time `bson:"started"`
+}
+
+func init() {
+	gob.Register(Impersonator{})
+}
+
+// GetImpersonator returns who is acting through the session, if it is an
+// impersonation session.
+func GetImpersonator(session *sessions.Session) (Impersonator, bool) {
+	imp, ok := session.Values[impersonatorKey].(Impersonator)
+	return imp, ok
+}
+
+// storedImpersonator returns the impersonator found in the session values in
+// the stored form.
+func (m *MongoDBStore) storedImpersonator(values map[interface{}]interface{}) *Impersonator {
+	imp, ok := values[impersonatorKey].(Impersonator)
+	if !ok {
+		return nil
+	}
+	imp.Principal = m.principalID(imp.Principal)
+	return &imp
+}
+
+// Impersonate creates and saves a session for targetUser linked to the saved
+// session of the acting admin. The impersonation session records the admin
+// in its impersonatedBy field, and the admin's document lists the
+// impersonation sessions in its impersonating field. Saving the returned
+// session sets its cookie in place of the admin's; EndImpersonation restores
+// it.
+func (m *MongoDBStore) Impersonate(ctx context.Context, admin *sessions.Session, targetUser string) (*sessions.Session, error) {
+	adminID, err := primitive.ObjectIDFromHex(admin.ID)
+	if err != nil || admin.IsNew {
+		return nil, m.sessionError("impersonate from", admin.Name(), ErrInvalidID)
+	}
+
+	session := m.newSession(admin.Name())
+	if tenant, ok := admin.Values[tenantKey]; ok {
+		// The session belongs to the tenant of the admin and is encoded with
+		// its keys.
+		session.Values[tenantKey] = tenant
+	}
+	session.ID = primitive.NewObjectID().Hex()
+	SetPrincipal(session, targetUser)
+	session.Values[impersonatorKey] = Impersonator{
+		SessionID: admin.ID,
+		Principal: GetPrincipal(admin),
+		Started:   time.Now(),
+	}
+	if _, err := m.upsert(session); err != nil {
+		return nil, m.sessionError("save", session.Name(), err)
+	}
+	session.IsNew = false
+
+	if err := m.linkImpersonation(ctx, adminID, "$addToSet", session.ID, admin.Name()); err != nil {
+		return nil, m.sessionError("link impersonation to", admin.Name(), err)
+	}
+	return session, nil
+}
+
+// EndImpersonation deletes the impersonation session, removes it from the
+// admin's document and sets the cookie of the admin's session again. It
+// returns ErrInvalidID for a session that is not an impersonation session.
+func (m *MongoDBStore) EndImpersonation(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	imp, ok := GetImpersonator(session)
+	if !ok {
+		return m.sessionError("end impersonation of", session.Name(), ErrInvalidID)
+	}
+	adminID, err := primitive.ObjectIDFromHex(imp.SessionID)
+	if err != nil {
+		return m.sessionError("end impersonation of", session.Name(), ErrInvalidID)
+	}
+
+	impersonationID := session.ID
+	if err := m.delete(session); err != nil {
+		return m.sessionError("delete", session.Name(), err)
+	}
+	if err := m.linkImpersonation(r.Context(), adminID, "$pull", impersonationID, session.Name()); err != nil {
+		return m.sessionError("unlink impersonation from", session.Name(), err)
+	}
+
+	encoded, err := securecookie.EncodeMulti(session.Name(), imp.SessionID, m.CookieCodecs(session.Name())...)
+	if err != nil {
+		return m.sessionError("encode cookie of", session.Name(), err)
+	}
+	opts := *session.Options
+	m.Token.SetToken(w, m.tokenName(session.Name()), encoded, &opts)
+	return nil
+}
+
+// linkImpersonation adds or removes the impersonation session in the
+// impersonating field of the admin's document.
+func (m *MongoDBStore) linkImpersonation(ctx context.Context, adminID primitive.ObjectID, op, id, name string) error {
+	filter := m.liveFilter(adminID)
+	update := bson.D{{Key: op, Value: bson.D{{Key: "impersonating", Value: id}}}}
+	m.uncache(adminID)
+	return m.observe(m.profilerContext(ctx, name), "updateOne", filter, func(ctx context.Context) (string, error) {
+		res, err := m.collection.UpdateOne(ctx, filter, update)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("matched=%d modified=%d", res.MatchedCount, res.ModifiedCount), nil
+	})
+}
+
+// FindImpersonations returns the documents of the impersonation sessions
+// started by the principal, for auditing who acted as whom. The encoded
+// session data is not fetched.
+func (m *MongoDBStore) FindImpersonations(ctx context.Context, principal string) ([]Session, error) {
+	if m.Tenant != nil {
+		return nil, ErrTenantRequired
+	}
+	return m.findImpersonations(ctx, principal, nil)
+}
+
+// findImpersonations finds the sessions impersonated by the principal,
+// restricted to the tenant if any.
+func (m *MongoDBStore) findImpersonations(ctx context.Context, principal string, tenant *string) ([]Session, error) {
+	filter := bson.D{{Key: "impersonatedBy.principal", Value: m.principalID(principal)}}
+	if tenant != nil {
+		filter = append(filter, bson.E{Key: "tenant", Value: *tenant})
+	}
+
+	var cur *mongo.Cursor
+	err := m.observe(ctx, "find", filter, func(ctx context.Context) (string, error) {
+		var err error
+		cur, err = m.collection.Find(ctx, filter, m.findOptions().SetProjection(bson.D{{Key: "data", Value: 0}}))
+		return "", err
+	})
+	if err != nil {
+		return nil, m.opError("find impersonations", err)
+	}
+	defer cur.Close(ctx)
+
+	var found []Session
+	for cur.Next(ctx) {
+		var s Session
+		if err := cur.Decode(&s); err != nil {
+			return nil, m.opError("find impersonations", err)
+		}
+		found = append(found, s)
+	}
+	return found, m.opError("find impersonations", cur.Err())
+}
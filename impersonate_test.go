@@ -0,0 +1,78 @@
+package mongodbstore
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+func TestImpersonatorStored(t *testing.T) {
+	store := newOfflineStore(t)
+	session := sessions.NewSession(store, "session-key")
+	session.ID = "5cc8b3a2a4d5b6c7d8e9f0a1"
+
+	if _, ok := GetImpersonator(session); ok {
+		t.Errorf("Expected regular session not to be impersonated")
+	}
+	req := httptest.NewRequest("GET", "http://localhost:8080/", nil)
+	if err := store.EndImpersonation(req, httptest.NewRecorder(), session); !errors.Is(err, ErrInvalidID) {
+		t.Errorf("Expected ErrInvalidID for a regular session; Got %v", err)
+	}
+
+	session.Values[impersonatorKey] = Impersonator{SessionID: "5cc8b3a2a4d5b6c7d8e9f0a2", Principal: "admin",
+		Started: time.Now()}
+	doc, err := store.document(session)
+	if err != nil {
+		t.Fatalf("Error encoding session: %v", err)
+	}
+	if doc.ImpersonatedBy == nil || doc.ImpersonatedBy.Principal != "admin" {
+		t.Errorf("Expected impersonator in the document; Got %+v", doc.ImpersonatedBy)
+	}
+}
+
+func TestMongoStoreImpersonateTenant(t *testing.T) {
+	store := newLiveStore(t)
+	store.Tenant = func(r *http.Request) string { return r.Host }
+	store.TenantKeys = TenantKeys{
+		"a.example.com": securecookie.CodecsFromPairs([]byte("tenant-a-hash-key-0123456789abcd")),
+	}
+
+	req := httptest.NewRequest("GET", "http://a.example.com/", nil)
+	admin, err := store.New(req, "session-key")
+	if err != nil {
+		t.Fatalf("Error creating session: %v", err)
+	}
+	SetPrincipal(admin, "admin")
+	if err := store.Save(req, httptest.NewRecorder(), admin); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	admin.IsNew = false
+
+	session, err := store.Impersonate(context.Background(), admin, "alice")
+	if err != nil {
+		t.Fatalf("Error impersonating: %v", err)
+	}
+	rsp := httptest.NewRecorder()
+	if err := store.Save(req, rsp, session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+
+	next := httptest.NewRequest("GET", "http://a.example.com/", nil)
+	for _, c := range rsp.Result().Cookies() {
+		next.AddCookie(c)
+	}
+	loaded, err := store.New(next, "session-key")
+	if err != nil || loaded.IsNew || GetPrincipal(loaded) != "alice" {
+		t.Fatalf("Expected the impersonation session of the tenant; Got %v, new=%t, %v",
+			loaded.Values, loaded.IsNew, err)
+	}
+	if imp, ok := GetImpersonator(loaded); !ok || imp.Principal != "admin" {
+		t.Errorf("Expected the impersonator; Got %+v", imp)
+	}
+}
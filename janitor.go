@@ -0,0 +1,288 @@
+package mongodbstore
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CollectionStats describes the size of the sessions collection.
+type CollectionStats struct {
+	// Sessions is the number of documents, tombstones included.
+	Sessions int64
+	// Bytes is the uncompressed size of the documents.
+	Bytes int64
+	// AvgSessionBytes is the average size of a document.
+	AvgSessionBytes float64
+}
+
+// CollectionStats returns the size of the sessions collection from the
+// collStats command.
+func (m *MongoDBStore) CollectionStats(ctx context.Context) (CollectionStats, error) {
+	var stats CollectionStats
+	err := m.observe(ctx, "collStats", nil, func(ctx context.Context) (string, error) {
+		var res struct {
+			Count      float64 `bson:"count"`
+			Size       float64 `bson:"size"`
+			AvgObjSize float64 `bson:"avgObjSize"`
+		}
+		cmd := bson.D{{Key: "collStats", Value: m.collection.Name()}}
+		if err := m.collection.Database().RunCommand(ctx, cmd).Decode(&res); err != nil {
+			return "", err
+		}
+		stats = CollectionStats{Sessions: int64(res.Count), Bytes: int64(res.Size), AvgSessionBytes: res.AvgObjSize}
+		return fmt.Sprintf("sessions=%d bytes=%d", stats.Sessions, stats.Bytes), nil
+	})
+	return stats, m.opError("collection stats", err)
+}
+
+// ShedPolicy evicts sessions when the collection grows past a threshold,
+// lowest priorities first and, within a priority, least recently modified
+// first, so that authenticated sessions survive traffic spikes of anonymous
+// ones. Evicted sessions are deleted; their clients get new sessions. Only
+// the sessions of the store are evicted: the documents of the fiberstorage
+// package, which have string ids, are left to the TTL indexes.
+type ShedPolicy struct {
+	// MaxSessions and MaxBytes are the thresholds, either of which may be
+	// zero.
+	MaxSessions int64
+	MaxBytes    int64
+	// Target is the fraction of the thresholds shedding brings the
+	// collection back to, 0.9 by default.
+	Target float64
+	// MaxPriority is the highest priority that may be evicted,
+	// PriorityAnonymous by default.
+	MaxPriority Priority
+	// BatchSize is the most sessions evicted per janitor run, 1000 by
+	// default.
+	BatchSize int64
+}
+
+// excess returns the number of sessions to evict from a collection of the
+// size.
+func (p *ShedPolicy) excess(stats CollectionStats) int64 {
+	target := p.Target
+	if target <= 0 || target > 1 {
+		target = 0.9
+	}
+	var n int64
+	if p.MaxSessions > 0 && stats.Sessions > p.MaxSessions {
+		n = stats.Sessions - int64(float64(p.MaxSessions)*target)
+	}
+	if p.MaxBytes > 0 && stats.Bytes > p.MaxBytes && stats.AvgSessionBytes > 0 {
+		if b := int64((float64(stats.Bytes) - float64(p.MaxBytes)*target) / stats.AvgSessionBytes); b > n {
+			n = b
+		}
+	}
+	batch := p.BatchSize
+	if batch <= 0 {
+		batch = 1000
+	}
+	if n > batch {
+		n = batch
+	}
+	return n
+}
+
+// Janitor is the configuration of the background maintenance of
+// EnableJanitor.
+type Janitor struct {
+	// Interval is the time between runs, DefaultJanitorInterval by default.
+	Interval time.Duration
+	// Shed, if set, evicts sessions when the collection is too large.
+	Shed *ShedPolicy
+	// Watermarks warn operators when the collection grows past thresholds.
+	Watermarks []Watermark
+}
+
+// DefaultJanitorInterval is the Interval of a Janitor that sets none.
+const DefaultJanitorInterval = time.Minute
+
+// Watermark is a threshold of the collection size. Its callbacks are called
+// by the janitor run that sees the collection cross it, so operators get
+// warned before the storage or the throughput of TTL deletions run out.
+type Watermark struct {
+	// Sessions and Bytes are the thresholds, either of which may be zero.
+	// The watermark is exceeded when either is.
+	Sessions int64
+	Bytes    int64
+	// OnExceeded is called when the collection grows past the watermark, and
+	// OnCleared, if set, when it is back below.
+	OnExceeded func(stats CollectionStats)
+	OnCleared  func(stats CollectionStats)
+}
+
+// exceeded reports whether a collection of the size exceeds the watermark.
+func (w *Watermark) exceeded(stats CollectionStats) bool {
+	return w.Sessions > 0 && stats.Sessions > w.Sessions ||
+		w.Bytes > 0 && stats.Bytes > w.Bytes
+}
+
+// janitor runs the maintenance in the background.
+type janitor struct {
+	Janitor
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+	// exceeded tells which Watermarks the last run saw exceeded.
+	exceeded []bool
+}
+
+// EnableJanitor runs maintenance of the collection every interval in the
+// background until Close: it reads the CollectionStats, checks the
+// Watermarks and applies the ShedPolicy. Failures are reported to the error
+// handler, and returned by Run if the last runs kept failing.
+func (m *MongoDBStore) EnableJanitor(j Janitor) {
+	if j.Interval <= 0 {
+		j.Interval = DefaultJanitorInterval
+	}
+	jn := &janitor{
+		Janitor:  j,
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+		exceeded: make([]bool, len(j.Watermarks)),
+	}
+	m.janitor = jn
+	m.goBackground("janitor", func(context.Context) error {
+		return jn.run(m)
+	})
+}
+
+// closeJanitor stops the janitor and waits for its current run.
+func (m *MongoDBStore) closeJanitor(ctx context.Context) error {
+	jn := m.janitor
+	if jn == nil {
+		return nil
+	}
+	jn.once.Do(func() { close(jn.done) })
+	select {
+	case <-jn.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run runs the maintenance until the janitor is closed. It returns the last
+// error if the last runs kept failing.
+func (jn *janitor) run(m *MongoDBStore) error {
+	defer close(jn.stopped)
+
+	ticker := time.NewTicker(jn.Interval)
+	defer ticker.Stop()
+
+	var failed failures
+	for {
+		select {
+		case <-jn.done:
+			return failed.result()
+		case <-ticker.C:
+		}
+		err := m.sweep(context.Background(), jn)
+		if err != nil {
+			m.reportError(context.Background(), "janitor", err)
+		}
+		failed.record(err)
+	}
+}
+
+// sweep runs the maintenance once.
+func (m *MongoDBStore) sweep(ctx context.Context, jn *janitor) error {
+	stats, err := m.CollectionStats(ctx)
+	if err != nil {
+		return err
+	}
+	jn.checkWatermarks(stats)
+	if jn.Shed != nil {
+		if _, err := m.shed(ctx, jn.Shed, stats); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkWatermarks calls the callbacks of the watermarks crossed since the
+// last run.
+func (jn *janitor) checkWatermarks(stats CollectionStats) {
+	for i := range jn.Watermarks {
+		w := &jn.Watermarks[i]
+		exceeded := w.exceeded(stats)
+		if exceeded == jn.exceeded[i] {
+			continue
+		}
+		jn.exceeded[i] = exceeded
+		if exceeded && w.OnExceeded != nil {
+			w.OnExceeded(stats)
+		} else if !exceeded && w.OnCleared != nil {
+			w.OnCleared(stats)
+		}
+	}
+}
+
+// shed evicts the sessions the policy asks for from a collection of the size
+// and returns the number of evicted sessions.
+func (m *MongoDBStore) shed(ctx context.Context, p *ShedPolicy, stats CollectionStats) (int64, error) {
+	n := p.excess(stats)
+	if n <= 0 {
+		return 0, nil
+	}
+
+	filter := bson.D{
+		{Key: "_id", Value: bson.D{{Key: "$type", Value: "objectId"}}},
+		{Key: "priority", Value: bson.D{{Key: "$not", Value: bson.D{{Key: "$gt", Value: int(p.MaxPriority)}}}}},
+		{Key: "revoked", Value: bson.D{{Key: "$ne", Value: true}}},
+	}
+	var ids []primitive.ObjectID
+	err := m.observe(ctx, "find", filter, func(ctx context.Context) (string, error) {
+		opts := options.Find().
+			SetSort(bson.D{{Key: "priority", Value: 1}, {Key: "modified", Value: 1}}).
+			SetLimit(n).
+			SetProjection(bson.D{{Key: "_id", Value: 1}})
+		cur, err := m.collection.Find(ctx, filter, opts)
+		if err != nil {
+			return "", err
+		}
+		defer cur.Close(ctx)
+		for cur.Next(ctx) {
+			var doc struct {
+				ID primitive.ObjectID `bson:"_id"`
+			}
+			if err := cur.Decode(&doc); err != nil {
+				return "", err
+			}
+			ids = append(ids, doc.ID)
+		}
+		return fmt.Sprintf("candidates=%d", len(ids)), cur.Err()
+	})
+	if err != nil || len(ids) == 0 {
+		return 0, m.opError("shed sessions", err)
+	}
+
+	var evicted int64
+	idFilter := bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}
+	err = m.observe(ctx, "deleteMany", idFilter, func(ctx context.Context) (string, error) {
+		res, err := m.collection.DeleteMany(ctx, idFilter)
+		if err != nil {
+			return "", err
+		}
+		evicted = res.DeletedCount
+		return fmt.Sprintf("deleted=%d", evicted), nil
+	})
+	for _, id := range ids {
+		m.uncache(id)
+	}
+	if err != nil {
+		return 0, m.opError("shed sessions", err)
+	}
+	m.counters.add(&m.counters.deletes, evicted)
+	m.counters.add(&m.counters.shed, evicted)
+	if m.Metrics != nil {
+		m.Metrics.Count("mongodbstore.shed", evicted)
+	}
+	return evicted, nil
+}
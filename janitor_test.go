@@ -0,0 +1,129 @@
+package mongodbstore
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+func TestShedPolicyExcess(t *testing.T) {
+	tests := []struct {
+		policy ShedPolicy
+		stats  CollectionStats
+		want   int64
+	}{
+		{ShedPolicy{MaxSessions: 100}, CollectionStats{Sessions: 100}, 0},
+		{ShedPolicy{MaxSessions: 100}, CollectionStats{Sessions: 120}, 30},
+		{ShedPolicy{MaxSessions: 100, Target: 0.5}, CollectionStats{Sessions: 120}, 70},
+		{ShedPolicy{MaxSessions: 100, BatchSize: 10}, CollectionStats{Sessions: 120}, 10},
+		{ShedPolicy{MaxBytes: 1000}, CollectionStats{Sessions: 20, Bytes: 2000, AvgSessionBytes: 100}, 11},
+		{ShedPolicy{MaxSessions: 100, MaxBytes: 1000}, CollectionStats{Sessions: 101, Bytes: 2000, AvgSessionBytes: 100}, 11},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.excess(tt.stats); got != tt.want {
+			t.Errorf("%+v, %+v: Expected %d; Got %d", tt.policy, tt.stats, tt.want, got)
+		}
+	}
+}
+
+func TestPriority(t *testing.T) {
+	store := newOfflineStore(t)
+	session := sessions.NewSession(store, "session-key")
+	session.ID = "5d1f2d6e1c9d440000a1b2c3"
+
+	if p := GetPriority(session); p != PriorityAnonymous {
+		t.Errorf("Expected PriorityAnonymous; Got %d", p)
+	}
+	SetPrincipal(session, "alice")
+	if p := GetPriority(session); p != PriorityAuthenticated {
+		t.Errorf("Expected PriorityAuthenticated; Got %d", p)
+	}
+	SetPriority(session, PriorityCritical)
+	s, err := store.document(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Priority != PriorityCritical {
+		t.Errorf("Expected PriorityCritical stored; Got %d", s.Priority)
+	}
+}
+
+func TestJanitorClose(t *testing.T) {
+	store := newOfflineStore(t)
+	store.EnableJanitor(Janitor{Interval: time.Hour, Shed: &ShedPolicy{MaxSessions: 10}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := store.Close(ctx); err != nil {
+		t.Fatalf("Error closing store: %v", err)
+	}
+	if err := store.Close(ctx); err != nil {
+		t.Fatalf("Error closing store twice: %v", err)
+	}
+}
+
+func TestJanitorDefaultInterval(t *testing.T) {
+	store := newOfflineStore(t)
+	store.EnableJanitor(Janitor{})
+	if store.janitor.Interval != DefaultJanitorInterval {
+		t.Errorf("Expected DefaultJanitorInterval; Got %v", store.janitor.Interval)
+	}
+	store.Close(context.Background())
+}
+
+func TestShedSkipsForeignIDs(t *testing.T) {
+	var buf bytes.Buffer
+	store := newOfflineStore(t)
+	store.Debug = true
+	store.Logger = log.New(&buf, "", 0)
+
+	// The offline store fails the find after logging its filter.
+	store.shed(context.Background(), &ShedPolicy{MaxSessions: 10}, CollectionStats{Sessions: 20})
+	if !strings.Contains(buf.String(), "_id:{$type:<string>}") {
+		t.Errorf("Expected shedding to be restricted to ObjectIDs; Got %q", buf.String())
+	}
+}
+
+func TestWatermarks(t *testing.T) {
+	var events []string
+	jn := &janitor{
+		Janitor: Janitor{Watermarks: []Watermark{
+			{
+				Sessions:   100,
+				OnExceeded: func(CollectionStats) { events = append(events, "sessions exceeded") },
+				OnCleared:  func(CollectionStats) { events = append(events, "sessions cleared") },
+			},
+			{
+				Bytes:      1 << 30,
+				OnExceeded: func(CollectionStats) { events = append(events, "bytes exceeded") },
+			},
+		}},
+		exceeded: make([]bool, 2),
+	}
+
+	for _, stats := range []CollectionStats{
+		{Sessions: 50},
+		{Sessions: 150},
+		{Sessions: 160},
+		{Sessions: 160, Bytes: 2 << 30},
+		{Sessions: 90, Bytes: 2 << 30},
+		{Sessions: 90},
+	} {
+		jn.checkWatermarks(stats)
+	}
+
+	want := []string{"sessions exceeded", "bytes exceeded", "sessions cleared"}
+	if len(events) != len(want) {
+		t.Fatalf("Expected %v; Got %v", want, events)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Errorf("Expected %v; Got %v", want, events)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package mongodbstore
+
+import (
+	"context"
+	"encoding/gob"
+	"sort"
+
+	"github.com/gorilla/sessions"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// labelsKey is the session value holding the labels of a session.
+const labelsKey = "mongodbstore.labels"
+
+// Label is a key/value pair attached to a session document. Labels are
+// indexed, so sessions can be queried by them.
+type Label struct {
+	Key   string `bson:"k"`
+	Value string `bson:"v"`
+}
+
+func init() {
+	gob.Register(map[string]string{})
+}
+
+// SetLabel attaches a label to the session. The label is stored with the
+// session document on the next save.
+func SetLabel(session *sessions.Session, key, value string) {
+	labels, _ := session.Values[labelsKey].(map[string]string)
+	if labels == nil {
+		labels = make(map[string]string)
+		session.Values[labelsKey] = labels
+	}
+	labels[key] = value
+}
+
+// RemoveLabel removes a label from the session.
+func RemoveLabel(session *sessions.Session, key string) {
+	labels, _ := session.Values[labelsKey].(map[string]string)
+	delete(labels, key)
+	if len(labels) == 0 {
+		delete(session.Values, labelsKey)
+	}
+}
+
+// GetLabel returns the value of a label of the session.
+func GetLabel(session *sessions.Session, key string) (string, bool) {
+	labels, _ := session.Values[labelsKey].(map[string]string)
+	value, ok := labels[key]
+	return value, ok
+}
+
+// storedLabels returns the labels found in the session values in the stored
+// form.
+func storedLabels(values map[interface{}]interface{}) []Label {
+	labels, _ := values[labelsKey].(map[string]string)
+	if len(labels) == 0 {
+		return nil
+	}
+
+	list := make([]Label, 0, len(labels))
+	for k, v := range labels {
+		list = append(list, Label{Key: k, Value: v})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list
+}
+
+// FindByLabel returns the documents of all sessions carrying the label. The
+// encoded session data is not fetched.
+func (m *MongoDBStore) FindByLabel(ctx context.Context, key, value string) ([]Session, error) {
+	if m.Tenant != nil {
+		return nil, ErrTenantRequired
+	}
+	return m.findByLabel(ctx, key, value, nil)
+}
+
+// findByLabel finds the sessions carrying the label, restricted to the
+// tenant if any.
+func (m *MongoDBStore) findByLabel(ctx context.Context, key, value string, tenant *string) ([]Session, error) {
+	filter := bson.D{{Key: "labels", Value: bson.D{{Key: "$elemMatch", Value: bson.D{
+		{Key: "k", Value: key},
+		{Key: "v", Value: value},
+	}}}}}
+	if tenant != nil {
+		filter = append(filter, bson.E{Key: "tenant", Value: *tenant})
+	}
+
+	var cur *mongo.Cursor
+	err := m.observe(ctx, "find", filter, func(ctx context.Context) (string, error) {
+		var err error
+		cur, err = m.collection.Find(ctx, filter, m.findOptions().SetProjection(bson.D{{Key: "data", Value: 0}}))
+		return "", err
+	})
+	if err != nil {
+		return nil, m.opError("find sessions by label", err)
+	}
+	defer cur.Close(ctx)
+
+	var found []Session
+	for cur.Next(ctx) {
+		var s Session
+		if err := cur.Decode(&s); err != nil {
+			return nil, m.opError("find sessions by label", err)
+		}
+		found = append(found, s)
+	}
+	return found, m.opError("find sessions by label", cur.Err())
+}
+
+// findOptions returns the options of queries matching sessions by string
+// fields.
+func (m *MongoDBStore) findOptions() *options.FindOptions {
+	opts := options.Find()
+	if c := m.collation(); c != nil {
+		opts.SetCollation(c)
+	}
+	return opts
+}
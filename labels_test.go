@@ -0,0 +1,51 @@
+package mongodbstore
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/gorilla/sessions"
+)
+
+func TestLabels(t *testing.T) {
+	store := newOfflineStore(t)
+	session := sessions.NewSession(store, "session-key")
+	session.ID = "5cc8b3a2a4d5b6c7d8e9f0a1"
+
+	SetLabel(session, "role", "admin")
+	SetLabel(session, "device", "mobile")
+	if value, ok := GetLabel(session, "role"); !ok || value != "admin" {
+		t.Errorf("Expected the label; Got %q, %t", value, ok)
+	}
+
+	doc, err := store.document(session)
+	if err != nil {
+		t.Fatalf("Error encoding session: %v", err)
+	}
+	want := []Label{{Key: "device", Value: "mobile"}, {Key: "role", Value: "admin"}}
+	if !reflect.DeepEqual(doc.Labels, want) {
+		t.Errorf("Expected the labels sorted by key; Got %v", doc.Labels)
+	}
+
+	RemoveLabel(session, "role")
+	RemoveLabel(session, "device")
+	if _, ok := GetLabel(session, "role"); ok {
+		t.Error("Expected the label to be removed")
+	}
+	if _, ok := session.Values[labelsKey]; ok {
+		t.Error("Expected no labels value once the last label is removed")
+	}
+	if doc, err = store.document(session); err != nil || doc.Labels != nil {
+		t.Errorf("Expected no stored labels; Got %v, %v", doc.Labels, err)
+	}
+}
+
+func TestFindByLabelTenant(t *testing.T) {
+	store := newOfflineStore(t)
+	store.Tenant = func(r *http.Request) string { return r.Host }
+	if _, err := store.FindByLabel(context.Background(), "role", "admin"); err != ErrTenantRequired {
+		t.Errorf("Expected ErrTenantRequired; Got %v", err)
+	}
+}
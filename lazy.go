@@ -0,0 +1,70 @@
+package mongodbstore
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/sessions"
+)
+
+// LazySession defers decoding the cookie and reading the session from
+// MongoDB until the session is first needed. Middleware can hand one to
+// every handler, and handlers that never look at the session, such as health
+// checks, skip the database round trip entirely.
+type LazySession struct {
+	store *MongoDBStore
+	r     *http.Request
+	name  string
+
+	mu      sync.Mutex
+	loaded  bool
+	session *sessions.Session
+	err     error
+}
+
+// GetLazy returns a LazySession for the given name. The session is obtained
+// with Get, and thereby registered, on the first call to Session or Values.
+func (m *MongoDBStore) GetLazy(r *http.Request, name string) *LazySession {
+	return &LazySession{store: m, r: r, name: name}
+}
+
+// Session loads the session on first use and returns it.
+func (l *LazySession) Session() (*sessions.Session, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.loaded {
+		l.session, l.err = l.store.Get(l.r, l.name)
+		l.loaded = true
+	}
+	return l.session, l.err
+}
+
+// Values loads the session on first use and returns its values.
+func (l *LazySession) Values() (map[interface{}]interface{}, error) {
+	session, err := l.Session()
+	if session == nil {
+		return nil, err
+	}
+	return session.Values, err
+}
+
+// Loaded reports whether the session has been loaded.
+func (l *LazySession) Loaded() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.loaded
+}
+
+// Save saves the session if it was loaded and does nothing otherwise.
+func (l *LazySession) Save(w http.ResponseWriter) error {
+	l.mu.Lock()
+	session := l.session
+	l.mu.Unlock()
+
+	if session == nil {
+		return nil
+	}
+	return session.Save(l.r, w)
+}
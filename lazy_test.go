@@ -0,0 +1,30 @@
+package mongodbstore
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestGetLazy(t *testing.T) {
+	store := newOfflineStore(t)
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+
+	lazy := store.GetLazy(req, "session-key")
+	if lazy.Loaded() {
+		t.Fatalf("Expected session not to be loaded")
+	}
+	if _, ok := store.tracked(req)["session-key"]; ok {
+		t.Fatalf("Expected no session to be obtained before first use")
+	}
+
+	values, err := lazy.Values()
+	if err != nil {
+		t.Fatalf("Error loading session: %v", err)
+	}
+	values["foo"] = "bar"
+
+	session, _ := lazy.Session()
+	if !lazy.Loaded() || session.Values["foo"] != "bar" {
+		t.Errorf("Expected loaded session with foo=bar; Got %v", session.Values)
+	}
+}
@@ -0,0 +1,130 @@
+package mongodbstore
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gorilla/sessions"
+)
+
+// legacyKey holds the legacy session a new session was migrated from.
+const legacyKey transientKey = "legacy"
+
+// readLegacy copies the values of the session with the same name in the
+// Legacy store into the new session. It reports whether a legacy session was
+// found.
+func (m *MongoDBStore) readLegacy(r *http.Request, session *sessions.Session) bool {
+	if m.Legacy == nil {
+		return false
+	}
+	legacy, err := m.Legacy.New(r, session.Name())
+	if err != nil || legacy == nil || legacy.IsNew {
+		return false
+	}
+
+	for k, v := range legacy.Values {
+		session.Values[k] = v
+	}
+	session.Values[legacyKey] = legacy
+	m.counters.add(&m.counters.migrations, 1)
+	return true
+}
+
+// MigrationMode selects how the store and its Legacy store share sessions
+// during a migration.
+type MigrationMode int32
+
+const (
+	// MigrationReadThrough serves sessions from MongoDB, migrating sessions
+	// found only in the Legacy store and deleting them there once saved.
+	MigrationReadThrough MigrationMode = iota
+	// MigrationDualWrite serves sessions from MongoDB like
+	// MigrationReadThrough, but writes every save and deletion to the Legacy
+	// store too instead of deleting migrated sessions from it, so the
+	// migration can be rolled back with MigrationLegacyAuthoritative. The
+	// stores must use different cookie names.
+	MigrationDualWrite
+	// MigrationLegacyAuthoritative serves New, Save and SaveAll from the
+	// Legacy store, as before the migration.
+	MigrationLegacyAuthoritative
+)
+
+var migrationModes = []string{"read-through", "dual-write", "legacy"}
+
+func (mode MigrationMode) String() string {
+	if mode < 0 || int(mode) >= len(migrationModes) {
+		return fmt.Sprintf("MigrationMode(%d)", int32(mode))
+	}
+	return migrationModes[mode]
+}
+
+// ParseMigrationMode returns the mode named s: "read-through", "dual-write"
+// or "legacy", for setting the mode from flags or environment variables.
+func ParseMigrationMode(s string) (MigrationMode, error) {
+	for i, name := range migrationModes {
+		if s == name {
+			return MigrationMode(i), nil
+		}
+	}
+	return 0, fmt.Errorf("mongodbstore: unknown migration mode %q", s)
+}
+
+// SetMigrationMode switches the migration mode. It is safe to call while the
+// store serves requests.
+func (m *MongoDBStore) SetMigrationMode(mode MigrationMode) {
+	atomic.StoreInt32(&m.migrationMode, int32(mode))
+}
+
+// MigrationMode returns the current migration mode.
+func (m *MongoDBStore) MigrationMode() MigrationMode {
+	return MigrationMode(atomic.LoadInt32(&m.migrationMode))
+}
+
+// delegateStore returns the store that New, Save and SaveAll are delegated
+// to: the promoted mirror or the authoritative Legacy store.
+func (m *MongoDBStore) delegateStore() sessions.Store {
+	if standby := m.promotedStore(); standby != nil {
+		return standby
+	}
+	if m.Legacy != nil && m.MigrationMode() == MigrationLegacyAuthoritative {
+		return m.Legacy
+	}
+	return nil
+}
+
+// writeLegacy updates the Legacy store after the session was saved to or
+// deleted from MongoDB. In MigrationDualWrite mode the session is written to
+// the Legacy store; otherwise the legacy session it was migrated from is
+// deleted, so that it can't be migrated again after the session is deleted.
+// It must be called before the cookie of the session is written, in case
+// both stores use the same cookie name.
+func (m *MongoDBStore) writeLegacy(r *http.Request, w http.ResponseWriter, session *sessions.Session) {
+	if m.Legacy == nil {
+		return
+	}
+	legacy, migrated := session.Values[legacyKey].(*sessions.Session)
+	delete(session.Values, legacyKey)
+
+	dual := m.MigrationMode() == MigrationDualWrite
+	if !dual && !migrated {
+		return
+	}
+	if !migrated {
+		var err error
+		if legacy, err = m.Legacy.New(r, session.Name()); err != nil || legacy == nil {
+			legacy = sessions.NewSession(m.Legacy, session.Name())
+		}
+	}
+
+	if dual && session.Options.MaxAge >= 0 {
+		legacy.Values = persistentValues(session)
+		opts := *session.Options
+		legacy.Options = &opts
+	} else {
+		legacy.Options.MaxAge = -1
+	}
+	if err := m.Legacy.Save(r, w, legacy); err != nil {
+		m.reportError(r.Context(), "write legacy session", m.sessionError("write legacy", session.Name(), err))
+	}
+}
@@ -0,0 +1,105 @@
+package mongodbstore
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/sessions"
+)
+
+// legacyStore serves one stored session to requests with a legacy cookie.
+type legacyStore struct {
+	recordingStore
+}
+
+func (s *legacyStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	session.IsNew = true
+	if c, err := r.Cookie("legacy"); err == nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if values, ok := s.saved[c.Value]; ok {
+			session.ID = c.Value
+			session.Values = values
+			session.IsNew = false
+		}
+	}
+	return session, nil
+}
+
+func TestLegacyReadThrough(t *testing.T) {
+	store := newOfflineStore(t)
+	legacy := &legacyStore{recordingStore{saved: map[string]map[interface{}]interface{}{
+		"old-id": {"user": "alice"},
+	}}}
+	store.Legacy = legacy
+
+	req := httptest.NewRequest("GET", "/", nil)
+	session, err := store.New(req, "session-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := session.Values["user"]; ok {
+		t.Fatal("Expected no values without a legacy session")
+	}
+
+	req.AddCookie(&http.Cookie{Name: "legacy", Value: "old-id"})
+	session, err = store.New(req, "session-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !session.IsNew || session.Values["user"] != "alice" {
+		t.Fatalf("Expected a new session with the legacy values; Got new=%v %v", session.IsNew, session.Values)
+	}
+	if got := store.counters.snapshot()["migrations"]; got != 1 {
+		t.Errorf("Expected 1 migration; Got %d", got)
+	}
+
+	store.writeLegacy(req, httptest.NewRecorder(), session)
+	if _, ok := legacy.saved["old-id"]; ok {
+		t.Error("Expected the legacy session to be deleted")
+	}
+	if _, ok := session.Values[legacyKey]; ok {
+		t.Error("Expected the legacy session to be forgotten")
+	}
+}
+
+func TestMigrationMode(t *testing.T) {
+	store := newOfflineStore(t)
+	legacy := &legacyStore{recordingStore{saved: make(map[string]map[interface{}]interface{})}}
+	store.Legacy = legacy
+
+	mode, err := ParseMigrationMode("dual-write")
+	if err != nil || mode != MigrationDualWrite || mode.String() != "dual-write" {
+		t.Fatalf("ParseMigrationMode = %v, %v", mode, err)
+	}
+	if _, err := ParseMigrationMode("both"); err == nil {
+		t.Error("Expected an unknown mode to be rejected")
+	}
+
+	store.SetMigrationMode(MigrationDualWrite)
+	req := httptest.NewRequest("GET", "/", nil)
+	session, err := store.New(req, "session-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.Values["user"] = "bob"
+	store.writeLegacy(req, httptest.NewRecorder(), session)
+	var written bool
+	for _, values := range legacy.saved {
+		written = written || values["user"] == "bob"
+	}
+	if !written {
+		t.Errorf("Expected the save to be written to the legacy store; Got %v", legacy.saved)
+	}
+
+	store.SetMigrationMode(MigrationLegacyAuthoritative)
+	session, err = store.New(req, "session-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Store() != legacy {
+		t.Error("Expected New to be served by the authoritative legacy store")
+	}
+}
@@ -0,0 +1,49 @@
+package mongodbstore
+
+import (
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// deadlines returns the idle and absolute expiration times of the session
+// according to the Lifetime policy and IdleTimeout. Zero times mean no limit.
+func (m *MongoDBStore) deadlines(session *sessions.Session, now time.Time) (idle, absolute time.Time) {
+	var idleTimeout, absoluteTimeout time.Duration
+	if m.Lifetime != nil {
+		idleTimeout, absoluteTimeout = m.Lifetime(session)
+	}
+	if idleTimeout <= 0 {
+		idleTimeout = m.IdleTimeout
+	}
+	if idleTimeout > 0 {
+		idle = now.Add(idleTimeout)
+	}
+	if absoluteTimeout > 0 {
+		absolute = now.Add(absoluteTimeout)
+	}
+	return idle, absolute
+}
+
+// storageExpires returns the time the document saved at now is removed after,
+// according to StorageTTL. The zero time means never.
+func (m *MongoDBStore) storageExpires(now time.Time) time.Time {
+	if m.StorageTTL <= 0 {
+		return time.Time{}
+	}
+	return now.Add(m.StorageTTL)
+}
+
+// expired reports whether the document is past one of its deadlines.
+func (s *Session) expired(now time.Time) bool {
+	if !s.IdleExpires.IsZero() && !now.Before(s.IdleExpires) {
+		return true
+	}
+	if !s.AbsoluteExpires.IsZero() && !now.Before(s.AbsoluteExpires) {
+		return true
+	}
+	if !s.Expires.IsZero() && !now.Before(s.Expires) {
+		return true
+	}
+	return false
+}
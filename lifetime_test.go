@@ -0,0 +1,151 @@
+package mongodbstore
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/x/bsonx"
+)
+
+func TestLifetime(t *testing.T) {
+	store := newOfflineStore(t)
+	store.Lifetime = func(session *sessions.Session) (time.Duration, time.Duration) {
+		if session.Values["admin"] == true {
+			return 15 * time.Minute, 8 * time.Hour
+		}
+		return 30 * 24 * time.Hour, 0
+	}
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, _ := store.New(req, "session-key")
+	session.ID = "5cc8b3a2a4d5b6c7d8e9f0a1"
+	session.Values["admin"] = true
+
+	s, err := store.document(session)
+	if err != nil {
+		t.Fatalf("Error encoding session: %v", err)
+	}
+	if d := s.IdleExpires.Sub(s.Modified); d != 15*time.Minute {
+		t.Errorf("Expected idle timeout of 15m; Got %v", d)
+	}
+	if d := s.AbsoluteExpires.Sub(s.Modified); d != 8*time.Hour {
+		t.Errorf("Expected absolute timeout of 8h; Got %v", d)
+	}
+
+	if s.expired(s.Modified.Add(time.Minute)) {
+		t.Errorf("Expected session to be valid after a minute")
+	}
+	if !s.expired(s.Modified.Add(16 * time.Minute)) {
+		t.Errorf("Expected session to be expired after 16 minutes")
+	}
+
+	update := s.update()
+	if len(update) != 4 || update[1].Key != "$setOnInsert" || update[2].Key != "$unset" || update[3].Key != "$min" {
+		t.Errorf("Expected $set, $setOnInsert, $unset and $min; Got %v", update)
+	}
+}
+
+func TestMaxLifetime(t *testing.T) {
+	store := newOfflineStore(t)
+	store.CacheTTL = time.Minute
+	store.MaxLifetime = time.Hour
+
+	id := primitive.NewObjectID()
+	data, err := securecookie.EncodeMulti("session-key", map[interface{}]interface{}{"foo": "bar"}, store.Codecs...)
+	if err != nil {
+		t.Fatalf("Error encoding data: %v", err)
+	}
+	store.cacheDoc(&Session{ID: id, Data: data, Created: time.Now().Add(-2 * time.Hour)})
+	cookie, err := securecookie.EncodeMulti("session-key", id.Hex(), store.Codecs...)
+	if err != nil {
+		t.Fatalf("Error encoding cookie: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "http://localhost:8080/", nil)
+	req.AddCookie(&http.Cookie{Name: "session-key", Value: cookie})
+	rsp := httptest.NewRecorder()
+	mw := &Middleware{Store: store, Name: "session-key"}
+	mw.ServeHTTP(rsp, req, func(w http.ResponseWriter, r *http.Request) {
+		session, err := store.Get(r, "session-key")
+		if !errors.Is(err, ErrSessionExpired) {
+			t.Errorf("Expected ErrSessionExpired; Got %v", err)
+		}
+		if !session.IsNew || session.ID != "" || len(session.Values) != 0 {
+			t.Errorf("Expected new session; Got %+v", session)
+		}
+	})
+
+	cookies := rsp.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+		t.Errorf("Expected expired session cookie; Got %v", cookies)
+	}
+}
+
+func TestStorageTTL(t *testing.T) {
+	store := newOfflineStore(t)
+	store.MaxAge(0)
+	store.StorageTTL = time.Hour
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, _ := store.New(req, "session-key")
+	session.ID = "5cc8b3a2a4d5b6c7d8e9f0a1"
+
+	s, err := store.document(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Until(s.Expires); d < 59*time.Minute || d > time.Hour {
+		t.Errorf("expires in %v, want about an hour", d)
+	}
+	if s.expired(time.Now()) || !s.expired(s.Expires) {
+		t.Error("StorageTTL not enforced on load")
+	}
+
+	for _, index := range indexes(0) {
+		if index.Options.ExpireAfterSeconds != nil && *index.Options.ExpireAfterSeconds == 0 &&
+			index.Keys.(bsonx.Doc)[0].Key == "modified" {
+			t.Error("session cookies make the modified index remove documents immediately")
+		}
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	store := newOfflineStore(t)
+	store.IdleTimeout = time.Hour
+	store.Lifetime = func(session *sessions.Session) (time.Duration, time.Duration) {
+		if session.Values["admin"] == true {
+			return time.Minute, 0
+		}
+		return 0, 0
+	}
+
+	session := sessions.NewSession(store, "session-key")
+	now := time.Now()
+	if idle, _ := store.deadlines(session, now); !idle.Equal(now.Add(time.Hour)) {
+		t.Errorf("idle deadline = %v, want IdleTimeout", idle.Sub(now))
+	}
+	session.Values["admin"] = true
+	if idle, _ := store.deadlines(session, now); !idle.Equal(now.Add(time.Minute)) {
+		t.Errorf("idle deadline = %v, want the Lifetime timeout", idle.Sub(now))
+	}
+}
+
+func TestCookieMaxAge(t *testing.T) {
+	store := newOfflineStore(t)
+	store.CookieMaxAge(0)
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, _ := store.New(req, "session-key")
+	if session.Options.MaxAge != 0 {
+		t.Errorf("cookie MaxAge = %d, want a session cookie", session.Options.MaxAge)
+	}
+	if store.StorageTTL != 0 || store.IdleTimeout != 0 {
+		t.Error("CookieMaxAge changed the server-side lifetimes")
+	}
+}
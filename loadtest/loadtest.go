@@ -0,0 +1,170 @@
+// Package loadtest drives concurrent session traffic against a
+// sessions.Store, typically a mongodbstore.MongoDBStore connected to a real
+// cluster, and reports operation latencies.
+package loadtest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"time"
+
+	gcontext "github.com/gorilla/context"
+	"github.com/gorilla/sessions"
+)
+
+// Config configures a load test run.
+type Config struct {
+	// Store is the store under test.
+	Store sessions.Store
+	// SessionName is the name of the session used by the simulated clients.
+	SessionName string
+	// Concurrency is the number of simulated clients.
+	Concurrency int
+	// Duration is how long the test runs.
+	Duration time.Duration
+	// WriteRatio is the fraction of requests, between 0 and 1, that change a
+	// session value before saving.
+	WriteRatio float64
+}
+
+// Latency summarizes the latencies of one kind of operation.
+type Latency struct {
+	Count  int
+	Errors int
+	P50    time.Duration
+	P99    time.Duration
+	Max    time.Duration
+}
+
+// String formats the summary on a single line.
+func (l Latency) String() string {
+	return fmt.Sprintf("count=%d errors=%d p50=%v p99=%v max=%v", l.Count, l.Errors, l.P50, l.P99, l.Max)
+}
+
+// Report is the result of a load test run.
+type Report struct {
+	Load   Latency
+	Save   Latency
+	Delete Latency
+}
+
+type recorder struct {
+	mu        sync.Mutex
+	durations []time.Duration
+	errors    int
+}
+
+func (r *recorder) record(start time.Time, err error) {
+	d := time.Since(start)
+	r.mu.Lock()
+	if err != nil {
+		r.errors++
+	} else {
+		r.durations = append(r.durations, d)
+	}
+	r.mu.Unlock()
+}
+
+func (r *recorder) latency() Latency {
+	l := Latency{Count: len(r.durations), Errors: r.errors}
+	if len(r.durations) == 0 {
+		return l
+	}
+	sort.Slice(r.durations, func(i, j int) bool { return r.durations[i] < r.durations[j] })
+	l.P50 = percentile(r.durations, 0.50)
+	l.P99 = percentile(r.durations, 0.99)
+	l.Max = r.durations[len(r.durations)-1]
+	return l
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	i := int(float64(len(sorted))*p+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+// Run simulates Concurrency clients, each creating a session and then
+// repeatedly loading it and saving it until Duration elapses or ctx is done.
+// Every client creates its session, even if Duration elapses first, and
+// deletes it at the end.
+func Run(ctx context.Context, cfg Config) (*Report, error) {
+	if cfg.Store == nil {
+		return nil, fmt.Errorf("loadtest: no store")
+	}
+	if cfg.SessionName == "" {
+		cfg.SessionName = "loadtest"
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.Duration)
+	defer cancel()
+
+	var load, save, del recorder
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.Concurrency; i++ {
+		wg.Add(1)
+		go func(client int) {
+			defer wg.Done()
+			runClient(ctx, cfg, client, &load, &save, &del)
+		}(i)
+	}
+	wg.Wait()
+
+	return &Report{
+		Load:   load.latency(),
+		Save:   save.latency(),
+		Delete: del.latency(),
+	}, nil
+}
+
+func runClient(ctx context.Context, cfg Config, client int, load, save, del *recorder) {
+	var cookie string
+	var session *sessions.Session
+	for n := 0; n == 0 || ctx.Err() == nil; n++ {
+		req := httptest.NewRequest("GET", "http://localhost/", nil)
+		if cookie != "" {
+			req.Header.Set("Cookie", cookie)
+		}
+
+		start := time.Now()
+		s, err := cfg.Store.New(req, cfg.SessionName)
+		load.record(start, err)
+		if err == nil {
+			session = s
+			if cookie == "" || float64(n%100) < cfg.WriteRatio*100 {
+				session.Values["client"] = client
+				session.Values["n"] = n
+				rsp := httptest.NewRecorder()
+				start = time.Now()
+				err = cfg.Store.Save(req, rsp, session)
+				save.record(start, err)
+				for _, c := range rsp.Result().Cookies() {
+					if err == nil && c.Name == cfg.SessionName {
+						cookie = (&http.Cookie{Name: c.Name, Value: c.Value}).String()
+					}
+				}
+			}
+		}
+		gcontext.Clear(req)
+	}
+
+	if session == nil {
+		return
+	}
+	session.Options.MaxAge = -1
+	req := httptest.NewRequest("GET", "http://localhost/", nil)
+	start := time.Now()
+	del.record(start, cfg.Store.Save(req, httptest.NewRecorder(), session))
+	gcontext.Clear(req)
+}
@@ -0,0 +1,43 @@
+package loadtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+func TestRun(t *testing.T) {
+	report, err := Run(context.Background(), Config{
+		Store:       sessions.NewCookieStore([]byte("secret-key")),
+		Concurrency: 4,
+		Duration:    50 * time.Millisecond,
+		WriteRatio:  0.5,
+	})
+	if err != nil {
+		t.Fatalf("Error running load test: %v", err)
+	}
+	if report.Load.Count == 0 || report.Save.Count == 0 {
+		t.Errorf("Expected loads and saves; Got %+v", report)
+	}
+	if report.Delete.Count != 4 {
+		t.Errorf("Expected 4 deletes; Got %v", report.Delete)
+	}
+	if report.Load.P50 > report.Load.P99 {
+		t.Errorf("Expected p50 <= p99; Got %v", report.Load)
+	}
+}
+
+func TestRunElapsed(t *testing.T) {
+	report, err := Run(context.Background(), Config{
+		Store:       sessions.NewCookieStore([]byte("secret-key")),
+		Concurrency: 4,
+	})
+	if err != nil {
+		t.Fatalf("Error running load test: %v", err)
+	}
+	if report.Save.Count != 4 || report.Delete.Count != 4 {
+		t.Errorf("Expected every client to create and delete its session; Got %+v", report)
+	}
+}
@@ -0,0 +1,128 @@
+package mongodbstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrLockLost is returned by Unlock when the lock expired and was taken by
+// someone else in the meantime.
+var ErrLockLost = errors.New("mongodbstore: session lock lost")
+
+// lockRetryInterval is how long Lock waits before trying again to take a lock
+// held by someone else.
+const lockRetryInterval = 50 * time.Millisecond
+
+// SessionLock is a lock on a stored session taken with Lock.
+type SessionLock struct {
+	store *MongoDBStore
+	name  string
+	id    primitive.ObjectID
+	owner string
+}
+
+// Lock takes an exclusive lock on the stored session, so that multi-step
+// flows such as a payment callback racing a user request can serialize their
+// access to the session across application nodes. It waits until the lock is
+// free or ctx is done. The lock expires after ttl unless released with Unlock
+// earlier, so a crashed holder does not block the session forever.
+//
+// The lock is advisory: loads and saves ignore it. Holders should load the
+// session after taking the lock and save it before releasing it.
+func (m *MongoDBStore) Lock(ctx context.Context, session *sessions.Session, ttl time.Duration) (*SessionLock, error) {
+	if session.IsNew {
+		return nil, m.sessionError("lock", session.Name(), ErrNotFound)
+	}
+	sessionID, err := primitive.ObjectIDFromHex(session.ID)
+	if err != nil {
+		return nil, m.sessionError("lock", session.Name(), ErrInvalidID)
+	}
+	owner, err := randomString(16)
+	if err != nil {
+		return nil, m.sessionError("lock", session.Name(), err)
+	}
+
+	l := &SessionLock{store: m, name: session.Name(), id: sessionID, owner: owner}
+	for {
+		acquired, err := l.try(ctx, ttl)
+		if err != nil {
+			return nil, m.sessionError("lock", session.Name(), err)
+		}
+		if acquired {
+			return l, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, m.sessionError("lock", session.Name(), ctx.Err())
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
+
+// try takes the lock if it is free or expired.
+func (l *SessionLock) try(ctx context.Context, ttl time.Duration) (bool, error) {
+	m := l.store
+	now := time.Now()
+	filter := append(m.liveFilter(l.id), bson.E{Key: "$or", Value: bson.A{
+		bson.D{{Key: "lock", Value: bson.D{{Key: "$exists", Value: false}}}},
+		bson.D{{Key: "lock.expires", Value: bson.D{{Key: "$lte", Value: now}}}},
+	}})
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "lock", Value: bson.D{
+		{Key: "owner", Value: l.owner},
+		{Key: "expires", Value: now.Add(ttl)},
+	}}}}}
+
+	var matched int64
+	err := m.observe(m.profilerContext(ctx, l.name), "updateOne", filter, func(ctx context.Context) (string, error) {
+		res, err := m.collection.UpdateOne(ctx, filter, update)
+		if err != nil {
+			return "", err
+		}
+		matched = res.MatchedCount
+		return fmt.Sprintf("matched=%d modified=%d", res.MatchedCount, res.ModifiedCount), nil
+	})
+	if err != nil || matched == 1 {
+		return err == nil, err
+	}
+
+	// No match: either the lock is held or the session does not exist. Err
+	// of a SingleResult does not report a missing document, Decode does.
+	filter = m.liveFilter(l.id)
+	err = m.observe(m.profilerContext(ctx, l.name), "findOne", filter, func(ctx context.Context) (string, error) {
+		return "", m.collection.FindOne(ctx, filter,
+			options.FindOne().SetProjection(bson.D{{Key: "_id", Value: 1}})).Decode(nil)
+	})
+	if err == mongo.ErrNoDocuments {
+		return false, ErrNotFound
+	}
+	return false, err
+}
+
+// Unlock releases the lock. It returns ErrLockLost if the lock expired and
+// was taken by someone else.
+func (l *SessionLock) Unlock(ctx context.Context) error {
+	m := l.store
+	filter := bson.D{{Key: "_id", Value: l.id}, {Key: "lock.owner", Value: l.owner}}
+	var matched int64
+	err := m.observe(m.profilerContext(ctx, l.name), "updateOne", filter, func(ctx context.Context) (string, error) {
+		res, err := m.collection.UpdateOne(ctx, filter, bson.D{{Key: "$unset", Value: bson.D{{Key: "lock", Value: ""}}}})
+		if err != nil {
+			return "", err
+		}
+		matched = res.MatchedCount
+		return fmt.Sprintf("matched=%d modified=%d", res.MatchedCount, res.ModifiedCount), nil
+	})
+	if err == nil && matched == 0 {
+		err = ErrLockLost
+	}
+	return m.sessionError("unlock", l.name, err)
+}
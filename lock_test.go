@@ -0,0 +1,133 @@
+package mongodbstore
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	gcontext "github.com/gorilla/context"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+func TestLockNewSession(t *testing.T) {
+	store := newOfflineStore(t)
+	session := sessions.NewSession(store, "session-key")
+	session.IsNew = true
+
+	if _, err := store.Lock(context.Background(), session, time.Second); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for an unsaved session; Got %v", err)
+	}
+}
+
+// savedSession saves a new session to the store and returns it as loaded by
+// the next request.
+func savedSession(t *testing.T, store *MongoDBStore) *sessions.Session {
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	defer gcontext.Clear(req)
+	session, err := store.Get(req, "session-key")
+	if err != nil {
+		t.Fatalf("Error creating session: %v", err)
+	}
+	rsp := httptest.NewRecorder()
+	if err := store.Save(req, rsp, session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+
+	next := reload(rsp)
+	defer gcontext.Clear(next)
+	loaded, err := store.Get(next, "session-key")
+	if err != nil || loaded.IsNew {
+		t.Fatalf("Expected the stored session; Got %v, %v", loaded, err)
+	}
+	return loaded
+}
+
+func TestMongoStoreLock(t *testing.T) {
+	store := newLiveStore(t)
+	session := savedSession(t, store)
+	ctx := context.Background()
+
+	first, err := store.Lock(ctx, session, time.Minute)
+	if err != nil {
+		t.Fatalf("Error taking the lock: %v", err)
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	if _, err := store.Lock(waitCtx, session, time.Minute); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected to wait for the held lock; Got %v", err)
+	}
+
+	if err := first.Unlock(ctx); err != nil {
+		t.Fatalf("Error releasing the lock: %v", err)
+	}
+	second, err := store.Lock(ctx, session, time.Minute)
+	if err != nil {
+		t.Fatalf("Expected to take the released lock; Got %v", err)
+	}
+	if err := first.Unlock(ctx); !errors.Is(err, ErrLockLost) {
+		t.Errorf("Expected ErrLockLost releasing a lock twice; Got %v", err)
+	}
+	if err := second.Unlock(ctx); err != nil {
+		t.Errorf("Error releasing the lock: %v", err)
+	}
+}
+
+func TestMongoStoreLockExpiry(t *testing.T) {
+	store := newLiveStore(t)
+	session := savedSession(t, store)
+	ctx := context.Background()
+
+	first, err := store.Lock(ctx, session, 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Error taking the lock: %v", err)
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	second, err := store.Lock(waitCtx, session, time.Minute)
+	if err != nil {
+		t.Fatalf("Expected to take the expired lock; Got %v", err)
+	}
+	if err := first.Unlock(ctx); !errors.Is(err, ErrLockLost) {
+		t.Errorf("Expected ErrLockLost once the lock was taken over; Got %v", err)
+	}
+	if err := second.Unlock(ctx); err != nil {
+		t.Errorf("Error releasing the lock: %v", err)
+	}
+}
+
+func TestMongoStoreLockTombstone(t *testing.T) {
+	store := newLiveStore(t)
+	store.TombstoneTTL = time.Hour
+	session := savedSession(t, store)
+	ctx := context.Background()
+
+	if err := store.deleteContext(ctx, session); err != nil {
+		t.Fatalf("Error deleting session: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	if _, err := store.Lock(ctx, session, time.Minute); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a revoked session; Got %v", err)
+	}
+}
+
+// reloadSession returns the session as loaded from the store by a request
+// carrying its cookie.
+func reloadSession(t *testing.T, store *MongoDBStore, session *sessions.Session) *sessions.Session {
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, store.CookieCodecs(session.Name())...)
+	if err != nil {
+		t.Fatalf("Error encoding session id: %v", err)
+	}
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	defer gcontext.Clear(req)
+	req.AddCookie(&http.Cookie{Name: session.Name(), Value: encoded})
+	loaded, err := store.Get(req, session.Name())
+	if err != nil || loaded.IsNew {
+		t.Fatalf("Expected the stored session; Got %v, %v", loaded, err)
+	}
+	return loaded
+}
@@ -0,0 +1,150 @@
+package mongodbstore
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryStore is a Store keeping sessions in memory, for running an
+// application locally without MongoDB. Like MongoDBStore it keeps the
+// session id in the cookie and the values, encoded with the Codecs, on the
+// server, so values that MongoDBStore can't store fail here too. Sessions
+// are lost when the process exits and are not shared between processes.
+type MemoryStore struct {
+	Codecs  []securecookie.Codec
+	Options *sessions.Options
+
+	mu       sync.Mutex
+	sessions map[string]memorySession
+}
+
+// memorySession is a session stored by a MemoryStore.
+type memorySession struct {
+	data    string
+	expires time.Time
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore returns a new MemoryStore. maxAge and keyPairs are those of
+// NewMongoDBStore.
+func NewMemoryStore(maxAge int, keyPairs ...[]byte) *MemoryStore {
+	store := &MemoryStore{
+		Codecs: securecookie.CodecsFromPairs(keyPairs...),
+		Options: &sessions.Options{
+			Path:   "/",
+			MaxAge: maxAge,
+		},
+		sessions: make(map[string]memorySession),
+	}
+	for _, codec := range store.Codecs {
+		if sc, ok := codec.(*securecookie.SecureCookie); ok {
+			sc.MaxAge(maxAge)
+		}
+	}
+	return store
+}
+
+// Get registers and returns a session for the given name.
+func (s *MemoryStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New returns a session for the given name without adding it to the registry.
+func (s *MemoryStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	opts := *s.Options
+	session.Options = &opts
+	session.IsNew = true
+
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+	if session.ID, err = ParseToken(name, cookie.Value, s.Codecs...); err != nil {
+		return session, err
+	}
+
+	s.mu.Lock()
+	stored, ok := s.sessions[session.ID]
+	if ok && !stored.expires.IsZero() && time.Now().After(stored.expires) {
+		delete(s.sessions, session.ID)
+		ok = false
+	}
+	s.mu.Unlock()
+	if !ok {
+		return session, nil
+	}
+
+	if err := securecookie.DecodeMulti(name, stored.data, &session.Values, s.Codecs...); err != nil {
+		return session, err
+	}
+	session.IsNew = false
+	return session, nil
+}
+
+// Save stores the session, or deletes it if Options.MaxAge < 0, and writes
+// its cookie.
+func (s *MemoryStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if session.Options.MaxAge < 0 {
+		s.mu.Lock()
+		delete(s.sessions, session.ID)
+		s.mu.Unlock()
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	if session.ID == "" {
+		session.ID = primitive.NewObjectID().Hex()
+	}
+	values := persistentValues(session)
+	data, err := securecookie.EncodeMulti(session.Name(), values, s.Codecs...)
+	if err != nil {
+		return encodeError(values, err)
+	}
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+
+	stored := memorySession{data: data}
+	if session.Options.MaxAge > 0 {
+		stored.expires = time.Now().Add(time.Duration(session.Options.MaxAge) * time.Second)
+	}
+	s.mu.Lock()
+	s.sessions[session.ID] = stored
+	s.mu.Unlock()
+
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+// Destroy deletes the session with the given name and expires its cookie.
+func (s *MemoryStore) Destroy(r *http.Request, w http.ResponseWriter, name string) error {
+	session, err := s.Get(r, name)
+	if err != nil {
+		session = sessions.NewSession(s, name)
+		opts := *s.Options
+		session.Options = &opts
+	}
+	session.Options.MaxAge = -1
+	return s.Save(r, w, session)
+}
+
+// Refresh saves the session with the given name unchanged, extending its
+// lifetime. It does nothing for a request without a stored session.
+func (s *MemoryStore) Refresh(r *http.Request, w http.ResponseWriter, name string) error {
+	session, err := s.Get(r, name)
+	if err != nil {
+		return err
+	}
+	if session.IsNew {
+		return nil
+	}
+	return s.Save(r, w, session)
+}
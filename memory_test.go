@@ -0,0 +1,66 @@
+package mongodbstore
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore(3600, []byte("secret-key"))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	session, err := store.Get(req, "session-key")
+	if err != nil || !session.IsNew {
+		t.Fatalf("Expected a new session; Got %v, %v", session, err)
+	}
+	session.Values["foo"] = "bar"
+	w := httptest.NewRecorder()
+	if err := store.Save(req, w, session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Cookie", w.Header().Get("Set-Cookie"))
+	loaded, err := store.Get(req, "session-key")
+	if err != nil || loaded.IsNew || loaded.ID != session.ID || loaded.Values["foo"] != "bar" {
+		t.Fatalf("Expected the saved session; Got %+v, %v", loaded, err)
+	}
+
+	loaded.Values["bad"] = struct{ unregistered int }{}
+	if err := store.Save(req, httptest.NewRecorder(), loaded); err == nil {
+		t.Error("Expected unencodable values to fail like in MongoDBStore")
+	}
+	delete(loaded.Values, "bad")
+
+	if err := store.Destroy(req, httptest.NewRecorder(), "session-key"); err != nil {
+		t.Fatalf("Error destroying session: %v", err)
+	}
+	req2 := httptest.NewRequest("GET", "/", nil)
+	req2.Header.Set("Cookie", w.Header().Get("Set-Cookie"))
+	if s, _ := store.New(req2, "session-key"); !s.IsNew {
+		t.Error("Expected the destroyed session to be gone")
+	}
+}
+
+func TestOpenStoreDevFallback(t *testing.T) {
+	cfg := Config{
+		URI:         "mongodb://127.0.0.1:1/?serverSelectionTimeoutMS=100&connectTimeoutMS=100",
+		Database:    "app",
+		KeyPairs:    [][]byte{bytes.Repeat([]byte("k"), 32)},
+		DevFallback: true,
+	}
+	store, err := OpenStore(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Expected a fallback store; Got %v", err)
+	}
+	if _, ok := store.(*MemoryStore); !ok {
+		t.Errorf("Expected a MemoryStore; Got %T", store)
+	}
+
+	cfg.DevFallback = false
+	if _, err := OpenStore(context.Background(), cfg); err == nil {
+		t.Error("Expected an error without DevFallback")
+	}
+}
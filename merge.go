@@ -0,0 +1,97 @@
+package mongodbstore
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	"github.com/gorilla/sessions"
+)
+
+// MergeFunc merges the value of a key in the source session of MergeInto
+// with its value in the target session and returns the merged value. It is
+// only called for keys both sessions hold.
+type MergeFunc func(from, to interface{}) interface{}
+
+// Merge functions for MergeStrategy.
+var (
+	// KeepTarget keeps the value of the target session.
+	KeepTarget MergeFunc = func(from, to interface{}) interface{} { return to }
+	// PreferSource replaces the value of the target session.
+	PreferSource MergeFunc = func(from, to interface{}) interface{} { return from }
+	// AppendSlices appends a slice of the source to a slice of the same type
+	// of the target, as for the items of two carts. Other values are kept.
+	AppendSlices MergeFunc = appendSlices
+)
+
+func appendSlices(from, to interface{}) interface{} {
+	f, t := reflect.ValueOf(from), reflect.ValueOf(to)
+	if f.Kind() != reflect.Slice || f.Type() != t.Type() {
+		return to
+	}
+	merged := reflect.MakeSlice(t.Type(), 0, t.Len()+f.Len())
+	merged = reflect.AppendSlice(merged, t)
+	return reflect.AppendSlice(merged, f).Interface()
+}
+
+// MergeStrategy tells MergeInto how to merge the values both sessions hold.
+type MergeStrategy struct {
+	// Keys are the merge functions of some keys.
+	Keys map[interface{}]MergeFunc
+	// Default merges the other keys, KeepTarget if nil.
+	Default MergeFunc
+}
+
+// mergeFunc returns the merge function of the key.
+func (s MergeStrategy) mergeFunc(key interface{}) MergeFunc {
+	if f, ok := s.Keys[key]; ok {
+		return f
+	}
+	if s.Default != nil {
+		return s.Default
+	}
+	return KeepTarget
+}
+
+// MergeInto merges the values of the from session, typically the anonymous
+// session of a user who just logged in, into the to session, their
+// authenticated one, and deletes the from session. Values only from holds are
+// copied; values both hold are merged according to the strategy. Values
+// maintained by the store, such as the principal, labels and expiration times
+// of SetWithTTL, are not merged. The from session is left empty, as a new
+// session; the to session must be saved to persist the merged values.
+func (m *MongoDBStore) MergeInto(ctx context.Context, from, to *sessions.Session, strategy MergeStrategy) error {
+	for key, value := range from.Values {
+		if reservedKey(key) {
+			continue
+		}
+		if current, ok := to.Values[key]; ok {
+			to.Values[key] = strategy.mergeFunc(key)(value, current)
+		} else {
+			to.Values[key] = value
+		}
+	}
+
+	if from.ID == "" || from.IsNew {
+		return nil
+	}
+	if err := m.deleteContext(ctx, from); err != nil {
+		return m.sessionError("delete", from.Name(), err)
+	}
+	m.notify(Event{Type: EventDestroyed, Name: from.Name(), ID: from.ID, Principal: GetPrincipal(from)})
+	from.Values = make(map[interface{}]interface{})
+	from.ID = ""
+	from.IsNew = true
+	return nil
+}
+
+// reservedKey reports whether the session value is maintained by the store.
+func reservedKey(key interface{}) bool {
+	switch k := key.(type) {
+	case transientKey:
+		return true
+	case string:
+		return strings.HasPrefix(k, "mongodbstore.")
+	}
+	return false
+}
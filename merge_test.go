@@ -0,0 +1,54 @@
+package mongodbstore
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/gorilla/sessions"
+)
+
+func TestMergeInto(t *testing.T) {
+	store := newOfflineStore(t)
+
+	from := sessions.NewSession(store, "session-key")
+	from.IsNew = true
+	from.Values["cart"] = []string{"book"}
+	from.Values["theme"] = "dark"
+	from.Values["locale"] = "fr"
+	from.Values["draft"] = "text"
+	SetPrincipal(from, "anonymous")
+
+	to := sessions.NewSession(store, "session-key")
+	to.Values["cart"] = []string{"pen"}
+	to.Values["theme"] = "light"
+	to.Values["locale"] = "en"
+	SetPrincipal(to, "alice")
+
+	strategy := MergeStrategy{
+		Keys: map[interface{}]MergeFunc{
+			"cart":  AppendSlices,
+			"theme": PreferSource,
+		},
+	}
+	if err := store.MergeInto(context.Background(), from, to, strategy); err != nil {
+		t.Fatalf("Error merging sessions: %v", err)
+	}
+
+	want := map[interface{}]interface{}{
+		"cart":       []string{"pen", "book"},
+		"theme":      "dark",
+		"locale":     "en",
+		"draft":      "text",
+		principalKey: "alice",
+	}
+	if !reflect.DeepEqual(to.Values, want) {
+		t.Errorf("Expected %v; Got %v", want, to.Values)
+	}
+}
+
+func TestAppendSlicesMismatch(t *testing.T) {
+	if got := AppendSlices([]int{1}, []string{"a"}); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Errorf("Expected the target kept; Got %v", got)
+	}
+}
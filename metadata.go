@@ -0,0 +1,91 @@
+package mongodbstore
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+)
+
+// metadataKey holds the metadata captured when a new session is created.
+const metadataKey transientKey = "metadata"
+
+// Metadata describes the client that created a session. It is stored in the
+// meta field of the session document when CaptureMetadata is set, along with
+// the Enrichment of the Enricher.
+type Metadata struct {
+	IP         string     `bson:"ip,omitempty"`
+	UserAgent  string     `bson:"userAgent,omitempty"`
+	Enrichment Enrichment `bson:",inline"`
+
+	// enriched is set once the Enricher was called.
+	enriched bool
+}
+
+// IPPolicy selects how client IP addresses are stored in session metadata.
+type IPPolicy int
+
+const (
+	// IPNone does not store IP addresses.
+	IPNone IPPolicy = iota
+	// IPFull stores IP addresses as they are.
+	IPFull
+	// IPTruncated stores the /24 network of IPv4 addresses and the /48
+	// network of IPv6 addresses.
+	IPTruncated
+	// IPHashed stores an HMAC-SHA256 of the address keyed with IPHashKey, so
+	// sessions from the same address can be correlated without storing it.
+	IPHashed
+)
+
+// metadata returns the metadata of the request according to the policy.
+func (m *MongoDBStore) metadata(r *http.Request) *Metadata {
+	meta := &Metadata{UserAgent: r.UserAgent()}
+	if ip := clientIP(r); ip != nil {
+		meta.IP = m.storedIP(ip)
+	}
+	return meta
+}
+
+// clientIP returns the address of the client of the request, or nil.
+func clientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// storedIP returns the form of the address stored under the IPPolicy.
+func (m *MongoDBStore) storedIP(ip net.IP) string {
+	switch m.IPPolicy {
+	case IPFull:
+		return ip.String()
+	case IPTruncated:
+		if ip4 := ip.To4(); ip4 != nil {
+			return ip4.Mask(net.CIDRMask(24, 32)).String()
+		}
+		return ip.Mask(net.CIDRMask(48, 128)).String()
+	case IPHashed:
+		return m.ipHash(ip)
+	}
+	return ""
+}
+
+// ipHash returns the HMAC-SHA256 of the address keyed with IPHashKey.
+func (m *MongoDBStore) ipHash(ip net.IP) string {
+	mac := hmac.New(sha256.New, m.IPHashKey)
+	mac.Write(ip.To16())
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// storedMetadata returns the metadata captured for a new session, if any,
+// from its values.
+func storedMetadata(isNew bool, values map[interface{}]interface{}) *Metadata {
+	if !isNew {
+		return nil
+	}
+	meta, _ := values[metadataKey].(*Metadata)
+	return meta
+}
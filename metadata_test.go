@@ -0,0 +1,109 @@
+package mongodbstore
+
+import (
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestMetadataIPPolicy(t *testing.T) {
+	store := newOfflineStore(t)
+	store.IPHashKey = []byte("key")
+
+	tests := []struct {
+		policy IPPolicy
+		addr   string
+		want   string
+	}{
+		{IPNone, "192.0.2.17:1234", ""},
+		{IPFull, "192.0.2.17:1234", "192.0.2.17"},
+		{IPTruncated, "192.0.2.17:1234", "192.0.2.0"},
+		{IPTruncated, "[2001:db8:1:2::17]:1234", "2001:db8:1::"},
+		{IPFull, "not an address", ""},
+	}
+	for _, tt := range tests {
+		store.IPPolicy = tt.policy
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.addr
+		r.Header.Set("User-Agent", "test-agent")
+		meta := store.metadata(r)
+		if meta.IP != tt.want {
+			t.Errorf("policy %d, %q: ip = %q, want %q", tt.policy, tt.addr, meta.IP, tt.want)
+		}
+		if meta.UserAgent != "test-agent" {
+			t.Errorf("user agent = %q", meta.UserAgent)
+		}
+	}
+
+	store.IPPolicy = IPHashed
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "192.0.2.17:1234"
+	hashed := store.metadata(r).IP
+	if len(hashed) != 64 || hashed == "192.0.2.17" {
+		t.Fatalf("hashed ip = %q", hashed)
+	}
+	r.RemoteAddr = "192.0.2.17:5678"
+	if got := store.metadata(r).IP; got != hashed {
+		t.Errorf("hash of the same address differs: %q != %q", got, hashed)
+	}
+}
+
+func TestMetadataStoredOnCreate(t *testing.T) {
+	store := newOfflineStore(t)
+	store.CaptureMetadata = true
+	store.IPPolicy = IPTruncated
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "192.0.2.17:1234"
+	session, err := store.New(r, "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.ID = "5d1f2d6e1c9d440000a1b2c3"
+
+	s, err := store.document(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Metadata == nil || s.Metadata.IP != "192.0.2.0" {
+		t.Fatalf("metadata = %+v", s.Metadata)
+	}
+
+	session.IsNew = false
+	if s, _ := store.document(session); s.Metadata != nil {
+		t.Errorf("metadata rewritten on update: %+v", s.Metadata)
+	}
+}
+
+// TestMetadataSavedWithSafeValues is meant to be run with -race.
+func TestMetadataSavedWithSafeValues(t *testing.T) {
+	store := newOfflineStore(t)
+	store.CaptureMetadata = true
+
+	r := httptest.NewRequest("GET", "/", nil)
+	session, err := store.New(r, "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.ID = "5d1f2d6e1c9d440000a1b2c3"
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			SafeValues(r, session).Set(i, i)
+			// The offline store fails the write after building the document.
+			store.Save(r, httptest.NewRecorder(), session)
+		}(i)
+	}
+	wg.Wait()
+
+	s, err := store.document(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Metadata == nil {
+		t.Error("Expected the metadata of the new session")
+	}
+}
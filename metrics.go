@@ -0,0 +1,82 @@
+package mongodbstore
+
+import (
+	"bytes"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MetricsSink receives metrics about store operations. Tags are "key:value"
+// strings.
+type MetricsSink interface {
+	Timing(name string, d time.Duration, tags ...string)
+	Count(name string, n int64, tags ...string)
+}
+
+// StatsdSink is a MetricsSink sending metrics to a StatsD server over UDP.
+// With DogStatsD set tags are sent in the DogStatsD format, otherwise they
+// are dropped.
+type StatsdSink struct {
+	Prefix    string
+	DogStatsD bool
+
+	mu   sync.Mutex
+	conn net.Conn
+	buf  bytes.Buffer
+}
+
+// NewStatsdSink returns a StatsdSink sending to addr, such as
+// "127.0.0.1:8125". Metric names are prefixed with prefix.
+func NewStatsdSink(addr, prefix string) (*StatsdSink, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &StatsdSink{Prefix: prefix, conn: conn}, nil
+}
+
+// Timing sends a timer in milliseconds.
+func (s *StatsdSink) Timing(name string, d time.Duration, tags ...string) {
+	s.send(name, strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64), "ms", tags)
+}
+
+// Count sends a counter increment.
+func (s *StatsdSink) Count(name string, n int64, tags ...string) {
+	s.send(name, strconv.FormatInt(n, 10), "c", tags)
+}
+
+// Histogram sends a histogram sample.
+func (s *StatsdSink) Histogram(name string, value float64, tags ...string) {
+	s.send(name, strconv.FormatFloat(value, 'f', -1, 64), "h", tags)
+}
+
+// Close closes the connection to the server.
+func (s *StatsdSink) Close() error {
+	return s.conn.Close()
+}
+
+func (s *StatsdSink) send(name, value, typ string, tags []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.buf.Reset()
+	s.buf.WriteString(s.Prefix)
+	s.buf.WriteString(name)
+	s.buf.WriteByte(':')
+	s.buf.WriteString(value)
+	s.buf.WriteByte('|')
+	s.buf.WriteString(typ)
+	if s.DogStatsD && len(tags) > 0 {
+		s.buf.WriteString("|#")
+		for i, tag := range tags {
+			if i > 0 {
+				s.buf.WriteByte(',')
+			}
+			s.buf.WriteString(tag)
+		}
+	}
+	// Metrics are best effort; a lost datagram is not worth reporting.
+	_, _ = s.conn.Write(s.buf.Bytes())
+}
@@ -0,0 +1,75 @@
+package mongodbstore
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+func TestStatsdSink(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+	defer conn.Close()
+
+	sink, err := NewStatsdSink(conn.LocalAddr().String(), "app.")
+	if err != nil {
+		t.Fatalf("Error creating sink: %v", err)
+	}
+	defer sink.Close()
+
+	buf := make([]byte, 512)
+	read := func() string {
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("Error reading: %v", err)
+		}
+		return string(buf[:n])
+	}
+
+	sink.Count("mongodbstore.errors", 1, "op:findOne")
+	if got := read(); got != "app.mongodbstore.errors:1|c" {
+		t.Errorf("Expected plain counter; Got %q", got)
+	}
+
+	sink.DogStatsD = true
+	sink.Timing("mongodbstore.operation", 1500*time.Microsecond, "op:findOne", "collection:sessions")
+	if got := read(); got != "app.mongodbstore.operation:1.500|ms|#op:findOne,collection:sessions" {
+		t.Errorf("Expected tagged timer; Got %q", got)
+	}
+}
+
+func TestOnLargeSession(t *testing.T) {
+	store := newOfflineStore(t)
+	store.SizeWarning = 300
+	var warned int
+	store.OnLargeSession = func(session *sessions.Session, size int) {
+		warned = size
+	}
+
+	session := sessions.NewSession(store, "session-key")
+	session.ID = "5cc8b3a2a4d5b6c7d8e9f0a1"
+	session.Values["small"] = "x"
+	if _, err := store.document(session); err != nil {
+		t.Fatalf("Error encoding session: %v", err)
+	}
+	if warned != 0 {
+		t.Errorf("Expected no warning for a small session; Got %d", warned)
+	}
+
+	session.Values["large"] = strings.Repeat("x", 400)
+	if _, err := store.document(session); err != nil {
+		t.Fatalf("Error encoding session: %v", err)
+	}
+	if warned <= 400 {
+		t.Errorf("Expected warning with the encoded size; Got %d", warned)
+	}
+	if saved := store.counters.snapshot()["saved_bytes"]; saved <= int64(warned) {
+		t.Errorf("Expected saved bytes to add up; Got %d", saved)
+	}
+}
@@ -0,0 +1,78 @@
+package mongodbstore
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/sessions"
+)
+
+// loadErrorKey holds the error that prevented loading a stored session.
+const loadErrorKey transientKey = "loadError"
+
+// LoadError returns the error that prevented loading the stored session the
+// request referred to, such as MongoDB being unreachable. New and Get return
+// a new session in that case instead of failing.
+func LoadError(session *sessions.Session) error {
+	err, _ := session.Values[loadErrorKey].(error)
+	return err
+}
+
+// Middleware loads the session named Name before calling the next handler,
+// so that a store failure is handled once instead of by every handler. It
+// works as a net/http middleware, as used by chi, through Handler, and as a
+// negroni handler through ServeHTTP.
+//
+// A session past MaxLifetime gets its cookie cleared. The session is
+// registered with the request, so handlers obtain it with
+// Get as usual. Handlers must be wrapped with context.ClearHandler unless the
+// router clears the gorilla context.
+type Middleware struct {
+	// Store is the session store.
+	Store *MongoDBStore
+	// Name is the name of the session to load.
+	Name string
+	// Anonymous lets requests through with a new session when the stored
+	// session cannot be loaded, instead of failing them. The new session gets
+	// a new id once saved, so the stored one is not overwritten.
+	Anonymous bool
+	// OnError writes the response for a request whose session cannot be
+	// loaded. By default it responds with 503 Service Unavailable.
+	OnError func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// Handler returns next wrapped by the middleware.
+func (mw *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mw.ServeHTTP(w, r, next.ServeHTTP)
+	})
+}
+
+// ServeHTTP loads the session and calls next, as a negroni handler.
+func (mw *Middleware) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	// Cookie decode errors leave a new session in the registry and are not
+	// store failures, so they are ignored here.
+	session, err := mw.Store.Get(r, mw.Name)
+	if errors.Is(err, ErrSessionExpired) {
+		opts := *session.Options
+		opts.MaxAge = -1
+		mw.Store.Token.SetToken(w, mw.Store.tokenName(mw.Name), "", &opts)
+	}
+	if err := LoadError(session); err != nil {
+		if !mw.Anonymous {
+			mw.onError(w, r, err)
+			return
+		}
+		session.ID = ""
+		delete(session.Values, loadErrorKey)
+	}
+	next(w, r)
+}
+
+func (mw *Middleware) onError(w http.ResponseWriter, r *http.Request, err error) {
+	if mw.OnError != nil {
+		mw.OnError(w, r, err)
+		return
+	}
+	http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+}
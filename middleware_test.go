@@ -0,0 +1,43 @@
+package mongodbstore
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/context"
+	"github.com/gorilla/securecookie"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMiddleware(t *testing.T) {
+	store := newOfflineStore(t)
+	cookie, err := securecookie.EncodeMulti("session-key", primitive.NewObjectID().Hex(), store.Codecs...)
+	if err != nil {
+		t.Fatalf("Error encoding cookie: %v", err)
+	}
+
+	for _, anonymous := range []bool{false, true} {
+		mw := &Middleware{Store: store, Name: "session-key", Anonymous: anonymous}
+		called := false
+		h := context.ClearHandler(mw.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+			session, _ := store.Get(r, "session-key")
+			if session.ID != "" || LoadError(session) != nil {
+				t.Errorf("Expected fresh anonymous session; Got id %q", session.ID)
+			}
+		})))
+
+		req := httptest.NewRequest("GET", "http://localhost:8080/", nil)
+		req.AddCookie(&http.Cookie{Name: "session-key", Value: cookie})
+		rsp := httptest.NewRecorder()
+		h.ServeHTTP(rsp, req)
+
+		if anonymous && !called {
+			t.Errorf("Expected anonymous request to reach the handler")
+		}
+		if !anonymous && (called || rsp.Code != http.StatusServiceUnavailable) {
+			t.Errorf("Expected 503 without calling the handler; Got %d, %v", rsp.Code, called)
+		}
+	}
+}
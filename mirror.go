@@ -0,0 +1,228 @@
+package mongodbstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// errMirrorFull is reported when a write is dropped because the mirror queue
+// is full.
+var errMirrorFull = errors.New("mongodbstore: mirror queue full, write dropped")
+
+// errMirrorQueueSize is returned by EnableMirror for a queue that can't hold
+// a write.
+var errMirrorQueueSize = errors.New("mongodbstore: mirror queue size must be positive")
+
+// mirrorWrite is a save or deletion waiting to be replicated.
+type mirrorWrite struct {
+	name    string
+	id      string
+	values  map[interface{}]interface{}
+	options sessions.Options
+	queued  time.Time
+}
+
+// mirror replicates writes to a standby store in the background.
+type mirror struct {
+	store    sessions.Store
+	queue    chan mirrorWrite
+	stopped  chan struct{}
+	promoted int32
+
+	mu     sync.Mutex
+	closed bool
+	// pending holds the queue times of the writes in the queue, oldest first.
+	pending []time.Time
+	// inFlight is the queue time of the write being replicated, zero when the
+	// mirror is idle.
+	inFlight time.Time
+}
+
+// EnableMirror replicates saves and deletions of sessions to a standby store,
+// such as a store of another cluster or a Redis store, for disaster recovery.
+// Writes are replicated in the background in the order they were made, with
+// the session ids of this store, so the standby can serve the cookies
+// encoded by this store if it uses the same ids and codecs. Up to queueSize
+// writes wait for replication; further writes are dropped and reported to
+// the error handler. queueSize must be positive. Buffered refreshes of write-behind mode and access times
+// are not replicated.
+//
+// The replication lag is sent to Metrics as mongodbstore.mirror.lag and
+// returned by MirrorLag. PromoteMirror makes the store serve all requests from the
+// standby.
+func (m *MongoDBStore) EnableMirror(store sessions.Store, queueSize int) error {
+	if queueSize <= 0 {
+		return errMirrorQueueSize
+	}
+	mr := &mirror{
+		store:   store,
+		queue:   make(chan mirrorWrite, queueSize),
+		stopped: make(chan struct{}),
+	}
+	m.mirror = mr
+	m.goBackground("mirror", func(context.Context) error {
+		mr.run(m)
+		return nil
+	})
+	return nil
+}
+
+// MirrorLag returns how long the oldest write not yet replicated has been
+// waiting, or zero when the standby is up to date.
+func (m *MongoDBStore) MirrorLag() time.Duration {
+	mr := m.mirror
+	if mr == nil {
+		return 0
+	}
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	oldest := mr.inFlight
+	if oldest.IsZero() && len(mr.pending) > 0 {
+		oldest = mr.pending[0]
+	}
+	if oldest.IsZero() {
+		return 0
+	}
+	return time.Since(oldest)
+}
+
+// PromoteMirror makes the store delegate New, Save and SaveAll to the standby
+// store, for failing over when MongoDB is unavailable. Replication stops: the
+// write being replicated completes, but the writes still queued are dropped.
+// Their number is returned and reported to the error handler, as the standby
+// misses them. Other operations, such as the DeleteWhere family, still use
+// MongoDB.
+func (m *MongoDBStore) PromoteMirror() int {
+	mr := m.mirror
+	if mr == nil {
+		return 0
+	}
+	mr.mu.Lock()
+	dropped := 0
+	if atomic.CompareAndSwapInt32(&mr.promoted, 0, 1) {
+		dropped = len(mr.pending)
+		mr.pending = nil
+	}
+	mr.mu.Unlock()
+
+	if dropped > 0 {
+		m.reportError(context.Background(), "mirror",
+			m.opError("promote mirror", fmt.Errorf("%d queued writes dropped", dropped)))
+	}
+	return dropped
+}
+
+// promotedStore returns the standby store once promoted.
+func (m *MongoDBStore) promotedStore() sessions.Store {
+	if mr := m.mirror; mr != nil && atomic.LoadInt32(&mr.promoted) == 1 {
+		return mr.store
+	}
+	return nil
+}
+
+// mirrorSave queues the replication of the saved or deleted session.
+func (m *MongoDBStore) mirrorSave(session *sessions.Session) {
+	mr := m.mirror
+	if mr == nil || session.ID == "" {
+		return
+	}
+	write := mirrorWrite{
+		name:    session.Name(),
+		id:      session.ID,
+		options: *session.Options,
+		queued:  time.Now(),
+	}
+	if session.Options.MaxAge >= 0 {
+		write.values = persistentValues(session)
+	}
+
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	if mr.closed || atomic.LoadInt32(&mr.promoted) == 1 {
+		return
+	}
+	select {
+	case mr.queue <- write:
+		mr.pending = append(mr.pending, write.queued)
+	default:
+		m.reportError(context.Background(), "mirror", m.sessionError("mirror", write.name, errMirrorFull))
+	}
+}
+
+// closeMirror stops the replication once the queued writes are replicated.
+func (m *MongoDBStore) closeMirror(ctx context.Context) error {
+	mr := m.mirror
+	if mr == nil {
+		return nil
+	}
+	mr.mu.Lock()
+	if !mr.closed {
+		mr.closed = true
+		close(mr.queue)
+	}
+	mr.mu.Unlock()
+
+	select {
+	case <-mr.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (mr *mirror) run(m *MongoDBStore) {
+	defer close(mr.stopped)
+
+	for write := range mr.queue {
+		mr.mu.Lock()
+		if atomic.LoadInt32(&mr.promoted) == 1 {
+			mr.mu.Unlock()
+			continue
+		}
+		mr.pending = mr.pending[1:]
+		mr.inFlight = write.queued
+		mr.mu.Unlock()
+
+		err := mr.replicate(write)
+		if m.Metrics != nil {
+			m.Metrics.Timing("mongodbstore.mirror.lag", time.Since(write.queued))
+		}
+		if err != nil {
+			m.reportError(context.Background(), "mirror", m.sessionError("mirror", write.name, err))
+		}
+
+		mr.mu.Lock()
+		mr.inFlight = time.Time{}
+		mr.mu.Unlock()
+	}
+}
+
+// replicate saves the write to the standby store. The response written by
+// the standby, such as its cookie, is discarded.
+func (mr *mirror) replicate(write mirrorWrite) error {
+	r, err := http.NewRequest("POST", "/", nil)
+	if err != nil {
+		return err
+	}
+	session := sessions.NewSession(mr.store, write.name)
+	session.ID = write.id
+	session.Options = &write.options
+	if write.values != nil {
+		session.Values = write.values
+	}
+	return mr.store.Save(r, discardResponse{}, session)
+}
+
+// discardResponse is a http.ResponseWriter discarding everything written.
+type discardResponse struct{}
+
+func (discardResponse) Header() http.Header         { return http.Header{} }
+func (discardResponse) Write(b []byte) (int, error) { return len(b), nil }
+func (discardResponse) WriteHeader(int)             {}
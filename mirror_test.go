@@ -0,0 +1,180 @@
+package mongodbstore
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// recordingStore is a sessions.Store remembering the sessions saved to it.
+type recordingStore struct {
+	mu    sync.Mutex
+	saved map[string]map[interface{}]interface{}
+}
+
+func (s *recordingStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+func (s *recordingStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	session.IsNew = true
+	return session, nil
+}
+
+func (s *recordingStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if session.Options.MaxAge < 0 {
+		delete(s.saved, session.ID)
+	} else {
+		s.saved[session.ID] = session.Values
+	}
+	return nil
+}
+
+func TestMirror(t *testing.T) {
+	store := newOfflineStore(t)
+	standby := &recordingStore{saved: make(map[string]map[interface{}]interface{})}
+	if err := store.EnableMirror(standby, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	session := sessions.NewSession(store, "session-key")
+	session.ID = "5cc8b3a2a4d5b6c7d8e9f0a1"
+	session.Values["foo"] = "bar"
+	store.mirrorSave(session)
+
+	deleted := sessions.NewSession(store, "session-key")
+	deleted.ID = "5cc8b3a2a4d5b6c7d8e9f0a2"
+	store.mirrorSave(deleted)
+	deleted.Options.MaxAge = -1
+	store.mirrorSave(deleted)
+
+	if err := store.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if v := standby.saved[session.ID]; v == nil || v["foo"] != "bar" {
+		t.Errorf("Expected the session to be replicated; Got %v", standby.saved)
+	}
+	if _, ok := standby.saved[deleted.ID]; ok {
+		t.Error("Expected the deletion to be replicated")
+	}
+	if lag := store.MirrorLag(); lag != 0 {
+		t.Errorf("Expected no lag once closed; Got %v", lag)
+	}
+}
+
+func TestPromoteMirror(t *testing.T) {
+	store := newOfflineStore(t)
+	standby := &recordingStore{saved: make(map[string]map[interface{}]interface{})}
+	if err := store.EnableMirror(standby, 10); err != nil {
+		t.Fatal(err)
+	}
+	store.PromoteMirror()
+
+	req := httptest.NewRequest("GET", "/", nil)
+	session, err := store.New(req, "session-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Store() != standby {
+		t.Fatal("Expected New to be served by the promoted mirror")
+	}
+	session.ID = "5cc8b3a2a4d5b6c7d8e9f0a1"
+	if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := standby.saved[session.ID]; !ok {
+		t.Error("Expected Save to be served by the promoted mirror")
+	}
+}
+
+// blockingStore is a sessions.Store whose saves wait for release.
+type blockingStore struct {
+	recordingStore
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	s.started <- struct{}{}
+	<-s.release
+	return s.recordingStore.Save(r, w, session)
+}
+
+func TestMirrorQueueSize(t *testing.T) {
+	store := newOfflineStore(t)
+	if err := store.EnableMirror(&recordingStore{}, 0); err == nil {
+		t.Error("Expected an empty queue to be rejected")
+	}
+	if store.mirror != nil {
+		t.Error("Expected no mirror to be enabled")
+	}
+}
+
+func TestMirrorLagAndPromotion(t *testing.T) {
+	store := newOfflineStore(t)
+	var reported []error
+	store.WithErrorHandler(func(ctx context.Context, op string, err error) {
+		if op == "mirror" {
+			reported = append(reported, err)
+		}
+	})
+	standby := &blockingStore{
+		recordingStore: recordingStore{saved: make(map[string]map[interface{}]interface{})},
+		started:        make(chan struct{}),
+		release:        make(chan struct{}),
+	}
+	if err := store.EnableMirror(standby, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"5cc8b3a2a4d5b6c7d8e9f0a1", "5cc8b3a2a4d5b6c7d8e9f0a2", "5cc8b3a2a4d5b6c7d8e9f0a3"} {
+		session := sessions.NewSession(store, "session-key")
+		session.ID = id
+		store.mirrorSave(session)
+	}
+	<-standby.started
+	time.Sleep(10 * time.Millisecond)
+	if lag := store.MirrorLag(); lag < 10*time.Millisecond {
+		t.Errorf("Expected the lag of the write in flight; Got %v", lag)
+	}
+
+	if dropped := store.PromoteMirror(); dropped != 2 {
+		t.Errorf("Expected the 2 queued writes to be dropped; Got %d", dropped)
+	}
+	if len(reported) != 1 {
+		t.Errorf("Expected the dropped writes to be reported; Got %v", reported)
+	}
+	close(standby.release)
+	if err := store.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(standby.saved) != 1 {
+		t.Errorf("Expected only the write in flight to be replicated; Got %v", standby.saved)
+	}
+	if lag := store.MirrorLag(); lag != 0 {
+		t.Errorf("Expected no lag once closed; Got %v", lag)
+	}
+}
+
+func TestMirrorLagQueued(t *testing.T) {
+	store := newOfflineStore(t)
+	mr := &mirror{queue: make(chan mirrorWrite, 10)}
+	store.mirror = mr
+
+	session := sessions.NewSession(store, "session-key")
+	session.ID = "5cc8b3a2a4d5b6c7d8e9f0a1"
+	store.mirrorSave(session)
+	time.Sleep(10 * time.Millisecond)
+	store.mirrorSave(session)
+	if lag := store.MirrorLag(); lag < 10*time.Millisecond {
+		t.Errorf("Expected the lag of the oldest queued write; Got %v", lag)
+	}
+}
@@ -9,7 +9,9 @@ package mongodbstore
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gorilla/securecookie"
@@ -19,55 +21,437 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/x/bsonx"
+	"golang.org/x/sync/singleflight"
 )
 
 // Error definitions
 var (
 	ErrInvalidID = errors.New("mongodbstore: invalid session id")
+
+	// ErrSessionExpired is returned by New and Get along with a new session
+	// when the stored session is older than MaxLifetime.
+	ErrSessionExpired = errors.New("mongodbstore: session exceeded its maximum lifetime")
+
+	errExpired = errors.New("mongodbstore: session expired")
 )
 
 // Session object store in MongoDB
 type Session struct {
-	ID       primitive.ObjectID `bson:"_id,omitempty"`
-	Data     string
-	Modified time.Time
+	ID              primitive.ObjectID `bson:"_id,omitempty"`
+	Data            string
+	Modified        time.Time
+	Created         time.Time     `bson:"created,omitempty"`
+	LastAccessed    time.Time     `bson:"lastAccessed,omitempty"`
+	Values          bson.M        `bson:"values,omitempty"`
+	ImpersonatedBy  *Impersonator `bson:"impersonatedBy,omitempty"`
+	Revoked         bool          `bson:"revoked,omitempty"`
+	Metadata        *Metadata     `bson:"meta,omitempty"`
+	Impersonating   []string      `bson:"impersonating,omitempty"`
+	Labels          []Label       `bson:"labels,omitempty"`
+	Principal       string        `bson:"principal,omitempty"`
+	IdleExpires     time.Time     `bson:"idleExpires,omitempty"`
+	Expires         time.Time     `bson:"expires,omitempty"`
+	Checksum        string        `bson:"checksum,omitempty"`
+	AbsoluteExpires time.Time     `bson:"absoluteExpires,omitempty"`
+	Tenant          string        `bson:"tenant,omitempty"`
+	Priority        Priority      `bson:"priority,omitempty"`
 }
 
 // MongoDBStore stores sessions in MongoDB
 type MongoDBStore struct {
+	// Codecs encode the session id in the cookie and, unless DataCodecs are
+	// set, the session data stored in MongoDB.
 	Codecs     []securecookie.Codec
 	Options    *sessions.Options
 	Token      TokenGetSetter
 	collection *mongo.Collection
+
+	// DataCodecs, when set, encode the session data stored in MongoDB, so
+	// that the cookie keys in Codecs and the data keys can be rotated
+	// independently. Data is decoded with DataCodecs first and then with
+	// Codecs, so data saved before DataCodecs were introduced stays readable
+	// and is re-encoded on its next save.
+	DataCodecs []securecookie.Codec
+
+	// NameCodecs, if set, encode the session id in the cookie and, unless
+	// DataCodecs are set, the stored data of sessions with the given names
+	// in place of Codecs. Sessions such as "auth" and "prefs" are then signed
+	// with different keys, and a leaked key only compromises the sessions of
+	// its name.
+	NameCodecs map[string][]securecookie.Codec
+
+	// TokenName, if set, maps session names to the names of their tokens,
+	// such as cookies or headers, e.g. "auth" to "sid", so that token names
+	// can be standardized and don't reveal the session names. Tokens are
+	// still bound to the session names by the codecs.
+	TokenName func(name string) string
+
+	// DecodeConcurrency is the number of codecs tried concurrently when
+	// decoding cookies and stored data. Values below 2 try the codecs one
+	// after another. Concurrent decoding cuts latency with large key rings.
+	DecodeConcurrency int
+
+	// ReadYourWrites, when positive, makes the first loads of a session within
+	// that duration after a save read from the primary, even if the
+	// collection prefers secondaries. The hint travels with the client as a
+	// short-lived token, so it works across redirects and app nodes.
+	ReadYourWrites time.Duration
+
+	// Lifetime, if set, returns the idle and absolute timeouts of a session,
+	// for example a short idle timeout for administrators. Zero durations
+	// mean no limit. The idle deadline is moved forward on every save, the
+	// absolute deadline can only move closer. Sessions past a deadline are
+	// not loaded and are removed by TTL indexes created with ensureTTL.
+	Lifetime func(session *sessions.Session) (idle, absolute time.Duration)
+
+	// StorageTTL, when positive, is how long session documents are kept
+	// after their last save, independently of the cookie MaxAge. It allows
+	// session cookies, with a maxAge of 0, whose documents still expire on
+	// the server. Documents past it are not loaded and are removed by the
+	// TTL index on expires created with ensureTTL.
+	StorageTTL time.Duration
+
+	// IdleTimeout, when positive, is the idle timeout of sessions the
+	// Lifetime policy gives none. Unlike StorageTTL it can be set per
+	// session through Lifetime.
+	IdleTimeout time.Duration
+
+	// Debug enables logging of every MongoDB operation to Logger, with the
+	// values in filters redacted.
+	Debug  bool
+	Logger Logger
+
+	// Metrics, if set, receives the duration of every MongoDB operation as
+	// "mongodbstore.operation" and failed operations as
+	// "mongodbstore.errors", tagged with the operation and collection.
+	Metrics MetricsSink
+
+	// ProfilerLabels attaches pprof labels naming the operation, collection
+	// and session to goroutines while they run MongoDB operations, so that
+	// CPU and goroutine profiles attribute that time to the store.
+	ProfilerLabels bool
+
+	// NegativeCacheTTL, when positive, enables an in-memory cache of cookies
+	// that failed to decode and of session ids without a document, for that
+	// long. Repeated junk cookies then skip decoding and MongoDB, and a
+	// cached session id gets a new session with a new id. The cache holds at
+	// most NegativeCacheSize entries, 10000 by default.
+	NegativeCacheTTL  time.Duration
+	NegativeCacheSize int
+
+	// WriteLimiter, if set, limits the rate of session writes per client.
+	// Save, SaveAll and Persist return ErrRateLimited for writes over the
+	// limit, or whose wait for a token outlasts the request context.
+	// Deletions are never limited.
+	WriteLimiter *RateLimiter
+
+	// CoalesceLoads makes concurrent loads of the same session, such as the
+	// parallel XHRs of a page, share a single MongoDB query per process.
+	CoalesceLoads bool
+
+	// CacheTTL, when positive, keeps session documents read from MongoDB in
+	// memory for that long, up to CacheSize documents (10000 by default).
+	// Saves and deletions through this store update the cache, but changes
+	// made by other processes are not seen until the entry expires, so keep
+	// the TTL short. Preload fills the cache ahead of requests.
+	CacheTTL  time.Duration
+	CacheSize int
+
+	// DestroyHooks are called by Destroy after a session was deleted, for
+	// example to audit logouts or to revoke tokens issued for the session.
+	DestroyHooks []func(r *http.Request, session *sessions.Session)
+
+	// MaxLifetime, when positive, is the maximum age of a session counted
+	// from its first save, regardless of its activity. Older sessions are
+	// replaced by new ones and New returns ErrSessionExpired; Middleware then
+	// clears their cookie. Sessions first saved before MaxLifetime was
+	// introduced have no creation time and are not limited.
+	MaxLifetime time.Duration
+
+	// AccessInterval, when positive, makes loads record the time a session
+	// was last accessed in its lastAccessed field, separately from modified,
+	// which only changes when the session is saved. The time is written in
+	// the background, or queued in write-behind mode, at most once per
+	// interval and session.
+	AccessInterval time.Duration
+
+	// TouchInterval, when positive, limits how often saving a session whose
+	// values did not change refreshes the stored document: such saves are
+	// skipped while the document was written less than TouchInterval ago.
+	// The cookie is still refreshed. Keep it well below the idle timeout of
+	// the Lifetime policy, which the skipped writes don't extend.
+	TouchInterval time.Duration
+
+	// SizeWarning, when positive, is the encoded session size in bytes above
+	// which saving a session calls OnLargeSession, for example to log the
+	// keys of sessions that collect runaway values.
+	SizeWarning    int
+	OnLargeSession func(session *sessions.Session, size int)
+
+	// ValuePolicy, when set, is checked before a session is encoded for
+	// saving.
+	ValuePolicy *ValuePolicy
+
+	// OAuthTokenCodecs, when set, encode the tokens stored with
+	// SetOAuthToken. Codecs with an encryption key keep the tokens encrypted
+	// even where the session data itself is only signed.
+	OAuthTokenCodecs []securecookie.Codec
+
+	// Collation, when set, is used by the queries matching sessions by label,
+	// principal or other string fields: FindByLabel, FindImpersonations and
+	// the DeleteWhere family. Lookups by id don't use it. Queries can only
+	// use indexes built with the same collation; the indexes created by
+	// NewMongoDBStore use the simple collation, so create matching ones.
+	Collation *options.Collation
+
+	// Compatibility avoids the features that MongoDB-compatible services
+	// lack. DetectFeatures finds them by probing the server.
+	Compatibility Compatibility
+
+	// TombstoneTTL, when positive, makes deleting a session, through Save
+	// with MaxAge < 0, SaveAll, Destroy or the DeleteWhere family, replace
+	// its document by a tombstone kept for that long instead of removing it.
+	// Saving the session while its tombstone exists fails with
+	// ErrSessionRevoked rather than bringing it back. Tombstones are removed
+	// by the TTL index on idleExpires, which NewMongoDBStore creates with
+	// ensureTTL.
+	TombstoneTTL time.Duration
+
+	// PrincipalKey, when set, makes session documents store an HMAC-SHA256
+	// of the principal keyed with it instead of the principal itself, so the
+	// collection does not reveal user identifiers. DeleteByPrincipal and
+	// FindImpersonations hash their argument the same way. Changing the key
+	// detaches the stored sessions from their principals until saved again.
+	PrincipalKey []byte
+
+	// CaptureMetadata makes new sessions record the user agent and, as the
+	// IPPolicy allows, the IP address of the request that created them, in
+	// the meta field of the document. IPHashKey keys the IPHashed policy;
+	// without a key hashed IPv4 addresses are easy to reverse.
+	CaptureMetadata bool
+	IPPolicy        IPPolicy
+	IPHashKey       []byte
+
+	// Enricher, if set, enriches the metadata captured for new sessions when
+	// they are first saved. It defaults to NopEnricher.
+	Enricher Enricher
+
+	// CSRFKey keys the double-submit tokens of SetCSRFCookie and VerifyCSRF,
+	// which are bound to the session IDs.
+	CSRFKey []byte
+
+	// Anomalies, if set, checks the address of every request loading a
+	// session against the addresses and locations the session was used from
+	// and reports suspicious activity to its OnAnomaly hook.
+	Anomalies *AnomalyDetector
+
+	// PersistPolicy, if set, decides per request whether sessions are stored
+	// in MongoDB or kept in the cookie only.
+	PersistPolicy PersistPolicy
+
+	// Legacy, if set, is the store sessions are migrated from. When a request
+	// has no session stored in MongoDB, the session of the same name in the
+	// Legacy store, if any, is returned as a new session holding its values.
+	// Saving it stores it in MongoDB and deletes it from the Legacy store,
+	// so stores can be switched without logging users out. SetMigrationMode
+	// adds a dual-write phase and a rollback switch.
+	Legacy sessions.Store
+
+	// Quarantine, if set, is the collection documents that failed to decode
+	// QuarantineAfter times in a row (3 by default) are moved to, with the
+	// session name, the error and the time, so that operators can tell a bad
+	// deploy or a lost key from corrupted data. Failures are counted per
+	// process.
+	Quarantine      *mongo.Collection
+	QuarantineAfter int
+
+	// Tenant, if set, turns on multi-tenant mode: sessions belong to the
+	// tenant of the request that created them, which is stored in their
+	// document, and requests of other tenants can't load them. Admin
+	// operations are only available through ForTenant. TenantKeys,
+	// if set, encode the session data of each tenant with its own keys
+	// instead of DataCodecs and Codecs; cookies, which only hold the session
+	// id, are still encoded with Codecs.
+	Tenant     TenantFunc
+	TenantKeys TenantKeyProvider
+
+	// TenantQuotas, if set, returns the limits of each tenant in multi-tenant
+	// mode, enforced by Save and SaveAll with a *QuotaError. The usage of a
+	// tenant is counted in MongoDB at most every QuotaInterval, a minute by
+	// default, so limits are approximate when several processes create
+	// sessions of the tenant in between.
+	TenantQuotas  func(tenant string) TenantQuota
+	QuotaInterval time.Duration
+
+	// CarryOver lists the session values, such as form drafts or a cart,
+	// that survive the expiry or destruction of their session: they are
+	// copied into the new session returned in place of an expired one, and
+	// into a new session saved by Destroy.
+	CarryOver []string
+
+	// ExpiryGrace, when positive, keeps loading sessions that expired less
+	// than ExpiryGrace ago, by their idle, absolute or storage deadline or
+	// MaxLifetime, as stale sessions: IsStale reports them and Save refuses
+	// them with ErrSessionStale until Revive. The documents must still
+	// exist: the TTL indexes remove them within about a minute of their
+	// deadline, which bounds the useful grace window.
+	ExpiryGrace time.Duration
+
+	// Snapshots, if set, is the collection Snapshot stores copies of
+	// sessions in, for SnapshotTTL, a day by default. EnsureIndexes creates
+	// its TTL index.
+	Snapshots   *mongo.Collection
+	SnapshotTTL time.Duration
+
+	// NonceTTL is how long nonces of MintNonce stay valid, 10 minutes by
+	// default, and MaxNonces the number of unconsumed nonces kept per
+	// session, 16 by default.
+	NonceTTL  time.Duration
+	MaxNonces int
+
+	// LoginThrottle, if set, enables the brute-force protection of
+	// RecordFailedLogin and IsLockedOut.
+	LoginThrottle *LoginThrottle
+
+	// ShutdownTimeout bounds the shutdown of the background components by
+	// Run, 30 seconds by default.
+	ShutdownTimeout time.Duration
+
+	// ResumeTokens, if set, persists the position of WatchSessions.
+	ResumeTokens ResumeTokenStore
+
+	counters    counters
+	negative    negativeCache
+	cache       docCache
+	errHandler  errorHandler
+	writeBehind *writeBehind
+	mirror      *mirror
+	publishers  []*publisher
+	janitor     *janitor
+	background  background
+	tokenPrefix string
+	// migrationMode is the MigrationMode, accessed atomically.
+	migrationMode int32
+
+	// indexMaxAge is the maxAge of NewMongoDBStore, the TTL of the index on
+	// modified.
+	indexMaxAge int
+
+	detected         detectedFeatures
+	quotaMu          sync.Mutex
+	usage            map[string]*tenantUsage
+	decodeFailuresMu sync.Mutex
+	decodeFailures   map[primitive.ObjectID]int
+	keyHints         keyHints
+	loads            singleflight.Group
+	primaryOnce      sync.Once
+	primary          *mongo.Collection
 }
 
 // NewMongoDBStore returns a new MongoDBStore.
-// Set ensureTTL to true let the database auto-remove expired object by maxAge.
+// Set ensureTTL to true let the database auto-remove expired object by maxAge
+// and to create the indexes used to query sessions. With a maxAge of 0, for
+// session cookies, documents are only removed after StorageTTL.
 func NewMongoDBStore(c *mongo.Collection, maxAge int, ensureTTL bool, keyPairs ...[]byte) *MongoDBStore {
 	store := &MongoDBStore{
-		Codecs: securecookie.CodecsFromPairs(keyPairs...),
+		Codecs: NewCodecs(CodecOptions{}, keyPairs...),
 		Options: &sessions.Options{
 			Path:   "/",
 			MaxAge: maxAge,
 		},
-		Token:      &CookieToken{},
-		collection: c,
+		Token:       &CookieToken{},
+		collection:  c,
+		indexMaxAge: maxAge,
 	}
 
 	store.MaxAge(maxAge)
 
 	if ensureTTL {
-		_, _ = c.Indexes().CreateOne(context.Background(), mongo.IndexModel{
-			Keys: bsonx.Doc{{Key: "modified", Value: bsonx.Int32(1)}}, // value is the type 1 (asc) or -1 (desc)
+		for _, index := range indexes(maxAge) {
+			if _, err := c.Indexes().CreateOne(context.Background(), index); err != nil {
+				store.reportError(context.Background(), "create index", err)
+			}
+		}
+	}
+
+	return store
+}
+
+// indexes returns the indexes created by NewMongoDBStore with ensureTTL.
+func indexes(maxAge int) []mongo.IndexModel {
+	modified := &options.IndexOptions{
+		Background: newBool(true),
+		Sparse:     newBool(true),
+	}
+	if maxAge > 0 {
+		// A TTL of 0 would remove the documents of session cookies as soon
+		// as they are saved.
+		modified.ExpireAfterSeconds = newInt32(int32(maxAge))
+	}
+	return []mongo.IndexModel{
+		{
+			Keys:    bsonx.Doc{{Key: "modified", Value: bsonx.Int32(1)}}, // value is the type 1 (asc) or -1 (desc)
+			Options: modified,
+		},
+		{
+			Keys: bsonx.Doc{{Key: "expires", Value: bsonx.Int32(1)}},
 			Options: &options.IndexOptions{
 				Background:         newBool(true),
 				Sparse:             newBool(true),
-				ExpireAfterSeconds: newInt32(int32(maxAge)),
+				ExpireAfterSeconds: newInt32(0),
 			},
-		})
+		},
+		{
+			Keys: bsonx.Doc{{Key: "idleExpires", Value: bsonx.Int32(1)}},
+			Options: &options.IndexOptions{
+				Background:         newBool(true),
+				Sparse:             newBool(true),
+				ExpireAfterSeconds: newInt32(0),
+			},
+		},
+		{
+			Keys: bsonx.Doc{{Key: "absoluteExpires", Value: bsonx.Int32(1)}},
+			Options: &options.IndexOptions{
+				Background:         newBool(true),
+				Sparse:             newBool(true),
+				ExpireAfterSeconds: newInt32(0),
+			},
+		},
+		{
+			Keys: bsonx.Doc{{Key: "labels.k", Value: bsonx.Int32(1)}, {Key: "labels.v", Value: bsonx.Int32(1)}},
+			Options: &options.IndexOptions{
+				Background: newBool(true),
+				Sparse:     newBool(true),
+			},
+		},
+		{
+			Keys: bsonx.Doc{{Key: "principal", Value: bsonx.Int32(1)}},
+			Options: &options.IndexOptions{
+				Background: newBool(true),
+				Sparse:     newBool(true),
+			},
+		},
+		{
+			Keys: bsonx.Doc{{Key: "impersonatedBy.principal", Value: bsonx.Int32(1)}},
+			Options: &options.IndexOptions{
+				Background: newBool(true),
+				Sparse:     newBool(true),
+			},
+		},
+		{
+			Keys: bsonx.Doc{{Key: "priority", Value: bsonx.Int32(1)}, {Key: "modified", Value: bsonx.Int32(1)}},
+			Options: &options.IndexOptions{
+				Background: newBool(true),
+			},
+		},
+		{
+			Keys: bsonx.Doc{{Key: "tenant", Value: bsonx.Int32(1)}},
+			Options: &options.IndexOptions{
+				Background: newBool(true),
+				Sparse:     newBool(true),
+			},
+		},
 	}
-
-	return store
 }
 
 // Get registers and returns a session for the given name and session store.
@@ -77,135 +461,573 @@ func (m *MongoDBStore) Get(r *http.Request, name string) (*sessions.Session, err
 }
 
 // New returns a session for the given name without adding it to the registry.
+// The session is tracked for SaveAll only if the request already carries
+// gorilla context, such as the registry of Get, so New alone leaves nothing
+// to clear behind.
 func (m *MongoDBStore) New(r *http.Request, name string) (*sessions.Session, error) {
-	session := sessions.NewSession(m, name)
-	session.Options = &sessions.Options{
-		Path:     m.Options.Path,
-		MaxAge:   m.Options.MaxAge,
-		Domain:   m.Options.Domain,
-		Secure:   m.Options.Secure,
-		HttpOnly: m.Options.HttpOnly,
+	if delegate := m.delegateStore(); delegate != nil {
+		return delegate.New(r, name)
 	}
-	session.IsNew = true
+	session := m.requestSession(r, name)
 	var err error
-	if cook, errToken := m.Token.GetToken(r, name); errToken == nil {
-		err = securecookie.DecodeMulti(name, cook, &session.ID, m.Codecs...)
-		if err == nil {
-			err = m.load(session)
-			if err == nil {
+	var doc *Session
+	if cook, errToken := m.Token.GetToken(r, m.tokenName(name)); errToken == nil {
+		if m.decodeCookieOnly(session, cook) {
+			// The session was never stored, so it stays new.
+			m.track(r, session, nil)
+			return session, nil
+		}
+		if cached, ok := m.negativeLookup("token:" + cook); ok {
+			err = cached
+		} else if session.ID, err = m.parseToken(name, cook); err != nil {
+			if len(cook) <= MaxTokenLength {
+				m.negativeStore("token:"+cook, err)
+			}
+		} else if _, ok := m.negativeLookup("id:" + session.ID); ok {
+			// Another node may have written the session since, so the new
+			// session gets a new id instead of overwriting it.
+			session.ID = ""
+		} else {
+			doc, err = m.load(context.Background(), session, m.recentlyWritten(r, session))
+			switch err {
+			case nil:
 				session.IsNew = false
-			} else {
+				m.detectAnomalies(r, session)
+			case ErrSessionExpired:
+				m.negativeStore("id:"+session.ID, nil)
+				session.ID = ""
+				m.track(r, session, nil)
+				return session, m.sessionError("load", name, err)
+			case errOtherTenant:
+				// The session exists for its own tenant, so the id is
+				// neither cached as missing nor reused.
+				session.ID = ""
+				err = nil
+			case ErrSessionRevoked:
+				// A new session must not reuse the id of the tombstone.
+				m.negativeStore("id:"+session.ID, nil)
+				session.ID = ""
+				err = nil
+			case errExpired:
+				// Like a revoked session, an expired one keeps its document
+				// until the TTL index removes it, so its id is not reused.
+				m.negativeStore("id:"+session.ID, nil)
+				session.ID = ""
+				err = nil
+			case mongo.ErrNoDocuments:
+				m.negativeStore("id:"+session.ID, nil)
+				err = nil
+			default:
+				err = m.sessionError("load", name, err)
+				session.Values[loadErrorKey] = err
+				m.reportError(r.Context(), "load", err)
 				err = nil
 			}
 		}
 	}
-	return session, err
+	if session.IsNew && session.Values[loadErrorKey] == nil && m.readLegacy(r, session) {
+		// The cookie may belong to the legacy store.
+		err = nil
+	}
+	m.track(r, session, doc)
+	return session, m.sessionError("decode cookie of", name, err)
 }
 
 // Save saves all sessions registered for the current request.
 func (m *MongoDBStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if delegate := m.delegateStore(); delegate != nil {
+		return delegate.Save(r, w, session)
+	}
+	defer lockValues(r, session)()
+	return m.save(r, w, session)
+}
+
+// save saves the session, with its SafeValues guard held if it has one.
+func (m *MongoDBStore) save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
 	if session.Options.MaxAge < 0 {
-		if err := m.delete(session); err != nil {
-			return err
+		// Sessions kept in the cookie only have no document to delete.
+		if session.ID != "" {
+			if err := m.delete(session); err != nil {
+				return m.sessionError("delete", session.Name(), err)
+			}
+			m.stored(r, session, nil)
+			m.notify(Event{Type: EventDestroyed, Name: session.Name(), ID: session.ID, Principal: GetPrincipal(session)})
+		}
+		m.mirrorSave(session)
+		m.writeLegacy(r, w, session)
+		if sessionCookieMode(session) != modeSkipCookie {
+			m.setToken(w, session, "")
 		}
-		m.Token.SetToken(w, session.Name(), "", session.Options)
 		return nil
 	}
 
-	if session.ID == "" {
-		session.ID = primitive.NewObjectID().Hex()
+	if IsStale(session) {
+		return m.sessionError("save", session.Name(), ErrSessionStale)
 	}
 
-	if err := m.upsert(session); err != nil {
-		return err
+	if !m.persist(r, session) {
+		return m.saveCookieOnly(w, session)
 	}
 
-	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, m.Codecs...)
-	if err != nil {
-		return err
+	if sessionCookieMode(session) == modeCookieOnly {
+		if session.ID == "" {
+			return m.sessionError("save", session.Name(), ErrInvalidID)
+		}
+		return m.setCookie(w, session)
+	}
+
+	if !m.allowWrite(r.Context(), r, session) {
+		return m.sessionError("save", session.Name(), ErrRateLimited)
+	}
+
+	if err := m.checkQuota(r.Context(), session); err != nil {
+		return m.sessionError("save", session.Name(), err)
+	}
+
+	if session.ID == "" {
+		session.ID = primitive.NewObjectID().Hex()
 	}
+	m.enrich(r, session)
 
-	m.Token.SetToken(w, session.Name(), encoded, session.Options)
-	return nil
+	if !m.skipTouch(r, session) && !m.deferTouch(r, session) {
+		s, err := m.upsert(session)
+		if err != nil {
+			return m.sessionError("save", session.Name(), err)
+		}
+		m.stored(r, session, s)
+		m.markRecentWrite(w, session)
+		m.mirrorSave(session)
+	}
+	m.writeLegacy(r, w, session)
+	return m.setCookie(w, session)
 }
 
 // MaxAge sets the maximum age for the store and the underlying cookie
 // implementation. Individual sessions can be deleted by setting Options.MaxAge
-// = -1 for that session.
+// = -1 for that session. It is the same as CookieMaxAge.
 func (m *MongoDBStore) MaxAge(age int) {
+	m.CookieMaxAge(age)
+}
+
+// CookieMaxAge sets the lifetime of new session cookies and the validity
+// window of cookies encoded by the Codecs, in seconds. It doesn't change how
+// long documents are kept, which is set by the maxAge of NewMongoDBStore and
+// StorageTTL, nor when idle sessions expire, which is set by IdleTimeout and
+// Lifetime.
+func (m *MongoDBStore) CookieMaxAge(age int) {
 	m.Options.MaxAge = age
 
 	// Set the maxAge for each securecookie instance.
-	for _, codec := range m.Codecs {
-		if sc, ok := codec.(*securecookie.SecureCookie); ok {
-			sc.MaxAge(age)
+	setMaxAge := func(codecs []securecookie.Codec) {
+		for _, codec := range codecs {
+			if sc, ok := codec.(*securecookie.SecureCookie); ok {
+				sc.MaxAge(age)
+			}
 		}
 	}
+	setMaxAge(m.Codecs)
+	for _, codecs := range m.NameCodecs {
+		setMaxAge(codecs)
+	}
+}
+
+// Collection returns the collection the sessions are stored in.
+func (m *MongoDBStore) Collection() *mongo.Collection {
+	return m.collection
+}
+
+// CookieCodecs returns the codecs encoding the cookies of sessions with the
+// name: its NameCodecs if any, the Codecs otherwise.
+func (m *MongoDBStore) CookieCodecs(name string) []securecookie.Codec {
+	if codecs, ok := m.NameCodecs[name]; ok {
+		return codecs
+	}
+	return m.Codecs
+}
+
+// dataEncoders returns the codecs encoding the stored data of sessions with
+// the name.
+func (m *MongoDBStore) dataEncoders(name string) []securecookie.Codec {
+	if len(m.DataCodecs) > 0 {
+		return m.DataCodecs
+	}
+	return m.CookieCodecs(name)
+}
+
+// dataDecoders returns the codecs tried when decoding stored data of sessions
+// with the name. Their MaxAge is not checked: how long data stays valid is
+// decided by the expiry of its document, not by the age of cookies.
+func (m *MongoDBStore) dataDecoders(name string) []securecookie.Codec {
+	cookie := m.CookieCodecs(name)
+	codecs := make([]securecookie.Codec, 0, len(m.DataCodecs)+len(cookie))
+	return withoutMaxAge(append(append(codecs, m.DataCodecs...), cookie...))
+}
+
+// newSession returns a new session with the default options of the store.
+func (m *MongoDBStore) newSession(name string) *sessions.Session {
+	session := sessions.NewSession(m, name)
+	opts := *m.Options
+	session.Options = &opts
+	session.IsNew = true
+	return session
+}
+
+// requestSession returns a new session for the request, with the tenant and
+// the metadata of the request and the number of chunks of its token.
+func (m *MongoDBStore) requestSession(r *http.Request, name string) *sessions.Session {
+	session := m.newSession(name)
+	if m.Tenant != nil {
+		session.Values[tenantKey] = m.Tenant(r)
+	}
+	if c, ok := m.Token.(*CookieToken); ok && c.MaxSize > 0 {
+		session.Values[tokenChunksKey] = c.chunks(r, m.tokenName(name))
+	}
+	if m.CaptureMetadata {
+		session.Values[metadataKey] = m.metadata(r)
+	}
+	return session
 }
 
-func (m *MongoDBStore) load(session *sessions.Session) error {
+// load fetches the session document and decodes its values into the session.
+// It returns the document the values were decoded from. If primary is true
+// the document is read from the primary.
+func (m *MongoDBStore) load(ctx context.Context, session *sessions.Session, primary bool) (*Session, error) {
 	sessionID, err := primitive.ObjectIDFromHex(session.ID)
 	if err != nil {
-		return ErrInvalidID
+		return nil, ErrInvalidID
+	}
+
+	s, err := m.fetch(m.profilerContext(ctx, session.Name()), sessionID, primary)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.Tenant != nil && s.Tenant != SessionTenant(session) {
+		return nil, errOtherTenant
+	}
+	now := time.Now()
+	if s.Revoked {
+		return nil, ErrSessionRevoked
+	}
+	stale := false
+	if s.expired(now) {
+		if !m.withinGrace(s, now) {
+			m.carryOverExpired(session, s)
+			return nil, errExpired
+		}
+		stale = true
+	}
+	if m.MaxLifetime > 0 && !s.Created.IsZero() && now.Sub(s.Created) >= m.MaxLifetime {
+		if !m.withinGrace(s, now) {
+			m.carryOverExpired(session, s)
+			return nil, ErrSessionExpired
+		}
+		stale = true
+	}
+
+	if s.corrupted() {
+		m.counters.add(&m.counters.corrupted, 1)
+		if m.Metrics != nil {
+			m.Metrics.Count("mongodbstore.corrupted", 1)
+		}
+		m.decodeFailed(s.ID, session.Name(), ErrCorruptedSession)
+		return nil, ErrCorruptedSession
+	}
+	decoders, err := m.sessionDecoders(session)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.decodeMulti(session.Name(), s.Data, &session.Values, session.ID, decoders...); err != nil {
+		m.decodeFailed(s.ID, session.Name(), err)
+		return nil, err
+	}
+	m.decodeSucceeded(s.ID)
+	if stale {
+		session.Values[staleKey] = m.expiry(s)
+	}
+	pruneExpired(session.Values, now)
+	if len(s.Values) > 0 {
+		values := make(bson.M, len(s.Values))
+		for k, v := range s.Values {
+			values[k] = v
+		}
+		session.Values[atomicValuesKey] = values
+	}
+	m.recordAccess(s, session.Name(), now)
+
+	return s, nil
+}
+
+// fetch reads the session document with the id. With CoalesceLoads,
+// concurrent fetches of the same document share a single query.
+func (m *MongoDBStore) fetch(ctx context.Context, id primitive.ObjectID, primary bool) (*Session, error) {
+	if !primary {
+		if doc, ok := m.cached(id); ok {
+			return doc, nil
+		}
+	}
+
+	if !m.CoalesceLoads {
+		return m.find(ctx, id, primary)
 	}
 
-	s := Session{}
-	err = m.collection.FindOne(context.Background(), bson.D{{Key: "_id", Value: sessionID}}).Decode(&s)
+	key := id.Hex()
+	if primary {
+		key += "/primary"
+	}
+	v, err, _ := m.loads.Do(key, func() (interface{}, error) {
+		return m.find(ctx, id, primary)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*Session), nil
+}
+
+// find queries the session document with the id.
+func (m *MongoDBStore) find(ctx context.Context, id primitive.ObjectID, primary bool) (*Session, error) {
+	coll := m.collection
+	if primary {
+		coll = m.primaryCollection()
+	}
+
+	m.counters.add(&m.counters.loads, 1)
+	s := &Session{}
+	filter := bson.D{{Key: "_id", Value: id}}
+	err := m.observe(ctx, "findOne", filter, func(ctx context.Context) (string, error) {
+		err := coll.FindOne(ctx, filter, options.FindOne().SetProjection(loadProjection())).Decode(s)
+		if err == mongo.ErrNoDocuments {
+			return "not found", err
+		}
+		return "found", err
+	})
+	if err != nil {
+		return nil, err
+	}
+	m.cacheDoc(s)
+	return s, nil
+}
+
+// upsert writes the document of the session and returns it.
+func (m *MongoDBStore) upsert(session *sessions.Session) (*Session, error) {
+	s, err := m.document(session)
+	if err != nil {
+		return nil, err
+	}
+
+	m.counters.add(&m.counters.saves, 1)
+	ctx := m.profilerContext(context.Background(), session.Name())
+	if session.IsNew {
+		err = m.insert(ctx, s)
+		if err == nil {
+			m.quotaCreated(s)
+			m.notify(Event{Type: EventCreated, Name: session.Name(), ID: session.ID, Principal: GetPrincipal(session)})
+		}
+		if isDuplicateKey(err) {
+			// A concurrent save of the same new session, or an earlier save
+			// during this request, inserted the document first.
+			_, err = m.update(ctx, s, true)
+		}
+	} else {
+		var matched bool
+		matched, err = m.update(ctx, s, false)
+		if err == nil && !matched {
+			// The session was deleted since it was loaded, most likely by
+			// the TTL index. It is written again with its current values.
+			m.counters.add(&m.counters.resurrections, 1)
+			_, err = m.update(ctx, s, true)
+		}
+	}
 	if err != nil {
-		return err
+		return nil, m.revokedError(err)
 	}
 
-	if err := securecookie.DecodeMulti(session.Name(), s.Data, &session.Values, m.Codecs...); err != nil {
-		return err
+	m.negativeRemove(session.ID)
+	m.uncache(s.ID)
+	return s, nil
+}
+
+// insert writes the document of a new session.
+func (m *MongoDBStore) insert(ctx context.Context, s *Session) error {
+	filter := bson.D{{Key: "_id", Value: s.ID}}
+	err := m.observe(ctx, "insertOne", filter, func(ctx context.Context) (string, error) {
+		_, err := m.collection.InsertOne(ctx, s)
+		return "", err
+	})
+	if err == nil {
+		m.counters.add(&m.counters.creates, 1)
 	}
+	return err
+}
 
-	return nil
+// update writes the document of an existing session and reports whether it
+// was found. With upsert a missing document is inserted; a duplicate key
+// error from racing with a concurrent upsert is retried once.
+func (m *MongoDBStore) update(ctx context.Context, s *Session, upsert bool) (bool, error) {
+	filter := m.liveFilter(s.ID)
+	var matched bool
+	write := func(ctx context.Context) (string, error) {
+		res, err := m.collection.UpdateOne(ctx, filter, s.update(), options.Update().SetUpsert(upsert))
+		if err != nil {
+			return "", err
+		}
+		matched = res.MatchedCount > 0 || res.UpsertedID != nil
+		return fmt.Sprintf("matched=%d modified=%d upserted=%t", res.MatchedCount, res.ModifiedCount,
+			res.UpsertedID != nil), nil
+	}
+	err := m.observe(ctx, "updateOne", filter, write)
+	if upsert && isDuplicateKey(err) {
+		err = m.observe(ctx, "updateOne", filter, write)
+	}
+	return matched, err
 }
 
-func (m *MongoDBStore) upsert(session *sessions.Session) error {
+// document encodes the session into the document stored in MongoDB.
+func (m *MongoDBStore) document(session *sessions.Session) (*Session, error) {
 	sessionID, err := primitive.ObjectIDFromHex(session.ID)
 	if err != nil {
-		return ErrInvalidID
+		return nil, ErrInvalidID
 	}
 
+	// The values are read once, so that the stored data, tenant and metadata
+	// all come from the same state of the session.
+	values, transient := splitValues(session)
+	tenant, _ := transient[tenantKey].(string)
+	now := time.Now()
+	pruneExpired(values, now)
 	var modified time.Time
-	if val, ok := session.Values["modified"]; ok {
+	if val, ok := values["modified"]; ok {
 		modified, ok = val.(time.Time)
 		if !ok {
-			return errors.New("mongodbstore: invalid modified value")
+			return nil, errors.New("mongodbstore: invalid modified value")
 		}
 	} else {
-		modified = time.Now()
+		modified = now
 	}
+	idle, absolute := m.deadlines(session, now)
 
-	encoded, err := securecookie.EncodeMulti(session.Name(), session.Values, m.Codecs...)
-	if err != nil {
-		return err
+	if m.ValuePolicy != nil {
+		if err := m.ValuePolicy.check(values); err != nil {
+			return nil, err
+		}
 	}
 
-	s := Session{
-		ID:       sessionID,
-		Data:     encoded,
-		Modified: modified,
+	encoders, err := m.tenantEncoders(tenant, session.Name())
+	if err != nil {
+		return nil, err
 	}
-
-	_, err = m.collection.ReplaceOne(context.Background(), bson.D{{Key: "_id", Value: s.ID}}, &s,
-		&options.ReplaceOptions{Upsert: newBool(true)})
+	encoded, err := securecookie.EncodeMulti(session.Name(), values, encoders...)
 	if err != nil {
-		return err
+		return nil, encodeError(values, err)
 	}
+	m.recordSize(session, len(encoded))
 
-	return nil
+	return &Session{
+		ID:              sessionID,
+		Data:            encoded,
+		Checksum:        checksum(encoded),
+		Modified:        modified,
+		Created:         now,
+		Labels:          storedLabels(values),
+		Principal:       m.principalID(storedPrincipal(values)),
+		ImpersonatedBy:  m.storedImpersonator(values),
+		Metadata:        storedMetadata(session.IsNew, transient),
+		IdleExpires:     idle,
+		Expires:         m.storageExpires(now),
+		AbsoluteExpires: absolute,
+		Tenant:          tenant,
+		Priority:        storedPriority(values),
+	}, nil
+}
+
+// update returns the update writing the document. Fields maintained outside
+// of the session values are left untouched, and the absolute deadline of an
+// existing session can only move closer.
+func (s *Session) update() bson.D {
+	set := bson.D{
+		{Key: "data", Value: s.Data},
+		{Key: "checksum", Value: s.Checksum},
+		{Key: "modified", Value: s.Modified},
+	}
+	var unset bson.D
+	optional := func(key string, value interface{}, empty bool) {
+		if empty {
+			unset = append(unset, bson.E{Key: key, Value: ""})
+		} else {
+			set = append(set, bson.E{Key: key, Value: value})
+		}
+	}
+	optional("labels", s.Labels, len(s.Labels) == 0)
+	optional("principal", s.Principal, s.Principal == "")
+	optional("impersonatedBy", s.ImpersonatedBy, s.ImpersonatedBy == nil)
+	optional("idleExpires", s.IdleExpires, s.IdleExpires.IsZero())
+	optional("expires", s.Expires, s.Expires.IsZero())
+	optional("priority", s.Priority, s.Priority == 0)
+
+	onInsert := bson.D{{Key: "created", Value: s.Created}}
+	if s.Metadata != nil {
+		onInsert = append(onInsert, bson.E{Key: "meta", Value: s.Metadata})
+	}
+	if s.Tenant != "" {
+		onInsert = append(onInsert, bson.E{Key: "tenant", Value: s.Tenant})
+	}
+	update := bson.D{
+		{Key: "$set", Value: set},
+		{Key: "$setOnInsert", Value: onInsert},
+	}
+	if len(unset) > 0 {
+		update = append(update, bson.E{Key: "$unset", Value: unset})
+	}
+	if !s.AbsoluteExpires.IsZero() {
+		update = append(update, bson.E{Key: "$min", Value: bson.D{{Key: "absoluteExpires", Value: s.AbsoluteExpires}}})
+	}
+	return update
 }
 
 func (m *MongoDBStore) delete(session *sessions.Session) error {
+	return m.deleteContext(context.Background(), session)
+}
+
+// deleteContext deletes the document of the session, or replaces it by a
+// tombstone with TombstoneTTL.
+func (m *MongoDBStore) deleteContext(ctx context.Context, session *sessions.Session) error {
 	sessionID, err := primitive.ObjectIDFromHex(session.ID)
 	if err != nil {
 		return ErrInvalidID
 	}
 
-	_, err = m.collection.DeleteOne(context.Background(), bson.D{{Key: "_id", Value: sessionID}})
-	return err
+	m.counters.add(&m.counters.deletes, 1)
+	m.uncache(sessionID)
+	filter := bson.D{{Key: "_id", Value: sessionID}}
+	ctx = m.profilerContext(ctx, session.Name())
+	if m.TombstoneTTL > 0 {
+		return m.observe(ctx, "updateOne", filter, func(ctx context.Context) (string, error) {
+			res, err := m.collection.UpdateOne(ctx, filter, m.tombstoneUpdate(time.Now()), options.Update().SetUpsert(true))
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("matched=%d tombstone=true", res.MatchedCount), nil
+		})
+	}
+	return m.observe(ctx, "deleteOne", filter, func(ctx context.Context) (string, error) {
+		res, err := m.collection.DeleteOne(ctx, filter)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("deleted=%d", res.DeletedCount), nil
+	})
+}
+
+// loadFields are the document fields needed to load a session. Everything
+// else stored with the session is left on the server.
+var loadFields = []string{"data", "revoked", "values", "modified", "created", "lastAccessed", "idleExpires", "absoluteExpires", "expires", "checksum", "tenant"}
+
+func loadProjection() bson.D {
+	projection := make(bson.D, 0, len(loadFields))
+	for _, field := range loadFields {
+		projection = append(projection, bson.E{Key: field, Value: 1})
+	}
+	return projection
 }
 
 func newBool(val bool) *bool {
@@ -7,12 +7,18 @@
 package mongodbstore
 
 import (
+	"context"
 	"encoding/gob"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/gorilla/sessions"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -165,6 +171,110 @@ func TestMongoStore(t *testing.T) {
 	}
 }
 
+// liveServer records whether the MongoDB server of TestMongoStore answers,
+// probed once for all tests.
+var liveServer struct {
+	once sync.Once
+	err  error
+}
+
+// newLiveStore returns a store using a collection of its own, emptied, on the
+// MongoDB server of TestMongoStore. The test is skipped when no server
+// answers.
+func newLiveStore(t *testing.T) *MongoDBStore {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	connect := func() (*mongo.Client, error) {
+		return mongo.Connect(ctx, options.Client().ApplyURI("mongodb://localhost:27017").
+			SetServerSelectionTimeout(2*time.Second))
+	}
+	liveServer.once.Do(func() {
+		client, err := connect()
+		if err == nil {
+			err = client.Ping(ctx, nil)
+			client.Disconnect(context.Background())
+		}
+		liveServer.err = err
+	})
+	if liveServer.err != nil {
+		t.Skipf("No MongoDB server: %v", liveServer.err)
+	}
+
+	client, err := connect()
+	if err != nil {
+		t.Fatalf("Error connecting: %v", err)
+	}
+	t.Cleanup(func() { client.Disconnect(context.Background()) })
+
+	c := client.Database("test").Collection("test_" + strings.ToLower(t.Name()))
+	if err := c.Drop(ctx); err != nil {
+		t.Fatalf("Error dropping collection: %v", err)
+	}
+	return NewMongoDBStore(c, 3600, true, []byte("secret-key"))
+}
+
+// TestLoadProjection checks that loading keeps the fields a session is
+// decoded and validated with, and leaves the others on the server.
+func TestLoadProjection(t *testing.T) {
+	now := time.Now().Truncate(time.Millisecond).UTC()
+	doc, err := bson.Marshal(&Session{
+		ID:              primitive.NewObjectID(),
+		Data:            "data",
+		Modified:        now,
+		Created:         now,
+		LastAccessed:    now,
+		Values:          bson.M{"k": "v"},
+		Revoked:         true,
+		Metadata:        &Metadata{IP: "127.0.0.1"},
+		Impersonating:   []string{"other"},
+		Labels:          []Label{{Key: "k", Value: "v"}},
+		Principal:       "alice",
+		IdleExpires:     now,
+		Expires:         now,
+		Checksum:        "sum",
+		AbsoluteExpires: now,
+		Tenant:          "acme",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	elems, err := bson.Raw(doc).Elements()
+	if err != nil {
+		t.Fatal(err)
+	}
+	projected := map[string]bool{"_id": true}
+	for _, e := range loadProjection() {
+		projected[e.Key] = true
+	}
+	kept := bson.D{}
+	for _, e := range elems {
+		if projected[e.Key()] {
+			kept = append(kept, bson.E{Key: e.Key(), Value: e.Value()})
+			delete(projected, e.Key())
+		}
+	}
+	if len(projected) != 0 {
+		t.Errorf("Expected projected fields to exist; Got unknown %v", projected)
+	}
+
+	raw, err := bson.Marshal(kept)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s Session
+	if err := bson.Unmarshal(raw, &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Data != "data" || s.Values["k"] != "v" || !s.Revoked || s.Checksum != "sum" || s.Tenant != "acme" ||
+		!s.Modified.Equal(now) || !s.Created.Equal(now) || !s.LastAccessed.Equal(now) ||
+		!s.IdleExpires.Equal(now) || !s.Expires.Equal(now) || !s.AbsoluteExpires.Equal(now) {
+		t.Errorf("Expected the loaded fields to be kept; Got %+v", s)
+	}
+	if s.Metadata != nil || s.Impersonating != nil || s.Labels != nil || s.Principal != "" {
+		t.Errorf("Expected the other fields to be left out; Got %+v", s)
+	}
+}
+
 func init() {
 	gob.Register(FlashMessage{})
 }
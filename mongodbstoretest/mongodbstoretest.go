@@ -0,0 +1,70 @@
+// Package mongodbstoretest provides helpers for tests of applications using
+// mongodbstore, such as starting a test with a logged in user.
+package mongodbstoretest
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/ashulepov/mongodbstore"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+// DefaultName is the session name used when SeedOptions don't set one.
+const DefaultName = "session"
+
+// SeedOptions are the optional settings of a seeded session.
+type SeedOptions struct {
+	// Name is the session name, DefaultName if empty.
+	Name string
+	// Principal and Labels tag the session like SetPrincipal and SetLabel.
+	Principal string
+	Labels    map[string]string
+}
+
+// SeedSession stores a session holding the values in the store and returns
+// its id. The test fails if the session can't be stored.
+func SeedSession(ctx context.Context, t testing.TB, store *mongodbstore.MongoDBStore,
+	values map[interface{}]interface{}, opts *SeedOptions) string {
+	t.Helper()
+	if opts == nil {
+		opts = &SeedOptions{}
+	}
+
+	session := sessions.NewSession(store, sessionName(opts.Name))
+	options := *store.Options
+	session.Options = &options
+	for k, v := range values {
+		session.Values[k] = v
+	}
+	mongodbstore.SetPrincipal(session, opts.Principal)
+	for k, v := range opts.Labels {
+		mongodbstore.SetLabel(session, k, v)
+	}
+
+	if _, err := store.Persist(ctx, session); err != nil {
+		t.Fatalf("mongodbstoretest: seeding session: %v", err)
+	}
+	return session.ID
+}
+
+// CookieFor returns the Cookie header value making a request use the session
+// with the given name and id, such as one returned by SeedSession.
+func CookieFor(t testing.TB, store *mongodbstore.MongoDBStore, name, sessionID string) string {
+	t.Helper()
+	name = sessionName(name)
+	encoded, err := securecookie.EncodeMulti(name, sessionID, store.CookieCodecs(name)...)
+	if err != nil {
+		t.Fatalf("mongodbstoretest: encoding cookie: %v", err)
+	}
+	return (&http.Cookie{Name: name, Value: encoded}).String()
+}
+
+func sessionName(name string) string {
+	if name == "" {
+		return DefaultName
+	}
+	return name
+}
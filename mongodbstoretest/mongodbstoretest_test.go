@@ -0,0 +1,33 @@
+package mongodbstoretest
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ashulepov/mongodbstore"
+	"github.com/gorilla/securecookie"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestCookieFor(t *testing.T) {
+	client, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	if err != nil {
+		t.Fatalf("Error creating client: %v", err)
+	}
+	store := mongodbstore.NewMongoDBStore(client.Database("test").Collection("test_session"), 3600, false,
+		[]byte("secret-key"))
+
+	id := "5cc8b3a2a4d5b6c7d8e9f0a1"
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Cookie", CookieFor(t, store, "", id))
+
+	cookie, err := req.Cookie(DefaultName)
+	if err != nil {
+		t.Fatalf("Expected a cookie named %q: %v", DefaultName, err)
+	}
+	var got string
+	if err := securecookie.DecodeMulti(DefaultName, cookie.Value, &got, store.Codecs...); err != nil || got != id {
+		t.Errorf("Expected the cookie to hold %s; Got %q, %v", id, got, err)
+	}
+}
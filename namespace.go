@@ -0,0 +1,93 @@
+package mongodbstore
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/sessions"
+)
+
+// NamespaceSeparator separates the namespace from the key in the names of
+// namespaced session values.
+const NamespaceSeparator = "."
+
+// Namespaced is a view over the session values whose keys start with a
+// namespace prefix, so that several middlewares and libraries can share one
+// session without clobbering each other's keys. Access goes through the
+// SafeValues guard of the session.
+type Namespaced struct {
+	prefix string
+	values *Values
+}
+
+// Namespace returns a view over the session values in namespace name,
+// through the SafeValues guard of the session for the request.
+func Namespace(r *http.Request, session *sessions.Session, name string) *Namespaced {
+	return &Namespaced{
+		prefix: name + NamespaceSeparator,
+		values: SafeValues(r, session),
+	}
+}
+
+// Get returns the value stored under key in the namespace.
+func (n *Namespaced) Get(key string) (interface{}, bool) {
+	return n.values.Get(n.prefix + key)
+}
+
+// GetString returns the string stored under key in the namespace, or ""
+// if there is none.
+func (n *Namespaced) GetString(key string) string {
+	value, _ := n.Get(key)
+	s, _ := value.(string)
+	return s
+}
+
+// GetInt returns the int stored under key in the namespace, or 0 if there is
+// none.
+func (n *Namespaced) GetInt(key string) int {
+	value, _ := n.Get(key)
+	i, _ := value.(int)
+	return i
+}
+
+// GetBool returns the bool stored under key in the namespace, or false if
+// there is none.
+func (n *Namespaced) GetBool(key string) bool {
+	value, _ := n.Get(key)
+	b, _ := value.(bool)
+	return b
+}
+
+// Set stores value under key in the namespace.
+func (n *Namespaced) Set(key string, value interface{}) {
+	n.values.Set(n.prefix+key, value)
+}
+
+// Delete removes the value stored under key in the namespace.
+func (n *Namespaced) Delete(key string) {
+	n.values.Delete(n.prefix + key)
+}
+
+// Keys returns the keys in the namespace, without the prefix.
+func (n *Namespaced) Keys() []string {
+	var keys []string
+	n.values.View(func(values map[interface{}]interface{}) {
+		for k := range values {
+			if s, ok := k.(string); ok && strings.HasPrefix(s, n.prefix) {
+				keys = append(keys, strings.TrimPrefix(s, n.prefix))
+			}
+		}
+	})
+	return keys
+}
+
+// Clear removes all values in the namespace.
+func (n *Namespaced) Clear() {
+	n.values.Update(func(values map[interface{}]interface{}) {
+		for k := range values {
+			if s, ok := k.(string); ok && strings.HasPrefix(s, n.prefix) {
+				delete(values, k)
+			}
+		}
+	})
+}
@@ -0,0 +1,34 @@
+package mongodbstore
+
+import (
+	"testing"
+
+	"github.com/gorilla/sessions"
+)
+
+func TestNamespace(t *testing.T) {
+	session := sessions.NewSession(nil, "session-key")
+	cart := Namespace(nil, session, "cart")
+	prefs := Namespace(nil, session, "prefs")
+
+	cart.Set("items", 3)
+	prefs.Set("items", "compact")
+
+	if n := cart.GetInt("items"); n != 3 {
+		t.Errorf("Expected 3 items in cart; Got %v", n)
+	}
+	if s := prefs.GetString("items"); s != "compact" {
+		t.Errorf("Expected compact items preference; Got %q", s)
+	}
+	if session.Values["cart.items"] != 3 {
+		t.Errorf("Expected prefixed key in session values; Got %v", session.Values)
+	}
+
+	cart.Clear()
+	if keys := cart.Keys(); len(keys) != 0 {
+		t.Errorf("Expected empty cart; Got %v", keys)
+	}
+	if keys := prefs.Keys(); len(keys) != 1 || keys[0] != "items" {
+		t.Errorf("Expected prefs to keep items; Got %v", keys)
+	}
+}
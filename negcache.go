@@ -0,0 +1,101 @@
+package mongodbstore
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultNegativeCacheSize is the number of entries kept by the negative
+// cache when NegativeCacheSize is not set.
+const defaultNegativeCacheSize = 10000
+
+// negativeCache remembers tokens that failed to decode and session ids with no
+// document, so that repeated junk cookies don't reach MongoDB.
+type negativeCache struct {
+	mu      sync.Mutex
+	entries map[string]negativeEntry
+}
+
+type negativeEntry struct {
+	expires time.Time
+	err     error
+}
+
+// get returns the cached error for key and whether key was cached.
+func (c *negativeCache) get(key string, now time.Time) (error, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !now.Before(e.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return e.err, true
+}
+
+// put caches key with the error to return for it until ttl elapses. When the
+// cache is full, expired entries are dropped first, then arbitrary ones.
+func (c *negativeCache) put(key string, err error, ttl time.Duration, size int, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[string]negativeEntry)
+	}
+	if len(c.entries) >= size {
+		for k, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		for k := range c.entries {
+			if len(c.entries) < size {
+				break
+			}
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = negativeEntry{expires: now.Add(ttl), err: err}
+}
+
+func (c *negativeCache) remove(key string) {
+	c.mu.Lock()
+	delete(c.entries, key)
+	c.mu.Unlock()
+}
+
+// negativeLookup checks the negative cache for key.
+func (m *MongoDBStore) negativeLookup(key string) (error, bool) {
+	if m.NegativeCacheTTL <= 0 {
+		return nil, false
+	}
+	err, ok := m.negative.get(key, time.Now())
+	if ok {
+		m.counters.add(&m.counters.negativeHits, 1)
+	}
+	return err, ok
+}
+
+// negativeStore caches key in the negative cache.
+func (m *MongoDBStore) negativeStore(key string, err error) {
+	if m.NegativeCacheTTL <= 0 {
+		return
+	}
+	size := m.NegativeCacheSize
+	if size <= 0 {
+		size = defaultNegativeCacheSize
+	}
+	m.negative.put(key, err, m.NegativeCacheTTL, size, time.Now())
+}
+
+// negativeRemove forgets that the session with the id had no document.
+func (m *MongoDBStore) negativeRemove(id string) {
+	if m.NegativeCacheTTL <= 0 {
+		return
+	}
+	m.negative.remove("id:" + id)
+}
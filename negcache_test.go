@@ -0,0 +1,68 @@
+package mongodbstore
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+)
+
+func TestNegativeCache(t *testing.T) {
+	var c negativeCache
+	now := time.Now()
+	boom := errors.New("boom")
+
+	c.put("a", boom, time.Minute, 2, now)
+	c.put("b", nil, time.Second, 2, now)
+	if err, ok := c.get("a", now); !ok || err != boom {
+		t.Errorf("Expected cached error; Got %v, %v", err, ok)
+	}
+	if _, ok := c.get("b", now.Add(2*time.Second)); ok {
+		t.Errorf("Expected expired entry to be gone")
+	}
+
+	c.put("b", nil, time.Second, 2, now)
+	c.put("c", nil, time.Minute, 2, now.Add(2*time.Second))
+	if len(c.entries) != 2 {
+		t.Errorf("Expected cache to stay within its size; Got %d entries", len(c.entries))
+	}
+	if _, ok := c.get("c", now.Add(2*time.Second)); !ok {
+		t.Errorf("Expected newest entry to be cached")
+	}
+}
+
+func TestNegativeCacheToken(t *testing.T) {
+	store := newOfflineStore(t)
+	store.NegativeCacheTTL = time.Minute
+
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+		req.AddCookie(&http.Cookie{Name: "session-key", Value: "junk"})
+		if _, err := store.New(req, "session-key"); err == nil {
+			t.Errorf("Expected decode error for junk cookie")
+		}
+	}
+	if hits := store.counters.snapshot()["negative_cache_hits"]; hits != 1 {
+		t.Errorf("Expected one negative cache hit; Got %d", hits)
+	}
+}
+
+func TestNegativeCacheID(t *testing.T) {
+	store := newOfflineStore(t)
+	store.NegativeCacheTTL = time.Minute
+
+	id := "5cc8b3a2a4d5b6c7d8e9f0a1"
+	store.negativeStore("id:"+id, nil)
+	token, _ := securecookie.EncodeMulti("session-key", id, store.Codecs...)
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	req.AddCookie(&http.Cookie{Name: "session-key", Value: token})
+	session, err := store.New(req, "session-key")
+	if err != nil {
+		t.Fatalf("Error creating session: %v", err)
+	}
+	if !session.IsNew || session.ID != "" {
+		t.Errorf("Expected a new session with a new id; Got %q", session.ID)
+	}
+}
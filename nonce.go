@@ -0,0 +1,121 @@
+package mongodbstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrInvalidNonce is returned by ConsumeNonce for nonces that were not minted
+// for the session, already consumed, evicted or expired.
+var ErrInvalidNonce = errors.New("mongodbstore: invalid or replayed nonce")
+
+// Defaults of NonceTTL and MaxNonces.
+const (
+	defaultNonceTTL  = 10 * time.Minute
+	defaultMaxNonces = 16
+)
+
+// MintNonce returns a new single-use nonce of the session, to be embedded in
+// a form or a request and verified by ConsumeNonce, so that a replayed
+// state-changing request such as a password change is refused even with a
+// valid cookie. Nonces are stored in the session document, hashed, until
+// consumed or NonceTTL elapsed; only the MaxNonces most recent are kept. The
+// session must have been saved.
+func (m *MongoDBStore) MintNonce(ctx context.Context, session *sessions.Session) (string, error) {
+	sessionID, err := primitive.ObjectIDFromHex(session.ID)
+	if err != nil {
+		return "", m.sessionError("mint nonce of", session.Name(), ErrInvalidID)
+	}
+	nonce, err := randomString(32)
+	if err != nil {
+		return "", m.sessionError("mint nonce of", session.Name(), err)
+	}
+
+	filter := m.liveFilter(sessionID)
+	update := m.mintUpdate(nonceHash(nonce), time.Now())
+	err = m.updateNonces(ctx, session, filter, update)
+	if err == errNoMatch {
+		err = ErrNotFound
+	}
+	if err != nil {
+		return "", m.sessionError("mint nonce of", session.Name(), err)
+	}
+	return nonce, nil
+}
+
+// ConsumeNonce verifies that the nonce was minted for the session and removes
+// it, atomically, so that of concurrent requests with the same nonce only
+// one succeeds. It returns ErrInvalidNonce, wrapped, for unknown, consumed
+// or expired nonces. Expired nonces of the session are removed as well.
+func (m *MongoDBStore) ConsumeNonce(ctx context.Context, session *sessions.Session, nonce string) error {
+	sessionID, err := primitive.ObjectIDFromHex(session.ID)
+	if err != nil {
+		return m.sessionError("consume nonce of", session.Name(), ErrInvalidID)
+	}
+
+	now := time.Now()
+	hash := nonceHash(nonce)
+	filter := append(m.liveFilter(sessionID), bson.E{Key: "nonces", Value: bson.D{{Key: "$elemMatch", Value: bson.D{
+		{Key: "h", Value: hash},
+		{Key: "exp", Value: bson.D{{Key: "$gt", Value: now}}},
+	}}}})
+	update := bson.D{{Key: "$pull", Value: bson.D{{Key: "nonces", Value: bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "h", Value: hash}},
+		bson.D{{Key: "exp", Value: bson.D{{Key: "$lte", Value: now}}}},
+	}}}}}}}
+	err = m.updateNonces(ctx, session, filter, update)
+	if err == errNoMatch {
+		err = ErrInvalidNonce
+	}
+	return m.sessionError("consume nonce of", session.Name(), err)
+}
+
+// mintUpdate returns the update appending the nonce hash to the nonces of a
+// document, keeping the most recent ones.
+func (m *MongoDBStore) mintUpdate(hash string, now time.Time) bson.D {
+	ttl := m.NonceTTL
+	if ttl <= 0 {
+		ttl = defaultNonceTTL
+	}
+	max := m.MaxNonces
+	if max <= 0 {
+		max = defaultMaxNonces
+	}
+	return bson.D{{Key: "$push", Value: bson.D{{Key: "nonces", Value: bson.D{
+		{Key: "$each", Value: bson.A{bson.D{{Key: "h", Value: hash}, {Key: "exp", Value: now.Add(ttl)}}}},
+		{Key: "$slice", Value: -max},
+	}}}}}
+}
+
+// errNoMatch is returned by updateNonces when no document matched.
+var errNoMatch = errors.New("no matching document")
+
+func (m *MongoDBStore) updateNonces(ctx context.Context, session *sessions.Session, filter, update bson.D) error {
+	var matched int64
+	err := m.observe(m.profilerContext(ctx, session.Name()), "updateOne", filter, func(ctx context.Context) (string, error) {
+		res, err := m.collection.UpdateOne(ctx, filter, update)
+		if err != nil {
+			return "", err
+		}
+		matched = res.MatchedCount
+		return fmt.Sprintf("matched=%d modified=%d", res.MatchedCount, res.ModifiedCount), nil
+	})
+	if err == nil && matched == 0 {
+		err = errNoMatch
+	}
+	return err
+}
+
+// nonceHash returns the hex encoded SHA-256 of the nonce, as stored.
+func nonceHash(nonce string) string {
+	sum := sha256.Sum256([]byte(nonce))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,41 @@
+package mongodbstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestNonceInvalidSession(t *testing.T) {
+	store := newOfflineStore(t)
+	session := sessions.NewSession(store, "session-key")
+	if _, err := store.MintNonce(context.Background(), session); !errors.Is(err, ErrInvalidID) {
+		t.Errorf("Expected ErrInvalidID minting for an unsaved session; Got %v", err)
+	}
+	if err := store.ConsumeNonce(context.Background(), session, "nonce"); !errors.Is(err, ErrInvalidID) {
+		t.Errorf("Expected ErrInvalidID consuming for an unsaved session; Got %v", err)
+	}
+}
+
+func TestMintUpdate(t *testing.T) {
+	store := newOfflineStore(t)
+	store.MaxNonces = 4
+	now := time.Now()
+
+	update := store.mintUpdate(nonceHash("nonce"), now)
+	push := update.Map()["$push"].(bson.D).Map()["nonces"].(bson.D).Map()
+	if push["$slice"] != -4 {
+		t.Errorf("Expected the 4 most recent nonces kept; Got %v", push["$slice"])
+	}
+	entry := push["$each"].(bson.A)[0].(bson.D).Map()
+	if entry["h"] == "nonce" || entry["h"] != nonceHash("nonce") {
+		t.Errorf("Expected the nonce stored hashed; Got %v", entry["h"])
+	}
+	if exp := entry["exp"].(time.Time); !exp.Equal(now.Add(defaultNonceTTL)) {
+		t.Errorf("Expected the nonce to expire after %v; Got %v", defaultNonceTTL, exp.Sub(now))
+	}
+}
@@ -0,0 +1,125 @@
+package mongodbstore
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/gob"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+const (
+	// oauthFlowKey is the session value holding a pending OAuth login.
+	oauthFlowKey = "mongodbstore.oauthFlow"
+	// oauthTokenKey is the session value holding the OAuth token.
+	oauthTokenKey = "mongodbstore.oauthToken"
+)
+
+// ErrOAuthState is returned by CompleteOAuth when the state does not match a
+// pending login, because it was forged, already used or has expired.
+var ErrOAuthState = errors.New("mongodbstore: invalid oauth state")
+
+// oauthFlow is a pending OAuth login.
+type oauthFlow struct {
+	State    string
+	Verifier string
+}
+
+// OAuthToken is an OAuth2 token kept in a session. Its fields mirror those of
+// golang.org/x/oauth2.Token.
+type OAuthToken struct {
+	AccessToken  string
+	TokenType    string
+	RefreshToken string
+	Expiry       time.Time
+}
+
+func init() {
+	gob.Register(oauthFlow{})
+	gob.Register(OAuthToken{})
+}
+
+// BeginOAuth starts an OAuth2 authorization code login. It stores a random
+// state and a PKCE code verifier in the session, valid for ttl, and returns
+// the state and the S256 code challenge to put into the authorization URL.
+// The session must be saved before redirecting.
+func BeginOAuth(session *sessions.Session, ttl time.Duration) (state, challenge string, err error) {
+	flow := oauthFlow{}
+	if flow.State, err = randomString(32); err != nil {
+		return "", "", err
+	}
+	if flow.Verifier, err = randomString(32); err != nil {
+		return "", "", err
+	}
+
+	SetWithTTL(session, oauthFlowKey, flow, ttl)
+	sum := sha256.Sum256([]byte(flow.Verifier))
+	return flow.State, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// CompleteOAuth checks the state returned to the redirect URL against the
+// pending login of the session and returns the PKCE code verifier to send
+// with the token request. The pending login is consumed with TakeOnce, so a
+// state can only be used once, even by concurrent requests.
+func (m *MongoDBStore) CompleteOAuth(r *http.Request, session *sessions.Session, state string) (verifier string, err error) {
+	expiries, _ := session.Values[expiriesKey].(map[string]time.Time)
+	expires, hasExpiry := expiries[oauthFlowKey]
+
+	value, ok, err := m.TakeOnce(r, session, oauthFlowKey)
+	if err != nil {
+		return "", err
+	}
+	flow, _ := value.(oauthFlow)
+	if !ok || (hasExpiry && !time.Now().Before(expires)) ||
+		subtle.ConstantTimeCompare([]byte(flow.State), []byte(state)) != 1 {
+		return "", ErrOAuthState
+	}
+	return flow.Verifier, nil
+}
+
+// SetOAuthToken stores the token in the session. With OAuthTokenCodecs set it
+// is encoded with them, so it can be encrypted separately from the rest of
+// the session.
+func (m *MongoDBStore) SetOAuthToken(session *sessions.Session, token OAuthToken) error {
+	if len(m.OAuthTokenCodecs) == 0 {
+		session.Values[oauthTokenKey] = token
+		return nil
+	}
+
+	encoded, err := securecookie.EncodeMulti(oauthTokenKey, token, m.OAuthTokenCodecs...)
+	if err != nil {
+		return m.sessionError("encode oauth token of", session.Name(), err)
+	}
+	session.Values[oauthTokenKey] = encoded
+	return nil
+}
+
+// GetOAuthToken returns the token stored with SetOAuthToken. ok is false if the
+// session has none.
+func (m *MongoDBStore) GetOAuthToken(session *sessions.Session) (token OAuthToken, ok bool, err error) {
+	switch v := session.Values[oauthTokenKey].(type) {
+	case OAuthToken:
+		return v, true, nil
+	case string:
+		if err := securecookie.DecodeMulti(oauthTokenKey, v, &token, m.OAuthTokenCodecs...); err != nil {
+			return OAuthToken{}, false, m.sessionError("decode oauth token of", session.Name(), err)
+		}
+		return token, true, nil
+	}
+	return OAuthToken{}, false, nil
+}
+
+// randomString returns n random bytes encoded as unpadded base64url.
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
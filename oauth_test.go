@@ -0,0 +1,64 @@
+package mongodbstore
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+)
+
+func TestOAuthFlow(t *testing.T) {
+	store := newOfflineStore(t)
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, err := store.New(req, "session-key")
+	if err != nil {
+		t.Fatalf("Error creating session: %v", err)
+	}
+
+	if _, _, err := BeginOAuth(session, time.Minute); err != nil {
+		t.Fatalf("Error beginning login: %v", err)
+	}
+
+	if _, err := store.CompleteOAuth(req, session, "forged"); err != ErrOAuthState {
+		t.Errorf("Expected ErrOAuthState for forged state; Got %v", err)
+	}
+
+	state, challenge, err := BeginOAuth(session, time.Minute)
+	if err != nil {
+		t.Fatalf("Error beginning login: %v", err)
+	}
+	verifier, err := store.CompleteOAuth(req, session, state)
+	if err != nil {
+		t.Fatalf("Error completing login: %v", err)
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != challenge {
+		t.Errorf("Expected verifier to match the challenge")
+	}
+	if _, err := store.CompleteOAuth(req, session, state); err != ErrOAuthState {
+		t.Errorf("Expected ErrOAuthState for reused state; Got %v", err)
+	}
+}
+
+func TestOAuthToken(t *testing.T) {
+	store := newOfflineStore(t)
+	store.OAuthTokenCodecs = securecookie.CodecsFromPairs([]byte("hash-key"), []byte("0123456789abcdef"))
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, _ := store.New(req, "session-key")
+
+	token := OAuthToken{AccessToken: "access", RefreshToken: "refresh", Expiry: time.Unix(1e9, 0)}
+	if err := store.SetOAuthToken(session, token); err != nil {
+		t.Fatalf("Error storing token: %v", err)
+	}
+	if _, ok := session.Values[oauthTokenKey].(string); !ok {
+		t.Errorf("Expected token to be stored encoded")
+	}
+
+	got, ok, err := store.GetOAuthToken(session)
+	if err != nil || !ok || got.AccessToken != "access" || !got.Expiry.Equal(token.Expiry) {
+		t.Errorf("Expected stored token; Got %+v, %v, %v", got, ok, err)
+	}
+}
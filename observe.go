@@ -0,0 +1,113 @@
+package mongodbstore
+
+import (
+	"context"
+	"fmt"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Logger is the interface used to log debug output. *log.Logger implements
+// it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// observe runs the MongoDB operation fn and reports its duration to the
+// metrics sink. In debug mode the operation, its redacted filter, duration and
+// result are logged. fn returns a short description of its result.
+func (m *MongoDBStore) observe(ctx context.Context, op string, filter interface{},
+	fn func(ctx context.Context) (string, error)) error {
+	var result string
+	var err error
+	start := time.Now()
+	if m.ProfilerLabels {
+		pprof.Do(ctx, pprof.Labels("mongodbstore.op", op, "mongodbstore.collection", m.collection.Name()),
+			func(ctx context.Context) {
+				result, err = fn(ctx)
+			})
+	} else {
+		result, err = fn(ctx)
+	}
+	took := time.Since(start)
+	if err != nil && err != mongo.ErrNoDocuments {
+		m.counters.add(&m.counters.errors, 1)
+	}
+
+	if m.Metrics != nil {
+		tags := []string{"op:" + op, "collection:" + m.collection.Name()}
+		m.Metrics.Timing("mongodbstore.operation", took, tags...)
+		if err != nil && err != mongo.ErrNoDocuments {
+			m.Metrics.Count("mongodbstore.errors", 1, tags...)
+		}
+	}
+
+	if m.Debug && m.Logger != nil {
+		if err != nil {
+			result = "error: " + err.Error()
+		}
+		m.Logger.Printf("mongodbstore: %s %s filter=%s took=%v %s",
+			m.collection.Name(), op, redact(filter), took, result)
+	}
+	return err
+}
+
+// profilerContext returns ctx with a pprof label naming the session when
+// ProfilerLabels is set.
+func (m *MongoDBStore) profilerContext(ctx context.Context, name string) context.Context {
+	if !m.ProfilerLabels {
+		return ctx
+	}
+	return pprof.WithLabels(ctx, pprof.Labels("mongodbstore.session", name))
+}
+
+// bulkResult describes the result of a BulkWrite.
+func bulkResult(res *mongo.BulkWriteResult, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("matched=%d modified=%d upserted=%d deleted=%d",
+		res.MatchedCount, res.ModifiedCount, res.UpsertedCount, res.DeletedCount), nil
+}
+
+// redact formats a filter with its values hidden, keeping field names and
+// operators so the shape of the query stays visible.
+func redact(filter interface{}) string {
+	switch f := filter.(type) {
+	case nil:
+		return "{}"
+	case bson.D:
+		parts := make([]string, 0, len(f))
+		for _, e := range f {
+			parts = append(parts, e.Key+":"+redactValue(e.Value))
+		}
+		return "{" + strings.Join(parts, " ") + "}"
+	case bson.M:
+		parts := make([]string, 0, len(f))
+		for k, v := range f {
+			parts = append(parts, k+":"+redactValue(v))
+		}
+		sort.Strings(parts)
+		return "{" + strings.Join(parts, " ") + "}"
+	case []interface{}:
+		parts := make([]string, 0, len(f))
+		for _, v := range f {
+			parts = append(parts, redactValue(v))
+		}
+		return "[" + strings.Join(parts, " ") + "]"
+	}
+	return "?"
+}
+
+func redactValue(v interface{}) string {
+	switch v.(type) {
+	case bson.D, bson.M, []interface{}:
+		return redact(v)
+	}
+	return fmt.Sprintf("<%T>", v)
+}
@@ -0,0 +1,58 @@
+package mongodbstore
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"runtime/pprof"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDebugLogging(t *testing.T) {
+	var buf bytes.Buffer
+	store := newOfflineStore(t)
+	store.Debug = true
+	store.Logger = log.New(&buf, "", 0)
+
+	id := primitive.NewObjectID()
+	filter := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "modified", Value: bson.M{"$lt": 42}},
+	}
+	_ = store.observe(context.Background(), "findOne", filter, func(ctx context.Context) (string, error) {
+		return "found", nil
+	})
+
+	out := buf.String()
+	if strings.Contains(out, id.Hex()) {
+		t.Errorf("Expected session id to be redacted; Got %q", out)
+	}
+	for _, part := range []string{"test_session findOne", "_id:<primitive.ObjectID>", "modified:{$lt:<int>}", "found"} {
+		if !strings.Contains(out, part) {
+			t.Errorf("Expected %q in %q", part, out)
+		}
+	}
+}
+
+func TestProfilerLabels(t *testing.T) {
+	store := newOfflineStore(t)
+	store.ProfilerLabels = true
+
+	ctx := store.profilerContext(context.Background(), "session-key")
+	_ = store.observe(ctx, "findOne", nil, func(ctx context.Context) (string, error) {
+		for key, want := range map[string]string{
+			"mongodbstore.op":         "findOne",
+			"mongodbstore.collection": "test_session",
+			"mongodbstore.session":    "session-key",
+		} {
+			if got, _ := pprof.Label(ctx, key); got != want {
+				t.Errorf("Expected label %s=%s; Got %q", key, want, got)
+			}
+		}
+		return "", nil
+	})
+}
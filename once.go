@@ -0,0 +1,87 @@
+package mongodbstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/sessions"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ErrConcurrentUpdate is returned by TakeOnce when the stored session changed
+// since it was loaded, so the value may already have been taken by another
+// request.
+var ErrConcurrentUpdate = errors.New("mongodbstore: session changed concurrently")
+
+// SetOnce sets a session value meant to be read once with TakeOnce, such as an
+// OAuth state, a magic link nonce or a download token.
+func SetOnce(session *sessions.Session, key string, value interface{}) {
+	session.Values[key] = value
+}
+
+// TakeOnce removes the value from the session and persists the removal right
+// away, before returning the value. The removal only succeeds if the stored
+// session is still the one loaded or last saved during the request, so when
+// two requests race for the same value only one gets it; the other gets
+// ErrConcurrentUpdate. ok is false if the session has no such value.
+//
+// The session must have been obtained from the store during the request r,
+// or from Validate or NewSession with a nil r.
+func (m *MongoDBStore) TakeOnce(r *http.Request, session *sessions.Session, key string) (value interface{}, ok bool, err error) {
+	defer lockValues(r, session)()
+	value, ok = session.Values[key]
+	if !ok {
+		return nil, false, nil
+	}
+
+	var t *tracked
+	if r != nil {
+		if tr, found := m.tracked(r)[session.Name()]; found && tr.session == session {
+			t = tr
+		}
+	}
+	var loaded string
+	if t != nil {
+		loaded = t.data
+	} else {
+		loaded, _ = session.Values[loadedDataKey].(string)
+	}
+
+	delete(session.Values, key)
+	if session.ID == "" || loaded == "" {
+		// No document holds the value, even if the session is new but was
+		// already saved during the request.
+		return value, true, nil
+	}
+
+	s, err := m.document(session)
+	if err != nil {
+		session.Values[key] = value
+		return nil, false, m.sessionError("take value from", session.Name(), err)
+	}
+
+	m.counters.add(&m.counters.saves, 1)
+	filter := bson.D{{Key: "_id", Value: s.ID}, {Key: "data", Value: loaded}}
+	var matched int64
+	err = m.observe(m.profilerContext(context.Background(), session.Name()), "updateOne", filter, func(ctx context.Context) (string, error) {
+		res, err := m.collection.UpdateOne(ctx, filter, s.update())
+		if err != nil {
+			return "", err
+		}
+		matched = res.MatchedCount
+		return fmt.Sprintf("matched=%d modified=%d", res.MatchedCount, res.ModifiedCount), nil
+	})
+	if err == nil && matched == 0 {
+		err = ErrConcurrentUpdate
+	}
+	if err != nil {
+		session.Values[key] = value
+		return nil, false, m.sessionError("take value from", session.Name(), err)
+	}
+
+	m.uncache(s.ID)
+	m.stored(r, session, s)
+	return value, true, nil
+}
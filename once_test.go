@@ -0,0 +1,100 @@
+package mongodbstore
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/context"
+)
+
+func TestTakeOnceNewSession(t *testing.T) {
+	store := newOfflineStore(t)
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, err := store.New(req, "session-key")
+	if err != nil {
+		t.Fatalf("Error creating session: %v", err)
+	}
+
+	SetOnce(session, "state", "xyz")
+	value, ok, err := store.TakeOnce(req, session, "state")
+	if err != nil || !ok || value != "xyz" {
+		t.Errorf("Expected to take the value; Got %v, %v, %v", value, ok, err)
+	}
+	if _, ok, _ := store.TakeOnce(req, session, "state"); ok {
+		t.Errorf("Expected value to be gone after taking it")
+	}
+}
+
+// reload returns the next request of a client that received rsp.
+func reload(rsp *httptest.ResponseRecorder) *http.Request {
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	for _, c := range rsp.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	return req
+}
+
+func TestMongoStoreTakeOnceFreshSession(t *testing.T) {
+	store := newLiveStore(t)
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	defer context.Clear(req)
+	session, err := store.Get(req, "session-key")
+	if err != nil {
+		t.Fatalf("Error creating session: %v", err)
+	}
+	SetOnce(session, "state", "xyz")
+	rsp := httptest.NewRecorder()
+	if err := store.Save(req, rsp, session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+
+	// The session is still new, but its document holds the value.
+	if value, ok, err := store.TakeOnce(req, session, "state"); err != nil || !ok || value != "xyz" {
+		t.Fatalf("Expected to take the value; Got %v, %v, %v", value, ok, err)
+	}
+
+	next := reload(rsp)
+	defer context.Clear(next)
+	loaded, err := store.Get(next, "session-key")
+	if err != nil || loaded.IsNew {
+		t.Fatalf("Expected the stored session; Got %v, %v", loaded, err)
+	}
+	if _, ok := loaded.Values["state"]; ok {
+		t.Errorf("Expected the value to be removed from MongoDB")
+	}
+}
+
+func TestMongoStoreTakeOnceAfterSave(t *testing.T) {
+	store := newLiveStore(t)
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	defer context.Clear(req)
+	session, err := store.Get(req, "session-key")
+	if err != nil {
+		t.Fatalf("Error creating session: %v", err)
+	}
+	SetOnce(session, "state", "xyz")
+	rsp := httptest.NewRecorder()
+	if err := store.Save(req, rsp, session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+
+	next := reload(rsp)
+	defer context.Clear(next)
+	loaded, err := store.Get(next, "session-key")
+	if err != nil || loaded.IsNew {
+		t.Fatalf("Expected the stored session; Got %v, %v", loaded, err)
+	}
+	loaded.Values["views"] = 1
+	if err := store.Save(next, httptest.NewRecorder(), loaded); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	if value, ok, err := store.TakeOnce(next, loaded, "state"); err != nil || !ok || value != "xyz" {
+		t.Errorf("Expected to take the value after a save; Got %v, %v, %v", value, ok, err)
+	}
+	if err := store.SaveAll(next, httptest.NewRecorder()); err != nil {
+		t.Errorf("Error saving sessions: %v", err)
+	}
+}
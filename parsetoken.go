@@ -0,0 +1,72 @@
+package mongodbstore
+
+import (
+	"errors"
+
+	"github.com/gorilla/securecookie"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MaxTokenLength is the length above which tokens are rejected without being
+// decoded. Tokens holding a session id encoded by securecookie are about 200
+// bytes long.
+const MaxTokenLength = 1024
+
+// ErrInvalidToken is returned for tokens that are malformed or hold something
+// else than a session id.
+var ErrInvalidToken = errors.New("mongodbstore: invalid token")
+
+// ParseToken returns the session id held by a token, such as the value of a
+// session cookie, encoded by one of the codecs under the session name. Tokens
+// come from clients, so before running the codecs it rejects tokens that are
+// too long or contain characters securecookie never produces; the codecs then
+// compare MACs in constant time. The decoded id must be a well-formed
+// ObjectID.
+func ParseToken(name, token string, codecs ...securecookie.Codec) (string, error) {
+	if err := checkToken(token); err != nil {
+		return "", err
+	}
+	var id string
+	if err := securecookie.DecodeMulti(name, token, &id, codecs...); err != nil {
+		return "", err
+	}
+	return checkID(id)
+}
+
+// parseToken is ParseToken using the Codecs of the store and their key hints.
+func (m *MongoDBStore) parseToken(name, token string) (string, error) {
+	if err := checkToken(token); err != nil {
+		return "", err
+	}
+	var id string
+	if err := m.decodeMulti(name, token, &id, "", m.CookieCodecs(name)...); err != nil {
+		return "", err
+	}
+	return checkID(id)
+}
+
+// checkToken rejects tokens that can't have been encoded by securecookie:
+// empty or too long, or with characters outside the URL-safe base64
+// alphabet.
+func checkToken(token string) error {
+	if token == "" || len(token) > MaxTokenLength {
+		return ErrInvalidToken
+	}
+	for i := 0; i < len(token); i++ {
+		switch c := token[i]; {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '=':
+		default:
+			return ErrInvalidToken
+		}
+	}
+	return nil
+}
+
+// checkID returns the id if it is the hexadecimal form of an ObjectID.
+func checkID(id string) (string, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil || oid.Hex() != id {
+		return "", ErrInvalidToken
+	}
+	return id, nil
+}
@@ -0,0 +1,35 @@
+//go:build go1.18
+// +build go1.18
+
+package mongodbstore
+
+import (
+	"testing"
+
+	"github.com/gorilla/securecookie"
+)
+
+func FuzzParseToken(f *testing.F) {
+	codecs := securecookie.CodecsFromPairs([]byte("secret-key"))
+	token, err := securecookie.EncodeMulti("session-key", "5cc8b3a2a4d5b6c7d8e9f0a1", codecs...)
+	if err != nil {
+		f.Fatalf("Error encoding token: %v", err)
+	}
+	f.Add(token)
+	f.Add("")
+	f.Add("session-key=" + token)
+	f.Add(token[:len(token)/2])
+
+	f.Fuzz(func(t *testing.T, token string) {
+		id, err := ParseToken("session-key", token, codecs...)
+		if err != nil {
+			return
+		}
+		if _, err := checkID(id); err != nil {
+			t.Errorf("ParseToken returned the malformed id %q", id)
+		}
+		if len(token) > MaxTokenLength {
+			t.Errorf("ParseToken accepted a token of %d bytes", len(token))
+		}
+	})
+}
@@ -0,0 +1,38 @@
+package mongodbstore
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gorilla/securecookie"
+)
+
+func TestParseToken(t *testing.T) {
+	codecs := securecookie.CodecsFromPairs([]byte("secret-key"))
+	id := "5cc8b3a2a4d5b6c7d8e9f0a1"
+	token, err := securecookie.EncodeMulti("session-key", id, codecs...)
+	if err != nil {
+		t.Fatalf("Error encoding token: %v", err)
+	}
+	if got, err := ParseToken("session-key", token, codecs...); err != nil || got != id {
+		t.Errorf("Expected %s; Got %q, %v", id, got, err)
+	}
+
+	notID, _ := securecookie.EncodeMulti("session-key", "not-an-id", codecs...)
+	upper, _ := securecookie.EncodeMulti("session-key", strings.ToUpper(id), codecs...)
+	for _, bad := range []string{
+		"",
+		strings.Repeat("A", MaxTokenLength+1),
+		token[:10] + "+/" + token[12:],
+		token + " ",
+		notID,
+		upper,
+	} {
+		if _, err := ParseToken("session-key", bad, codecs...); err == nil {
+			t.Errorf("Expected %.40q to be rejected", bad)
+		}
+	}
+	if _, err := ParseToken("other-name", token, codecs...); err == nil {
+		t.Error("Expected a token of another name to be rejected")
+	}
+}
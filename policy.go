@@ -0,0 +1,110 @@
+package mongodbstore
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"reflect"
+)
+
+// ValuePolicy limits what can be stored in a session. Saving a session that
+// violates the policy fails with a *PolicyError before anything is encoded
+// or written.
+type ValuePolicy struct {
+	// MaxKeys is the maximum number of values in a session. Zero means no
+	// limit.
+	MaxKeys int
+	// MaxValueBytes is the maximum encoded size of a single value. Zero means
+	// no limit.
+	MaxValueBytes int
+	// AllowUnencodable turns off the check for channels, functions and
+	// unsafe pointers anywhere inside the values. gob cannot encode them and
+	// otherwise fails with a less precise error.
+	AllowUnencodable bool
+}
+
+// PolicyError reports a session value violating the ValuePolicy of the store.
+// Key is nil when the violation concerns the session as a whole.
+type PolicyError struct {
+	Key    interface{}
+	Reason string
+}
+
+func (e *PolicyError) Error() string {
+	if e.Key == nil {
+		return "mongodbstore: session violates value policy: " + e.Reason
+	}
+	return fmt.Sprintf("mongodbstore: session value %v violates value policy: %s", e.Key, e.Reason)
+}
+
+// check returns a *PolicyError for the first violation found in values.
+func (p *ValuePolicy) check(values map[interface{}]interface{}) error {
+	if p.MaxKeys > 0 && len(values) > p.MaxKeys {
+		return &PolicyError{Reason: fmt.Sprintf("%d values exceed the maximum of %d", len(values), p.MaxKeys)}
+	}
+
+	var buf bytes.Buffer
+	for k, v := range values {
+		if !p.AllowUnencodable {
+			if path, typ := unencodable(reflect.ValueOf(v), "", 0); typ != nil {
+				return &PolicyError{Key: k, Reason: fmt.Sprintf("value%s is of unencodable type %s", path, typ)}
+			}
+		}
+		if p.MaxValueBytes > 0 {
+			buf.Reset()
+			// Unregistered types are reported by the encoding that follows.
+			if err := gob.NewEncoder(&buf).Encode(map[interface{}]interface{}{k: v}); err == nil &&
+				buf.Len() > p.MaxValueBytes {
+				return &PolicyError{Key: k, Reason: fmt.Sprintf("encoded size %d exceeds the maximum of %d bytes",
+					buf.Len(), p.MaxValueBytes)}
+			}
+		}
+	}
+	return nil
+}
+
+// maxPolicyDepth bounds the traversal of nested values, which also stops it
+// on cyclic pointers.
+const maxPolicyDepth = 16
+
+// unencodable returns the path and type of the first channel, function or
+// unsafe pointer inside v, or a nil type if there is none.
+func unencodable(v reflect.Value, path string, depth int) (string, reflect.Type) {
+	if !v.IsValid() || depth > maxPolicyDepth {
+		return "", nil
+	}
+
+	switch v.Kind() {
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return path, v.Type()
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return "", nil
+		}
+		return unencodable(v.Elem(), path, depth+1)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if p, t := unencodable(v.Index(i), fmt.Sprintf("%s[%d]", path, i), depth+1); t != nil {
+				return p, t
+			}
+		}
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			if p, t := unencodable(v.MapIndex(key), fmt.Sprintf("%s[%v]", path, key), depth+1); t != nil {
+				return p, t
+			}
+		}
+	case reflect.Struct:
+		typ := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			// gob ignores unexported fields.
+			if typ.Field(i).PkgPath != "" {
+				continue
+			}
+			if p, t := unencodable(v.Field(i), path+"."+typ.Field(i).Name, depth+1); t != nil {
+				return p, t
+			}
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,47 @@
+package mongodbstore
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/sessions"
+)
+
+func TestValuePolicy(t *testing.T) {
+	store := newOfflineStore(t)
+	store.ValuePolicy = &ValuePolicy{MaxKeys: 2, MaxValueBytes: 100}
+
+	session := sessions.NewSession(store, "session-key")
+	session.ID = "5cc8b3a2a4d5b6c7d8e9f0a1"
+	session.Values["ok"] = "x"
+	if _, err := store.document(session); err != nil {
+		t.Fatalf("Expected session within policy; Got %v", err)
+	}
+
+	type wrapper struct {
+		Callbacks []func()
+	}
+	for _, tc := range []struct {
+		key, value interface{}
+		want       string
+	}{
+		{"big", strings.Repeat("x", 200), "encoded size"},
+		{"fn", wrapper{Callbacks: []func(){func() {}}}, "value.Callbacks[0] is of unencodable type func()"},
+		{"ch", map[string]interface{}{"c": make(chan int)}, "value[c] is of unencodable type chan int"},
+	} {
+		session.Values[tc.key] = tc.value
+		_, err := store.document(session)
+		var perr *PolicyError
+		if !errors.As(err, &perr) || perr.Key != tc.key || !strings.Contains(perr.Reason, tc.want) {
+			t.Errorf("Expected policy error for %v containing %q; Got %v", tc.key, tc.want, err)
+		}
+		delete(session.Values, tc.key)
+	}
+
+	session.Values["a"], session.Values["b"] = 1, 2
+	var perr *PolicyError
+	if _, err := store.document(session); !errors.As(err, &perr) || perr.Key != nil {
+		t.Errorf("Expected policy error for too many keys; Got %v", err)
+	}
+}
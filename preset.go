@@ -0,0 +1,73 @@
+package mongodbstore
+
+import "net/http"
+
+// SecurityPreset is a vetted combination of cookie attributes applied by
+// ApplySecurityPreset.
+type SecurityPreset int
+
+// Security presets, from the most to the least restrictive.
+const (
+	// SecurityStrict makes cookies HttpOnly, Secure and SameSite=Strict, and
+	// prefixes their names with __Host-, which binds them to the host: the
+	// cookie path is / and the domain is cleared. Links from other sites
+	// arrive without the session.
+	SecurityStrict SecurityPreset = iota + 1
+	// SecurityBalanced makes cookies HttpOnly, Secure and SameSite=Lax, and
+	// prefixes their names with __Secure-. It keeps the path and domain, and
+	// sessions follow top-level navigation from other sites.
+	SecurityBalanced
+	// SecurityLegacy makes cookies HttpOnly without further attributes or
+	// prefix, for sites still served over plain HTTP or to browsers
+	// mishandling SameSite.
+	SecurityLegacy
+)
+
+func (p SecurityPreset) String() string {
+	switch p {
+	case SecurityStrict:
+		return "strict"
+	case SecurityBalanced:
+		return "balanced"
+	case SecurityLegacy:
+		return "legacy"
+	}
+	return "unknown"
+}
+
+// Cookie name prefixes enforced by browsers.
+const (
+	hostPrefix   = "__Host-"
+	securePrefix = "__Secure-"
+)
+
+// ApplySecurityPreset sets the cookie attributes of the store options and
+// the prefix of the token names to the preset, so that safe defaults take
+// one call. It is meant to be called once, after NewMongoDBStore and before
+// serving requests; options set afterwards override the preset, and
+// SelfCheck reports combinations browsers would reject.
+//
+// Changing the prefix renames the cookies, so existing sessions are lost
+// when a preset with another prefix is applied to a running site.
+func (m *MongoDBStore) ApplySecurityPreset(p SecurityPreset) {
+	opts := m.Options
+	switch p {
+	case SecurityStrict:
+		opts.HttpOnly = true
+		opts.Secure = true
+		opts.SameSite = http.SameSiteStrictMode
+		opts.Path = "/"
+		opts.Domain = ""
+		m.tokenPrefix = hostPrefix
+	case SecurityBalanced:
+		opts.HttpOnly = true
+		opts.Secure = true
+		opts.SameSite = http.SameSiteLaxMode
+		m.tokenPrefix = securePrefix
+	case SecurityLegacy:
+		opts.HttpOnly = true
+		opts.Secure = false
+		opts.SameSite = http.SameSiteDefaultMode
+		m.tokenPrefix = ""
+	}
+}
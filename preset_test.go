@@ -0,0 +1,38 @@
+package mongodbstore
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestApplySecurityPreset(t *testing.T) {
+	store := newOfflineStore(t)
+	store.Options.Domain = "example.com"
+	store.ApplySecurityPreset(SecurityStrict)
+	if problems := store.checkOptions(); len(problems) > 0 {
+		t.Errorf("Expected no conflicting options; Got %v", problems)
+	}
+
+	session := store.newSession("session-key")
+	opts := session.Options
+	if !opts.HttpOnly || !opts.Secure || opts.SameSite != http.SameSiteStrictMode || opts.Domain != "" {
+		t.Errorf("Expected strict options; Got %+v", opts)
+	}
+	w := httptest.NewRecorder()
+	store.Token.SetToken(w, store.tokenName(session.Name()), "token", opts)
+	if cookie := w.Header().Get("Set-Cookie"); !strings.HasPrefix(cookie, "__Host-session-key=token") || !strings.Contains(cookie, "SameSite=Strict") {
+		t.Errorf("Expected a strict __Host- cookie; Got %q", cookie)
+	}
+
+	store.Options.Domain = "example.com"
+	if got := len(store.checkOptions()); got != 1 {
+		t.Errorf("Expected the domain to conflict with the __Host- prefix; Got %v", store.checkOptions())
+	}
+
+	store.ApplySecurityPreset(SecurityLegacy)
+	if store.tokenName("session-key") != "session-key" || store.Options.Secure {
+		t.Errorf("Expected legacy options; Got %q and %+v", store.tokenName("session-key"), store.Options)
+	}
+}
@@ -0,0 +1,50 @@
+package mongodbstore
+
+import (
+	"github.com/gorilla/sessions"
+)
+
+// priorityKey is the session value holding the priority set with
+// SetPriority.
+const priorityKey = "mongodbstore.priority"
+
+// Priority ranks sessions for eviction when the janitor sheds sessions under
+// pressure: lower priorities are evicted first.
+type Priority int
+
+// Session priorities.
+const (
+	// PriorityAnonymous is the default priority of sessions without a
+	// principal.
+	PriorityAnonymous Priority = iota
+	// PriorityAuthenticated is the default priority of sessions with a
+	// principal.
+	PriorityAuthenticated
+	// PriorityCritical is for sessions that should be evicted last, such
+	// as those of administrators.
+	PriorityCritical
+)
+
+// SetPriority sets the priority of the session, overriding the default one
+// derived from its principal. It is stored with the session document on the
+// next save.
+func SetPriority(session *sessions.Session, p Priority) {
+	session.Values[priorityKey] = int(p)
+}
+
+// GetPriority returns the priority of the session.
+func GetPriority(session *sessions.Session) Priority {
+	return storedPriority(session.Values)
+}
+
+// storedPriority returns the priority set in the session values, or the
+// default priority of the session.
+func storedPriority(values map[interface{}]interface{}) Priority {
+	if p, ok := values[priorityKey].(int); ok {
+		return Priority(p)
+	}
+	if storedPrincipal(values) != "" {
+		return PriorityAuthenticated
+	}
+	return PriorityAnonymous
+}
@@ -0,0 +1,135 @@
+package mongodbstore
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// EventType is the type of a session lifecycle event.
+type EventType string
+
+// Types of session lifecycle events.
+const (
+	// EventCreated is sent when a new session is first stored.
+	EventCreated EventType = "session.created"
+	// EventDestroyed is sent when a session is deleted by saving it with
+	// MaxAge < 0, as Destroy does.
+	EventDestroyed EventType = "session.destroyed"
+	// EventRevoked is sent when the DeleteWhere family deletes sessions.
+	EventRevoked EventType = "session.revoked"
+)
+
+// Event is a session lifecycle event. Webhooks POST it as JSON.
+type Event struct {
+	Type EventType `json:"type"`
+	Time time.Time `json:"time"`
+	// Name and ID identify the session of created and destroyed events.
+	Name string `json:"name,omitempty"`
+	ID   string `json:"id,omitempty"`
+	// Principal is the principal of the session, or of the sessions revoked
+	// by DeleteByPrincipal.
+	Principal string `json:"principal,omitempty"`
+	// Count is the number of sessions revoked.
+	Count int64 `json:"count,omitempty"`
+}
+
+// Publisher publishes session lifecycle events, to a webhook or an event bus
+// such as NATS or Kafka. The eventbus package has publishers for both.
+type Publisher interface {
+	Publish(ctx context.Context, e Event) error
+}
+
+// PublisherFunc adapts a function to the Publisher interface.
+type PublisherFunc func(ctx context.Context, e Event) error
+
+// Publish calls f(ctx, e).
+func (f PublisherFunc) Publish(ctx context.Context, e Event) error {
+	return f(ctx, e)
+}
+
+// errPublisherFull is reported when an event is dropped because the queue of
+// a publisher is full.
+var errPublisherFull = errors.New("mongodbstore: publisher queue full, event dropped")
+
+// publisher publishes events in the background.
+type publisher struct {
+	Publisher
+	queue   chan Event
+	stopped chan struct{}
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// EnablePublisher publishes session lifecycle events with the publisher, so
+// that external systems can react to sessions being created, destroyed and
+// revoked without polling the collection. Events are published one at a time
+// in the background, in the order they happened. Up to queueSize events wait
+// for publication; further events are dropped and reported to the error
+// handler, as are failed publications. Close waits for the queued events to
+// be published. Several publishers may be enabled; each gets every event.
+func (m *MongoDBStore) EnablePublisher(p Publisher, queueSize int) {
+	pub := &publisher{
+		Publisher: p,
+		queue:     make(chan Event, queueSize),
+		stopped:   make(chan struct{}),
+	}
+	m.publishers = append(m.publishers, pub)
+	m.goBackground("publisher", func(context.Context) error {
+		pub.run(m)
+		return nil
+	})
+}
+
+// notify queues the event for the publishers.
+func (m *MongoDBStore) notify(e Event) {
+	if len(m.publishers) == 0 {
+		return
+	}
+	e.Time = time.Now()
+
+	for _, pub := range m.publishers {
+		pub.mu.Lock()
+		if !pub.closed {
+			select {
+			case pub.queue <- e:
+			default:
+				m.reportError(context.Background(), "publish", m.opError("publish "+string(e.Type), errPublisherFull))
+			}
+		}
+		pub.mu.Unlock()
+	}
+}
+
+// closePublishers stops the publishers once the queued events are published.
+func (m *MongoDBStore) closePublishers(ctx context.Context) error {
+	for _, pub := range m.publishers {
+		pub.mu.Lock()
+		if !pub.closed {
+			pub.closed = true
+			close(pub.queue)
+		}
+		pub.mu.Unlock()
+	}
+
+	for _, pub := range m.publishers {
+		select {
+		case <-pub.stopped:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (pub *publisher) run(m *MongoDBStore) {
+	defer close(pub.stopped)
+
+	for e := range pub.queue {
+		if err := pub.Publish(context.Background(), e); err != nil {
+			m.reportError(context.Background(), "publish", m.opError("publish "+string(e.Type), err))
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package mongodbstore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// decodeFailed records a failure to decode the document and, once it failed
+// QuarantineAfter times, moves it to the Quarantine collection in the
+// background.
+func (m *MongoDBStore) decodeFailed(id primitive.ObjectID, name string, cause error) {
+	if m.Quarantine == nil {
+		return
+	}
+	after := m.QuarantineAfter
+	if after <= 0 {
+		after = 3
+	}
+
+	m.decodeFailuresMu.Lock()
+	if m.decodeFailures == nil {
+		m.decodeFailures = make(map[primitive.ObjectID]int)
+	}
+	m.decodeFailures[id]++
+	failures := m.decodeFailures[id]
+	if failures >= after {
+		delete(m.decodeFailures, id)
+	}
+	m.decodeFailuresMu.Unlock()
+
+	if failures < after {
+		return
+	}
+	go func() {
+		ctx := m.profilerContext(context.Background(), name)
+		m.reportError(ctx, "quarantine", m.quarantine(ctx, id, name, cause))
+	}()
+}
+
+// decodeSucceeded forgets the failures recorded for the document.
+func (m *MongoDBStore) decodeSucceeded(id primitive.ObjectID) {
+	if m.Quarantine == nil {
+		return
+	}
+	m.decodeFailuresMu.Lock()
+	delete(m.decodeFailures, id)
+	m.decodeFailuresMu.Unlock()
+}
+
+// quarantine copies the document to the Quarantine collection, with the name
+// of the session, the decode error and the time, and deletes it from the
+// session collection. Clients holding its cookie get new sessions.
+func (m *MongoDBStore) quarantine(ctx context.Context, id primitive.ObjectID, name string, cause error) error {
+	filter := bson.D{{Key: "_id", Value: id}}
+	var doc bson.Raw
+	err := m.observe(ctx, "findOne", filter, func(ctx context.Context) (string, error) {
+		var err error
+		doc, err = m.collection.FindOne(ctx, filter).DecodeBytes()
+		return "", err
+	})
+	if err != nil {
+		return m.opError("quarantine session", err)
+	}
+
+	record := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "name", Value: name},
+		{Key: "error", Value: cause.Error()},
+		{Key: "quarantined", Value: time.Now()},
+		{Key: "session", Value: doc},
+	}
+	err = m.observe(ctx, "insertOne", nil, func(ctx context.Context) (string, error) {
+		_, err := m.Quarantine.InsertOne(ctx, record)
+		return "", err
+	})
+	if err != nil && !isDuplicateKey(err) {
+		return m.opError("quarantine session", err)
+	}
+
+	m.uncache(id)
+	return m.observe(ctx, "deleteOne", filter, func(ctx context.Context) (string, error) {
+		res, err := m.collection.DeleteOne(ctx, filter)
+		if err != nil {
+			return "", err
+		}
+		m.counters.add(&m.counters.quarantined, res.DeletedCount)
+		return fmt.Sprintf("deleted=%d", res.DeletedCount), nil
+	})
+}
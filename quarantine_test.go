@@ -0,0 +1,61 @@
+package mongodbstore
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestQuarantineAfterRepeatedFailures(t *testing.T) {
+	store := newOfflineStore(t)
+	store.CacheTTL = time.Minute
+	store.Quarantine = store.Collection().Database().Collection("test_quarantine")
+	store.QuarantineAfter = 2
+	attempts := make(chan error, 1)
+	store.WithErrorHandler(func(ctx context.Context, op string, err error) {
+		if op == "quarantine" {
+			attempts <- err
+		}
+	})
+
+	foreign := securecookie.CodecsFromPairs([]byte("other-key"))
+	data, err := securecookie.EncodeMulti("session-key", map[interface{}]interface{}{"foo": "bar"}, foreign...)
+	if err != nil {
+		t.Fatalf("Error encoding data: %v", err)
+	}
+	id := primitive.NewObjectID()
+	store.cacheDoc(&Session{ID: id, Data: data})
+	token, _ := securecookie.EncodeMulti("session-key", id.Hex(), store.Codecs...)
+
+	load := func() {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Cookie", "session-key="+token)
+		session, err := store.New(req, "session-key")
+		if err != nil {
+			t.Fatalf("Error loading session: %v", err)
+		}
+		if LoadError(session) == nil {
+			t.Fatal("Expected undecodable data to fail to load")
+		}
+	}
+
+	load()
+	select {
+	case <-attempts:
+		t.Fatal("Expected no quarantine after a single failure")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	load()
+	select {
+	case <-attempts:
+		// The offline store can't reach MongoDB, but the document was
+		// sent to quarantine.
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the document to be quarantined")
+	}
+}
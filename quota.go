@@ -0,0 +1,143 @@
+package mongodbstore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// TenantQuota limits the sessions a tenant may store. Zero limits are
+// unlimited.
+type TenantQuota struct {
+	MaxSessions int64
+	// MaxBytes limits the total size of the encoded session data.
+	MaxBytes int64
+}
+
+// QuotaError is returned by Save when a tenant exceeded its TenantQuota.
+type QuotaError struct {
+	Tenant string
+	// Resource is "sessions" or "bytes".
+	Resource string
+	Limit    int64
+	Used     int64
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("mongodbstore: tenant %q exceeded its quota of %d %s (%d used)", e.Tenant, e.Limit, e.Resource, e.Used)
+}
+
+// tenantUsage is the usage of a tenant counted in MongoDB, plus the sessions
+// created by this process since.
+type tenantUsage struct {
+	sessions int64
+	bytes    int64
+	counted  time.Time
+}
+
+// checkQuota returns a *QuotaError if saving the session would exceed the
+// quota of its tenant. New sessions are refused once the tenant has
+// MaxSessions, and all saves once it stores MaxBytes. Failures to count the
+// usage are reported to the error handler and the save is allowed.
+func (m *MongoDBStore) checkQuota(ctx context.Context, session *sessions.Session) error {
+	tenant := SessionTenant(session)
+	if m.TenantQuotas == nil || tenant == "" {
+		return nil
+	}
+	quota := m.TenantQuotas(tenant)
+	if quota.MaxSessions <= 0 && quota.MaxBytes <= 0 {
+		return nil
+	}
+
+	usage, err := m.tenantUsage(ctx, tenant)
+	if err != nil {
+		m.reportError(ctx, "quota", m.opError("count usage of tenant "+tenant, err))
+		return nil
+	}
+
+	var qerr *QuotaError
+	switch {
+	case session.IsNew && quota.MaxSessions > 0 && usage.sessions >= quota.MaxSessions:
+		qerr = &QuotaError{Tenant: tenant, Resource: "sessions", Limit: quota.MaxSessions, Used: usage.sessions}
+	case quota.MaxBytes > 0 && usage.bytes >= quota.MaxBytes:
+		qerr = &QuotaError{Tenant: tenant, Resource: "bytes", Limit: quota.MaxBytes, Used: usage.bytes}
+	default:
+		return nil
+	}
+	m.counters.add(&m.counters.quotaRejections, 1)
+	if m.Metrics != nil {
+		m.Metrics.Count("mongodbstore.quota.rejected", 1, "tenant:"+tenant, "resource:"+qerr.Resource)
+	}
+	return qerr
+}
+
+// tenantUsage returns the usage of the tenant, counted in MongoDB at most
+// every QuotaInterval.
+func (m *MongoDBStore) tenantUsage(ctx context.Context, tenant string) (tenantUsage, error) {
+	interval := m.QuotaInterval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	m.quotaMu.Lock()
+	u, ok := m.usage[tenant]
+	m.quotaMu.Unlock()
+	if ok && time.Since(u.counted) < interval {
+		return *u, nil
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{{Key: "tenant", Value: tenant}, {Key: "revoked", Value: bson.D{{Key: "$ne", Value: true}}}}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: nil},
+			{Key: "sessions", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "bytes", Value: bson.D{{Key: "$sum", Value: bson.D{{Key: "$strLenBytes", Value: "$data"}}}}},
+		}}},
+	}
+	var counted struct {
+		Sessions int64 `bson:"sessions"`
+		Bytes    int64 `bson:"bytes"`
+	}
+	err := m.observe(ctx, "aggregate", pipeline, func(ctx context.Context) (string, error) {
+		cur, err := m.collection.Aggregate(ctx, pipeline)
+		if err != nil {
+			return "", err
+		}
+		defer cur.Close(ctx)
+		if cur.Next(ctx) {
+			if err := cur.Decode(&counted); err != nil {
+				return "", err
+			}
+		}
+		return fmt.Sprintf("sessions=%d bytes=%d", counted.Sessions, counted.Bytes), cur.Err()
+	})
+	if err != nil {
+		return tenantUsage{}, err
+	}
+
+	usage := &tenantUsage{sessions: counted.Sessions, bytes: counted.Bytes, counted: time.Now()}
+	m.quotaMu.Lock()
+	if m.usage == nil {
+		m.usage = make(map[string]*tenantUsage)
+	}
+	m.usage[tenant] = usage
+	m.quotaMu.Unlock()
+	return *usage, nil
+}
+
+// quotaCreated adds a session created by this process to the usage of its
+// tenant until the usage is counted again.
+func (m *MongoDBStore) quotaCreated(s *Session) {
+	if m.TenantQuotas == nil || s.Tenant == "" {
+		return
+	}
+	m.quotaMu.Lock()
+	defer m.quotaMu.Unlock()
+	if u, ok := m.usage[s.Tenant]; ok {
+		u.sessions++
+		u.bytes += int64(len(s.Data))
+	}
+}
@@ -0,0 +1,51 @@
+package mongodbstore
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTenantQuota(t *testing.T) {
+	store := newOfflineStore(t)
+	store.Tenant = func(r *http.Request) string { return r.Host }
+	store.TenantQuotas = func(tenant string) TenantQuota {
+		return TenantQuota{MaxSessions: 2, MaxBytes: 1000}
+	}
+	store.usage = map[string]*tenantUsage{
+		"full.example.com":  {sessions: 2, bytes: 100, counted: time.Now()},
+		"large.example.com": {sessions: 1, bytes: 1000, counted: time.Now()},
+	}
+
+	req := httptest.NewRequest("GET", "http://full.example.com/", nil)
+	session, _ := store.New(req, "session-key")
+	err := store.Save(req, httptest.NewRecorder(), session)
+	var qerr *QuotaError
+	if !errors.As(err, &qerr) || qerr.Resource != "sessions" || qerr.Tenant != "full.example.com" {
+		t.Fatalf("Expected a sessions QuotaError; Got %v", err)
+	}
+
+	// Existing sessions of a tenant at its session limit can still be saved.
+	session.IsNew = false
+	if err := store.checkQuota(req.Context(), session); err != nil {
+		t.Errorf("Expected no quota error for an existing session; Got %v", err)
+	}
+
+	req = httptest.NewRequest("GET", "http://large.example.com/", nil)
+	session, _ = store.New(req, "session-key")
+	session.IsNew = false
+	if err := store.checkQuota(req.Context(), session); !errors.As(err, &qerr) || qerr.Resource != "bytes" {
+		t.Errorf("Expected a bytes QuotaError; Got %v", err)
+	}
+
+	if got := store.counters.snapshot()["quota_rejections"]; got != 2 {
+		t.Errorf("Expected 2 quota rejections; Got %d", got)
+	}
+
+	store.quotaCreated(&Session{Tenant: "large.example.com", Data: "data"})
+	if u := store.usage["large.example.com"]; u.sessions != 2 || u.bytes != 1004 {
+		t.Errorf("Expected the created session counted; Got %+v", u)
+	}
+}
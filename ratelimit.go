@@ -0,0 +1,167 @@
+package mongodbstore
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// ErrRateLimited is returned by Save when the client exceeded the write rate
+// allowed by the store's WriteLimiter.
+var ErrRateLimited = errors.New("mongodbstore: too many session writes")
+
+// maxBuckets is the number of clients whose bucket is kept. The bucket of the
+// client seen least recently is dropped for a new one, so a storm of distinct
+// clients costs neither memory nor time; a dropped client starts over with a
+// full bucket.
+const maxBuckets = 10000
+
+// RateLimiter is a token bucket limiter keyed by client. Each client may
+// perform Burst operations at once and Rate operations per second on average.
+type RateLimiter struct {
+	Rate  float64
+	Burst int
+	// MaxDelay is how long an operation may wait for a token before it is
+	// rejected. Zero rejects operations right away.
+	MaxDelay time.Duration
+	// Key returns the client key of a request. By default it is the session
+	// id, or the remote IP address for sessions that have no id yet.
+	Key func(r *http.Request, session *sessions.Session) string
+
+	mu      sync.Mutex
+	buckets map[string]*list.Element
+	lru     list.List
+}
+
+type bucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a RateLimiter allowing rate operations per second
+// with bursts of burst operations.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	return &RateLimiter{Rate: rate, Burst: burst}
+}
+
+// Allow takes a token for key, waiting up to MaxDelay for one. It reports
+// whether the operation may proceed.
+func (l *RateLimiter) Allow(key string) bool {
+	return l.AllowContext(context.Background(), key)
+}
+
+// AllowContext is like Allow, but stops waiting for a token when ctx is done,
+// in which case the token is given back and the operation is rejected.
+func (l *RateLimiter) AllowContext(ctx context.Context, key string) bool {
+	wait, ok := l.reserve(key, time.Now())
+	if !ok {
+		return false
+	}
+	if wait <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		l.release(key)
+		return false
+	}
+}
+
+// reserve takes a token for key and returns how long to wait until it is
+// available. It fails without taking a token if the wait exceeds MaxDelay.
+func (l *RateLimiter) reserve(key string, now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.bucket(key, now)
+
+	b.tokens += now.Sub(b.last).Seconds() * l.Rate
+	if b.tokens > float64(l.Burst) {
+		b.tokens = float64(l.Burst)
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	if l.Rate <= 0 {
+		return 0, false
+	}
+	wait := time.Duration((1 - b.tokens) / l.Rate * float64(time.Second))
+	if wait > l.MaxDelay {
+		return 0, false
+	}
+	b.tokens--
+	return wait, true
+}
+
+// release gives back a token taken for key.
+func (l *RateLimiter) release(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if e, ok := l.buckets[key]; ok {
+		e.Value.(*bucket).tokens++
+	}
+}
+
+// bucket returns the bucket of key, creating a full one, in place of the
+// least recently used one once there are maxBuckets.
+func (l *RateLimiter) bucket(key string, now time.Time) *bucket {
+	if e, ok := l.buckets[key]; ok {
+		l.lru.MoveToFront(e)
+		return e.Value.(*bucket)
+	}
+
+	if l.buckets == nil {
+		l.buckets = make(map[string]*list.Element)
+	}
+	if l.lru.Len() >= maxBuckets {
+		oldest := l.lru.Back()
+		l.lru.Remove(oldest)
+		delete(l.buckets, oldest.Value.(*bucket).key)
+	}
+	b := &bucket{key: key, tokens: float64(l.Burst), last: now}
+	l.buckets[key] = l.lru.PushFront(b)
+	return b
+}
+
+// key returns the client key of the request.
+func (l *RateLimiter) key(r *http.Request, session *sessions.Session) string {
+	if l.Key != nil {
+		return l.Key(r, session)
+	}
+	if session.ID != "" {
+		return session.ID
+	}
+	if r == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// allowWrite applies the WriteLimiter to a save of the session, waiting for
+// a token no longer than ctx allows. r is nil outside a request.
+func (m *MongoDBStore) allowWrite(ctx context.Context, r *http.Request, session *sessions.Session) bool {
+	if m.WriteLimiter == nil {
+		return true
+	}
+	return m.WriteLimiter.AllowContext(ctx, m.WriteLimiter.key(r, session))
+}
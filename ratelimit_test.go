@@ -0,0 +1,89 @@
+package mongodbstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := NewRateLimiter(1, 2)
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if _, ok := l.reserve("client", now); !ok {
+			t.Fatalf("Expected burst operation %d to be allowed", i)
+		}
+	}
+	if _, ok := l.reserve("client", now); ok {
+		t.Errorf("Expected operation over the burst to be rejected")
+	}
+	if _, ok := l.reserve("other", now); !ok {
+		t.Errorf("Expected other client to be allowed")
+	}
+	if _, ok := l.reserve("client", now.Add(time.Second)); !ok {
+		t.Errorf("Expected operation to be allowed after refill")
+	}
+
+	l.MaxDelay = 2 * time.Second
+	if wait, ok := l.reserve("client", now.Add(time.Second)); !ok || wait != time.Second {
+		t.Errorf("Expected operation to wait a second; Got %v, %v", wait, ok)
+	}
+}
+
+func TestRateLimiterContext(t *testing.T) {
+	l := NewRateLimiter(0.001, 1)
+	l.MaxDelay = time.Hour
+	if !l.Allow("client") {
+		t.Fatalf("Expected the burst operation to be allowed")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if l.AllowContext(ctx, "client") {
+		t.Errorf("Expected the wait to stop with the context")
+	}
+	if b := l.buckets["client"].Value.(*bucket); b.tokens < -1e-3 || b.tokens > 1e-3 {
+		t.Errorf("Expected the token to be given back; Got %v", b.tokens)
+	}
+}
+
+func TestRateLimiterBounded(t *testing.T) {
+	l := NewRateLimiter(0, 1)
+	now := time.Now()
+	l.reserve("client", now)
+	for i := 0; i < maxBuckets; i++ {
+		l.reserve(fmt.Sprint(i), now)
+		if i == maxBuckets/2 {
+			// The client is seen again and stays limited.
+			if _, ok := l.reserve("client", now); ok {
+				t.Fatalf("Expected the client to be limited")
+			}
+		}
+	}
+	if len(l.buckets) != maxBuckets || l.lru.Len() != maxBuckets {
+		t.Errorf("Expected %d buckets; Got %d", maxBuckets, len(l.buckets))
+	}
+	if _, ok := l.buckets["0"]; ok {
+		t.Errorf("Expected the least recently seen client to be dropped")
+	}
+	if _, ok := l.reserve("client", now); ok {
+		t.Errorf("Expected a recently seen client to keep its bucket")
+	}
+}
+
+func TestSaveAllRateLimited(t *testing.T) {
+	store := newOfflineStore(t)
+	store.WriteLimiter = NewRateLimiter(0, 0)
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, _ := store.Get(req, "session-key")
+	session.Values["foo"] = "bar"
+	if err := store.SaveAll(req, httptest.NewRecorder()); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected ErrRateLimited; Got %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package mongodbstore
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// recentWriteSuffix is appended to the session name to form the name of the
+// token marking a recent write.
+const recentWriteSuffix = ".rw"
+
+// recentWrite is the value of the recent write marker. It is encoded with the
+// cookie codecs, so that clients can't forge markers to force primary reads.
+type recentWrite struct {
+	ID      string
+	Expires time.Time
+}
+
+// markRecentWrite sets a short-lived token telling the next request to load
+// the session from the primary. It does nothing unless ReadYourWrites is set,
+// or if the session skips its cookie.
+func (m *MongoDBStore) markRecentWrite(w http.ResponseWriter, session *sessions.Session) {
+	if m.ReadYourWrites <= 0 || sessionCookieMode(session) == modeSkipCookie {
+		return
+	}
+
+	name := m.tokenName(session.Name()) + recentWriteSuffix
+	marker := recentWrite{ID: session.ID, Expires: time.Now().Add(m.ReadYourWrites)}
+	encoded, err := securecookie.EncodeMulti(name, marker, m.CookieCodecs(session.Name())...)
+	if err != nil {
+		return
+	}
+	opts := *session.Options
+	opts.MaxAge = int((m.ReadYourWrites + time.Second - 1) / time.Second)
+	m.Token.SetToken(w, name, encoded, &opts)
+}
+
+// recentlyWritten reports whether the request carries an unexpired recent
+// write marker for the session.
+func (m *MongoDBStore) recentlyWritten(r *http.Request, session *sessions.Session) bool {
+	if m.ReadYourWrites <= 0 {
+		return false
+	}
+
+	name := m.tokenName(session.Name()) + recentWriteSuffix
+	token, err := m.Token.GetToken(r, name)
+	if err != nil {
+		return false
+	}
+	var marker recentWrite
+	if securecookie.DecodeMulti(name, token, &marker, m.CookieCodecs(session.Name())...) != nil {
+		return false
+	}
+	return marker.ID == session.ID && time.Now().Before(marker.Expires)
+}
+
+// primaryCollection returns the collection configured to read from the
+// primary, regardless of the read preference of the store's collection.
+func (m *MongoDBStore) primaryCollection() *mongo.Collection {
+	m.primaryOnce.Do(func() {
+		coll, err := m.collection.Clone(options.Collection().SetReadPreference(readpref.Primary()))
+		if err != nil {
+			coll = m.collection
+		}
+		m.primary = coll
+	})
+	return m.primary
+}
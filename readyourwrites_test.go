@@ -0,0 +1,51 @@
+package mongodbstore
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+)
+
+func TestReadYourWrites(t *testing.T) {
+	store := newOfflineStore(t)
+	store.ReadYourWrites = time.Minute
+
+	session := store.newSession("session-key")
+	session.ID = "5cc8b3a2a4d5b6c7d8e9f0a1"
+	rsp := httptest.NewRecorder()
+	store.markRecentWrite(rsp, session)
+
+	request := func(value string) *http.Request {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.AddCookie(&http.Cookie{Name: "session-key" + recentWriteSuffix, Value: value})
+		return req
+	}
+	cookies := rsp.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].MaxAge != 60 {
+		t.Fatalf("Expected a marker living a minute; Got %v", cookies)
+	}
+	if !store.recentlyWritten(request(cookies[0].Value), session) {
+		t.Errorf("Expected the marker to be read")
+	}
+
+	other := store.newSession("session-key")
+	other.ID = "5cc8b3a2a4d5b6c7d8e9f0a2"
+	if store.recentlyWritten(request(cookies[0].Value), other) {
+		t.Errorf("Expected the marker of another session to be ignored")
+	}
+	if store.recentlyWritten(request("1"), session) {
+		t.Errorf("Expected a forged marker to be ignored")
+	}
+
+	expired, err := securecookie.EncodeMulti("session-key"+recentWriteSuffix,
+		recentWrite{ID: session.ID, Expires: time.Now().Add(-time.Second)}, store.Codecs...)
+	if err != nil {
+		t.Fatalf("Error encoding marker: %v", err)
+	}
+	if store.recentlyWritten(request(expired), session) {
+		t.Errorf("Expected an expired marker to be ignored")
+	}
+}
@@ -0,0 +1,151 @@
+package mongodbstore
+
+import (
+	"context"
+
+	"github.com/gorilla/securecookie"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// defaultReencryptBatchSize is the batch size of ReencryptAll when none is
+// given.
+const defaultReencryptBatchSize = 100
+
+// ReencryptOptions configure ReencryptAll.
+type ReencryptOptions struct {
+	// BatchSize is the number of documents read and written at a time. It
+	// defaults to 100.
+	BatchSize int
+	// StartAfter resumes an interrupted run after the document with this id,
+	// as reported in ReencryptProgress.LastID.
+	StartAfter primitive.ObjectID
+	// Progress, if set, is called after every batch.
+	Progress func(ReencryptProgress)
+}
+
+// ReencryptProgress reports the state of a ReencryptAll run.
+type ReencryptProgress struct {
+	// Processed is the number of documents read.
+	Processed int64
+	// Reencoded is the number of documents written with the new codecs.
+	Reencoded int64
+	// Failed is the number of documents whose data the old codecs could not
+	// decode, for example because they belong to sessions of another name.
+	Failed int64
+	// Skipped is the number of documents changed by a concurrent save while
+	// being re-encoded. They were saved with the codecs of the saving store.
+	Skipped int64
+	// LastID is the id of the last document processed.
+	LastID primitive.ObjectID
+}
+
+// ReencryptAll re-encodes the stored data of all sessions with the given name
+// from oldCodecs to newCodecs, walking the collection in id order. It is
+// needed to retire a compromised data key: once it has run, the store can be
+// configured with DataCodecs set to the new codecs only. Sessions saved
+// concurrently by stores still using the old codecs are skipped, so stores
+// should be switched to encode with the new codecs first, keeping the old
+// ones for decoding.
+//
+// A run interrupted by an error or by ctx can be resumed by passing the
+// LastID of the last reported progress as StartAfter.
+func (m *MongoDBStore) ReencryptAll(ctx context.Context, name string, oldCodecs, newCodecs []securecookie.Codec,
+	opts ReencryptOptions) (ReencryptProgress, error) {
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultReencryptBatchSize
+	}
+	progress := ReencryptProgress{LastID: opts.StartAfter}
+	defer m.forgetKeyHints()
+
+	for {
+		docs, err := m.reencryptBatch(ctx, progress.LastID, batchSize)
+		if err != nil {
+			return progress, m.opError("re-encrypt sessions", err)
+		}
+		if len(docs) == 0 {
+			return progress, nil
+		}
+
+		var models []mongo.WriteModel
+		for _, doc := range docs {
+			values := make(map[interface{}]interface{})
+			if err := securecookie.DecodeMulti(name, doc.Data, &values, withoutMaxAge(oldCodecs)...); err != nil {
+				progress.Failed++
+				continue
+			}
+			encoded, err := securecookie.EncodeMulti(name, values, newCodecs...)
+			if err != nil {
+				return progress, m.opError("re-encrypt sessions", encodeError(values, err))
+			}
+			models = append(models, mongo.NewUpdateOneModel().
+				SetFilter(bson.D{{Key: "_id", Value: doc.ID}, {Key: "data", Value: doc.Data}}).
+				SetUpdate(bson.D{{Key: "$set", Value: bson.D{
+					{Key: "data", Value: encoded},
+					{Key: "checksum", Value: checksum(encoded)},
+				}}}))
+		}
+
+		if len(models) > 0 {
+			var modified int64
+			err := m.observe(ctx, "bulkWrite", nil, func(ctx context.Context) (string, error) {
+				res, err := m.collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+				if res != nil {
+					modified = res.ModifiedCount
+				}
+				return bulkResult(res, err)
+			})
+			if err != nil {
+				return progress, m.opError("re-encrypt sessions", err)
+			}
+			progress.Reencoded += modified
+			progress.Skipped += int64(len(models)) - modified
+		}
+
+		progress.Processed += int64(len(docs))
+		progress.LastID = docs[len(docs)-1].ID
+		m.cache.clear()
+		if opts.Progress != nil {
+			opts.Progress(progress)
+		}
+	}
+}
+
+// reencryptBatch reads the next documents holding data after the id.
+func (m *MongoDBStore) reencryptBatch(ctx context.Context, after primitive.ObjectID, n int) ([]Session, error) {
+	filter := bson.D{{Key: "data", Value: bson.D{{Key: "$exists", Value: true}}}}
+	if !after.IsZero() {
+		filter = append(filter, bson.E{Key: "_id", Value: bson.D{{Key: "$gt", Value: after}}})
+	}
+
+	var docs []Session
+	err := m.observe(ctx, "find", filter, func(ctx context.Context) (string, error) {
+		cur, err := m.collection.Find(ctx, filter, options.Find().
+			SetSort(bson.D{{Key: "_id", Value: 1}}).
+			SetLimit(int64(n)).
+			SetProjection(bson.D{{Key: "data", Value: 1}}))
+		if err != nil {
+			return "", err
+		}
+		defer cur.Close(ctx)
+
+		for cur.Next(ctx) {
+			var doc Session
+			if err := cur.Decode(&doc); err != nil {
+				return "", err
+			}
+			docs = append(docs, doc)
+		}
+		return "", cur.Err()
+	})
+	return docs, err
+}
+
+// forgetKeyHints drops the remembered codec indexes, which re-encoding
+// invalidates.
+func (m *MongoDBStore) forgetKeyHints() {
+	m.keyHints.reset()
+}
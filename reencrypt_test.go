@@ -0,0 +1,86 @@
+package mongodbstore
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestReencryptAllResume(t *testing.T) {
+	store := newOfflineStore(t)
+	store.keyHints.put("5cc8b3a2a4d5b6c7d8e9f0a1", 1)
+
+	start := primitive.NewObjectID()
+	progress, err := store.ReencryptAll(context.Background(), "session-key", store.Codecs,
+		securecookie.CodecsFromPairs([]byte("new-key")), ReencryptOptions{StartAfter: start})
+	if err == nil {
+		t.Fatalf("Expected error without a server")
+	}
+	if progress.LastID != start || progress.Processed != 0 {
+		t.Errorf("Expected progress to resume from StartAfter; Got %+v", progress)
+	}
+	if _, ok := store.keyHints.get("5cc8b3a2a4d5b6c7d8e9f0a1"); ok {
+		t.Errorf("Expected key hints to be forgotten")
+	}
+}
+
+func TestMongoStoreReencryptAll(t *testing.T) {
+	store := newLiveStore(t)
+	ctx := context.Background()
+	var saved []*sessions.Session
+	for i, name := range []string{"session-key", "session-key", "other-key", "session-key"} {
+		req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+		session, err := store.New(req, name)
+		if err != nil {
+			t.Fatalf("Error creating session: %v", err)
+		}
+		session.Values["n"] = i
+		if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+			t.Fatalf("Error saving session: %v", err)
+		}
+		saved = append(saved, session)
+	}
+
+	newCodecs := securecookie.CodecsFromPairs([]byte("new-key"))
+	var reported []ReencryptProgress
+	progress, err := store.ReencryptAll(ctx, "session-key", store.Codecs, newCodecs, ReencryptOptions{
+		BatchSize: 2,
+		Progress:  func(p ReencryptProgress) { reported = append(reported, p) },
+	})
+	if err != nil {
+		t.Fatalf("Error re-encrypting sessions: %v", err)
+	}
+	if progress.Processed != 4 || progress.Reencoded != 3 || progress.Failed != 1 || len(reported) != 2 {
+		t.Errorf("Unexpected progress %+v, reported %d times", progress, len(reported))
+	}
+
+	for i, session := range saved {
+		id, _ := primitive.ObjectIDFromHex(session.ID)
+		var doc Session
+		if err := store.collection.FindOne(ctx, bson.D{{Key: "_id", Value: id}}).Decode(&doc); err != nil {
+			t.Fatalf("Error loading session: %v", err)
+		}
+		values := make(map[interface{}]interface{})
+		err := securecookie.DecodeMulti(session.Name(), doc.Data, &values, newCodecs...)
+		if session.Name() == "other-key" {
+			if err == nil {
+				t.Errorf("Expected sessions of another name to be left alone")
+			}
+		} else if err != nil || values["n"] != i {
+			t.Errorf("Expected the data to be encoded with the new codecs; Got %v, %v", values, err)
+		}
+	}
+
+	// Resuming after the last document finds nothing left to do.
+	resumed, err := store.ReencryptAll(ctx, "session-key", store.Codecs, newCodecs,
+		ReencryptOptions{StartAfter: progress.LastID})
+	if err != nil || resumed.Processed != 0 {
+		t.Errorf("Expected nothing to resume; Got %+v, %v", resumed, err)
+	}
+}
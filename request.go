@@ -0,0 +1,82 @@
+package mongodbstore
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/context"
+	"github.com/gorilla/sessions"
+)
+
+// trackerKey is the key used to store the per-request session tracker in the
+// gorilla context, next to the sessions registry.
+type trackerKey struct{}
+
+// tracked is a session handed out by the store during a request together with
+// the encoded data it was loaded from or last saved with, and the time that
+// data was stored. data is empty while no document of the session exists.
+type tracked struct {
+	session  *sessions.Session
+	data     string
+	modified time.Time
+}
+
+// track remembers the session for the current request so that SaveAll can
+// find it later. doc is the document the session was loaded from, or nil for
+// new sessions.
+//
+// Only requests already carrying gorilla context, such as the registry of Get,
+// are tracked: their context must be cleared anyway, while a caller of New
+// alone may never clear it. Sessions not tracked keep the data they were
+// loaded from in their values, for TakeOnce.
+func (m *MongoDBStore) track(r *http.Request, session *sessions.Session, doc *Session) {
+	if r == nil || context.GetAll(r) == nil {
+		if doc != nil {
+			session.Values[loadedDataKey] = doc.Data
+		}
+		return
+	}
+	byStore, _ := context.Get(r, trackerKey{}).(map[*MongoDBStore]map[string]*tracked)
+	if byStore == nil {
+		byStore = make(map[*MongoDBStore]map[string]*tracked)
+		context.Set(r, trackerKey{}, byStore)
+	}
+	if byStore[m] == nil {
+		byStore[m] = make(map[string]*tracked)
+	}
+	t := &tracked{session: session}
+	if doc != nil {
+		t.data = doc.Data
+		t.modified = doc.Modified
+	}
+	byStore[m][session.Name()] = t
+}
+
+// tracked returns the sessions handed out by the store during the request.
+func (m *MongoDBStore) tracked(r *http.Request) map[string]*tracked {
+	byStore, _ := context.Get(r, trackerKey{}).(map[*MongoDBStore]map[string]*tracked)
+	return byStore[m]
+}
+
+// stored records that the session was saved as the document s, or deleted
+// when s is nil, so that later saves and TakeOnce during the request compare
+// against what is stored now. Sessions not tracked, such as those of
+// Validate, keep the data in their values.
+func (m *MongoDBStore) stored(r *http.Request, session *sessions.Session, s *Session) {
+	var data string
+	var modified time.Time
+	if s != nil {
+		data, modified = s.Data, s.Modified
+	}
+	if r != nil {
+		if t, ok := m.tracked(r)[session.Name()]; ok && t.session == session {
+			t.data, t.modified = data, modified
+			return
+		}
+	}
+	if data == "" {
+		delete(session.Values, loadedDataKey)
+		return
+	}
+	session.Values[loadedDataKey] = data
+}
@@ -0,0 +1,214 @@
+package mongodbstore
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// principalKey is the session value holding the principal of a session.
+const principalKey = "mongodbstore.principal"
+
+// SetPrincipal tags the session with the identifier of the user it belongs
+// to. The principal is stored with the session document on the next save and
+// allows revoking all sessions of a user with DeleteByPrincipal.
+func SetPrincipal(session *sessions.Session, principal string) {
+	if principal == "" {
+		delete(session.Values, principalKey)
+		return
+	}
+	session.Values[principalKey] = principal
+}
+
+// GetPrincipal returns the principal the session is tagged with.
+func GetPrincipal(session *sessions.Session) string {
+	return storedPrincipal(session.Values)
+}
+
+// storedPrincipal returns the principal found in the session values.
+func storedPrincipal(values map[interface{}]interface{}) string {
+	principal, _ := values[principalKey].(string)
+	return principal
+}
+
+// DeleteWhere deletes all session documents matching the filter and returns
+// the number of deleted sessions. Clients holding cookies of deleted sessions
+// get new sessions on their next request. With TombstoneTTL the documents are
+// replaced by tombstones. In multi-tenant mode the DeleteWhere family returns
+// ErrTenantRequired; ForTenant returns the family restricted to a tenant.
+func (m *MongoDBStore) DeleteWhere(ctx context.Context, filter bson.M) (int64, error) {
+	if m.Tenant != nil {
+		return 0, ErrTenantRequired
+	}
+	return m.revoke(ctx, filter, "")
+}
+
+// revoke deletes the sessions matching the filter, the sessions of the
+// principal if any, and sends the revoked event.
+func (m *MongoDBStore) revoke(ctx context.Context, filter bson.M, principal string) (int64, error) {
+	var deleted int64
+	if m.TombstoneTTL > 0 {
+		live := bson.M{"revoked": bson.M{"$ne": true}}
+		for k, v := range filter {
+			live[k] = v
+		}
+		err := m.observe(ctx, "updateMany", live, func(ctx context.Context) (string, error) {
+			opts := options.Update()
+			if c := m.collation(); c != nil {
+				opts.SetCollation(c)
+			}
+			res, err := m.collection.UpdateMany(ctx, live, m.tombstoneUpdate(time.Now()), opts)
+			if err != nil {
+				return "", err
+			}
+			deleted = res.ModifiedCount
+			m.counters.add(&m.counters.deletes, deleted)
+			return fmt.Sprintf("tombstones=%d", deleted), nil
+		})
+		m.cache.clear()
+		if err != nil {
+			return 0, m.opError("delete sessions", err)
+		}
+		m.notifyRevoked(deleted, principal)
+		return deleted, nil
+	}
+
+	err := m.observe(ctx, "deleteMany", filter, func(ctx context.Context) (string, error) {
+		opts := options.Delete()
+		if c := m.collation(); c != nil {
+			opts.SetCollation(c)
+		}
+		res, err := m.collection.DeleteMany(ctx, filter, opts)
+		if err != nil {
+			return "", err
+		}
+		deleted = res.DeletedCount
+		m.counters.add(&m.counters.deletes, deleted)
+		return fmt.Sprintf("deleted=%d", deleted), nil
+	})
+	// The deleted ids are unknown, so nothing cached can be trusted.
+	m.cache.clear()
+	if err != nil {
+		return 0, m.opError("delete sessions", err)
+	}
+	m.notifyRevoked(deleted, principal)
+	return deleted, nil
+}
+
+// notifyRevoked sends the revoked event of deleted sessions.
+func (m *MongoDBStore) notifyRevoked(deleted int64, principal string) {
+	if deleted > 0 {
+		m.notify(Event{Type: EventRevoked, Principal: principal, Count: deleted})
+	}
+}
+
+// DeleteModifiedBefore deletes all sessions last modified before t.
+func (m *MongoDBStore) DeleteModifiedBefore(ctx context.Context, t time.Time) (int64, error) {
+	return m.DeleteWhere(ctx, bson.M{"modified": bson.M{"$lt": t}})
+}
+
+// DeleteByPrincipal deletes all sessions tagged with the principal.
+func (m *MongoDBStore) DeleteByPrincipal(ctx context.Context, principal string) (int64, error) {
+	if m.Tenant != nil {
+		return 0, ErrTenantRequired
+	}
+	return m.revoke(ctx, bson.M{"principal": m.principalID(principal)}, principal)
+}
+
+// InvalidateOlderThanCredentialChange deletes the sessions tagged with the
+// principal that were created before changedAt, the time their password or
+// other credential changed, so that sessions opened with the old credential
+// end. Sessions created since, such as one issued on completing the
+// change, are kept; the session the change was made in is deleted if it
+// predates it.
+func (m *MongoDBStore) InvalidateOlderThanCredentialChange(ctx context.Context, principal string, changedAt time.Time) (int64, error) {
+	if m.Tenant != nil {
+		return 0, ErrTenantRequired
+	}
+	return m.revoke(ctx, m.credentialChangeFilter(principal, changedAt), principal)
+}
+
+// credentialChangeFilter matches the sessions of the principal created before
+// changedAt. Documents without a creation time are dated by their id.
+func (m *MongoDBStore) credentialChangeFilter(principal string, changedAt time.Time) bson.M {
+	// The smallest id of the second of changedAt.
+	var changedID primitive.ObjectID
+	binary.BigEndian.PutUint32(changedID[:4], uint32(changedAt.Unix()))
+	return bson.M{
+		"principal": m.principalID(principal),
+		"$or": bson.A{
+			bson.M{"created": bson.M{"$lt": changedAt}},
+			bson.M{
+				"created": bson.M{"$exists": false},
+				"_id":     bson.M{"$lt": changedID},
+			},
+		},
+	}
+}
+
+// principalID returns the form of the principal stored in session documents:
+// the principal itself, or its HMAC with PrincipalKey.
+func (m *MongoDBStore) principalID(principal string) string {
+	if len(m.PrincipalKey) == 0 || principal == "" {
+		return principal
+	}
+	mac := hmac.New(sha256.New, m.PrincipalKey)
+	mac.Write([]byte(principal))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// DeleteByLabel deletes all sessions carrying the label.
+func (m *MongoDBStore) DeleteByLabel(ctx context.Context, key, value string) (int64, error) {
+	return m.DeleteWhere(ctx, labelFilter(key, value))
+}
+
+// labelFilter matches the sessions carrying the label.
+func labelFilter(key, value string) bson.M {
+	return bson.M{"labels": bson.M{"$elemMatch": bson.M{"k": key, "v": value}}}
+}
+
+// ConfirmInvalidateAll must be passed to InvalidateAll to confirm the intent
+// to delete every session.
+const ConfirmInvalidateAll = "yes, invalidate all sessions"
+
+// PinnedLabel is the label marking sessions that InvalidateAll keeps, such as
+// sessions of service accounts.
+const PinnedLabel = "pinned"
+
+// ErrNotConfirmed is returned by InvalidateAll when the confirmation doesn't
+// match ConfirmInvalidateAll.
+var ErrNotConfirmed = errors.New("mongodbstore: invalidation not confirmed")
+
+// Pin marks the session to survive InvalidateAll.
+func Pin(session *sessions.Session) {
+	SetLabel(session, PinnedLabel, "true")
+}
+
+// InvalidateAll deletes every session except pinned ones, for incident
+// response. confirm must be ConfirmInvalidateAll, otherwise nothing is deleted
+// and ErrNotConfirmed is returned.
+func (m *MongoDBStore) InvalidateAll(ctx context.Context, confirm string) (int64, error) {
+	if confirm != ConfirmInvalidateAll {
+		return 0, ErrNotConfirmed
+	}
+
+	return m.DeleteWhere(ctx, unpinnedFilter())
+}
+
+// unpinnedFilter matches the sessions that are not pinned.
+func unpinnedFilter() bson.M {
+	return bson.M{"labels": bson.M{"$not": bson.M{"$elemMatch": bson.M{
+		"k": PinnedLabel,
+		"v": "true",
+	}}}}
+}
@@ -0,0 +1,139 @@
+package mongodbstore
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestPrincipalKey(t *testing.T) {
+	store := newOfflineStore(t)
+	session := sessions.NewSession(store, "session-key")
+	session.ID = "5cc8b3a2a4d5b6c7d8e9f0a1"
+	SetPrincipal(session, "alice")
+
+	doc, err := store.document(session)
+	if err != nil {
+		t.Fatalf("Error encoding session: %v", err)
+	}
+	if doc.Principal != "alice" {
+		t.Errorf("Expected raw principal without a key; Got %q", doc.Principal)
+	}
+
+	store.PrincipalKey = []byte("principal-key")
+	doc, err = store.document(session)
+	if err != nil {
+		t.Fatalf("Error encoding session: %v", err)
+	}
+	if doc.Principal == "alice" || doc.Principal != store.principalID("alice") || len(doc.Principal) != 64 {
+		t.Errorf("Expected hashed principal; Got %q", doc.Principal)
+	}
+	if GetPrincipal(session) != "alice" {
+		t.Errorf("Expected session values to keep the raw principal")
+	}
+	if store.principalID("") != "" {
+		t.Errorf("Expected empty principal to stay empty")
+	}
+}
+
+func TestCredentialChangeFilter(t *testing.T) {
+	store := newOfflineStore(t)
+	changedAt := time.Unix(1e9, 0)
+
+	filter := store.credentialChangeFilter("alice", changedAt)
+	if filter["principal"] != "alice" {
+		t.Errorf("Expected the principal; Got %v", filter["principal"])
+	}
+	or := filter["$or"].(bson.A)
+	if created := or[0].(bson.M)["created"].(bson.M)["$lt"]; created != changedAt {
+		t.Errorf("Expected sessions created before %v; Got %v", changedAt, created)
+	}
+	id := or[1].(bson.M)["_id"].(bson.M)["$lt"].(primitive.ObjectID)
+	if id.Hex() != "3b9aca000000000000000000" {
+		t.Errorf("Expected the first id of %v; Got %v", changedAt, id.Hex())
+	}
+}
+
+func TestDeleteWhere(t *testing.T) {
+	store := newOfflineStore(t)
+	var buf bytes.Buffer
+	store.Debug = true
+	store.Logger = log.New(&buf, "", 0)
+	store.CacheTTL = time.Minute
+	id := primitive.NewObjectID()
+	store.cacheDoc(&Session{ID: id})
+
+	// The offline store fails the deletions after logging their filters.
+	if _, err := store.DeleteByLabel(context.Background(), "role", "admin"); err == nil ||
+		!strings.Contains(err.Error(), "delete sessions") {
+		t.Errorf("Expected the deletion to fail; Got %v", err)
+	}
+	if !strings.Contains(buf.String(), "deleteMany filter={labels:{$elemMatch:{k:<string> v:<string>}}}") {
+		t.Errorf("Expected the label filter; Got %q", buf.String())
+	}
+	if _, ok := store.cached(id); ok {
+		t.Error("Expected the cache to be cleared")
+	}
+
+	buf.Reset()
+	store.TombstoneTTL = time.Hour
+	store.DeleteWhere(context.Background(), bson.M{"modified": bson.M{"$lt": 1}})
+	if !strings.Contains(buf.String(), "updateMany filter={modified:{$lt:<int>} revoked:{$ne:<bool>}}") {
+		t.Errorf("Expected tombstones of live sessions; Got %q", buf.String())
+	}
+
+	store.Tenant = func(r *http.Request) string { return r.Host }
+	if _, err := store.DeleteWhere(context.Background(), bson.M{}); err != ErrTenantRequired {
+		t.Errorf("Expected ErrTenantRequired; Got %v", err)
+	}
+	buf.Reset()
+	store.ForTenant("acme").DeleteWhere(context.Background(), bson.M{"tenant": "other"})
+	if !strings.Contains(buf.String(), "filter={revoked:{$ne:<bool>} tenant:<string>}") {
+		t.Errorf("Expected the deletion restricted to the tenant; Got %q", buf.String())
+	}
+}
+
+func TestInvalidateAllConfirm(t *testing.T) {
+	store := newOfflineStore(t)
+	var buf bytes.Buffer
+	store.Debug = true
+	store.Logger = log.New(&buf, "", 0)
+
+	for _, confirm := range []string{"", "yes", strings.ToUpper(ConfirmInvalidateAll)} {
+		if _, err := store.InvalidateAll(context.Background(), confirm); err != ErrNotConfirmed {
+			t.Errorf("%q: Expected ErrNotConfirmed; Got %v", confirm, err)
+		}
+		if _, err := store.ForTenant("acme").InvalidateAll(context.Background(), confirm); err != ErrNotConfirmed {
+			t.Errorf("%q: Expected ErrNotConfirmed for the tenant; Got %v", confirm, err)
+		}
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("Expected nothing deleted without confirmation; Got %q", buf.String())
+	}
+
+	// The offline store fails the deletion after logging its filter.
+	store.InvalidateAll(context.Background(), ConfirmInvalidateAll)
+	if !strings.Contains(buf.String(), "deleteMany filter={labels:{$not:{$elemMatch:{k:<string> v:<string>}}}}") {
+		t.Errorf("Expected pinned sessions to be kept; Got %q", buf.String())
+	}
+
+	session := sessions.NewSession(store, "session-key")
+	session.ID = "5cc8b3a2a4d5b6c7d8e9f0a1"
+	Pin(session)
+	doc, err := store.document(session)
+	if err != nil {
+		t.Fatalf("Error encoding session: %v", err)
+	}
+	pinned := unpinnedFilter()["labels"].(bson.M)["$not"].(bson.M)["$elemMatch"].(bson.M)
+	if len(doc.Labels) != 1 || doc.Labels[0].Key != pinned["k"] || doc.Labels[0].Value != pinned["v"] {
+		t.Errorf("Expected the pinned label to match the filter; Got %v", doc.Labels)
+	}
+}
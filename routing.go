@@ -0,0 +1,52 @@
+package mongodbstore
+
+import (
+	"sync"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+// SetRouting makes the store read with the read preference and write with the
+// write concern, either of which may be nil to keep the one of the
+// collection. It must be called before the store is used.
+//
+// Globally distributed replica sets can keep reads near the user with a
+// nearest read preference restricted to the local members by tag sets, for
+// example
+//
+//	readpref.Nearest(readpref.WithTags("region", "eu"))
+//
+// and acknowledge writes locally with a write concern naming a custom
+// getLastErrorModes mode of the replica set, for example
+//
+//	writeconcern.New(writeconcern.WTagSet("localRegion"))
+//
+// Such writes are acknowledged before they reach the other regions, so a
+// user whose next request lands in another region may briefly see the
+// previous state of the session, and a regional outage can lose the writes
+// not yet replicated. ReadYourWrites covers the first case for the same
+// region by reading recently written sessions from the primary. Deployments
+// that keep sessions in a separate collection per region use one store per
+// region instead.
+func (m *MongoDBStore) SetRouting(rp *readpref.ReadPref, wc *writeconcern.WriteConcern) error {
+	opts := options.Collection()
+	if rp != nil {
+		opts.SetReadPreference(rp)
+	}
+	if wc != nil {
+		opts.SetWriteConcern(wc)
+	}
+
+	coll, err := m.collection.Clone(opts)
+	if err != nil {
+		return m.opError("set routing", err)
+	}
+	m.collection = coll
+	m.primaryOnce = sync.Once{}
+	if m.writeBehind != nil {
+		m.writeBehind.collection = coll
+	}
+	return nil
+}
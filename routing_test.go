@@ -0,0 +1,24 @@
+package mongodbstore
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+func TestSetRouting(t *testing.T) {
+	store := newOfflineStore(t)
+	before := store.Collection()
+	rp := readpref.Nearest(readpref.WithTags("region", "eu"))
+	if err := store.SetRouting(rp, writeconcern.New(writeconcern.WTagSet("localRegion"))); err != nil {
+		t.Fatalf("Error setting routing: %v", err)
+	}
+
+	if store.Collection() == before || store.Collection().Name() != before.Name() {
+		t.Errorf("Expected a routed clone of the collection")
+	}
+	if store.primaryCollection() == before {
+		t.Errorf("Expected the primary collection to be cloned from the routed one")
+	}
+}
@@ -0,0 +1,166 @@
+package mongodbstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/x/bsonx"
+)
+
+// SelfCheckError lists the problems found by SelfCheck.
+type SelfCheckError struct {
+	Problems []error
+}
+
+func (e *SelfCheckError) Error() string {
+	msgs := make([]string, len(e.Problems))
+	for i, err := range e.Problems {
+		msgs[i] = err.Error()
+	}
+	return "mongodbstore: self-check failed: " + strings.Join(msgs, "; ")
+}
+
+// SelfCheck verifies the configuration of the store and its collection, so
+// that problems are found at startup rather than by the first request. It
+// checks that:
+//
+//   - every codec can encode and decode, which fails for AES keys that are
+//     not 16, 24 or 32 bytes long;
+//   - options don't conflict, such as SameSite=None without Secure or a
+//     storage TTL shorter than the idle timeout;
+//   - the collection is writable;
+//   - the indexes created by NewMongoDBStore with ensureTTL exist.
+//
+// All problems found are returned in a *SelfCheckError.
+func (m *MongoDBStore) SelfCheck(ctx context.Context) error {
+	var problems []error
+	problems = append(problems, m.checkCodecs()...)
+	problems = append(problems, m.checkOptions()...)
+	if err := m.checkWritable(ctx); err != nil {
+		problems = append(problems, err)
+	}
+	problems = append(problems, m.checkIndexes(ctx)...)
+
+	if len(problems) > 0 {
+		return &SelfCheckError{Problems: problems}
+	}
+	return nil
+}
+
+func (m *MongoDBStore) checkCodecs() []error {
+	var problems []error
+	if len(m.Codecs) == 0 {
+		problems = append(problems, errors.New("no codecs"))
+	}
+	check := func(kind string, codecs []securecookie.Codec) {
+		for i, codec := range codecs {
+			encoded, err := codec.Encode("self-check", "value")
+			var value string
+			if err == nil {
+				err = codec.Decode("self-check", encoded, &value)
+			}
+			if err != nil {
+				problems = append(problems, fmt.Errorf("%s %d: %w", kind, i, err))
+			}
+		}
+	}
+	check("codec", m.Codecs)
+	check("data codec", m.DataCodecs)
+	for name, codecs := range m.NameCodecs {
+		check(fmt.Sprintf("%q codec", name), codecs)
+	}
+	return problems
+}
+
+func (m *MongoDBStore) checkOptions() []error {
+	var problems []error
+	if m.Options.SameSite == http.SameSiteNoneMode && !m.Options.Secure {
+		problems = append(problems, errors.New("SameSite=None cookies must be Secure"))
+	}
+	if m.tokenPrefix != "" && !m.Options.Secure {
+		problems = append(problems, fmt.Errorf("%s cookies must be Secure", m.tokenPrefix))
+	}
+	if m.tokenPrefix == hostPrefix && (m.Options.Domain != "" || m.Options.Path != "/") {
+		problems = append(problems, fmt.Errorf("%s cookies must have the path / and no domain", hostPrefix))
+	}
+	if m.StorageTTL > 0 && m.IdleTimeout > m.StorageTTL {
+		problems = append(problems, fmt.Errorf("StorageTTL %v is shorter than IdleTimeout %v", m.StorageTTL, m.IdleTimeout))
+	}
+	if ttl := time.Duration(m.indexMaxAge) * time.Second; ttl > 0 && m.IdleTimeout > ttl {
+		problems = append(problems, fmt.Errorf("the TTL index removes sessions after %v, before IdleTimeout %v", ttl, m.IdleTimeout))
+	}
+	if m.MaxLifetime > 0 && m.IdleTimeout > m.MaxLifetime {
+		problems = append(problems, fmt.Errorf("IdleTimeout %v is longer than MaxLifetime %v", m.IdleTimeout, m.MaxLifetime))
+	}
+	return problems
+}
+
+// checkWritable inserts and deletes a probe document.
+func (m *MongoDBStore) checkWritable(ctx context.Context) error {
+	filter := bson.D{{Key: "_id", Value: primitive.NewObjectID()}}
+	err := m.observe(ctx, "insertOne", filter, func(ctx context.Context) (string, error) {
+		// The probe expires right away in case it can't be deleted.
+		_, err := m.collection.InsertOne(ctx, append(filter, bson.E{Key: "idleExpires", Value: time.Now()}))
+		return "", err
+	})
+	if err == nil {
+		err = m.observe(ctx, "deleteOne", filter, func(ctx context.Context) (string, error) {
+			_, err := m.collection.DeleteOne(ctx, filter)
+			return "", err
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("collection not writable: %w", err)
+	}
+	return nil
+}
+
+// checkIndexes reports the indexes of NewMongoDBStore missing from the
+// collection.
+func (m *MongoDBStore) checkIndexes(ctx context.Context) []error {
+	existing := make(map[string]bool)
+	err := m.observe(ctx, "listIndexes", nil, func(ctx context.Context) (string, error) {
+		cur, err := m.collection.Indexes().List(ctx)
+		if err != nil {
+			return "", err
+		}
+		defer cur.Close(ctx)
+		for cur.Next(ctx) {
+			var index struct {
+				Key bson.D `bson:"key"`
+			}
+			if err := cur.Decode(&index); err != nil {
+				return "", err
+			}
+			fields := make([]string, len(index.Key))
+			for i, e := range index.Key {
+				fields[i] = e.Key
+			}
+			existing[strings.Join(fields, ",")] = true
+		}
+		return fmt.Sprintf("indexes=%d", len(existing)), cur.Err()
+	})
+	if err != nil {
+		return []error{fmt.Errorf("listing indexes: %w", err)}
+	}
+
+	var problems []error
+	for _, index := range indexes(m.indexMaxAge) {
+		keys := index.Keys.(bsonx.Doc)
+		fields := make([]string, len(keys))
+		for i, e := range keys {
+			fields[i] = e.Key
+		}
+		if name := strings.Join(fields, ","); !existing[name] {
+			problems = append(problems, fmt.Errorf("missing index on %s", name))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,38 @@
+package mongodbstore
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+)
+
+func TestSelfCheckConfiguration(t *testing.T) {
+	store := newOfflineStore(t)
+	if problems := append(store.checkCodecs(), store.checkOptions()...); len(problems) > 0 {
+		t.Fatalf("Expected the default configuration to pass; Got %v", problems)
+	}
+
+	store.Codecs = append(store.Codecs, securecookie.New([]byte("hash-key"), []byte("short-block-key")))
+	store.Options.SameSite = http.SameSiteNoneMode
+	store.StorageTTL = time.Hour
+	store.IdleTimeout = 2 * time.Hour
+
+	if got := len(store.checkCodecs()); got != 1 {
+		t.Errorf("Expected the invalid AES key to be reported; Got %d problems", got)
+	}
+	// SameSite without Secure, StorageTTL and the TTL index both shorter
+	// than IdleTimeout.
+	if got := len(store.checkOptions()); got != 3 {
+		t.Errorf("Expected 3 conflicting options; Got %v", store.checkOptions())
+	}
+
+	err := store.SelfCheck(context.Background())
+	var selfCheck *SelfCheckError
+	if !errors.As(err, &selfCheck) || len(selfCheck.Problems) < 4 {
+		t.Errorf("Expected aggregated problems; Got %v", err)
+	}
+}
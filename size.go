@@ -0,0 +1,25 @@
+package mongodbstore
+
+import (
+	"github.com/gorilla/sessions"
+)
+
+// HistogramSink is implemented by metrics sinks that record distributions.
+// When the Metrics sink of the store implements it, the encoded size of every
+// saved session is recorded as "mongodbstore.session_bytes".
+type HistogramSink interface {
+	Histogram(name string, value float64, tags ...string)
+}
+
+// recordSize records the encoded size of a session being saved and calls
+// OnLargeSession when it exceeds SizeWarning.
+func (m *MongoDBStore) recordSize(session *sessions.Session, size int) {
+	m.counters.add(&m.counters.savedBytes, int64(size))
+	if h, ok := m.Metrics.(HistogramSink); ok {
+		h.Histogram("mongodbstore.session_bytes", float64(size),
+			"collection:"+m.collection.Name(), "session:"+session.Name())
+	}
+	if m.SizeWarning > 0 && size > m.SizeWarning && m.OnLargeSession != nil {
+		m.OnLargeSession(session, size)
+	}
+}
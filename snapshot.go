@@ -0,0 +1,145 @@
+package mongodbstore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/x/bsonx"
+)
+
+// ErrSnapshotNotFound is returned by Restore for snapshots that don't exist,
+// expired or belong to another session.
+var ErrSnapshotNotFound = errors.New("mongodbstore: snapshot not found")
+
+// errNoSnapshots is returned when the Snapshots collection is not set.
+var errNoSnapshots = errors.New("mongodbstore: no snapshots collection")
+
+// snapshot is a point-in-time copy of the values of a session.
+type snapshot struct {
+	ID      primitive.ObjectID `bson:"_id"`
+	Session string             `bson:"session"`
+	Name    string             `bson:"name"`
+	Data    string             `bson:"data"`
+	Created time.Time          `bson:"created"`
+	Expires time.Time          `bson:"expires"`
+}
+
+// Snapshot stores a copy of the current values of the session in the
+// Snapshots collection and returns its id, for example before a destructive
+// step of a wizard. The copy is encoded like the session data and kept for
+// SnapshotTTL, a day by default.
+func (m *MongoDBStore) Snapshot(ctx context.Context, session *sessions.Session) (string, error) {
+	if m.Snapshots == nil {
+		return "", errNoSnapshots
+	}
+	if session.ID == "" {
+		return "", m.sessionError("snapshot", session.Name(), ErrInvalidID)
+	}
+	encoders, err := m.sessionEncoders(session)
+	if err != nil {
+		return "", m.sessionError("snapshot", session.Name(), err)
+	}
+	values := persistentValues(session)
+	data, err := securecookie.EncodeMulti(session.Name(), values, encoders...)
+	if err != nil {
+		return "", m.sessionError("snapshot", session.Name(), encodeError(values, err))
+	}
+
+	ttl := m.SnapshotTTL
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	now := time.Now()
+	snap := snapshot{
+		ID:      primitive.NewObjectID(),
+		Session: session.ID,
+		Name:    session.Name(),
+		Data:    data,
+		Created: now,
+		Expires: now.Add(ttl),
+	}
+	err = m.observe(ctx, "insertOne", nil, func(ctx context.Context) (string, error) {
+		_, err := m.Snapshots.InsertOne(ctx, snap)
+		return "", err
+	})
+	if err != nil {
+		return "", m.sessionError("snapshot", session.Name(), err)
+	}
+	return snap.ID.Hex(), nil
+}
+
+// Restore replaces the values of the session by those of one of its
+// snapshots. The session must be saved to persist the restored values.
+func (m *MongoDBStore) Restore(ctx context.Context, session *sessions.Session, snapshotID string) error {
+	if m.Snapshots == nil {
+		return errNoSnapshots
+	}
+	id, err := primitive.ObjectIDFromHex(snapshotID)
+	if err != nil {
+		return m.sessionError("restore", session.Name(), ErrSnapshotNotFound)
+	}
+
+	filter := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "session", Value: session.ID},
+		{Key: "name", Value: session.Name()},
+		{Key: "expires", Value: bson.D{{Key: "$gt", Value: time.Now()}}},
+	}
+	var snap snapshot
+	err = m.observe(ctx, "findOne", filter, func(ctx context.Context) (string, error) {
+		return "", m.Snapshots.FindOne(ctx, filter).Decode(&snap)
+	})
+	if err == mongo.ErrNoDocuments {
+		return m.sessionError("restore", session.Name(), ErrSnapshotNotFound)
+	}
+	if err != nil {
+		return m.sessionError("restore", session.Name(), err)
+	}
+	return m.restoreSnapshot(session, &snap)
+}
+
+// restoreSnapshot decodes the snapshot into the session, keeping the values
+// that live only in memory.
+func (m *MongoDBStore) restoreSnapshot(session *sessions.Session, snap *snapshot) error {
+	decoders, err := m.sessionDecoders(session)
+	if err != nil {
+		return m.sessionError("restore", session.Name(), err)
+	}
+	values := make(map[interface{}]interface{})
+	if err := m.decodeMulti(session.Name(), snap.Data, &values, session.ID, decoders...); err != nil {
+		return m.sessionError("restore", session.Name(), err)
+	}
+	for k, v := range session.Values {
+		if _, ok := k.(transientKey); ok {
+			values[k] = v
+		}
+	}
+	session.Values = values
+	return nil
+}
+
+// snapshotIndexes returns the indexes of the Snapshots collection.
+func snapshotIndexes() []mongo.IndexModel {
+	return []mongo.IndexModel{
+		{
+			Keys: bsonx.Doc{{Key: "expires", Value: bsonx.Int32(1)}},
+			Options: &options.IndexOptions{
+				Background:         newBool(true),
+				ExpireAfterSeconds: newInt32(0),
+			},
+		},
+		{
+			Keys: bsonx.Doc{{Key: "session", Value: bsonx.Int32(1)}},
+			Options: &options.IndexOptions{
+				Background: newBool(true),
+			},
+		},
+	}
+}
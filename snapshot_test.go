@@ -0,0 +1,56 @@
+package mongodbstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+func TestRestoreSnapshot(t *testing.T) {
+	store := newOfflineStore(t)
+
+	session := sessions.NewSession(store, "session-key")
+	session.ID = "5d1f2d6e1c9d440000a1b2c3"
+	session.Values["step"] = 1
+	data, err := securecookie.EncodeMulti("session-key", persistentValues(session), store.Codecs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session.Values["step"] = 3
+	session.Values["confirmed"] = true
+	session.Values[loadErrorKey] = errors.New("kept")
+	if err := store.restoreSnapshot(session, &snapshot{Data: data}); err != nil {
+		t.Fatalf("Error restoring snapshot: %v", err)
+	}
+	if session.Values["step"] != 1 {
+		t.Errorf("Expected step 1; Got %v", session.Values["step"])
+	}
+	if _, ok := session.Values["confirmed"]; ok {
+		t.Error("Expected values set after the snapshot removed")
+	}
+	if session.Values[loadErrorKey] == nil {
+		t.Error("Expected in-memory values kept")
+	}
+}
+
+func TestSnapshotErrors(t *testing.T) {
+	store := newOfflineStore(t)
+	session := sessions.NewSession(store, "session-key")
+	ctx := context.Background()
+
+	if _, err := store.Snapshot(ctx, session); err != errNoSnapshots {
+		t.Errorf("Expected errNoSnapshots; Got %v", err)
+	}
+
+	store.Snapshots = store.collection.Database().Collection("snapshots")
+	if _, err := store.Snapshot(ctx, session); !errors.Is(err, ErrInvalidID) {
+		t.Errorf("Expected ErrInvalidID for a session without id; Got %v", err)
+	}
+	if err := store.Restore(ctx, session, "not an id"); !errors.Is(err, ErrSnapshotNotFound) {
+		t.Errorf("Expected ErrSnapshotNotFound; Got %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package mongodbstore
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// Session values holding the authentication state of a session.
+const (
+	authLevelKey       = "mongodbstore.authLevel"
+	authenticatedAtKey = "mongodbstore.authenticatedAt"
+)
+
+// ErrReauthRequired is returned when a session has not been authenticated
+// recently enough or at a high enough level for the requested action.
+var ErrReauthRequired = errors.New("mongodbstore: re-authentication required")
+
+// MarkAuthenticated records that the user of the session has just
+// authenticated at the given level, for example 1 for a password and 2 for a
+// second factor. Save the session to persist the marker.
+func MarkAuthenticated(session *sessions.Session, level int) {
+	session.Values[authLevelKey] = level
+	session.Values[authenticatedAtKey] = time.Now().UnixNano()
+}
+
+// ClearAuthentication removes the authentication markers from the session.
+func ClearAuthentication(session *sessions.Session) {
+	delete(session.Values, authLevelKey)
+	delete(session.Values, authenticatedAtKey)
+}
+
+// AuthLevel returns the level the session was last authenticated at, or 0.
+func AuthLevel(session *sessions.Session) int {
+	level, _ := session.Values[authLevelKey].(int)
+	return level
+}
+
+// AuthenticatedAt returns when the session was last authenticated, or the zero
+// time.
+func AuthenticatedAt(session *sessions.Session) time.Time {
+	nsec, ok := session.Values[authenticatedAtKey].(int64)
+	if !ok {
+		return time.Time{}
+	}
+	return time.Unix(0, nsec)
+}
+
+// RequireRecentAuth returns ErrReauthRequired unless the session was
+// authenticated within the given duration.
+func RequireRecentAuth(session *sessions.Session, within time.Duration) error {
+	at := AuthenticatedAt(session)
+	if at.IsZero() || time.Since(at) > within {
+		return ErrReauthRequired
+	}
+	return nil
+}
+
+// RequireAuthLevel returns ErrReauthRequired unless the session was
+// authenticated at least at level within the given duration.
+func RequireAuthLevel(session *sessions.Session, level int, within time.Duration) error {
+	if AuthLevel(session) < level {
+		return ErrReauthRequired
+	}
+	return RequireRecentAuth(session, within)
+}
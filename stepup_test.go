@@ -0,0 +1,34 @@
+package mongodbstore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+func TestStepUp(t *testing.T) {
+	session := sessions.NewSession(nil, "session-key")
+
+	if err := RequireRecentAuth(session, time.Hour); err != ErrReauthRequired {
+		t.Errorf("Expected ErrReauthRequired for unauthenticated session; Got %v", err)
+	}
+
+	MarkAuthenticated(session, 1)
+	if err := RequireRecentAuth(session, time.Hour); err != nil {
+		t.Errorf("Expected recent authentication; Got %v", err)
+	}
+	if err := RequireAuthLevel(session, 2, time.Hour); err != ErrReauthRequired {
+		t.Errorf("Expected ErrReauthRequired for level 2; Got %v", err)
+	}
+
+	session.Values[authenticatedAtKey] = time.Now().Add(-2 * time.Hour).UnixNano()
+	if err := RequireAuthLevel(session, 1, time.Hour); err != ErrReauthRequired {
+		t.Errorf("Expected ErrReauthRequired for stale authentication; Got %v", err)
+	}
+
+	ClearAuthentication(session)
+	if AuthLevel(session) != 0 || !AuthenticatedAt(session).IsZero() {
+		t.Errorf("Expected cleared authentication")
+	}
+}
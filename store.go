@@ -0,0 +1,83 @@
+package mongodbstore
+
+import (
+	"net/http"
+
+	"github.com/gorilla/sessions"
+)
+
+// Store extends sessions.Store with the operations applications commonly
+// need beyond loading and saving. Application code can depend on Store and
+// use a different implementation in tests.
+type Store interface {
+	sessions.Store
+
+	// Destroy deletes the session with the given name and expires its
+	// cookie.
+	Destroy(r *http.Request, w http.ResponseWriter, name string) error
+
+	// Refresh saves the session with the given name unchanged, extending
+	// the lifetime of the stored session and of its cookie.
+	Refresh(r *http.Request, w http.ResponseWriter, name string) error
+}
+
+var _ Store = (*MongoDBStore)(nil)
+
+// Destroy deletes the session with the given name, expires its cookie and
+// calls the DestroyHooks, as a logout does. The CarryOver values are saved in a
+// new session. A request without a valid session only gets the cookie
+// expired.
+func (m *MongoDBStore) Destroy(r *http.Request, w http.ResponseWriter, name string) error {
+	session, err := m.Get(r, name)
+	if err != nil || session.ID == "" {
+		opts := *m.Options
+		opts.MaxAge = -1
+		m.Token.SetToken(w, m.tokenName(name), "", &opts)
+		return nil
+	}
+
+	unlock := lockValues(r, session)
+	values := session.Values
+	session.Values = destroyedValues(values)
+	session.Options.MaxAge = -1
+	if delegate := m.delegateStore(); delegate != nil {
+		err = delegate.Save(r, w, session)
+	} else {
+		err = m.save(r, w, session)
+	}
+	// The hooks see the values the session had before it was destroyed.
+	session.Values = values
+	unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, hook := range m.DestroyHooks {
+		hook(r, session)
+	}
+	return m.carryOverDestroyed(r, w, name, values)
+}
+
+// destroyedValues returns the values a session keeps while Destroy deletes
+// it: only its principal, which EventDestroyed reports.
+func destroyedValues(values map[interface{}]interface{}) map[interface{}]interface{} {
+	destroyed := make(map[interface{}]interface{})
+	if principal := storedPrincipal(values); principal != "" {
+		destroyed[principalKey] = principal
+	}
+	return destroyed
+}
+
+// Refresh saves the session with the given name unchanged, extending the
+// lifetime of the stored session and of its cookie. It does nothing for a
+// request without a stored session.
+func (m *MongoDBStore) Refresh(r *http.Request, w http.ResponseWriter, name string) error {
+	session, err := m.Get(r, name)
+	if err != nil {
+		return err
+	}
+	if session.IsNew {
+		return nil
+	}
+	return m.Save(r, w, session)
+}
@@ -0,0 +1,34 @@
+package mongodbstore
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDestroyWithoutSession(t *testing.T) {
+	store := newOfflineStore(t)
+	req := httptest.NewRequest("GET", "http://localhost:8080/", nil)
+	rsp := httptest.NewRecorder()
+
+	if err := store.Destroy(req, rsp, "session-key"); err != nil {
+		t.Fatalf("Error destroying session: %v", err)
+	}
+	cookies := rsp.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "session-key" || cookies[0].MaxAge >= 0 {
+		t.Errorf("Expected expired session cookie; Got %v", cookies)
+	}
+
+	if err := store.Refresh(req, httptest.NewRecorder(), "session-key"); err != nil {
+		t.Errorf("Expected refresh of a missing session to do nothing; Got %v", err)
+	}
+}
+
+func TestDestroyedValues(t *testing.T) {
+	values := destroyedValues(map[interface{}]interface{}{principalKey: "alice", "cart": 3})
+	if len(values) != 1 || storedPrincipal(values) != "alice" {
+		t.Errorf("Expected only the principal to be kept; Got %v", values)
+	}
+	if values := destroyedValues(map[interface{}]interface{}{"cart": 3}); len(values) != 0 {
+		t.Errorf("Expected no values without a principal; Got %v", values)
+	}
+}
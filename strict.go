@@ -0,0 +1,48 @@
+package mongodbstore
+
+import (
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MinKeyLength is the minimum length of the hash keys accepted by
+// NewMongoDBStoreStrict, the length of keys generated by
+// securecookie.GenerateRandomKey(32).
+const MinKeyLength = 32
+
+// ErrWeakKeys is returned by NewMongoDBStoreStrict when the key pairs would
+// leave cookies unsigned or signed with guessable keys.
+var ErrWeakKeys = errors.New("mongodbstore: missing or weak keys")
+
+// NewMongoDBStoreStrict is like NewMongoDBStore but refuses weak keys: it
+// returns an error wrapping ErrWeakKeys when no key pairs are given, when a
+// hash key is shorter than MinKeyLength or when a block key is not a valid
+// AES-128, AES-192 or AES-256 key.
+func NewMongoDBStoreStrict(c *mongo.Collection, maxAge int, ensureTTL bool, keyPairs ...[]byte) (*MongoDBStore, error) {
+	if err := checkKeyPairs(keyPairs); err != nil {
+		return nil, err
+	}
+	return NewMongoDBStore(c, maxAge, ensureTTL, keyPairs...), nil
+}
+
+// checkKeyPairs returns an error wrapping ErrWeakKeys for weak key pairs.
+func checkKeyPairs(keyPairs [][]byte) error {
+	if len(keyPairs) == 0 {
+		return fmt.Errorf("%w: no key pairs", ErrWeakKeys)
+	}
+	for i := 0; i < len(keyPairs); i += 2 {
+		if n := len(keyPairs[i]); n < MinKeyLength {
+			return fmt.Errorf("%w: hash key %d is %d bytes long, want at least %d", ErrWeakKeys, i/2, n, MinKeyLength)
+		}
+		if i+1 < len(keyPairs) && keyPairs[i+1] != nil {
+			switch n := len(keyPairs[i+1]); n {
+			case 16, 24, 32:
+			default:
+				return fmt.Errorf("%w: block key %d is %d bytes long, want 16, 24 or 32", ErrWeakKeys, i/2, n)
+			}
+		}
+	}
+	return nil
+}
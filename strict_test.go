@@ -0,0 +1,33 @@
+package mongodbstore
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestCheckKeyPairs(t *testing.T) {
+	key := bytes.Repeat([]byte("k"), 32)
+	tests := []struct {
+		keyPairs [][]byte
+		ok       bool
+	}{
+		{nil, false},
+		{[][]byte{{}}, false},
+		{[][]byte{[]byte("secret-key")}, false},
+		{[][]byte{key}, true},
+		{[][]byte{key, nil}, true},
+		{[][]byte{key, key[:16]}, true},
+		{[][]byte{key, key[:20]}, false},
+		{[][]byte{key, key[:16], []byte("old")}, false},
+	}
+	for i, tt := range tests {
+		err := checkKeyPairs(tt.keyPairs)
+		if tt.ok && err != nil {
+			t.Errorf("%d: Expected keys to be accepted; Got %v", i, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrWeakKeys) {
+			t.Errorf("%d: Expected ErrWeakKeys; Got %v", i, err)
+		}
+	}
+}
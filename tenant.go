@@ -0,0 +1,158 @@
+package mongodbstore
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// tenantKey holds the tenant of the request that created or loaded the
+// session.
+const tenantKey transientKey = "tenant"
+
+// ErrUnknownTenant is returned by TenantKeys for tenants without keys, such
+// as tenants whose keys were revoked.
+var ErrUnknownTenant = errors.New("mongodbstore: unknown tenant")
+
+// errOtherTenant is returned by load for a document of another tenant.
+var errOtherTenant = errors.New("mongodbstore: session of another tenant")
+
+// TenantFunc returns the tenant of a request, for example from its host name.
+// Setting the Tenant of the store turns on multi-tenant mode.
+type TenantFunc func(r *http.Request) string
+
+// TenantKeyProvider returns the codecs encoding the session data of a
+// tenant. Removing the keys of a tenant revokes all its sessions: their
+// data can't be decoded anymore.
+type TenantKeyProvider interface {
+	TenantCodecs(tenant string) ([]securecookie.Codec, error)
+}
+
+// TenantKeys is a TenantKeyProvider with the codecs of each tenant.
+type TenantKeys map[string][]securecookie.Codec
+
+// TenantCodecs returns the codecs of the tenant, or ErrUnknownTenant.
+func (k TenantKeys) TenantCodecs(tenant string) ([]securecookie.Codec, error) {
+	codecs, ok := k[tenant]
+	if !ok || len(codecs) == 0 {
+		return nil, ErrUnknownTenant
+	}
+	return codecs, nil
+}
+
+// SessionTenant returns the tenant the session belongs to in multi-tenant
+// mode.
+func SessionTenant(session *sessions.Session) string {
+	tenant, _ := session.Values[tenantKey].(string)
+	return tenant
+}
+
+// sessionEncoders returns the codecs encoding the stored data of the session:
+// those of its tenant if the TenantKeys know it, the dataEncoders otherwise.
+func (m *MongoDBStore) sessionEncoders(session *sessions.Session) ([]securecookie.Codec, error) {
+	return m.tenantEncoders(SessionTenant(session), session.Name())
+}
+
+// tenantEncoders returns the codecs encoding the stored data of the sessions
+// of the tenant under name.
+func (m *MongoDBStore) tenantEncoders(tenant, name string) ([]securecookie.Codec, error) {
+	if tenant != "" && m.TenantKeys != nil {
+		return m.TenantKeys.TenantCodecs(tenant)
+	}
+	return m.dataEncoders(name), nil
+}
+
+// sessionDecoders returns the codecs decoding the stored data of the
+// session, without MaxAge like the dataDecoders.
+func (m *MongoDBStore) sessionDecoders(session *sessions.Session) ([]securecookie.Codec, error) {
+	if tenant := SessionTenant(session); tenant != "" && m.TenantKeys != nil {
+		codecs, err := m.TenantKeys.TenantCodecs(tenant)
+		if err != nil {
+			return nil, err
+		}
+		return withoutMaxAge(codecs), nil
+	}
+	return m.dataDecoders(session.Name()), nil
+}
+
+// ErrTenantRequired is returned by the admin operations of the store in
+// multi-tenant mode, which are only available through ForTenant.
+var ErrTenantRequired = errors.New("mongodbstore: tenant required in multi-tenant mode")
+
+// TenantSessions are the admin operations of the store restricted to the
+// sessions of one tenant, so that the operators of a tenant can't touch the
+// sessions of another.
+type TenantSessions struct {
+	store  *MongoDBStore
+	tenant string
+}
+
+// ForTenant returns the admin operations restricted to the tenant.
+func (m *MongoDBStore) ForTenant(tenant string) *TenantSessions {
+	return &TenantSessions{store: m, tenant: tenant}
+}
+
+// scope returns a copy of the filter restricted to the tenant.
+func (t *TenantSessions) scope(filter bson.M) bson.M {
+	scoped := bson.M{"tenant": t.tenant}
+	for k, v := range filter {
+		if k != "tenant" {
+			scoped[k] = v
+		}
+	}
+	return scoped
+}
+
+// DeleteWhere is MongoDBStore.DeleteWhere for the sessions of the tenant. A
+// tenant in the filter is ignored.
+func (t *TenantSessions) DeleteWhere(ctx context.Context, filter bson.M) (int64, error) {
+	return t.store.revoke(ctx, t.scope(filter), "")
+}
+
+// DeleteModifiedBefore deletes the sessions of the tenant last modified
+// before tm.
+func (t *TenantSessions) DeleteModifiedBefore(ctx context.Context, tm time.Time) (int64, error) {
+	return t.DeleteWhere(ctx, bson.M{"modified": bson.M{"$lt": tm}})
+}
+
+// DeleteByPrincipal deletes the sessions of the tenant tagged with the
+// principal.
+func (t *TenantSessions) DeleteByPrincipal(ctx context.Context, principal string) (int64, error) {
+	return t.store.revoke(ctx, t.scope(bson.M{"principal": t.store.principalID(principal)}), principal)
+}
+
+// InvalidateOlderThanCredentialChange deletes the sessions of the tenant
+// tagged with the principal that were created before changedAt.
+func (t *TenantSessions) InvalidateOlderThanCredentialChange(ctx context.Context, principal string, changedAt time.Time) (int64, error) {
+	return t.store.revoke(ctx, t.scope(t.store.credentialChangeFilter(principal, changedAt)), principal)
+}
+
+// DeleteByLabel deletes the sessions of the tenant carrying the label.
+func (t *TenantSessions) DeleteByLabel(ctx context.Context, key, value string) (int64, error) {
+	return t.DeleteWhere(ctx, labelFilter(key, value))
+}
+
+// InvalidateAll deletes every session of the tenant except pinned ones. confirm
+// must be ConfirmInvalidateAll.
+func (t *TenantSessions) InvalidateAll(ctx context.Context, confirm string) (int64, error) {
+	if confirm != ConfirmInvalidateAll {
+		return 0, ErrNotConfirmed
+	}
+	return t.DeleteWhere(ctx, unpinnedFilter())
+}
+
+// FindByLabel returns the sessions of the tenant carrying the label.
+func (t *TenantSessions) FindByLabel(ctx context.Context, key, value string) ([]Session, error) {
+	return t.store.findByLabel(ctx, key, value, &t.tenant)
+}
+
+// FindImpersonations returns the sessions of the tenant impersonated by the
+// principal.
+func (t *TenantSessions) FindImpersonations(ctx context.Context, principal string) ([]Session, error) {
+	return t.store.findImpersonations(ctx, principal, &t.tenant)
+}
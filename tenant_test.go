@@ -0,0 +1,104 @@
+package mongodbstore
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestTenantIsolation(t *testing.T) {
+	store := newOfflineStore(t)
+	store.CacheTTL = time.Minute
+	store.Tenant = func(r *http.Request) string { return r.Host }
+	keys := TenantKeys{
+		"a.example.com": securecookie.CodecsFromPairs([]byte("tenant-a-hash-key-0123456789abcd")),
+		"b.example.com": securecookie.CodecsFromPairs([]byte("tenant-b-hash-key-0123456789abcd")),
+	}
+	store.TenantKeys = keys
+
+	req := httptest.NewRequest("GET", "http://a.example.com/", nil)
+	session, err := store.New(req, "session-key")
+	if err != nil {
+		t.Fatalf("Error creating session: %v", err)
+	}
+	session.Values["foo"] = "bar"
+	session.ID = primitive.NewObjectID().Hex()
+	doc, err := store.document(session)
+	if err != nil {
+		t.Fatalf("Error encoding session: %v", err)
+	}
+	if doc.Tenant != "a.example.com" {
+		t.Errorf("Expected tenant a.example.com; Got %q", doc.Tenant)
+	}
+	var values map[interface{}]interface{}
+	if securecookie.DecodeMulti("session-key", doc.Data, &values, store.Codecs...) == nil {
+		t.Error("Expected data not decodable with the store codecs")
+	}
+	store.cacheDoc(doc)
+
+	token, _ := securecookie.EncodeMulti("session-key", doc.ID.Hex(), store.Codecs...)
+	load := func(host string) *http.Request {
+		req := httptest.NewRequest("GET", "http://"+host+"/", nil)
+		req.Header.Set("Cookie", "session-key="+token)
+		return req
+	}
+
+	session, err = store.New(load("a.example.com"), "session-key")
+	if err != nil || session.IsNew || session.Values["foo"] != "bar" {
+		t.Fatalf("Expected the session of tenant a; Got %v, new=%t, %v", session.Values, session.IsNew, err)
+	}
+
+	session, err = store.New(load("b.example.com"), "session-key")
+	if err != nil || !session.IsNew || session.ID != "" || len(persistentValues(session)) != 0 {
+		t.Errorf("Expected a new session for tenant b; Got id %q, %v, %v", session.ID, session.Values, err)
+	}
+
+	delete(keys, "a.example.com")
+	session, err = store.New(load("a.example.com"), "session-key")
+	if err != nil {
+		t.Fatalf("Error loading session: %v", err)
+	}
+	if got := LoadError(session); !errors.Is(got, ErrUnknownTenant) {
+		t.Errorf("Expected ErrUnknownTenant after revoking the keys; Got %v", got)
+	}
+}
+
+func TestTenantRequired(t *testing.T) {
+	store := newOfflineStore(t)
+	store.Tenant = func(r *http.Request) string { return r.Host }
+	ctx := context.Background()
+
+	if _, err := store.DeleteWhere(ctx, bson.M{}); err != ErrTenantRequired {
+		t.Errorf("DeleteWhere: Expected ErrTenantRequired; Got %v", err)
+	}
+	if _, err := store.DeleteByPrincipal(ctx, "alice"); err != ErrTenantRequired {
+		t.Errorf("DeleteByPrincipal: Expected ErrTenantRequired; Got %v", err)
+	}
+	if _, err := store.InvalidateOlderThanCredentialChange(ctx, "alice", time.Now()); err != ErrTenantRequired {
+		t.Errorf("InvalidateOlderThanCredentialChange: Expected ErrTenantRequired; Got %v", err)
+	}
+	if _, err := store.InvalidateAll(ctx, ConfirmInvalidateAll); err != ErrTenantRequired {
+		t.Errorf("InvalidateAll: Expected ErrTenantRequired; Got %v", err)
+	}
+	if _, err := store.FindByLabel(ctx, "role", "admin"); err != ErrTenantRequired {
+		t.Errorf("FindByLabel: Expected ErrTenantRequired; Got %v", err)
+	}
+	if _, err := store.FindImpersonations(ctx, "alice"); err != ErrTenantRequired {
+		t.Errorf("FindImpersonations: Expected ErrTenantRequired; Got %v", err)
+	}
+
+	scoped := store.ForTenant("a").scope(bson.M{"tenant": "b", "principal": "alice"})
+	if scoped["tenant"] != "a" || scoped["principal"] != "alice" {
+		t.Errorf("Expected the filter restricted to tenant a; Got %v", scoped)
+	}
+	if _, err := store.ForTenant("a").InvalidateAll(ctx, "no"); err != ErrNotConfirmed {
+		t.Errorf("Expected ErrNotConfirmed; Got %v", err)
+	}
+}
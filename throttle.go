@@ -0,0 +1,235 @@
+package mongodbstore
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/x/bsonx"
+)
+
+// errNoLoginThrottle is returned when the LoginThrottle is not set.
+var errNoLoginThrottle = errors.New("mongodbstore: no login throttle")
+
+// LoginThrottle is the configuration of the brute-force protection of
+// RecordFailedLogin and IsLockedOut. Failed logins are counted per principal
+// and per client address in their own collection; once either count reaches
+// Threshold, logins are locked out for BaseLockout, doubling with each
+// further failure up to MaxLockout.
+type LoginThrottle struct {
+	// Collection holds the failure counts. EnsureIndexes creates its TTL
+	// index.
+	Collection *mongo.Collection
+	// Threshold is the number of failures allowed before a lockout, 5 by
+	// default.
+	Threshold int
+	// Window is how long failures are counted after the last one, 15
+	// minutes by default.
+	Window time.Duration
+	// BaseLockout is the first lockout, a minute by default, and MaxLockout
+	// the longest, an hour by default.
+	BaseLockout time.Duration
+	MaxLockout  time.Duration
+}
+
+// loginFailures is the document counting the failed logins of a principal or
+// an address.
+type loginFailures struct {
+	Key         string    `bson:"_id"`
+	Failures    int       `bson:"failures"`
+	LockedUntil time.Time `bson:"lockedUntil,omitempty"`
+	Expires     time.Time `bson:"expires"`
+}
+
+// RecordFailedLogin counts a failed login of the principal from the address,
+// either of which may be empty, and returns until when further logins are
+// locked out, or the zero time. Principals are keyed like in session
+// documents, with their HMAC if PrincipalKey is set, and addresses by their
+// HMAC with IPHashKey.
+func (m *MongoDBStore) RecordFailedLogin(ctx context.Context, principal string, ip net.IP) (time.Time, error) {
+	lt := m.LoginThrottle
+	if lt == nil {
+		return time.Time{}, errNoLoginThrottle
+	}
+	now := time.Now()
+	var until time.Time
+	for _, key := range m.throttleKeys(principal, ip) {
+		locked, err := m.recordFailure(ctx, lt, key, now)
+		if err != nil {
+			return time.Time{}, m.opError("record failed login", err)
+		}
+		if locked.After(until) {
+			until = locked
+		}
+	}
+	return until, nil
+}
+
+// IsLockedOut reports whether logins of the principal or from the address are
+// locked out, and until when.
+func (m *MongoDBStore) IsLockedOut(ctx context.Context, principal string, ip net.IP) (bool, time.Time, error) {
+	lt := m.LoginThrottle
+	if lt == nil {
+		return false, time.Time{}, errNoLoginThrottle
+	}
+	keys := m.throttleKeys(principal, ip)
+	if len(keys) == 0 {
+		return false, time.Time{}, nil
+	}
+
+	now := time.Now()
+	filter := bson.D{
+		{Key: "_id", Value: bson.D{{Key: "$in", Value: keys}}},
+		{Key: "lockedUntil", Value: bson.D{{Key: "$gt", Value: now}}},
+	}
+	var until time.Time
+	err := m.observe(ctx, "find", filter, func(ctx context.Context) (string, error) {
+		cur, err := lt.Collection.Find(ctx, filter)
+		if err != nil {
+			return "", err
+		}
+		defer cur.Close(ctx)
+		for cur.Next(ctx) {
+			var doc loginFailures
+			if err := cur.Decode(&doc); err != nil {
+				return "", err
+			}
+			if doc.LockedUntil.After(until) {
+				until = doc.LockedUntil
+			}
+		}
+		return "", cur.Err()
+	})
+	if err != nil {
+		return false, time.Time{}, m.opError("check login lockout", err)
+	}
+	return !until.IsZero(), until, nil
+}
+
+// ResetFailedLogins forgets the failed logins of the principal, after a
+// successful login. The failures of addresses are kept, since an address
+// guessing the passwords of many principals may also succeed once.
+func (m *MongoDBStore) ResetFailedLogins(ctx context.Context, principal string) error {
+	lt := m.LoginThrottle
+	if lt == nil {
+		return errNoLoginThrottle
+	}
+	if principal == "" {
+		return nil
+	}
+	filter := bson.D{{Key: "_id", Value: "principal:" + m.principalID(principal)}}
+	err := m.observe(ctx, "deleteOne", filter, func(ctx context.Context) (string, error) {
+		_, err := lt.Collection.DeleteOne(ctx, filter)
+		return "", err
+	})
+	return m.opError("reset failed logins", err)
+}
+
+// throttleKeys returns the keys of the failure counts of the principal and
+// the address.
+func (m *MongoDBStore) throttleKeys(principal string, ip net.IP) []string {
+	var keys []string
+	if principal != "" {
+		keys = append(keys, "principal:"+m.principalID(principal))
+	}
+	if ip != nil {
+		keys = append(keys, "ip:"+m.ipHash(ip))
+	}
+	return keys
+}
+
+// recordFailure counts a failure on the key and locks it out once the count
+// reaches the threshold. It returns the end of the lockout, if any.
+func (m *MongoDBStore) recordFailure(ctx context.Context, lt *LoginThrottle, key string, now time.Time) (time.Time, error) {
+	// Counts past their window are reset, whether or not the TTL index
+	// removed them yet.
+	stale := bson.D{{Key: "_id", Value: key}, {Key: "expires", Value: bson.D{{Key: "$lte", Value: now}}}}
+	err := m.observe(ctx, "deleteOne", stale, func(ctx context.Context) (string, error) {
+		_, err := lt.Collection.DeleteOne(ctx, stale)
+		return "", err
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	filter := bson.D{{Key: "_id", Value: key}}
+	update := bson.D{
+		{Key: "$inc", Value: bson.D{{Key: "failures", Value: 1}}},
+		{Key: "$max", Value: bson.D{{Key: "expires", Value: now.Add(lt.window())}}},
+	}
+	var doc loginFailures
+	err = m.observe(ctx, "findOneAndUpdate", filter, func(ctx context.Context) (string, error) {
+		return "", lt.Collection.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().
+			SetUpsert(true).
+			SetReturnDocument(options.After)).Decode(&doc)
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	lockout := lt.lockout(doc.Failures)
+	if lockout <= 0 {
+		return time.Time{}, nil
+	}
+	until := now.Add(lockout)
+	update = bson.D{{Key: "$max", Value: bson.D{
+		{Key: "lockedUntil", Value: until},
+		{Key: "expires", Value: until},
+	}}}
+	err = m.observe(ctx, "updateOne", filter, func(ctx context.Context) (string, error) {
+		_, err := lt.Collection.UpdateOne(ctx, filter, update)
+		return "", err
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	return until, nil
+}
+
+func (lt *LoginThrottle) window() time.Duration {
+	if lt.Window <= 0 {
+		return 15 * time.Minute
+	}
+	return lt.Window
+}
+
+// lockout returns the lockout after the given number of failures, or 0 below
+// the threshold.
+func (lt *LoginThrottle) lockout(failures int) time.Duration {
+	threshold := lt.Threshold
+	if threshold <= 0 {
+		threshold = 5
+	}
+	if failures < threshold {
+		return 0
+	}
+	lockout := lt.BaseLockout
+	if lockout <= 0 {
+		lockout = time.Minute
+	}
+	max := lt.MaxLockout
+	if max <= 0 {
+		max = time.Hour
+	}
+	for i := threshold; i < failures && lockout < max; i++ {
+		lockout *= 2
+	}
+	if lockout > max {
+		lockout = max
+	}
+	return lockout
+}
+
+func loginThrottleIndexes() []mongo.IndexModel {
+	return []mongo.IndexModel{{
+		Keys: bsonx.Doc{{Key: "expires", Value: bsonx.Int32(1)}},
+		Options: &options.IndexOptions{
+			Background:         newBool(true),
+			ExpireAfterSeconds: newInt32(0),
+		},
+	}}
+}
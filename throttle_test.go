@@ -0,0 +1,46 @@
+package mongodbstore
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoginThrottleLockout(t *testing.T) {
+	lt := &LoginThrottle{Threshold: 3, BaseLockout: time.Minute, MaxLockout: 5 * time.Minute}
+	for failures, want := range []time.Duration{0, 0, 0, time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute} {
+		if got := lt.lockout(failures); got != want {
+			t.Errorf("%d failures: Expected lockout %v; Got %v", failures, want, got)
+		}
+	}
+
+	defaults := &LoginThrottle{}
+	if got := defaults.lockout(4); got != 0 {
+		t.Errorf("Expected no lockout below the default threshold; Got %v", got)
+	}
+	if got := defaults.lockout(100); got != time.Hour {
+		t.Errorf("Expected the default maximum lockout; Got %v", got)
+	}
+}
+
+func TestThrottleKeys(t *testing.T) {
+	store := newOfflineStore(t)
+	store.PrincipalKey = []byte("principal-key")
+
+	keys := store.throttleKeys("alice", net.ParseIP("192.0.2.1"))
+	if len(keys) != 2 || !strings.HasPrefix(keys[0], "principal:") || !strings.HasPrefix(keys[1], "ip:") {
+		t.Fatalf("Expected a principal and an address key; Got %v", keys)
+	}
+	if strings.Contains(keys[0], "alice") || strings.Contains(keys[1], "192.0.2.1") {
+		t.Errorf("Expected hashed keys; Got %v", keys)
+	}
+	if keys := store.throttleKeys("", nil); len(keys) != 0 {
+		t.Errorf("Expected no keys; Got %v", keys)
+	}
+
+	if _, err := store.RecordFailedLogin(context.Background(), "alice", nil); err == nil {
+		t.Error("Expected an error without a LoginThrottle")
+	}
+}
@@ -2,6 +2,8 @@ package mongodbstore
 
 import (
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/gorilla/sessions"
 )
@@ -11,18 +13,121 @@ type TokenGetSetter interface {
 	SetToken(rw http.ResponseWriter, name, value string, options *sessions.Options)
 }
 
-type CookieToken struct{}
+// CookieToken carries tokens in cookies.
+type CookieToken struct {
+	// MaxSize, if positive, is the longest value of a cookie. Longer tokens
+	// are split across the cookies name.0, name.1, … which are reassembled
+	// when read, for proxies capping cookie sizes below the 4KB of browsers.
+	MaxSize int
+}
+
+// maxCookieChunks is the number of chunk cookies expired when a token is set
+// without knowing how many chunks the client holds.
+const maxCookieChunks = 10
+
+// tokenChunksKey holds the number of chunk cookies the client of a session
+// holds, for CookieToken with a MaxSize.
+const tokenChunksKey transientKey = "tokenChunks"
 
 func (c *CookieToken) GetToken(req *http.Request, name string) (string, error) {
 	cook, err := req.Cookie(name)
-	if err != nil {
+	if err == nil {
+		return cook.Value, nil
+	}
+	if c.MaxSize <= 0 {
 		return "", err
 	}
 
-	return cook.Value, nil
+	var value strings.Builder
+	for i := 0; ; i++ {
+		chunk, err := req.Cookie(chunkName(name, i))
+		if err != nil {
+			if i == 0 {
+				return "", err
+			}
+			return value.String(), nil
+		}
+		value.WriteString(chunk.Value)
+	}
 }
 
+// SetToken sets the token cookie. With a MaxSize, the chunk cookies of a
+// previous token the client may hold are expired, up to maxCookieChunks of
+// them.
 func (c *CookieToken) SetToken(rw http.ResponseWriter, name, value string,
 	options *sessions.Options) {
-	http.SetCookie(rw, sessions.NewCookie(name, value, options))
+	c.setToken(rw, name, value, options, -1)
+}
+
+// setToken sets the token cookie of a client holding the given number of
+// chunk cookies, which are expired unless the token overwrites them. When
+// the number is unknown, -1, maxCookieChunks chunks are expired, and at least
+// the one following the new chunks, which ends the reassembly of any longer
+// token. It returns the number of chunk cookies written.
+func (c *CookieToken) setToken(rw http.ResponseWriter, name, value string,
+	options *sessions.Options, chunks int) int {
+	if c.MaxSize <= 0 {
+		http.SetCookie(rw, sessions.NewCookie(name, value, options))
+		return 0
+	}
+
+	expired := *options
+	expired.MaxAge = -1
+	stale := chunks
+	if stale < 0 {
+		stale = maxCookieChunks
+	}
+	if len(value) <= c.MaxSize {
+		// The chunks of a previous, longer token are expired rather than
+		// left behind in the browser.
+		http.SetCookie(rw, sessions.NewCookie(name, value, options))
+		for i := 0; i < stale; i++ {
+			http.SetCookie(rw, sessions.NewCookie(chunkName(name, i), "", &expired))
+		}
+		return 0
+	}
+
+	http.SetCookie(rw, sessions.NewCookie(name, "", &expired))
+	n := 0
+	for ; len(value) > 0; n++ {
+		size := c.MaxSize
+		if size > len(value) {
+			size = len(value)
+		}
+		http.SetCookie(rw, sessions.NewCookie(chunkName(name, n), value[:size], options))
+		value = value[size:]
+	}
+	// Stale chunks of a previous, longer token are expired.
+	if chunks < 0 && stale <= n {
+		stale = n + 1
+	}
+	for i := n; i < stale; i++ {
+		http.SetCookie(rw, sessions.NewCookie(chunkName(name, i), "", &expired))
+	}
+	return n
+}
+
+// chunks returns the number of chunk cookies of the token sent with req.
+func (c *CookieToken) chunks(req *http.Request, name string) int {
+	n := 0
+	for {
+		if _, err := req.Cookie(chunkName(name, n)); err != nil {
+			return n
+		}
+		n++
+	}
+}
+
+// chunkName returns the name of the i-th chunk cookie of a token.
+func chunkName(name string, i int) string {
+	return name + "." + strconv.Itoa(i)
+}
+
+// tokenName returns the name of the token of the session name, with the
+// cookie prefix of the security preset.
+func (m *MongoDBStore) tokenName(name string) string {
+	if m.TokenName != nil {
+		name = m.TokenName(name)
+	}
+	return m.tokenPrefix + name
 }
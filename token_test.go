@@ -0,0 +1,163 @@
+package mongodbstore
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestTokenName(t *testing.T) {
+	store := newOfflineStore(t)
+	store.CacheTTL = time.Minute
+	store.TokenName = func(name string) string { return "sid" }
+
+	values := map[interface{}]interface{}{"user": "alice"}
+	data, err := securecookie.EncodeMulti("auth", values, store.Codecs...)
+	if err != nil {
+		t.Fatalf("Error encoding data: %v", err)
+	}
+	id := primitive.NewObjectID()
+	store.cacheDoc(&Session{ID: id, Data: data, Checksum: checksum(data), Modified: time.Now()})
+	token, _ := securecookie.EncodeMulti("auth", id.Hex(), store.Codecs...)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Cookie", "sid="+token)
+	session, err := store.New(req, "auth")
+	if err != nil {
+		t.Fatalf("Error loading session: %v", err)
+	}
+	if session.IsNew || session.Values["user"] != "alice" {
+		t.Errorf("Expected the session of the sid cookie; Got %v", session.Values)
+	}
+
+	// The session name is not accepted as the cookie name.
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Cookie", "auth="+token)
+	if session, _ := store.New(req, "auth"); !session.IsNew {
+		t.Error("Expected a new session for the auth cookie")
+	}
+
+	w := httptest.NewRecorder()
+	if err := store.Destroy(httptest.NewRequest("GET", "/", nil), w, "auth"); err != nil {
+		t.Fatalf("Error destroying session: %v", err)
+	}
+	if cookie := w.Header().Get("Set-Cookie"); !strings.HasPrefix(cookie, "sid=;") {
+		t.Errorf("Expected the sid cookie expired; Got %q", cookie)
+	}
+}
+
+func TestCookieTokenChunks(t *testing.T) {
+	token := &CookieToken{MaxSize: 4}
+	opts := &sessions.Options{Path: "/"}
+
+	get := func(w *httptest.ResponseRecorder) (string, error) {
+		r := httptest.NewRequest("GET", "/", nil)
+		for _, c := range w.Result().Cookies() {
+			if c.MaxAge >= 0 {
+				r.AddCookie(c)
+			}
+		}
+		return token.GetToken(r, "sid")
+	}
+
+	w := httptest.NewRecorder()
+	token.SetToken(w, "sid", "0123456789", opts)
+	var names []string
+	for _, c := range w.Result().Cookies() {
+		if c.MaxAge >= 0 {
+			names = append(names, c.Name)
+		}
+	}
+	if strings.Join(names, ",") != "sid.0,sid.1,sid.2" {
+		t.Errorf("Expected 3 chunks; Got %v", names)
+	}
+	if value, err := get(w); err != nil || value != "0123456789" {
+		t.Errorf("Expected the reassembled token; Got %q, %v", value, err)
+	}
+
+	// A shorter token expires the stale chunks.
+	w = httptest.NewRecorder()
+	token.SetToken(w, "sid", "abcdef", opts)
+	expired := map[string]bool{}
+	for _, c := range w.Result().Cookies() {
+		expired[c.Name] = c.MaxAge < 0
+	}
+	if !expired["sid"] || expired["sid.1"] || !expired["sid.2"] || !expired["sid.9"] {
+		t.Errorf("Expected sid and sid.2 onwards expired; Got %v", expired)
+	}
+	if value, err := get(w); err != nil || value != "abcdef" {
+		t.Errorf("Expected the reassembled token; Got %q, %v", value, err)
+	}
+
+	// A token fitting a cookie is not chunked.
+	w = httptest.NewRecorder()
+	token.SetToken(w, "sid", "abc", opts)
+	expired = map[string]bool{}
+	for _, c := range w.Result().Cookies() {
+		expired[c.Name] = c.MaxAge < 0
+	}
+	if expired["sid"] || !expired["sid.0"] || !expired["sid.1"] || !expired["sid.9"] {
+		t.Errorf("Expected every chunk expired; Got %v", expired)
+	}
+	if value, err := get(w); err != nil || value != "abc" {
+		t.Errorf("Expected the token; Got %q, %v", value, err)
+	}
+
+	if _, err := token.GetToken(httptest.NewRequest("GET", "/", nil), "sid"); err == nil {
+		t.Error("Expected an error without cookies")
+	}
+}
+
+func TestCookieTokenRequestChunks(t *testing.T) {
+	store := newOfflineStore(t)
+	store.Token = &CookieToken{MaxSize: 4}
+
+	names := func(w *httptest.ResponseRecorder) string {
+		var names []string
+		for _, c := range w.Result().Cookies() {
+			names = append(names, c.Name)
+		}
+		return strings.Join(names, ",")
+	}
+
+	// A client without chunks gets no expired chunk cookies.
+	session, err := store.New(httptest.NewRequest("GET", "/", nil), "sid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	store.setToken(w, session, "abc")
+	if got := names(w); got != "sid" {
+		t.Errorf("Expected only the token cookie; Got %v", got)
+	}
+
+	// The chunks written are expired when the token shrinks.
+	w = httptest.NewRecorder()
+	store.setToken(w, session, "0123456789")
+	if got := names(w); got != "sid,sid.0,sid.1,sid.2" {
+		t.Errorf("Expected 3 chunks; Got %v", got)
+	}
+	w = httptest.NewRecorder()
+	store.setToken(w, session, "abc")
+	if got := names(w); got != "sid,sid.0,sid.1,sid.2" {
+		t.Errorf("Expected the 3 chunks expired; Got %v", got)
+	}
+
+	// The chunks sent by the client are expired.
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: "sid.0", Value: "0123"})
+	r.AddCookie(&http.Cookie{Name: "sid.1", Value: "45"})
+	// The reassembled token is invalid; a new session replaces it.
+	session, _ = store.New(r, "sid")
+	w = httptest.NewRecorder()
+	store.setToken(w, session, "")
+	if got := names(w); got != "sid,sid.0,sid.1" {
+		t.Errorf("Expected the chunks of the client expired; Got %v", got)
+	}
+}
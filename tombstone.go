@@ -0,0 +1,55 @@
+package mongodbstore
+
+import (
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrSessionRevoked is returned when saving a session that was deleted while
+// a tombstone of it is kept, for example by a request from another browser
+// tab racing a logout.
+var ErrSessionRevoked = errors.New("mongodbstore: session revoked")
+
+// tombstoneFields are the fields removed from a document when it is replaced
+// by a tombstone.
+var tombstoneFields = []string{"data", "checksum", "values", "labels", "principal", "impersonatedBy", "impersonating",
+	"absoluteExpires", "expires", "lastAccessed", "lock", "fiber"}
+
+// tombstoneUpdate returns the update replacing a document by a tombstone that
+// the TTL index on idleExpires removes after TombstoneTTL.
+func (m *MongoDBStore) tombstoneUpdate(now time.Time) bson.D {
+	unset := make(bson.D, 0, len(tombstoneFields))
+	for _, field := range tombstoneFields {
+		unset = append(unset, bson.E{Key: field, Value: ""})
+	}
+	return bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "revoked", Value: true},
+			{Key: "modified", Value: now},
+			{Key: "idleExpires", Value: now.Add(m.TombstoneTTL)},
+		}},
+		{Key: "$unset", Value: unset},
+	}
+}
+
+// liveFilter returns the filter matching the document with the id unless it
+// is a tombstone.
+func (m *MongoDBStore) liveFilter(id primitive.ObjectID) bson.D {
+	filter := bson.D{{Key: "_id", Value: id}}
+	if m.TombstoneTTL > 0 {
+		filter = append(filter, bson.E{Key: "revoked", Value: bson.D{{Key: "$ne", Value: true}}})
+	}
+	return filter
+}
+
+// revokedError maps the duplicate key error of an upsert colliding with a
+// tombstone to ErrSessionRevoked.
+func (m *MongoDBStore) revokedError(err error) error {
+	if m.TombstoneTTL > 0 && isDuplicateKey(err) {
+		return ErrSessionRevoked
+	}
+	return err
+}
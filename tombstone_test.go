@@ -0,0 +1,52 @@
+package mongodbstore
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestTombstone(t *testing.T) {
+	store := newOfflineStore(t)
+	dup := mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000}}}
+	if err := store.revokedError(dup); !isDuplicateKey(err) {
+		t.Errorf("Expected duplicate key error without tombstones; Got %v", err)
+	}
+	if len(store.liveFilter(primitive.NewObjectID())) != 1 {
+		t.Errorf("Expected plain id filter without tombstones")
+	}
+
+	store.TombstoneTTL = time.Minute
+	if err := store.revokedError(dup); err != ErrSessionRevoked {
+		t.Errorf("Expected ErrSessionRevoked; Got %v", err)
+	}
+	if len(store.liveFilter(primitive.NewObjectID())) != 2 {
+		t.Errorf("Expected filter excluding tombstones")
+	}
+	unset := store.tombstoneUpdate(time.Now()).Map()["$unset"].(bson.D).Map()
+	if _, ok := unset["fiber"]; !ok {
+		t.Errorf("Expected tombstones to drop Fiber payloads; Got %v", unset)
+	}
+
+	store.CacheTTL = time.Minute
+	id := primitive.NewObjectID()
+	store.cacheDoc(&Session{ID: id, Revoked: true, IdleExpires: time.Now().Add(time.Minute)})
+	cookie, err := securecookie.EncodeMulti("session-key", id.Hex(), store.Codecs...)
+	if err != nil {
+		t.Fatalf("Error encoding cookie: %v", err)
+	}
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	req.AddCookie(&http.Cookie{Name: "session-key", Value: cookie})
+	session, err := store.New(req, "session-key")
+	if err != nil {
+		t.Fatalf("Expected new session for revoked one; Got %v", err)
+	}
+	if !session.IsNew || session.ID != "" {
+		t.Errorf("Expected new session without the revoked id; Got %q", session.ID)
+	}
+}
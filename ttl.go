@@ -0,0 +1,60 @@
+package mongodbstore
+
+import (
+	"encoding/gob"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// expiriesKey is the session value holding the expiration times of values set
+// with SetWithTTL.
+const expiriesKey = "mongodbstore.expiries"
+
+func init() {
+	gob.Register(map[string]time.Time{})
+}
+
+// SetWithTTL sets a session value that is removed once d has passed, such as
+// a one-time password challenge or a redirect target. Expired values are
+// pruned when the session is loaded and when it is saved. Setting the key
+// again with a plain assignment keeps its expiration time; setting it with
+// SetWithTTL replaces it.
+func SetWithTTL(session *sessions.Session, key string, value interface{}, d time.Duration) {
+	expiries, _ := session.Values[expiriesKey].(map[string]time.Time)
+	if expiries == nil {
+		expiries = make(map[string]time.Time)
+		session.Values[expiriesKey] = expiries
+	}
+	session.Values[key] = value
+	expiries[key] = time.Now().Add(d)
+}
+
+// pruneExpired removes the values whose expiration time has passed, along with
+// expiration times of values that no longer exist. The expiration map is
+// replaced rather than modified, so values shared with a copy of the map
+// stay intact.
+func pruneExpired(values map[interface{}]interface{}, now time.Time) {
+	expiries, _ := values[expiriesKey].(map[string]time.Time)
+	if expiries == nil {
+		return
+	}
+
+	kept := make(map[string]time.Time, len(expiries))
+	for key, expires := range expiries {
+		if _, ok := values[key]; !ok {
+			continue
+		}
+		if !now.Before(expires) {
+			delete(values, key)
+			continue
+		}
+		kept[key] = expires
+	}
+
+	if len(kept) == 0 {
+		delete(values, expiriesKey)
+	} else {
+		values[expiriesKey] = kept
+	}
+}
@@ -0,0 +1,41 @@
+package mongodbstore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+func TestSetWithTTL(t *testing.T) {
+	store := newOfflineStore(t)
+	session := sessions.NewSession(store, "session-key")
+	session.ID = "5cc8b3a2a4d5b6c7d8e9f0a1"
+
+	SetWithTTL(session, "otp", "123456", time.Minute)
+	SetWithTTL(session, "redirect", "/home", time.Hour)
+	session.Values["user"] = "alice"
+
+	pruneExpired(session.Values, time.Now())
+	if session.Values["otp"] != "123456" {
+		t.Errorf("Expected value to survive before its expiration")
+	}
+
+	pruneExpired(session.Values, time.Now().Add(2*time.Minute))
+	if _, ok := session.Values["otp"]; ok {
+		t.Errorf("Expected expired value to be pruned")
+	}
+	if session.Values["redirect"] != "/home" || session.Values["user"] != "alice" {
+		t.Errorf("Expected other values to stay; Got %v", session.Values)
+	}
+
+	delete(session.Values, "redirect")
+	pruneExpired(session.Values, time.Now())
+	if _, ok := session.Values[expiriesKey]; ok {
+		t.Errorf("Expected expiration times to be removed with their values")
+	}
+
+	if _, err := store.document(session); err != nil {
+		t.Errorf("Error encoding session: %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package mongodbstore
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	gcontext "github.com/gorilla/context"
+	"github.com/gorilla/sessions"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// loadedDataKey holds the stored data a session returned by Validate was
+// decoded from, so that Persist can skip unchanged sessions.
+const loadedDataKey transientKey = "loadedData"
+
+// ErrNotFound is returned by Validate and Lock when the session does not exist
+// in MongoDB or has expired.
+var ErrNotFound = errors.New("mongodbstore: session not found")
+
+// Validate decodes a raw session token, as set in the cookie named name, and
+// loads the session it refers to. It serves servers that receive the token
+// outside an *http.Request, for example in a websocket handshake message or
+// in gRPC metadata. The name is needed because tokens are signed with it.
+//
+// Unlike New, Validate fails instead of returning a new session: with the
+// decode error for a malformed token and with ErrNotFound for an unknown or
+// expired session. A session expired less than ExpiryGrace ago is returned
+// stale, as reported by IsStale, and Persist fails with ErrSessionStale until
+// it is revived. A token holding the values of a session the PersistPolicy
+// kept out of MongoDB gives a new session with those values. The returned
+// session is not tracked, so SaveAll does not see it; save it with Persist.
+//
+// Sessions are loaded like New loads them. In multi-tenant mode the Tenant
+// function gets a request carrying ctx and nothing else, so it must find the
+// tenant in the context.
+func (m *MongoDBStore) Validate(ctx context.Context, name, token string) (*sessions.Session, error) {
+	session := m.requestSession(detachedRequest(ctx), name)
+	if m.decodeCookieOnly(session, token) {
+		// The session was never stored, so it stays new.
+		return session, nil
+	}
+
+	if cached, ok := m.negativeLookup("token:" + token); ok {
+		return nil, m.sessionError("decode token of", name, cached)
+	}
+	id, err := m.parseToken(name, token)
+	if err != nil {
+		if len(token) <= MaxTokenLength {
+			m.negativeStore("token:"+token, err)
+		}
+		return nil, m.sessionError("decode token of", name, err)
+	}
+	session.ID = id
+	if _, ok := m.negativeLookup("id:" + session.ID); ok {
+		return nil, m.sessionError("load", name, ErrNotFound)
+	}
+
+	doc, err := m.load(ctx, session, false)
+	if err != nil {
+		if err == mongo.ErrNoDocuments || err == errExpired || err == errOtherTenant {
+			if err != errOtherTenant {
+				m.negativeStore("id:"+session.ID, nil)
+			}
+			err = ErrNotFound
+		}
+		return nil, m.sessionError("load", name, err)
+	}
+	session.IsNew = false
+	session.Values[loadedDataKey] = doc.Data
+	return session, nil
+}
+
+// NewSession returns a new session outside an HTTP request, like New returns
+// for a request without a session token: with a copy of the store Options
+// and, in multi-tenant mode, the tenant Validate would find in ctx. Save it
+// with Persist.
+func (m *MongoDBStore) NewSession(ctx context.Context, name string) *sessions.Session {
+	return m.requestSession(detachedRequest(ctx), name)
+}
+
+// Persist saves the session outside an HTTP request and returns the token to
+// hand back to the client, encoded like the cookie named after the session.
+// The session is saved like Save saves it, under the PersistPolicy, the
+// quotas, the WriteLimiter and the cookie modes, except that write-behind and
+// TouchInterval don't apply. A session obtained from Validate is only written
+// when its values changed. A session with Options.MaxAge < 0 is deleted and
+// the returned token is empty, as it is for a session that skips its cookie.
+func (m *MongoDBStore) Persist(ctx context.Context, session *sessions.Session) (string, error) {
+	if session.Options.MaxAge < 0 && session.ID == "" {
+		return "", nil
+	}
+
+	r := detachedRequest(ctx)
+	defer gcontext.Clear(r)
+	w := &tokenWriter{}
+	data, _ := session.Values[loadedDataKey].(string)
+	if session.Options.MaxAge >= 0 && !session.IsNew && data != "" && !IsStale(session) &&
+		m.persist(r, session) && !m.dirty(&tracked{session: session, data: data}) {
+		if err := m.setCookie(w, session); err != nil {
+			return "", err
+		}
+		return w.token, nil
+	}
+
+	if err := m.save(r, w, session); err != nil {
+		return "", err
+	}
+	return w.token, nil
+}
+
+// detachedRequest returns the request Validate and Persist pass to the
+// functions configured on the store, which only carries ctx.
+func detachedRequest(ctx context.Context) *http.Request {
+	r, _ := http.NewRequestWithContext(ctx, http.MethodGet, "/", nil)
+	return r
+}
+
+// tokenWriter is the response writer Persist saves sessions to. It keeps the
+// session token and discards everything else written to the response.
+type tokenWriter struct {
+	token  string
+	header http.Header
+}
+
+func (w *tokenWriter) Header() http.Header {
+	if w.header == nil {
+		w.header = make(http.Header)
+	}
+	return w.header
+}
+
+func (w *tokenWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (w *tokenWriter) WriteHeader(int) {}
@@ -0,0 +1,104 @@
+package mongodbstore
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestValidate(t *testing.T) {
+	store := newOfflineStore(t)
+	store.CacheTTL = time.Minute
+
+	if _, err := store.Validate(context.Background(), "session-key", "junk"); err == nil {
+		t.Errorf("Expected error for junk token")
+	}
+
+	id := primitive.NewObjectID()
+	data, err := securecookie.EncodeMulti("session-key", map[interface{}]interface{}{"foo": "bar"}, store.Codecs...)
+	if err != nil {
+		t.Fatalf("Error encoding data: %v", err)
+	}
+	store.cacheDoc(&Session{ID: id, Data: data, IdleExpires: time.Now().Add(time.Hour)})
+	token, err := securecookie.EncodeMulti("session-key", id.Hex(), store.Codecs...)
+	if err != nil {
+		t.Fatalf("Error encoding token: %v", err)
+	}
+
+	session, err := store.Validate(context.Background(), "session-key", token)
+	if err != nil {
+		t.Fatalf("Error validating token: %v", err)
+	}
+	if session.IsNew || session.ID != id.Hex() || session.Values["foo"] != "bar" {
+		t.Errorf("Expected loaded session; Got %+v", session)
+	}
+
+	expired := primitive.NewObjectID()
+	store.cacheDoc(&Session{ID: expired, Data: data, IdleExpires: time.Now().Add(-time.Hour)})
+	token, _ = securecookie.EncodeMulti("session-key", expired.Hex(), store.Codecs...)
+	if _, err := store.Validate(context.Background(), "session-key", token); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for expired session; Got %v", err)
+	}
+
+	store.ExpiryGrace = 2 * time.Hour
+	session, err = store.Validate(context.Background(), "session-key", token)
+	if err != nil || !IsStale(session) {
+		t.Fatalf("Expected a stale session within ExpiryGrace; Got %v", err)
+	}
+	if _, err := store.Persist(context.Background(), session); !errors.Is(err, ErrSessionStale) {
+		t.Errorf("Expected ErrSessionStale; Got %v", err)
+	}
+}
+
+type tenantContextKey struct{}
+
+func TestValidateTenant(t *testing.T) {
+	store := newOfflineStore(t)
+	store.CacheTTL = time.Minute
+	store.Tenant = func(r *http.Request) string {
+		tenant, _ := r.Context().Value(tenantContextKey{}).(string)
+		return tenant
+	}
+
+	data, err := securecookie.EncodeMulti("session-key", map[interface{}]interface{}{"foo": "bar"}, store.Codecs...)
+	if err != nil {
+		t.Fatalf("Error encoding data: %v", err)
+	}
+	id := primitive.NewObjectID()
+	store.cacheDoc(&Session{ID: id, Data: data, Tenant: "acme", IdleExpires: time.Now().Add(time.Hour)})
+	token, _ := securecookie.EncodeMulti("session-key", id.Hex(), store.Codecs...)
+
+	ctx := context.WithValue(context.Background(), tenantContextKey{}, "acme")
+	session, err := store.Validate(ctx, "session-key", token)
+	if err != nil || SessionTenant(session) != "acme" || session.Values["foo"] != "bar" {
+		t.Fatalf("Expected the session of the tenant; Got %v", err)
+	}
+
+	ctx = context.WithValue(context.Background(), tenantContextKey{}, "other")
+	if _, err := store.Validate(ctx, "session-key", token); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for another tenant; Got %v", err)
+	}
+}
+
+func TestPersistCookieOnly(t *testing.T) {
+	store := newOfflineStore(t)
+	store.PersistPolicy = func(*http.Request, *sessions.Session) bool { return false }
+
+	session := store.newSession("session-key")
+	session.Values["foo"] = "bar"
+	token, err := store.Persist(context.Background(), session)
+	if err != nil || token == "" {
+		t.Fatalf("Expected the token of a session kept out of MongoDB; Got %v", err)
+	}
+
+	session, err = store.Validate(context.Background(), "session-key", token)
+	if err != nil || !session.IsNew || session.Values["foo"] != "bar" {
+		t.Errorf("Expected a new session with the values; Got %v", err)
+	}
+}
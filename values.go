@@ -0,0 +1,160 @@
+package mongodbstore
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/context"
+
+	"github.com/gorilla/sessions"
+)
+
+// transientKey is the type of session value keys that live only in memory.
+// Values under such keys are never encoded or stored.
+type transientKey string
+
+// safeValuesKey is the key of the Values guards of the sessions of a request
+// in the gorilla context, next to the sessions registry. Guards are kept out
+// of the values they guard, so that finding one doesn't race with the
+// writes it guards.
+type safeValuesKey struct{}
+
+// safeValuesMu serializes the creation of Values guards.
+var safeValuesMu sync.Mutex
+
+// Values guards the values of a session with a mutex, so that goroutines
+// spawned by a handler can share the session without data races. All
+// goroutines must access the values through the same guard, obtained with
+// SafeValues, and not through session.Values.
+type Values struct {
+	mu      sync.RWMutex
+	session *sessions.Session
+}
+
+// SafeValues returns the guard of the session values for the request,
+// creating it on first use. Once a guard exists, Save, SaveAll, Destroy and
+// TakeOnce hold it while they read and write the session values, so hooks
+// they call, such as OnLargeSession, must not use it. Other operations that
+// take no request, such as MergeInto or Snapshot, don't hold it and must
+// not run while goroutines use the guard.
+//
+// With a nil r the guard is not shared: each call returns a new one.
+func SafeValues(r *http.Request, session *sessions.Session) *Values {
+	if r == nil {
+		return &Values{session: session}
+	}
+	safeValuesMu.Lock()
+	defer safeValuesMu.Unlock()
+
+	guards, _ := context.Get(r, safeValuesKey{}).(map[*sessions.Session]*Values)
+	if guards == nil {
+		guards = make(map[*sessions.Session]*Values)
+		context.Set(r, safeValuesKey{}, guards)
+	}
+	v, ok := guards[session]
+	if !ok {
+		v = &Values{session: session}
+		guards[session] = v
+	}
+	return v
+}
+
+// guard returns the guard of the session values for the request if one was
+// created.
+func guard(r *http.Request, session *sessions.Session) *Values {
+	if r == nil {
+		return nil
+	}
+	safeValuesMu.Lock()
+	defer safeValuesMu.Unlock()
+
+	guards, _ := context.Get(r, safeValuesKey{}).(map[*sessions.Session]*Values)
+	return guards[session]
+}
+
+// lockValues locks the guard of the session values for the request, if
+// there is one, and returns the function unlocking it.
+func lockValues(r *http.Request, session *sessions.Session) func() {
+	v := guard(r, session)
+	if v == nil {
+		return func() {}
+	}
+	v.mu.Lock()
+	return v.mu.Unlock
+}
+
+// Get returns the value stored under key.
+func (v *Values) Get(key interface{}) (interface{}, bool) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	value, ok := v.session.Values[key]
+	return value, ok
+}
+
+// Set stores value under key.
+func (v *Values) Set(key, value interface{}) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.session.Values[key] = value
+}
+
+// Delete removes the value stored under key.
+func (v *Values) Delete(key interface{}) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	delete(v.session.Values, key)
+}
+
+// Update calls fn with the values while holding the lock, for changes that
+// must be atomic, such as incrementing a counter.
+func (v *Values) Update(fn func(values map[interface{}]interface{})) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	fn(v.session.Values)
+}
+
+// View calls fn with the values while holding the read lock. fn must not
+// modify the values.
+func (v *Values) View(fn func(values map[interface{}]interface{})) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	fn(v.session.Values)
+}
+
+// persistentValues returns a copy of the session values without transient
+// values.
+func persistentValues(session *sessions.Session) map[interface{}]interface{} {
+	persistent, _ := splitValues(session)
+	return persistent
+}
+
+// IsEmpty reports whether the session holds no values to save, the values
+// the store keeps in memory, such as the tenant, aside.
+func IsEmpty(session *sessions.Session) bool {
+	for k := range session.Values {
+		if _, ok := k.(transientKey); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// splitValues returns copies of the persistent and of the transient session
+// values, read in a single pass over the values.
+func splitValues(session *sessions.Session) (persistent, transient map[interface{}]interface{}) {
+	persistent = make(map[interface{}]interface{}, len(session.Values))
+	transient = make(map[interface{}]interface{})
+	for k, val := range session.Values {
+		if _, ok := k.(transientKey); ok {
+			transient[k] = val
+		} else {
+			persistent[k] = val
+		}
+	}
+	return persistent, transient
+}
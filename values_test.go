@@ -0,0 +1,46 @@
+package mongodbstore
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// TestSafeValues is meant to be run with -race.
+func TestSafeValues(t *testing.T) {
+	store := newOfflineStore(t)
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, _ := store.New(req, "session-key")
+	session.ID = "5cc8b3a2a4d5b6c7d8e9f0a1"
+	session.IsNew = false
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			SafeValues(req, session).Update(func(values map[interface{}]interface{}) {
+				n, _ := values["counter"].(int)
+				values["counter"] = n + 1
+			})
+			// The offline store fails the write after encoding the values.
+			store.Save(req, httptest.NewRecorder(), session)
+			store.SaveAll(req, httptest.NewRecorder())
+		}()
+	}
+	wg.Wait()
+
+	if n, _ := SafeValues(req, session).Get("counter"); n != 10 {
+		t.Errorf("Expected counter 10; Got %v", n)
+	}
+	if SafeValues(req, session) != SafeValues(req, session) {
+		t.Error("Expected one guard per session and request")
+	}
+	if _, ok := session.Values[safeValuesKey{}]; ok {
+		t.Error("Expected the guard to be kept out of the session values")
+	}
+	if values := persistentValues(session); len(values) != 1 {
+		t.Errorf("Expected only the counter; Got %v", values)
+	}
+}
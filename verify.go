@@ -0,0 +1,68 @@
+package mongodbstore
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// DecodeReport is the result of VerifyDecodable.
+type DecodeReport struct {
+	// Sampled is the number of documents examined.
+	Sampled int
+	// ByCodec counts the documents decoded by each codec, indexed like the
+	// codecs returned for stored data: DataCodecs followed by the
+	// CookieCodecs of the name, or these alone.
+	ByCodec []int
+	// Undecodable is the number of documents no codec could decode.
+	Undecodable int
+}
+
+// SafeToDrop reports whether no sampled document needed the codec at index
+// i. The larger the sample, the more confident the answer.
+func (r DecodeReport) SafeToDrop(i int) bool {
+	return i < len(r.ByCodec) && r.ByCodec[i] == 0
+}
+
+// VerifyDecodable samples up to sampleSize random session documents with the
+// given name and reports which of the current codecs decodes each of them,
+// without changing anything. Operators run it before removing an old key to
+// confirm no stored session still needs it; ReencryptAll re-encodes those
+// that do.
+func (m *MongoDBStore) VerifyDecodable(ctx context.Context, name string, sampleSize int) (DecodeReport, error) {
+	codecs := m.dataDecoders(name)
+	report := DecodeReport{ByCodec: make([]int, len(codecs))}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{{Key: "data", Value: bson.D{{Key: "$exists", Value: true}}}}}},
+		{{Key: "$sample", Value: bson.D{{Key: "size", Value: sampleSize}}}},
+		{{Key: "$project", Value: bson.D{{Key: "data", Value: 1}}}},
+	}
+	err := m.observe(ctx, "aggregate", nil, func(ctx context.Context) (string, error) {
+		cur, err := m.collection.Aggregate(ctx, pipeline)
+		if err != nil {
+			return "", err
+		}
+		defer cur.Close(ctx)
+
+		for cur.Next(ctx) {
+			var doc Session
+			if err := cur.Decode(&doc); err != nil {
+				return "", err
+			}
+			report.Sampled++
+			values := make(map[interface{}]interface{})
+			if i, err := decodeSerial(name, doc.Data, &values, codecs); err == nil {
+				report.ByCodec[i]++
+			} else {
+				report.Undecodable++
+			}
+		}
+		return "", cur.Err()
+	})
+	if err != nil {
+		return report, m.opError("verify sessions", err)
+	}
+	return report, nil
+}
@@ -0,0 +1,59 @@
+package mongodbstore
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gorilla/securecookie"
+)
+
+func TestDecodeReportSafeToDrop(t *testing.T) {
+	report := DecodeReport{Sampled: 5, ByCodec: []int{4, 0, 1}}
+	if report.SafeToDrop(0) || report.SafeToDrop(2) {
+		t.Errorf("Expected used codecs to be needed")
+	}
+	if !report.SafeToDrop(1) {
+		t.Errorf("Expected the unused codec to be safe to drop")
+	}
+	if report.SafeToDrop(3) {
+		t.Errorf("Expected unknown codec index not to be reported safe")
+	}
+}
+
+func TestMongoStoreVerifyDecodable(t *testing.T) {
+	store := newLiveStore(t)
+	save := func(name string) {
+		req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+		session, err := store.New(req, name)
+		if err != nil {
+			t.Fatalf("Error creating session: %v", err)
+		}
+		session.Values["foo"] = "bar"
+		if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+			t.Fatalf("Error saving session: %v", err)
+		}
+	}
+
+	// Two sessions saved before the data key was introduced, one after and
+	// one of another name.
+	save("session-key")
+	save("session-key")
+	store.DataCodecs = securecookie.CodecsFromPairs([]byte("data-key"))
+	save("session-key")
+	save("other-key")
+
+	report, err := store.VerifyDecodable(context.Background(), "session-key", 10)
+	if err != nil {
+		t.Fatalf("Error verifying sessions: %v", err)
+	}
+	want := DecodeReport{Sampled: 4, ByCodec: []int{1, 2}, Undecodable: 1}
+	if !reflect.DeepEqual(report, want) {
+		t.Errorf("Expected %+v; Got %+v", want, report)
+	}
+	if report.SafeToDrop(1) {
+		t.Errorf("Expected the cookie key to be needed by the older sessions")
+	}
+}
@@ -0,0 +1,251 @@
+package mongodbstore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrChangeStreamsUnsupported is returned by WatchSessions when the
+// database doesn't support change streams.
+var ErrChangeStreamsUnsupported = errors.New("mongodbstore: change streams not supported")
+
+// SessionEventType is the type of a change of a session document.
+type SessionEventType string
+
+// Types of session document changes.
+const (
+	SessionCreated SessionEventType = "created"
+	SessionUpdated SessionEventType = "updated"
+	// SessionDeleted is a deletion of a document, or its replacement by a
+	// tombstone.
+	SessionDeleted SessionEventType = "deleted"
+)
+
+// SessionEvent is a change of a session document seen by WatchSessions.
+type SessionEvent struct {
+	Type SessionEventType
+	ID   string
+	// Principal is the principal of the session as stored in the document:
+	// the principal, or its HMAC with PrincipalKey. It is empty for
+	// deletions.
+	Principal string
+	// Modified is the modification time of the document, zero for deletions.
+	Modified time.Time
+	// ResumeToken resumes watching after the event.
+	ResumeToken bson.Raw
+}
+
+// ResumeTokenStore persists the resume token of WatchSessions, so that a
+// restarted watcher resumes where the previous one stopped.
+type ResumeTokenStore interface {
+	// LoadResumeToken returns the saved token, or nil to watch from now.
+	LoadResumeToken(ctx context.Context) (bson.Raw, error)
+	SaveResumeToken(ctx context.Context, token bson.Raw) error
+}
+
+// CollectionResumeTokens returns a ResumeTokenStore keeping the token in the
+// document of the collection with the given id, one per watcher.
+func CollectionResumeTokens(c *mongo.Collection, id string) ResumeTokenStore {
+	return collectionResumeTokens{collection: c, id: id}
+}
+
+type collectionResumeTokens struct {
+	collection *mongo.Collection
+	id         string
+}
+
+func (c collectionResumeTokens) LoadResumeToken(ctx context.Context) (bson.Raw, error) {
+	var doc struct {
+		Token bson.Raw `bson:"token"`
+	}
+	err := c.collection.FindOne(ctx, bson.D{{Key: "_id", Value: c.id}}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	return doc.Token, err
+}
+
+func (c collectionResumeTokens) SaveResumeToken(ctx context.Context, token bson.Raw) error {
+	_, err := c.collection.UpdateOne(ctx,
+		bson.D{{Key: "_id", Value: c.id}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "token", Value: token}}}},
+		options.Update().SetUpsert(true))
+	return err
+}
+
+// changeEvent is a change stream event of the sessions collection. The
+// collection also holds documents that aren't sessions, such as those of
+// fiberstorage with string ids, so the document id and the full document
+// are decoded only once the change is known to be of a session.
+type changeEvent struct {
+	ID            bson.Raw `bson:"_id"`
+	OperationType string   `bson:"operationType"`
+	DocumentKey   struct {
+		ID bson.RawValue `bson:"_id"`
+	} `bson:"documentKey"`
+	FullDocument      bson.Raw `bson:"fullDocument"`
+	UpdateDescription struct {
+		UpdatedFields bson.M `bson:"updatedFields"`
+	} `bson:"updateDescription"`
+}
+
+// sessionEvent returns the session event of the change, if it is one.
+func (c *changeEvent) sessionEvent() (SessionEvent, bool, error) {
+	id, ok := c.DocumentKey.ID.ObjectIDOK()
+	if !ok {
+		return SessionEvent{}, false, nil
+	}
+	e := SessionEvent{ID: id.Hex(), ResumeToken: c.ID}
+	switch c.OperationType {
+	case "insert":
+		e.Type = SessionCreated
+	case "update", "replace":
+		e.Type = SessionUpdated
+		if revoked, _ := c.UpdateDescription.UpdatedFields["revoked"].(bool); revoked {
+			e.Type = SessionDeleted
+		}
+	case "delete":
+		e.Type = SessionDeleted
+	default:
+		return e, false, nil
+	}
+	if c.FullDocument != nil && e.Type != SessionDeleted {
+		var doc Session
+		if err := bson.Unmarshal(c.FullDocument, &doc); err != nil {
+			return e, false, err
+		}
+		e.Principal = doc.Principal
+		e.Modified = doc.Modified
+	}
+	return e, true, nil
+}
+
+// changeToken returns a copy of the resume token of the change document, so
+// that the stream advances past changes that can't be decoded.
+func changeToken(change bson.Raw) (bson.Raw, bool) {
+	token, ok := change.Lookup("_id").DocumentOK()
+	if !ok {
+		return nil, false
+	}
+	return append(bson.Raw(nil), token...), true
+}
+
+// WatchSessions returns a channel of the changes of session documents, so
+// that other services can follow sessions being created, updated and deleted
+// without knowing the schema. The change stream is resumed after errors, and
+// from the token of the ResumeTokens store, if set, which is saved once each
+// event was received from the channel. The channel is closed when ctx is
+// done or the store is closed.
+//
+// Updates include refreshes of the expiration times. Expirations by the TTL
+// indexes are deletions. Changes of documents that aren't sessions, such as
+// those of fiberstorage, are skipped, and changes that can't be decoded are
+// reported to the error handler; both still advance the resume token.
+func (m *MongoDBStore) WatchSessions(ctx context.Context) (<-chan SessionEvent, error) {
+	if !m.Capabilities().ChangeStreams {
+		return nil, ErrChangeStreamsUnsupported
+	}
+
+	var token bson.Raw
+	if m.ResumeTokens != nil {
+		var err error
+		if token, err = m.ResumeTokens.LoadResumeToken(ctx); err != nil {
+			return nil, m.opError("load resume token", err)
+		}
+	}
+	stream, err := m.watch(ctx, token)
+	if err != nil {
+		return nil, m.opError("watch sessions", err)
+	}
+
+	events := make(chan SessionEvent)
+	m.goBackground("watch sessions", func(bg context.Context) error {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go func() {
+			select {
+			case <-bg.Done():
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		m.tail(ctx, stream, token, events)
+		return nil
+	})
+	return events, nil
+}
+
+// watch opens a change stream of the collection, resuming after the token if
+// any.
+func (m *MongoDBStore) watch(ctx context.Context, token bson.Raw) (*mongo.ChangeStream, error) {
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if token != nil {
+		opts.SetResumeAfter(token)
+	}
+	return m.collection.Watch(ctx, mongo.Pipeline{}, opts)
+}
+
+// tail sends the events of the stream to the channel until ctx is done,
+// reopening the stream when it fails.
+func (m *MongoDBStore) tail(ctx context.Context, stream *mongo.ChangeStream, token bson.Raw, events chan<- SessionEvent) {
+	defer close(events)
+
+	backoff := time.Second
+	for {
+		for stream.Next(ctx) {
+			if t, ok := changeToken(stream.Current); ok {
+				token = t
+			}
+			var change changeEvent
+			err := stream.Decode(&change)
+			e, ok := SessionEvent{}, false
+			if err == nil {
+				e, ok, err = change.sessionEvent()
+			}
+			if err != nil {
+				m.reportError(ctx, "watch", m.opError("decode change", err))
+			}
+			if ok {
+				select {
+				case events <- e:
+				case <-ctx.Done():
+					stream.Close(context.Background())
+					return
+				}
+			}
+			if m.ResumeTokens != nil {
+				if err := m.ResumeTokens.SaveResumeToken(ctx, token); err != nil {
+					m.reportError(ctx, "watch", m.opError("save resume token", err))
+				}
+			}
+			backoff = time.Second
+		}
+		err := stream.Err()
+		stream.Close(context.Background())
+
+		for {
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				m.reportError(ctx, "watch", m.opError("watch sessions", err))
+			}
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return
+			}
+			if backoff < time.Minute {
+				backoff *= 2
+			}
+			if stream, err = m.watch(ctx, token); err == nil {
+				break
+			}
+		}
+	}
+}
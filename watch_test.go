@@ -0,0 +1,170 @@
+package mongodbstore
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestChangeSessionEvent(t *testing.T) {
+	id := primitive.NewObjectID()
+	modified := time.Now().Truncate(time.Millisecond).UTC()
+	full := bson.M{"_id": id, "modified": modified, "principal": "alice"}
+
+	tests := []struct {
+		change bson.M
+		want   SessionEventType
+		ok     bool
+	}{
+		{bson.M{"operationType": "insert", "fullDocument": full}, SessionCreated, true},
+		{bson.M{"operationType": "update", "fullDocument": full,
+			"updateDescription": bson.M{"updatedFields": bson.M{"modified": modified}}}, SessionUpdated, true},
+		{bson.M{"operationType": "update",
+			"updateDescription": bson.M{"updatedFields": bson.M{"revoked": true}}}, SessionDeleted, true},
+		{bson.M{"operationType": "delete"}, SessionDeleted, true},
+		{bson.M{"operationType": "invalidate"}, "", false},
+	}
+	for _, tt := range tests {
+		tt.change["_id"] = bson.M{"_data": "token"}
+		tt.change["documentKey"] = bson.M{"_id": id}
+		raw, err := bson.Marshal(tt.change)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var change changeEvent
+		if err := bson.Unmarshal(raw, &change); err != nil {
+			t.Fatalf("Error decoding change: %v", err)
+		}
+
+		e, ok, err := change.sessionEvent()
+		if err != nil {
+			t.Fatalf("%s: Error reading change: %v", tt.change["operationType"], err)
+		}
+		if ok != tt.ok || e.Type != tt.want {
+			t.Errorf("%s: Expected %q, %t; Got %q, %t", tt.change["operationType"], tt.want, tt.ok, e.Type, ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if e.ID != id.Hex() || len(e.ResumeToken) == 0 {
+			t.Errorf("%s: Unexpected event %+v", tt.change["operationType"], e)
+		}
+		if e.Type == SessionDeleted {
+			if e.Principal != "" {
+				t.Errorf("Expected no principal for deletions; Got %q", e.Principal)
+			}
+		} else if e.Principal != "alice" || !e.Modified.Equal(modified) {
+			t.Errorf("%s: Unexpected event %+v", tt.change["operationType"], e)
+		}
+	}
+}
+
+func TestChangeForeignDocument(t *testing.T) {
+	raw, err := bson.Marshal(bson.M{
+		"_id":           bson.M{"_data": "token"},
+		"operationType": "update",
+		"documentKey":   bson.M{"_id": "fiber-key"},
+		"fullDocument":  bson.M{"_id": "fiber-key", "fiber": []byte("value")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var change changeEvent
+	if err := bson.Unmarshal(raw, &change); err != nil {
+		t.Fatalf("Error decoding change of a foreign document: %v", err)
+	}
+	if _, ok, err := change.sessionEvent(); ok || err != nil {
+		t.Errorf("Expected the change to be skipped; Got %t, %v", ok, err)
+	}
+
+	token, ok := changeToken(raw)
+	if !ok || token.Lookup("_data").StringValue() != "token" {
+		t.Errorf("Expected the resume token of the change; Got %v", token)
+	}
+}
+
+func TestWatchSessionsUnsupported(t *testing.T) {
+	store := newOfflineStore(t)
+	store.Compatibility = CompatCosmosDB
+	if _, err := store.WatchSessions(context.Background()); err != ErrChangeStreamsUnsupported {
+		t.Errorf("Expected ErrChangeStreamsUnsupported; Got %v", err)
+	}
+}
+
+// nextEvent returns the next event of the channel, failing the test if none
+// arrives in time.
+func nextEvent(t *testing.T, events <-chan SessionEvent) SessionEvent {
+	select {
+	case e, ok := <-events:
+		if !ok {
+			t.Fatal("Expected an event; Got the channel closed")
+		}
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected an event; Got none")
+	}
+	return SessionEvent{}
+}
+
+func TestMongoStoreWatchSessions(t *testing.T) {
+	store := newLiveStore(t)
+	tokens := store.collection.Database().Collection(store.collection.Name() + "_tokens")
+	if err := tokens.Drop(context.Background()); err != nil {
+		t.Fatalf("Error dropping collection: %v", err)
+	}
+	store.ResumeTokens = CollectionResumeTokens(tokens, "watcher")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := store.WatchSessions(ctx)
+	if err != nil {
+		cancel()
+		t.Skipf("No change streams: %v", err)
+	}
+
+	session := savedSession(t, store)
+	if e := nextEvent(t, events); e.Type != SessionCreated || e.ID != session.ID {
+		t.Errorf("Expected the creation of %s; Got %+v", session.ID, e)
+	}
+	if _, err := store.collection.InsertOne(ctx, bson.M{"_id": "fiber-key", "fiber": []byte("value")}); err != nil {
+		t.Fatalf("Error inserting document: %v", err)
+	}
+	if _, err := store.CompareAndSetValue(ctx, session, "state", nil, "a"); err != nil {
+		t.Fatalf("Error setting value: %v", err)
+	}
+	e := nextEvent(t, events)
+	if e.Type != SessionUpdated || e.ID != session.ID || e.Modified.IsZero() {
+		t.Errorf("Expected the update of %s, skipping the foreign document; Got %+v", session.ID, e)
+	}
+
+	// A new watcher resumes after the last event received, once its token
+	// is saved.
+	for i := 0; ; i++ {
+		token, err := store.ResumeTokens.LoadResumeToken(ctx)
+		if err == nil && bytes.Equal(token, e.ResumeToken) {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("Expected the token of the last event to be saved; Got %v, %v", token, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	for range events {
+	}
+	if err := store.deleteContext(context.Background(), session); err != nil {
+		t.Fatalf("Error deleting session: %v", err)
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	if events, err = store.WatchSessions(ctx); err != nil {
+		t.Fatalf("Error resuming watch: %v", err)
+	}
+	if e := nextEvent(t, events); e.Type != SessionDeleted || e.ID != session.ID {
+		t.Errorf("Expected the deletion of %s; Got %+v", session.ID, e)
+	}
+}
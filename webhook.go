@@ -0,0 +1,106 @@
+package mongodbstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// SignatureHeader is the header of webhook requests holding the hex encoded
+// HMAC-SHA256 of the body keyed with the webhook secret.
+const SignatureHeader = "X-Mongodbstore-Signature"
+
+// Webhook is the configuration of the webhook of EnableWebhook.
+type Webhook struct {
+	// URL is where events are POSTed.
+	URL string
+	// Secret keys the signature of the events in SignatureHeader.
+	Secret []byte
+	// Client sends the events, http.DefaultClient if nil.
+	Client *http.Client
+	// Retries is the number of times a failed delivery is retried, with a
+	// backoff doubling from a second. Responses other than 2xx are failures.
+	Retries int
+	// QueueSize is the number of events waiting for delivery. Further events
+	// are dropped and reported to the error handler.
+	QueueSize int
+}
+
+// webhook is the Publisher POSTing events to a Webhook.
+type webhook struct {
+	Webhook
+	// backoff is the delay before the first retry.
+	backoff time.Duration
+}
+
+// EnableWebhook POSTs session lifecycle events to the webhook, so external
+// systems such as a SIEM can react to sessions being created, destroyed and
+// revoked without polling the collection. It is EnablePublisher with a
+// Publisher signing and POSTing the events as JSON.
+func (m *MongoDBStore) EnableWebhook(w Webhook) {
+	m.EnablePublisher(&webhook{Webhook: w, backoff: time.Second}, w.QueueSize)
+}
+
+// Publish POSTs the event.
+func (wh *webhook) Publish(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return wh.deliver(ctx, body)
+}
+
+// deliver POSTs the body, retrying failed deliveries.
+func (wh *webhook) deliver(ctx context.Context, body []byte) error {
+	mac := hmac.New(sha256.New, wh.Secret)
+	mac.Write(body)
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	client := wh.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	backoff := wh.backoff
+	var err error
+	for attempt := 0; attempt <= wh.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return err
+			}
+			backoff *= 2
+		}
+		if err = wh.post(ctx, client, body, signature); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (wh *webhook) post(ctx context.Context, client *http.Client, body []byte, signature string) error {
+	req, err := http.NewRequest("POST", wh.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, signature)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
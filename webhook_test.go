@@ -0,0 +1,99 @@
+package mongodbstore
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWebhook(t *testing.T) {
+	secret := []byte("secret")
+
+	var mu sync.Mutex
+	var events []Event
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(body)
+		if got, want := r.Header.Get(SignatureHeader), hex.EncodeToString(mac.Sum(nil)); got != want {
+			t.Errorf("Expected signature %s; Got %s", want, got)
+		}
+		var e Event
+		if err := json.Unmarshal(body, &e); err != nil {
+			t.Errorf("Error decoding event: %v", err)
+		}
+		events = append(events, e)
+	}))
+	defer srv.Close()
+
+	store := newOfflineStore(t)
+	store.EnablePublisher(&webhook{
+		Webhook: Webhook{URL: srv.URL, Secret: secret, Retries: 2},
+		backoff: time.Millisecond,
+	}, 10)
+
+	store.notify(Event{Type: EventCreated, Name: "session-key", ID: "5d1f2d6e1c9d440000a1b2c3"})
+	store.notifyRevoked(3, "alice")
+	store.notifyRevoked(0, "bob")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := store.Close(ctx); err != nil {
+		t.Fatalf("Error closing store: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events; Got %d", len(events))
+	}
+	if e := events[0]; e.Type != EventCreated || e.ID != "5d1f2d6e1c9d440000a1b2c3" || e.Time.IsZero() {
+		t.Errorf("Unexpected created event: %+v", e)
+	}
+	if e := events[1]; e.Type != EventRevoked || e.Count != 3 || e.Principal != "alice" {
+		t.Errorf("Unexpected revoked event: %+v", e)
+	}
+
+	// Events after Close are dropped.
+	store.notify(Event{Type: EventDestroyed})
+}
+
+func TestPublishers(t *testing.T) {
+	store := newOfflineStore(t)
+
+	var mu sync.Mutex
+	var got []EventType
+	for i := 0; i < 2; i++ {
+		store.EnablePublisher(PublisherFunc(func(ctx context.Context, e Event) error {
+			mu.Lock()
+			defer mu.Unlock()
+			got = append(got, e.Type)
+			return nil
+		}), 1)
+	}
+	store.notify(Event{Type: EventDestroyed})
+
+	if err := store.Close(context.Background()); err != nil {
+		t.Fatalf("Error closing store: %v", err)
+	}
+	if len(got) != 2 {
+		t.Errorf("Expected the event published twice; Got %v", got)
+	}
+}
@@ -0,0 +1,276 @@
+package mongodbstore
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// touch is a buffered refresh of a session document. Zero times are not
+// written.
+type touch struct {
+	modified     time.Time
+	idleExpires  time.Time
+	expires      time.Time
+	lastAccessed time.Time
+}
+
+// merge combines two refreshes of the same document, keeping the later time
+// of each field.
+func (t touch) merge(o touch) touch {
+	later := func(a, b time.Time) time.Time {
+		if b.After(a) {
+			return b
+		}
+		return a
+	}
+	return touch{
+		modified:     later(t.modified, o.modified),
+		idleExpires:  later(t.idleExpires, o.idleExpires),
+		expires:      later(t.expires, o.expires),
+		lastAccessed: later(t.lastAccessed, o.lastAccessed),
+	}
+}
+
+// defaultWriteBehindInterval is the flush interval of write-behind mode
+// enabled without one.
+const defaultWriteBehindInterval = time.Second
+
+// writeBehind buffers expiration refreshes of unchanged sessions and writes
+// them to MongoDB in batches.
+type writeBehind struct {
+	store      *MongoDBStore
+	collection *mongo.Collection
+	interval   time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	pending map[primitive.ObjectID]touch
+	closed  bool
+	flushc  chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// EnableWriteBehind turns on write-behind mode. Saves of sessions whose values
+// did not change since they were loaded only refresh the Modified time; in
+// write-behind mode these refreshes are buffered in memory and flushed with a
+// single BulkWrite every interval or as soon as maxEntries are pending.
+// Saves that change values, new sessions and deletions are always written
+// synchronously. Access times recorded on load with AccessInterval are
+// buffered too, so that read-heavy sites pay for one bulk write per interval
+// instead of one update per load.
+//
+// Buffered refreshes are lost if the process exits without calling Close,
+// and a failed flush is reported to the error handler but not retried; Run
+// returns the last error if the last flushes kept failing. A lost refresh
+// only shortens a session: its idle deadline passes earlier than it would
+// have, and its access time lags behind.
+//
+// An interval <= 0 flushes every second. Enabling write-behind mode again
+// replaces the interval and maxEntries; the refreshes buffered so far are
+// kept.
+func (m *MongoDBStore) EnableWriteBehind(interval time.Duration, maxEntries int) {
+	if interval <= 0 {
+		interval = defaultWriteBehindInterval
+	}
+	wb := &writeBehind{
+		store:      m,
+		collection: m.collection,
+		interval:   interval,
+		maxEntries: maxEntries,
+		pending:    make(map[primitive.ObjectID]touch),
+		flushc:     make(chan struct{}, 1),
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+	if old := m.writeBehind; old != nil && old.stop() {
+		old.mu.Lock()
+		wb.pending, old.pending = old.pending, wb.pending
+		old.mu.Unlock()
+	}
+	m.writeBehind = wb
+	m.goBackground("write-behind", func(context.Context) error {
+		return wb.run()
+	})
+}
+
+// Flush writes all buffered refreshes to MongoDB.
+func (m *MongoDBStore) Flush(ctx context.Context) error {
+	if m.writeBehind == nil {
+		return nil
+	}
+	return m.opError("flush", m.writeBehind.flush(ctx))
+}
+
+// Close stops write-behind mode and flushes the buffered refreshes. Saves
+// made after Close are written synchronously. It also waits for the writes
+// queued for the mirror to be replicated and stops replication, and for the
+// queued events to be published, stops the janitor and the change stream
+// tailers of WatchSessions, and waits for all background goroutines to return.
+func (m *MongoDBStore) Close(ctx context.Context) error {
+	if err := m.closeMirror(ctx); err != nil {
+		return m.opError("close mirror", err)
+	}
+	if err := m.closePublishers(ctx); err != nil {
+		return m.opError("close publishers", err)
+	}
+	if err := m.closeJanitor(ctx); err != nil {
+		return m.opError("close janitor", err)
+	}
+	if err := m.closeWriteBehind(ctx); err != nil {
+		return err
+	}
+	return m.opError("stop background", m.stopBackground(ctx))
+}
+
+// closeWriteBehind stops write-behind mode and flushes the buffered
+// refreshes.
+func (m *MongoDBStore) closeWriteBehind(ctx context.Context) error {
+	wb := m.writeBehind
+	if wb == nil || !wb.stop() {
+		return nil
+	}
+	return m.opError("flush", wb.flush(ctx))
+}
+
+// stop stops the periodic flushes and the buffering of refreshes, and waits
+// for the current flush. It reports whether wb was running.
+func (wb *writeBehind) stop() bool {
+	wb.mu.Lock()
+	if wb.closed {
+		wb.mu.Unlock()
+		return false
+	}
+	wb.closed = true
+	wb.mu.Unlock()
+
+	close(wb.done)
+	<-wb.stopped
+	return true
+}
+
+// deferTouch queues the refresh of an unchanged session loaded during the
+// request. It reports whether the session was queued.
+func (m *MongoDBStore) deferTouch(r *http.Request, session *sessions.Session) bool {
+	wb := m.writeBehind
+	if wb == nil {
+		return false
+	}
+
+	t, ok := m.tracked(r)[session.Name()]
+	if !ok || t.session != session || m.dirty(t) {
+		return false
+	}
+
+	sessionID, err := primitive.ObjectIDFromHex(session.ID)
+	if err != nil {
+		return false
+	}
+
+	now := time.Now()
+	idle, _ := m.deadlines(session, now)
+	m.uncache(sessionID)
+	return wb.touch(sessionID, touch{modified: now, idleExpires: idle, expires: m.storageExpires(now)})
+}
+
+// skipTouch reports whether saving the session would only refresh a document
+// written less than TouchInterval ago.
+func (m *MongoDBStore) skipTouch(r *http.Request, session *sessions.Session) bool {
+	if m.TouchInterval <= 0 {
+		return false
+	}
+
+	t, ok := m.tracked(r)[session.Name()]
+	if !ok || t.session != session || t.modified.IsZero() || m.dirty(t) {
+		return false
+	}
+	return time.Since(t.modified) < m.TouchInterval
+}
+
+func (wb *writeBehind) touch(id primitive.ObjectID, t touch) bool {
+	wb.mu.Lock()
+	if wb.closed {
+		wb.mu.Unlock()
+		return false
+	}
+	wb.pending[id] = wb.pending[id].merge(t)
+	full := wb.maxEntries > 0 && len(wb.pending) >= wb.maxEntries
+	wb.mu.Unlock()
+
+	if full {
+		select {
+		case wb.flushc <- struct{}{}:
+		default:
+		}
+	}
+	return true
+}
+
+// run flushes the buffered refreshes until wb is stopped. It returns the
+// last error if the last flushes kept failing.
+func (wb *writeBehind) run() error {
+	defer close(wb.stopped)
+
+	ticker := time.NewTicker(wb.interval)
+	defer ticker.Stop()
+
+	var failed failures
+	for {
+		select {
+		case <-wb.done:
+			return failed.result()
+		case <-ticker.C:
+		case <-wb.flushc:
+		}
+		err := wb.store.opError("flush", wb.flush(context.Background()))
+		if err != nil {
+			wb.store.reportError(context.Background(), "flush", err)
+		}
+		failed.record(err)
+	}
+}
+
+func (wb *writeBehind) flush(ctx context.Context) error {
+	wb.mu.Lock()
+	pending := wb.pending
+	wb.pending = make(map[primitive.ObjectID]touch)
+	wb.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	models := make([]mongo.WriteModel, 0, len(pending))
+	for id, t := range pending {
+		// $max keeps a late flush from moving the times backwards after a
+		// synchronous save of the same session.
+		var max bson.D
+		if !t.modified.IsZero() {
+			max = append(max, bson.E{Key: "modified", Value: t.modified})
+		}
+		if !t.idleExpires.IsZero() {
+			max = append(max, bson.E{Key: "idleExpires", Value: t.idleExpires})
+		}
+		if !t.expires.IsZero() {
+			max = append(max, bson.E{Key: "expires", Value: t.expires})
+		}
+		if !t.lastAccessed.IsZero() {
+			max = append(max, bson.E{Key: "lastAccessed", Value: t.lastAccessed})
+		}
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(wb.store.liveFilter(id)).
+			SetUpdate(bson.D{{Key: "$max", Value: max}}))
+	}
+
+	return wb.store.observe(ctx, "bulkWrite", nil, func(ctx context.Context) (string, error) {
+		return bulkResult(wb.collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)))
+	})
+}
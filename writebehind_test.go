@@ -0,0 +1,50 @@
+package mongodbstore
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestWriteBehindMergesTouches(t *testing.T) {
+	store := newOfflineStore(t)
+	store.EnableWriteBehind(time.Hour, 0)
+
+	id := primitive.NewObjectID()
+	now := time.Now()
+	store.writeBehind.touch(id, touch{modified: now, idleExpires: now.Add(time.Hour)})
+	store.writeBehind.touch(id, touch{lastAccessed: now.Add(time.Second)})
+
+	got := store.writeBehind.pending[id]
+	if !got.modified.Equal(now) || !got.idleExpires.Equal(now.Add(time.Hour)) ||
+		!got.lastAccessed.Equal(now.Add(time.Second)) {
+		t.Errorf("Expected merged touch; Got %+v", got)
+	}
+}
+
+func TestEnableWriteBehindTwice(t *testing.T) {
+	store := newOfflineStore(t)
+	store.EnableWriteBehind(0, 0)
+	first := store.writeBehind
+	if first.interval != defaultWriteBehindInterval {
+		t.Errorf("Expected the default interval; Got %v", first.interval)
+	}
+
+	id := primitive.NewObjectID()
+	now := time.Now()
+	first.touch(id, touch{modified: now})
+	store.EnableWriteBehind(time.Hour, 10)
+
+	select {
+	case <-first.stopped:
+	default:
+		t.Errorf("Expected the first writer to be stopped")
+	}
+	if first.touch(id, touch{modified: now}) {
+		t.Errorf("Expected the first writer to refuse touches")
+	}
+	if got := store.writeBehind.pending[id]; !got.modified.Equal(now) {
+		t.Errorf("Expected the pending touch to be kept; Got %+v", got)
+	}
+}